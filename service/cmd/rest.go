@@ -6,12 +6,21 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/afrianjunior/justpayd/internal/assignments"
 	"github.com/afrianjunior/justpayd/internal/auth"
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/calendar"
+	"github.com/afrianjunior/justpayd/internal/invitations"
+	"github.com/afrianjunior/justpayd/internal/locations"
+	"github.com/afrianjunior/justpayd/internal/mailer"
 	"github.com/afrianjunior/justpayd/internal/pkg"
 	"github.com/afrianjunior/justpayd/internal/shift_requests"
+	"github.com/afrianjunior/justpayd/internal/shift_templates"
 	"github.com/afrianjunior/justpayd/internal/shifts"
+	"github.com/afrianjunior/justpayd/internal/sso"
+	"github.com/afrianjunior/justpayd/internal/swaps"
 	"github.com/afrianjunior/justpayd/internal/users"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -35,17 +44,20 @@ type rest struct {
 	db     *sql.DB
 	logger *zap.SugaredLogger
 	config *pkg.Config
+	mailer mailer.Mailer
 }
 
 func NewRest(
 	db *sql.DB,
 	logger *zap.SugaredLogger,
 	config *pkg.Config,
+	mailer mailer.Mailer,
 ) Rest {
 	return &rest{
 		db:     db,
 		logger: logger,
 		config: config,
+		mailer: mailer,
 	}
 }
 
@@ -66,13 +78,27 @@ func (s *rest) setupRouter() *chi.Mux {
 	shiftRequestRepository := shift_requests.NewShiftRequestRepository(s.db)
 	authRepository := auth.NewAuthRepository(s.db)
 	assignmentRepository := assignments.NewAssignmentRepository(s.db)
+	invitationRepository := invitations.NewInvitationRepository(s.db)
+	locationRepository := locations.NewLocationRepository(s.db)
+	shiftTemplateRepository := shift_templates.NewShiftTemplateRepository(s.db)
+	calendarRepository := calendar.NewCalendarRepository(s.db)
+	availabilityRepository := availability.NewAvailabilityRepository(s.db)
+	swapRepository := swaps.NewSwapRepository(s.db)
+
+	unitOfWork := pkg.NewUnitOfWork(s.db)
 
 	// Initialize services
 	userService := users.NewUserService(userRepository)
-	shiftService := shifts.NewShiftService(shiftRepository)
-	shiftRequestService := shift_requests.NewShiftRequestService(shiftRequestRepository, assignmentRepository)
-	authService := auth.NewAuthService(authRepository, s.config)
-	assignmentService := assignments.NewAssignmentService(assignmentRepository)
+	availabilityService := availability.NewAvailabilityService(availabilityRepository)
+	shiftService := shifts.NewShiftService(shiftRepository, locationRepository, userRepository, assignments.NewConflictChecker(assignmentRepository, s.config), assignmentRepository, shiftRequestRepository, availabilityService, unitOfWork, s.config)
+	shiftRequestService := shift_requests.NewShiftRequestService(shiftRequestRepository, assignmentRepository, shiftRepository, availabilityService, unitOfWork, s.config)
+	authService := auth.NewAuthService(authRepository, s.mailer, sso.NewVerifier(s.config.OIDC), unitOfWork, s.config)
+	assignmentService := assignments.NewAssignmentService(assignmentRepository, shiftRepository, availabilityService, shiftRequestRepository, unitOfWork, s.config)
+	invitationService := invitations.NewInvitationService(invitationRepository, s.mailer, s.config)
+	locationService := locations.NewLocationService(locationRepository)
+	shiftTemplateService := shift_templates.NewShiftTemplateService(shiftTemplateRepository, locationRepository, assignmentRepository, availabilityService, unitOfWork, s.config)
+	calendarService := calendar.NewCalendarService(calendarRepository, userRepository, locationRepository, s.config)
+	swapService := swaps.NewSwapService(swapRepository, assignmentRepository, userRepository, availabilityService, shiftRequestRepository, unitOfWork, s.config)
 
 	// Initialize handlers
 	userHandler := users.NewUserHandler(userService, s.logger)
@@ -80,6 +106,12 @@ func (s *rest) setupRouter() *chi.Mux {
 	shiftRequestHandler := shift_requests.NewShiftRequestHandler(shiftRequestService, s.logger)
 	authHandler := auth.NewAuthHandler(authService, s.logger, s.config)
 	assignmentHandler := assignments.NewAssignmentHandler(assignmentService, s.logger)
+	invitationHandler := invitations.NewInvitationHandler(invitationService, s.logger)
+	locationHandler := locations.NewLocationHandler(locationService, s.logger)
+	shiftTemplateHandler := shift_templates.NewShiftTemplateHandler(shiftTemplateService, s.logger)
+	calendarHandler := calendar.NewCalendarHandler(calendarService, s.logger)
+	availabilityHandler := availability.NewAvailabilityHandler(availabilityService, s.logger)
+	swapHandler := swaps.NewSwapHandler(swapService, s.logger)
 
 	// Middleware
 	r.Use(middleware.Logger)
@@ -106,11 +138,44 @@ func (s *rest) setupRouter() *chi.Mux {
 		http.Redirect(w, r, "/reference", http.StatusFound)
 	})
 
+	r.Route("/.well-known", func(r chi.Router) {
+		authHandler.RegisterWellKnownRoutes(r)
+	})
+
+	// Local OpenID Connect provider for trying out SSO login without a real identity provider
+	if s.config.OIDC.StubIssuer {
+		stubIssuer, err := sso.NewStubIssuer(strings.TrimRight(s.config.BaseURL, "/")+"/oidc-stub", s.config.OIDC.ClientID)
+		if err != nil {
+			s.logger.Fatalf("Failed to create stub OIDC issuer: %v", err)
+		}
+		s.logger.Warnw("Stub OIDC issuer enabled, anyone can mint ID tokens. Do not use in production.")
+		r.Mount("/oidc-stub", stubIssuer.Handler())
+	}
+
 	// API Routes
 	r.Route("/api", func(r chi.Router) {
 		// Public routes (no authentication required)
 		r.Route("/auth", func(r chi.Router) {
 			authHandler.RegisterRoutes(r)
+			r.Route("/invitations", func(r chi.Router) {
+				invitationHandler.RegisterPublicRoutes(r)
+			})
+
+			// Account routes that act on the authenticated user
+			r.Group(func(r chi.Router) {
+				r.Use(pkg.RequireAuth(s.config, s.db))
+				authHandler.RegisterProtectedRoutes(r)
+			})
+		})
+
+		// Calendar apps fetch feeds without logging in, the token in the URL is the credential
+		r.Route("/calendar", func(r chi.Router) {
+			calendarHandler.RegisterPublicRoutes(r)
+
+			r.Group(func(r chi.Router) {
+				r.Use(pkg.RequireAuth(s.config, s.db))
+				calendarHandler.RegisterRoutes(r)
+			})
 		})
 
 		// Protected routes (authentication required)
@@ -130,6 +195,21 @@ func (s *rest) setupRouter() *chi.Mux {
 			r.Route("/assignments", func(r chi.Router) {
 				assignmentHandler.RegisterRoutes(r)
 			})
+			r.Route("/invitations", func(r chi.Router) {
+				invitationHandler.RegisterRoutes(r)
+			})
+			r.Route("/locations", func(r chi.Router) {
+				locationHandler.RegisterRoutes(r)
+			})
+			r.Route("/shift_templates", func(r chi.Router) {
+				shiftTemplateHandler.RegisterRoutes(r)
+			})
+			r.Route("/availability", func(r chi.Router) {
+				availabilityHandler.RegisterRoutes(r)
+			})
+			r.Route("/swaps", func(r chi.Router) {
+				swapHandler.RegisterRoutes(r)
+			})
 		})
 	})
 
@@ -1,23 +1,131 @@
 package assignments
 
-import "time"
+import (
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// Possible status values for assignments. Only an active assignment holds its shift, the
+// others are kept as the history of the worker.
+const (
+	StatusActive     = "active"
+	StatusUnassigned = "unassigned"
+	// StatusCancelled assignments ended because their shift was cancelled
+	StatusCancelled = "cancelled"
+)
+
+// ReasonHandedOver is the reason given to the approved request of a worker whose shift was
+// handed to someone else
+const ReasonHandedOver = "The shift was handed to another worker"
 
 type AssignmentResponse struct {
-	ID         int       `json:"id"`
-	ShiftID    int       `json:"shift_id"`
-	UserID     int       `json:"user_id"`
-	UserName   string    `json:"user_name"`
-	Date       string    `json:"date"`
-	StartTime  string    `json:"start_time"`
-	EndTime    string    `json:"end_time"`
+	ID       int    `json:"id"`
+	ShiftID  int    `json:"shift_id"`
+	UserID   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+	Role     string `json:"role"`
+	// The shift's schedule, in the zone of its location
+	pkg.Schedule
 	AssignedAt time.Time `json:"assigned_at"`
+	Status     string    `json:"status" example:"active"`
+	// EndedAt, EndedBy and EndReason are only set once the assignment is no longer active
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	EndedBy   *int       `json:"ended_by,omitempty"`
+	EndReason string     `json:"end_reason,omitempty"`
+}
+
+// IsActive reports whether the assignment still holds its shift
+func (a *AssignmentResponse) IsActive() bool {
+	return a.Status == StatusActive
+}
+
+// AssignmentFilter is a list query narrowed further by status
+type AssignmentFilter struct {
+	pkg.ListQuery
+	// Status defaults to active
+	Status string
+}
+
+// In renders the assignment's times in loc. A nil loc keeps the zone of the shift's location.
+func (a *AssignmentResponse) In(loc *time.Location) {
+	if loc == nil {
+		loc, _ = pkg.LoadTimeZone(a.TimeZone)
+	}
+	if loc == nil {
+		return
+	}
+	a.Schedule.In(loc)
+	a.AssignedAt = a.AssignedAt.In(loc)
+	if a.EndedAt != nil {
+		endedAt := a.EndedAt.In(loc)
+		a.EndedAt = &endedAt
+	}
 }
 
 type UpdateAssignmentRequest struct {
 	UserID int `json:"user_id" binding:"required"`
 }
 
+// UnassignRequest tells the worker why they were taken off the shift
+type UnassignRequest struct {
+	Reason string `json:"reason" binding:"required" example:"Reassigning after the schedule change"`
+}
+
 type CreateAssignmentRequest struct {
 	ShiftID int `json:"shift_id" binding:"required"`
 	UserID  int `json:"user_id" binding:"required"`
 }
+
+// Override lets an admin assign a worker despite schedule conflicts
+type Override struct {
+	// ByUserID is the admin forcing the assignment
+	ByUserID int
+}
+
+// OverrideRecord is an assignment forced through despite its conflicts
+type OverrideRecord struct {
+	ShiftID      int
+	UserID       int
+	OverriddenBy int
+	Conflicts    []pkg.ScheduleConflict
+}
+
+// OverrideEntry is an assignment of the shift forced through, as listed for the assignment.
+// Conflict times are rendered in the zone of the shift's location.
+type OverrideEntry struct {
+	ID               int                    `json:"id"`
+	ShiftID          int                    `json:"shift_id"`
+	UserID           int                    `json:"user_id"`
+	UserName         string                 `json:"user_name"`
+	OverriddenBy     int                    `json:"overridden_by"`
+	OverriddenByName string                 `json:"overridden_by_name"`
+	Conflicts        []pkg.ScheduleConflict `json:"conflicts"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// HistoryRecord is a hand-over of an assignment from one worker to another
+type HistoryRecord struct {
+	AssignmentID int
+	ShiftID      int
+	FromUserID   int
+	ToUserID     int
+	ChangedBy    int
+	// SwapID is the shift swap the hand-over came from, nil when an admin reassigned it
+	SwapID *int
+}
+
+// HistoryEntry is a hand-over of an assignment as listed in its history
+type HistoryEntry struct {
+	ID            int       `json:"id"`
+	AssignmentID  int       `json:"assignment_id"`
+	ShiftID       int       `json:"shift_id"`
+	FromUserID    int       `json:"from_user_id"`
+	FromUserName  string    `json:"from_user_name"`
+	ToUserID      int       `json:"to_user_id"`
+	ToUserName    string    `json:"to_user_name"`
+	ChangedBy     int       `json:"changed_by"`
+	ChangedByName string    `json:"changed_by_name"`
+	SwapID        *int      `json:"swap_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -2,8 +2,10 @@ package assignments
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/afrianjunior/justpayd/internal/pkg"
 	"github.com/go-chi/chi/v5"
@@ -23,40 +25,152 @@ func NewAssignmentHandler(assignmentService AssignmentService, logger *zap.Sugar
 }
 
 func (h *AssignmentHandler) RegisterRoutes(r chi.Router) {
-	r.Get("/", h.GetAssignments)
-	r.Put("/{id}", h.UpdateAssignment)
-	r.Post("/", h.CreateAssignment)
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermAssignmentsRead))
+		r.Get("/", h.GetAssignments)
+		r.Get("/{id}/history", h.GetHistory)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermAssignmentsManage))
+		r.Get("/{id}/overrides", h.GetOverrides)
+		r.Put("/{id}", h.UpdateAssignment)
+		r.Post("/", h.CreateAssignment)
+		r.Delete("/{id}", h.UnassignAssignment)
+	})
 }
 
 // GetAssignments godoc
 // @Summary List all assignments
-// @Description Get all shift assignments
+// @Description Get shift assignments, a page at a time. Only active assignments are listed unless status asks for the ones that ended.
 // @Tags assignments
 // @Produce json
+// @Param from query string false "First day of the shift, YYYY-MM-DD in the zone of its location"
+// @Param to query string false "Last day of the shift, YYYY-MM-DD in the zone of its location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param user_id query int false "Only assignments of this user"
+// @Param status query string false "active, unassigned or cancelled" default(active)
+// @Param sort query string false "start_at, assigned_at, user_name or id, prefixed with - for descending" default(start_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
 // @Success 200 {object} pkg.BaseResponse{data=[]AssignmentResponse} "Successfully retrieved assignments"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /assignments [get]
 func (h *AssignmentHandler) GetAssignments(w http.ResponseWriter, r *http.Request) {
-	assignments, err := h.AssignmentService.GetAssignments(r.Context())
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	q, err := pkg.ParseListQuery(r)
 	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	filter := &AssignmentFilter{ListQuery: *q, Status: strings.TrimSpace(r.URL.Query().Get("status"))}
+
+	assignments, page, err := h.AssignmentService.GetAssignments(r.Context(), filter)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error getting assignments: %v", err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve assignments"))
 		return
 	}
-	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(assignments))
+	for i := range assignments {
+		assignments[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(assignments, page))
+}
+
+// GetHistory godoc
+// @Summary Assignment history
+// @Description Lists who the assignment was handed from and to, by an admin or through a shift swap, oldest first
+// @Tags assignments
+// @Produce json
+// @Param id path int true "Assignment ID"
+// @Success 200 {object} pkg.BaseResponse{data=[]HistoryEntry} "Successfully retrieved the history"
+// @Failure 400 {object} pkg.BaseResponse "Invalid assignment ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 404 {object} pkg.BaseResponse "Assignment not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /assignments/{id}/history [get]
+func (h *AssignmentHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid assignment ID"))
+		return
+	}
+
+	history, err := h.AssignmentService.GetHistory(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Assignment not found"))
+			return
+		}
+		h.logger.Errorf("Error getting the history of assignment %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve the assignment history"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(history))
+}
+
+// GetOverrides godoc
+// @Summary Assignment overrides
+// @Description Lists the conflicts admins forced the assignment's shift through, who did it and for which worker, oldest first. Conflict times are in the zone of the shift's location.
+// @Tags assignments
+// @Produce json
+// @Param id path int true "Assignment ID"
+// @Success 200 {object} pkg.BaseResponse{data=[]OverrideEntry} "Successfully retrieved the overrides"
+// @Failure 400 {object} pkg.BaseResponse "Invalid assignment ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Assignment not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /assignments/{id}/overrides [get]
+func (h *AssignmentHandler) GetOverrides(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid assignment ID"))
+		return
+	}
+
+	overrides, err := h.AssignmentService.GetOverrides(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Assignment not found"))
+			return
+		}
+		h.logger.Errorf("Error getting the overrides of assignment %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve the assignment overrides"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(overrides))
 }
 
 // UpdateAssignment godoc
 // @Summary Update assignment
-// @Description Change the user assigned to a shift
+// @Description Change the user assigned to a shift. The new user must not have a shift overlapping it or leaving less than the minimum rest, unless forced. The hand-over is kept in the assignment's history.
 // @Tags assignments
 // @Accept json
 // @Produce json
 // @Param id path int true "Assignment ID"
+// @Param force query bool false "Assign despite conflicts, the override is recorded"
 // @Param payload body UpdateAssignmentRequest true "Assignment update payload"
 // @Success 200 {object} pkg.BaseResponse{data=AssignmentResponse} "Assignment updated successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request payload or assignment ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
 // @Failure 404 {object} pkg.BaseResponse "Assignment not found"
+// @Failure 409 {object} pkg.BaseResponse "The assignment ended, or the worker has conflicting shifts listed in conflicts"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /assignments/{id} [put]
 func (h *AssignmentHandler) UpdateAssignment(w http.ResponseWriter, r *http.Request) {
@@ -73,8 +187,25 @@ func (h *AssignmentHandler) UpdateAssignment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	assignment, err := h.AssignmentService.UpdateAssignment(r.Context(), id, &payload)
+	override, err := OverrideFromRequest(r)
 	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	assignment, err := h.AssignmentService.UpdateAssignment(r.Context(), id, &payload, userID, override)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error updating assignment ID %d: %v", id, err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update assignment"))
 		return
@@ -88,13 +219,17 @@ func (h *AssignmentHandler) UpdateAssignment(w http.ResponseWriter, r *http.Requ
 
 // CreateAssignment godoc
 // @Summary Create a new assignment
-// @Description Assign a user to a shift
+// @Description Assign a user to a shift. The user must not have a shift overlapping it or leaving less than the minimum rest, unless forced.
 // @Tags assignments
 // @Accept json
 // @Produce json
+// @Param force query bool false "Assign despite conflicts, the override is recorded"
 // @Param payload body CreateAssignmentRequest true "Assignment creation payload"
 // @Success 201 {object} pkg.BaseResponse{data=AssignmentResponse} "Assignment created successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Shift not found"
+// @Failure 409 {object} pkg.BaseResponse "Shift is already assigned or cancelled, or the user has conflicting shifts listed in conflicts"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /assignments [post]
 func (h *AssignmentHandler) CreateAssignment(w http.ResponseWriter, r *http.Request) {
@@ -104,8 +239,19 @@ func (h *AssignmentHandler) CreateAssignment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	assignment, err := h.AssignmentService.CreateAssignment(r.Context(), &payload)
+	override, err := OverrideFromRequest(r)
 	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	assignment, err := h.AssignmentService.CreateAssignment(r.Context(), &payload, override)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error creating assignment: %v", err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create assignment"))
 		return
@@ -113,3 +259,83 @@ func (h *AssignmentHandler) CreateAssignment(w http.ResponseWriter, r *http.Requ
 
 	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(assignment))
 }
+
+// UnassignAssignment godoc
+// @Summary Unassign a worker from a shift
+// @Description Takes the worker off the shift, which becomes open again. The assignment is kept as the worker's history with the reason, and the swaps offering it are cancelled.
+// @Tags assignments
+// @Accept json
+// @Produce json
+// @Param id path int true "Assignment ID"
+// @Param payload body UnassignRequest true "Why the worker is unassigned"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of the shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=AssignmentResponse} "Worker unassigned successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload, assignment ID or time zone"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Assignment not found"
+// @Failure 409 {object} pkg.BaseResponse "The assignment already ended"
+// @Failure 422 {object} pkg.BaseResponse "Reason is missing"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /assignments/{id} [delete]
+func (h *AssignmentHandler) UnassignAssignment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid assignment ID"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	var payload UnassignRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	assignment, err := h.AssignmentService.UnassignAssignment(r.Context(), id, &payload, userID)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Assignment not found"))
+			return
+		}
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error unassigning assignment ID %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to unassign the worker"))
+		return
+	}
+	assignment.In(tz)
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(assignment))
+}
+
+// OverrideFromRequest reads the force query parameter of admin routes assigning shifts.
+// It returns nil unless force is true.
+func OverrideFromRequest(r *http.Request) (*Override, error) {
+	value := r.URL.Query().Get("force")
+	if value == "" {
+		return nil, nil
+	}
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, pkg.NewValidationError("Invalid force parameter, must be true or false")
+	}
+	if !force {
+		return nil, nil
+	}
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		return nil, pkg.NewUnauthorizedError("User not authenticated")
+	}
+	return &Override{ByUserID: userID}, nil
+}
@@ -3,17 +3,26 @@ package assignments
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
 )
 
 // AssignmentRepository defines the interface for assignment data operations
 type AssignmentRepository interface {
-	GetAssignments(ctx context.Context) ([]AssignmentResponse, error)
+	GetAssignments(ctx context.Context, filter *AssignmentFilter) ([]AssignmentResponse, *pkg.Pagination, error)
 	GetAssignmentByID(ctx context.Context, id int) (*AssignmentResponse, error)
 	UpdateAssignment(ctx context.Context, id int, req *UpdateAssignmentRequest) (*AssignmentResponse, error)
 	CreateAssignment(ctx context.Context, req *CreateAssignmentRequest) (*AssignmentResponse, error)
+	EndAssignment(ctx context.Context, id int, status string, endedBy int, reason string) (*AssignmentResponse, error)
+	CancelShiftAssignment(ctx context.Context, shiftID int, cancelledBy int, reason string) error
+	GetBookedShifts(ctx context.Context, userID int, from time.Time, to time.Time, excludeShiftID int) ([]pkg.BookedShift, error)
+	RecordOverride(ctx context.Context, record *OverrideRecord) error
+	GetOverrides(ctx context.Context, shiftID int) ([]OverrideEntry, error)
+	RecordHistory(ctx context.Context, record *HistoryRecord) error
+	GetHistory(ctx context.Context, assignmentID int) ([]HistoryEntry, error)
 }
 
 type assignmentRepository struct {
@@ -25,267 +34,131 @@ func NewAssignmentRepository(db *sql.DB) AssignmentRepository {
 	return &assignmentRepository{db: db}
 }
 
-func (r *assignmentRepository) GetAssignments(ctx context.Context) ([]AssignmentResponse, error) {
-	query := `
-		SELECT 
-			a.id, 
-			a.shift_id, 
-			a.user_id, 
+const assignmentQuery = `
+		SELECT
+			a.id,
+			a.shift_id,
+			a.user_id,
 			u.name as user_name,
-			s.date,
-			s.start_time,
-			s.end_time,
-			a.assigned_at
+			s.role,
+			s.start_at,
+			s.end_at,
+			COALESCE(l.time_zone, 'UTC') as time_zone,
+			a.assigned_at,
+			a.status,
+			a.ended_at,
+			a.ended_by,
+			COALESCE(a.end_reason, '') as end_reason
 		FROM assignments a
 		JOIN users u ON a.user_id = u.id
 		JOIN shifts s ON a.shift_id = s.id
-		ORDER BY s.date, s.start_time
+		LEFT JOIN locations l ON s.location_id = l.id
 	`
 
-	rows, err := r.db.QueryContext(ctx, query)
+// assignmentList applies list queries to assignmentQuery
+var assignmentList = &pkg.ListSpec[AssignmentResponse]{
+	Sorts: map[string]pkg.SortKey[AssignmentResponse]{
+		"start_at":    {Column: "s.start_at", Value: func(a *AssignmentResponse) interface{} { return pkg.FormatTimestamp(a.StartAt) }},
+		"assigned_at": {Column: "a.assigned_at", Value: func(a *AssignmentResponse) interface{} { return pkg.FormatTimestamp(a.AssignedAt) }},
+		"user_name":   {Column: "u.name", Value: func(a *AssignmentResponse) interface{} { return a.UserName }},
+		"id":          {Column: "a.id", Value: func(a *AssignmentResponse) interface{} { return a.ID }},
+	},
+	DefaultSort: "start_at",
+	IDColumn:    "a.id",
+	ID:          func(a *AssignmentResponse) int { return a.ID },
+	Date:        "s.date",
+	Location:    "s.location_id",
+	Role:        "s.role",
+	User:        "a.user_id",
+}
+
+func (r *assignmentRepository) GetAssignments(ctx context.Context, filter *AssignmentFilter) ([]AssignmentResponse, *pkg.Pagination, error) {
+	status := filter.Status
+	if status == "" {
+		status = StatusActive
+	}
+
+	q := &filter.ListQuery
+	clause, args, err := assignmentList.Build(q, []string{"a.status = ?"}, []interface{}{status})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, assignmentQuery+clause, args...)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var assignments []AssignmentResponse
 	for rows.Next() {
-		var assignment AssignmentResponse
-		var dateStr, startTimeStr, endTimeStr string
-		var assignedAtStr string
-
-		if err := rows.Scan(
-			&assignment.ID,
-			&assignment.ShiftID,
-			&assignment.UserID,
-			&assignment.UserName,
-			&dateStr,
-			&startTimeStr,
-			&endTimeStr,
-			&assignedAtStr,
-		); err != nil {
-			return nil, err
-		}
-
-		// Parse date string
-		layout := time.RFC3339
-		date, err := time.Parse(layout, dateStr)
-		if err != nil {
-			// Try other common formats
-			layouts := []string{"2006-01-02", "2006/01/02", "2006-01-02T15:04:05Z"}
-			for _, l := range layouts {
-				date, err = time.Parse(l, dateStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse date string %q: %v\n", dateStr, err)
-				// Use the string value directly if parsing fails
-				assignment.Date = dateStr
-			} else {
-				assignment.Date = date.Format("2006-01-02")
-			}
-		} else {
-			assignment.Date = date.Format("2006-01-02")
-		}
-
-		// Parse start time string
-		timeLayout := time.RFC3339
-		startTime, err := time.Parse(timeLayout, startTimeStr)
+		assignment, err := scanAssignment(rows)
 		if err != nil {
-			// Try common time formats
-			timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-			for _, l := range timeLayouts {
-				startTime, err = time.Parse(l, startTimeStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse start time string %q: %v\n", startTimeStr, err)
-				// Use the string value directly if parsing fails
-				assignment.StartTime = startTimeStr
-			} else {
-				assignment.StartTime = startTime.Format("15:04:05")
-			}
-		} else {
-			assignment.StartTime = startTime.Format("15:04:05")
-		}
-
-		// Parse end time string
-		endTime, err := time.Parse(timeLayout, endTimeStr)
-		if err != nil {
-			// Try common time formats
-			timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-			for _, l := range timeLayouts {
-				endTime, err = time.Parse(l, endTimeStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse end time string %q: %v\n", endTimeStr, err)
-				// Use the string value directly if parsing fails
-				assignment.EndTime = endTimeStr
-			} else {
-				assignment.EndTime = endTime.Format("15:04:05")
-			}
-		} else {
-			assignment.EndTime = endTime.Format("15:04:05")
-		}
-
-		// Parse assigned_at timestamp
-		assignedAt, err := time.Parse(layout, assignedAtStr)
-		if err != nil {
-			// Try other common formats
-			layouts := []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z", "2006-01-02 15:04:05.999999999-07:00"}
-			for _, l := range layouts {
-				assignedAt, err = time.Parse(l, assignedAtStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse assigned_at string %q: %v\n", assignedAtStr, err)
-			}
+			return nil, nil, err
 		}
-		assignment.AssignedAt = assignedAt
-
-		assignments = append(assignments, assignment)
+		assignments = append(assignments, *assignment)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return assignments, nil
+	assignments, page := assignmentList.Page(q, assignments)
+	return assignments, page, nil
 }
 
 func (r *assignmentRepository) GetAssignmentByID(ctx context.Context, id int) (*AssignmentResponse, error) {
-	query := `
-		SELECT 
-			a.id, 
-			a.shift_id, 
-			a.user_id,
-			u.name as user_name,
-			s.date,
-			s.start_time,
-			s.end_time,
-			a.assigned_at
-		FROM assignments a
-		JOIN users u ON a.user_id = u.id
-		JOIN shifts s ON a.shift_id = s.id
-		WHERE a.id = ?
-	`
-
-	var assignment AssignmentResponse
-	var dateStr, startTimeStr, endTimeStr string
-	var assignedAtStr string
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&assignment.ID,
-		&assignment.ShiftID,
-		&assignment.UserID,
-		&assignment.UserName,
-		&dateStr,
-		&startTimeStr,
-		&endTimeStr,
-		&assignedAtStr,
-	)
+	query := assignmentQuery + " WHERE a.id = ?"
 
+	assignment, err := scanAssignment(pkg.Conn(ctx, r.db).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil // Not found
 		}
 		return nil, err
 	}
+	return assignment, nil
+}
 
-	// Parse date string
-	layout := time.RFC3339
-	date, err := time.Parse(layout, dateStr)
-	if err != nil {
-		// Try other common formats
-		layouts := []string{"2006-01-02", "2006/01/02", "2006-01-02T15:04:05Z"}
-		for _, l := range layouts {
-			date, err = time.Parse(l, dateStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse date string %q: %v\n", dateStr, err)
-			// Use the string value directly if parsing fails
-			assignment.Date = dateStr
-		} else {
-			assignment.Date = date.Format("2006-01-02")
-		}
-	} else {
-		assignment.Date = date.Format("2006-01-02")
-	}
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	// Parse start time string
-	timeLayout := time.RFC3339
-	startTime, err := time.Parse(timeLayout, startTimeStr)
-	if err != nil {
-		// Try common time formats
-		timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-		for _, l := range timeLayouts {
-			startTime, err = time.Parse(l, startTimeStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse start time string %q: %v\n", startTimeStr, err)
-			// Use the string value directly if parsing fails
-			assignment.StartTime = startTimeStr
-		} else {
-			assignment.StartTime = startTime.Format("15:04:05")
-		}
-	} else {
-		assignment.StartTime = startTime.Format("15:04:05")
-	}
+// scanAssignment reads a row of assignmentQuery, rendering its times in the zone of the shift's location
+func scanAssignment(row rowScanner) (*AssignmentResponse, error) {
+	var assignment AssignmentResponse
+	var startAt, endAt time.Time
+	var timeZone string
+	var endedAt sql.NullTime
+	var endedBy sql.NullInt64
 
-	// Parse end time string
-	endTime, err := time.Parse(timeLayout, endTimeStr)
-	if err != nil {
-		// Try common time formats
-		timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-		for _, l := range timeLayouts {
-			endTime, err = time.Parse(l, endTimeStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse end time string %q: %v\n", endTimeStr, err)
-			// Use the string value directly if parsing fails
-			assignment.EndTime = endTimeStr
-		} else {
-			assignment.EndTime = endTime.Format("15:04:05")
-		}
-	} else {
-		assignment.EndTime = endTime.Format("15:04:05")
+	if err := row.Scan(
+		&assignment.ID,
+		&assignment.ShiftID,
+		&assignment.UserID,
+		&assignment.UserName,
+		&assignment.Role,
+		&startAt,
+		&endAt,
+		&timeZone,
+		&assignment.AssignedAt,
+		&assignment.Status,
+		&endedAt,
+		&endedBy,
+		&assignment.EndReason,
+	); err != nil {
+		return nil, err
 	}
-
-	// Parse assigned_at timestamp
-	assignedAt, err := time.Parse(layout, assignedAtStr)
-	if err != nil {
-		// Try other common formats
-		layouts := []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z", "2006-01-02 15:04:05.999999999-07:00"}
-		for _, l := range layouts {
-			assignedAt, err = time.Parse(l, assignedAtStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse assigned_at string %q: %v\n", assignedAtStr, err)
-		}
+	if endedAt.Valid {
+		assignment.EndedAt = &endedAt.Time
+	}
+	if endedBy.Valid {
+		id := int(endedBy.Int64)
+		assignment.EndedBy = &id
 	}
-	assignment.AssignedAt = assignedAt
 
+	assignment.Schedule = pkg.NewSchedule(startAt, endAt, timeZone)
+	assignment.In(nil)
 	return &assignment, nil
 }
 
@@ -306,7 +179,7 @@ func (r *assignmentRepository) UpdateAssignment(ctx context.Context, id int, req
 		WHERE id = ?
 	`
 
-	_, err = r.db.ExecContext(ctx, query, req.UserID, id)
+	_, err = pkg.Conn(ctx, r.db).ExecContext(ctx, query, req.UserID, id)
 	if err != nil {
 		return nil, err
 	}
@@ -321,8 +194,11 @@ func (r *assignmentRepository) CreateAssignment(ctx context.Context, req *Create
 		VALUES (?, ?, CURRENT_TIMESTAMP)
 	`
 
-	result, err := r.db.ExecContext(ctx, query, req.ShiftID, req.UserID)
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, req.ShiftID, req.UserID)
 	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return nil, pkg.NewConflictError("shift is already assigned")
+		}
 		return nil, err
 	}
 
@@ -335,3 +211,241 @@ func (r *assignmentRepository) CreateAssignment(ctx context.Context, req *Create
 	// Get the full assignment details
 	return r.GetAssignmentByID(ctx, int(id))
 }
+
+// EndAssignment takes the worker off the shift, keeping the assignment with the given status
+// as their history. The swaps offering it, or offering it in return, are cancelled, so it
+// belongs in a unit of work. An assignment that already ended is reported as a conflict.
+func (r *assignmentRepository) EndAssignment(ctx context.Context, id int, status string, endedBy int, reason string) (*AssignmentResponse, error) {
+	now := pkg.FormatTimestamp(time.Now())
+	db := pkg.Conn(ctx, r.db)
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE assignments
+		SET status = ?, ended_at = ?, ended_by = ?, end_reason = ?
+		WHERE id = ? AND status = ?
+	`, status, now, endedBy, reason, id, StatusActive)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		assignment, err := r.GetAssignmentByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if assignment == nil {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, pkg.NewConflictError("assignment was already " + assignment.Status)
+	}
+
+	swaps := `
+		SELECT id FROM shift_swaps
+		WHERE status IN ('open', 'proposed', 'accepted') AND (assignment_id = ? OR counter_assignment_id = ?)
+	`
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO shift_swap_events (swap_id, action, actor_id, note)
+		SELECT id, 'cancelled', ?, ? FROM (`+swaps+`)
+	`, endedBy, reason, id, id); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `
+		UPDATE shift_swaps SET status = 'cancelled', reason = ?, updated_at = ?
+		WHERE id IN (`+swaps+`)
+	`, reason, now, id, id); err != nil {
+		return nil, err
+	}
+
+	return r.GetAssignmentByID(ctx, id)
+}
+
+// CancelShiftAssignment ends the active assignment of a cancelled shift as cancelled, see
+// EndAssignment. Shifts nobody is assigned to are left alone.
+func (r *assignmentRepository) CancelShiftAssignment(ctx context.Context, shiftID int, cancelledBy int, reason string) error {
+	var id int
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT id FROM assignments WHERE shift_id = ? AND status = ?", shiftID, StatusActive).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.EndAssignment(ctx, id, StatusCancelled, cancelledBy, reason)
+	return err
+}
+
+// GetBookedShifts lists the shifts assigned to the user that overlap from to to, leaving
+// out the shift with excludeShiftID
+func (r *assignmentRepository) GetBookedShifts(ctx context.Context, userID int, from time.Time, to time.Time, excludeShiftID int) ([]pkg.BookedShift, error) {
+	query := `
+		SELECT s.id, s.start_at, s.end_at
+		FROM assignments a
+		JOIN shifts s ON a.shift_id = s.id
+		WHERE a.user_id = ? AND a.status = 'active' AND s.id <> ? AND s.start_at < ? AND s.end_at > ?
+		ORDER BY s.start_at
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, userID, excludeShiftID, pkg.FormatTimestamp(to), pkg.FormatTimestamp(from))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shifts []pkg.BookedShift
+	for rows.Next() {
+		var shift pkg.BookedShift
+		if err := rows.Scan(&shift.ShiftID, &shift.StartAt, &shift.EndAt); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, shift)
+	}
+	return shifts, rows.Err()
+}
+
+// RecordOverride keeps track of an assignment forced through despite its conflicts
+func (r *assignmentRepository) RecordOverride(ctx context.Context, record *OverrideRecord) error {
+	conflicts, err := json.Marshal(record.Conflicts)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO assignment_overrides (shift_id, user_id, overridden_by, conflicts)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err = pkg.Conn(ctx, r.db).ExecContext(ctx, query, record.ShiftID, record.UserID, record.OverriddenBy, string(conflicts))
+	return err
+}
+
+// RecordHistory keeps track of an assignment handed to another worker
+func (r *assignmentRepository) RecordHistory(ctx context.Context, record *HistoryRecord) error {
+	query := `
+		INSERT INTO assignment_history (assignment_id, shift_id, from_user_id, to_user_id, changed_by, swap_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query,
+		record.AssignmentID, record.ShiftID, record.FromUserID, record.ToUserID, record.ChangedBy, record.SwapID)
+	return err
+}
+
+// GetOverrides lists the assignments of the shift admins forced through, oldest first
+func (r *assignmentRepository) GetOverrides(ctx context.Context, shiftID int) ([]OverrideEntry, error) {
+	query := `
+		SELECT
+			o.id,
+			o.shift_id,
+			o.user_id,
+			u.name,
+			o.overridden_by,
+			ou.name,
+			o.conflicts,
+			o.created_at,
+			COALESCE(l.time_zone, 'UTC') as time_zone
+		FROM assignment_overrides o
+		JOIN users u ON o.user_id = u.id
+		JOIN users ou ON o.overridden_by = ou.id
+		JOIN shifts s ON o.shift_id = s.id
+		LEFT JOIN locations l ON s.location_id = l.id
+		WHERE o.shift_id = ?
+		ORDER BY o.created_at, o.id
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, shiftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []OverrideEntry{}
+	for rows.Next() {
+		var entry OverrideEntry
+		var conflicts, timeZone string
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.ShiftID,
+			&entry.UserID,
+			&entry.UserName,
+			&entry.OverriddenBy,
+			&entry.OverriddenByName,
+			&conflicts,
+			&entry.CreatedAt,
+			&timeZone,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(conflicts), &entry.Conflicts); err != nil {
+			return nil, err
+		}
+
+		// Overrides recorded before conflicts were rendered in the location's zone hold UTC times
+		if loc, err := pkg.LoadTimeZone(timeZone); err == nil {
+			entry.CreatedAt = entry.CreatedAt.In(loc)
+			for i := range entry.Conflicts {
+				entry.Conflicts[i].StartAt = entry.Conflicts[i].StartAt.In(loc)
+				entry.Conflicts[i].EndAt = entry.Conflicts[i].EndAt.In(loc)
+			}
+		}
+		overrides = append(overrides, entry)
+	}
+	return overrides, rows.Err()
+}
+
+// GetHistory lists the hand-overs of an assignment, oldest first
+func (r *assignmentRepository) GetHistory(ctx context.Context, assignmentID int) ([]HistoryEntry, error) {
+	query := `
+		SELECT
+			h.id,
+			h.assignment_id,
+			h.shift_id,
+			h.from_user_id,
+			fu.name,
+			h.to_user_id,
+			tu.name,
+			h.changed_by,
+			cu.name,
+			h.swap_id,
+			h.created_at
+		FROM assignment_history h
+		JOIN users fu ON h.from_user_id = fu.id
+		JOIN users tu ON h.to_user_id = tu.id
+		JOIN users cu ON h.changed_by = cu.id
+		WHERE h.assignment_id = ?
+		ORDER BY h.created_at, h.id
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		var swapID sql.NullInt64
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.AssignmentID,
+			&entry.ShiftID,
+			&entry.FromUserID,
+			&entry.FromUserName,
+			&entry.ToUserID,
+			&entry.ToUserName,
+			&entry.ChangedBy,
+			&entry.ChangedByName,
+			&swapID,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if swapID.Valid {
+			id := int(swapID.Int64)
+			entry.SwapID = &id
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
@@ -1,33 +1,254 @@
 package assignments
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/shifts"
+)
 
 // AssignmentService defines the interface for assignment business logic
 type AssignmentService interface {
-	GetAssignments(ctx context.Context) ([]AssignmentResponse, error)
-	UpdateAssignment(ctx context.Context, id int, req *UpdateAssignmentRequest) (*AssignmentResponse, error)
-	CreateAssignment(ctx context.Context, req *CreateAssignmentRequest) (*AssignmentResponse, error)
+	GetAssignments(ctx context.Context, filter *AssignmentFilter) ([]AssignmentResponse, *pkg.Pagination, error)
+	UpdateAssignment(ctx context.Context, id int, req *UpdateAssignmentRequest, changedBy int, override *Override) (*AssignmentResponse, error)
+	CreateAssignment(ctx context.Context, req *CreateAssignmentRequest, override *Override) (*AssignmentResponse, error)
+	UnassignAssignment(ctx context.Context, id int, req *UnassignRequest, endedBy int) (*AssignmentResponse, error)
+	GetHistory(ctx context.Context, id int) ([]HistoryEntry, error)
+	GetOverrides(ctx context.Context, id int) ([]OverrideEntry, error)
+}
+
+// RequestReleaser ends the approved shift request of a worker taken off the shift, so they
+// may ask for it again. The shift requests repository implements it, shift requests depend
+// on assignments and not the other way around.
+type RequestReleaser interface {
+	ReleaseApprovedRequest(ctx context.Context, shiftID int, userID int, releasedBy int, reason string) error
 }
 
 type assignmentService struct {
 	assignmentRepository AssignmentRepository
+	shiftRepository      shifts.ShiftRepository
+	availabilityService  availability.AvailabilityService
+	requestReleaser      RequestReleaser
+	unitOfWork           pkg.UnitOfWork
+	config               *pkg.Config
 }
 
 // NewAssignmentService creates a new instance of AssignmentService
-func NewAssignmentService(assignmentRepository AssignmentRepository) AssignmentService {
-	return &assignmentService{assignmentRepository: assignmentRepository}
+func NewAssignmentService(
+	assignmentRepository AssignmentRepository,
+	shiftRepository shifts.ShiftRepository,
+	availabilityService availability.AvailabilityService,
+	requestReleaser RequestReleaser,
+	unitOfWork pkg.UnitOfWork,
+	config *pkg.Config,
+) AssignmentService {
+	return &assignmentService{
+		assignmentRepository: assignmentRepository,
+		shiftRepository:      shiftRepository,
+		availabilityService:  availabilityService,
+		requestReleaser:      requestReleaser,
+		unitOfWork:           unitOfWork,
+		config:               config,
+	}
+}
+
+func (s *assignmentService) GetAssignments(ctx context.Context, filter *AssignmentFilter) ([]AssignmentResponse, *pkg.Pagination, error) {
+	switch filter.Status {
+	case "", StatusActive, StatusUnassigned, StatusCancelled:
+	default:
+		return nil, nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "status", Message: "must be active, unassigned or cancelled"}})
+	}
+	return s.assignmentRepository.GetAssignments(ctx, filter)
+}
+
+// UpdateAssignment hands the shift to another worker, who must be free and available at the
+// time. The hand-over is kept in the assignment's history, and the request that got the
+// previous worker the shift is unassigned, so they may request it again.
+func (s *assignmentService) UpdateAssignment(ctx context.Context, id int, req *UpdateAssignmentRequest, changedBy int, override *Override) (*AssignmentResponse, error) {
+	var updated *AssignmentResponse
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		assignment, err := s.assignmentRepository.GetAssignmentByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if assignment == nil {
+			return nil // Not found
+		}
+		if !assignment.IsActive() {
+			return pkg.NewConflictError("assignment was " + assignment.Status)
+		}
+
+		if req.UserID != assignment.UserID {
+			conflicts, err := FindConflicts(ctx, s.assignmentRepository, req.UserID, assignment.ShiftID, assignment.StartAt, assignment.EndAt, s.config.Shifts.MinRest())
+			if err != nil {
+				return err
+			}
+			unavailable, err := s.availabilityService.CheckAvailability(ctx, req.UserID, assignment.StartAt, assignment.EndAt)
+			if err != nil {
+				return err
+			}
+			conflicts = append(conflicts, unavailable...)
+			if err := ResolveConflicts(ctx, s.assignmentRepository, assignment.ShiftID, req.UserID, conflicts, override); err != nil {
+				return err
+			}
+			if err := s.assignmentRepository.RecordHistory(ctx, &HistoryRecord{
+				AssignmentID: id,
+				ShiftID:      assignment.ShiftID,
+				FromUserID:   assignment.UserID,
+				ToUserID:     req.UserID,
+				ChangedBy:    changedBy,
+			}); err != nil {
+				return fmt.Errorf("failed to record the history of assignment %d: %w", id, err)
+			}
+			if err := s.requestReleaser.ReleaseApprovedRequest(ctx, assignment.ShiftID, assignment.UserID, changedBy, ReasonHandedOver); err != nil {
+				return err
+			}
+		}
+
+		updated, err = s.assignmentRepository.UpdateAssignment(ctx, id, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// CreateAssignment assigns the shift to a worker, who must be free and available at the time
+func (s *assignmentService) CreateAssignment(ctx context.Context, req *CreateAssignmentRequest, override *Override) (*AssignmentResponse, error) {
+	shift, err := s.shiftRepository.GetShiftByID(ctx, req.ShiftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shift %d: %w", req.ShiftID, err)
+	}
+	if shift == nil {
+		return nil, pkg.ErrNotFound
+	}
+	if shift.IsCancelled() {
+		return nil, pkg.NewConflictError("shift is cancelled")
+	}
+
+	var created *AssignmentResponse
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		conflicts, err := FindConflicts(ctx, s.assignmentRepository, req.UserID, shift.ID, shift.StartAt, shift.EndAt, s.config.Shifts.MinRest())
+		if err != nil {
+			return err
+		}
+		unavailable, err := s.availabilityService.CheckAvailability(ctx, req.UserID, shift.StartAt, shift.EndAt)
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, unavailable...)
+		if err := ResolveConflicts(ctx, s.assignmentRepository, shift.ID, req.UserID, conflicts, override); err != nil {
+			return err
+		}
+
+		created, err = s.assignmentRepository.CreateAssignment(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UnassignAssignment takes the worker off the shift, which is open again. The assignment is
+// kept as the worker's history, with who unassigned them and why, and the request that got
+// them the shift is unassigned too, so they may request it again.
+func (s *assignmentService) UnassignAssignment(ctx context.Context, id int, req *UnassignRequest, endedBy int) (*AssignmentResponse, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "reason", Message: "is required"}})
+	}
+
+	var unassigned *AssignmentResponse
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		var err error
+		unassigned, err = s.assignmentRepository.EndAssignment(ctx, id, StatusUnassigned, endedBy, reason)
+		if err != nil {
+			return err
+		}
+		return s.requestReleaser.ReleaseApprovedRequest(ctx, unassigned.ShiftID, unassigned.UserID, endedBy, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unassigned, nil
+}
+
+// GetHistory lists who the assignment was handed from and to, oldest first
+func (s *assignmentService) GetHistory(ctx context.Context, id int) ([]HistoryEntry, error) {
+	assignment, err := s.assignmentRepository.GetAssignmentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if assignment == nil {
+		return nil, pkg.ErrNotFound
+	}
+	return s.assignmentRepository.GetHistory(ctx, id)
+}
+
+// GetOverrides lists who forced the shift of the assignment on a worker despite which
+// conflicts, oldest first. It covers the workers the shift was handed to before too.
+func (s *assignmentService) GetOverrides(ctx context.Context, id int) ([]OverrideEntry, error) {
+	assignment, err := s.assignmentRepository.GetAssignmentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if assignment == nil {
+		return nil, pkg.ErrNotFound
+	}
+	return s.assignmentRepository.GetOverrides(ctx, assignment.ShiftID)
+}
+
+// conflictChecker checks the assignees of imported rosters like CreateAssignment checks a
+// worker, so imports can't skip the minimum rest or leave forced assignments unrecorded
+type conflictChecker struct {
+	assignmentRepository AssignmentRepository
+	config               *pkg.Config
+}
+
+// NewConflictChecker creates the shifts.AssignmentChecker of roster imports
+func NewConflictChecker(assignmentRepository AssignmentRepository, config *pkg.Config) shifts.AssignmentChecker {
+	return &conflictChecker{assignmentRepository: assignmentRepository, config: config}
+}
+
+func (c *conflictChecker) FindConflicts(ctx context.Context, userID int, start time.Time, end time.Time) ([]pkg.ScheduleConflict, error) {
+	return FindConflicts(ctx, c.assignmentRepository, userID, 0, start, end, c.config.Shifts.MinRest())
 }
 
-func (s *assignmentService) GetAssignments(ctx context.Context) ([]AssignmentResponse, error) {
-	return s.assignmentRepository.GetAssignments(ctx)
+func (c *conflictChecker) RecordOverride(ctx context.Context, shiftID int, userID int, overriddenBy int, conflicts []pkg.ScheduleConflict) error {
+	return ResolveConflicts(ctx, c.assignmentRepository, shiftID, userID, conflicts, &Override{ByUserID: overriddenBy})
 }
 
-func (s *assignmentService) UpdateAssignment(ctx context.Context, id int, req *UpdateAssignmentRequest) (*AssignmentResponse, error) {
-	// Here you could add validation or business logic if needed
-	return s.assignmentRepository.UpdateAssignment(ctx, id, req)
+// FindConflicts lists the assigned shifts of the user clashing with the shift from start to
+// end, either overlapping it or leaving less than minRest between them
+func FindConflicts(ctx context.Context, repo AssignmentRepository, userID int, shiftID int, start time.Time, end time.Time, minRest time.Duration) ([]pkg.ScheduleConflict, error) {
+	from, to := pkg.RestWindow(start, end, minRest)
+	booked, err := repo.GetBookedShifts(ctx, userID, from, to, shiftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the shifts of user %d: %w", userID, err)
+	}
+	return pkg.FindScheduleConflicts(start, end, booked, minRest), nil
 }
 
-func (s *assignmentService) CreateAssignment(ctx context.Context, req *CreateAssignmentRequest) (*AssignmentResponse, error) {
-	// You could add validation or business logic here if needed
-	return s.assignmentRepository.CreateAssignment(ctx, req)
+// ResolveConflicts refuses to give the user the shift when it has conflicts, unless an
+// admin overrides them, in which case the override is recorded. It belongs in the unit of
+// work assigning the shift, so the record is only kept when the assignment is.
+func ResolveConflicts(ctx context.Context, repo AssignmentRepository, shiftID int, userID int, conflicts []pkg.ScheduleConflict, override *Override) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if override == nil {
+		return pkg.NewScheduleConflictError(conflicts)
+	}
+	return repo.RecordOverride(ctx, &OverrideRecord{
+		ShiftID:      shiftID,
+		UserID:       userID,
+		OverriddenBy: override.ByUserID,
+		Conflicts:    conflicts,
+	})
 }
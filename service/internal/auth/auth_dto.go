@@ -1,12 +1,71 @@
 package auth
 
+import "time"
+
 // LoginRequest represents the credentials provided for login
 type LoginRequest struct {
-	Email string `json:"email" example:"user@example.com"`
+	Email    string `json:"email" example:"user@example.com"`
+	Password string `json:"password" example:"correct-horse-battery"`
+}
+
+// SSOLoginRequest carries an ID token issued by the configured OpenID Connect provider
+type SSOLoginRequest struct {
+	IDToken string `json:"id_token"`
 }
 
 // LoginResponse represents the response after successful authentication
 type LoginResponse struct {
-	Token  string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	UserID int    `json:"user_id" example:"1"`
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token" example:"q8Zk3v1o0x6mJ2cU5rN7yA..."`
+	ExpiresIn    int    `json:"expires_in" example:"900"` // access token lifetime in seconds
+	UserID       int    `json:"user_id" example:"1"`
+}
+
+// RefreshRequest represents a request to exchange a refresh token for a new token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" example:"q8Zk3v1o0x6mJ2cU5rN7yA..."`
+}
+
+// LogoutRequest represents a request to end the current session
+type LogoutRequest struct {
+	// AllSessions revokes every session of the user instead of only the current one
+	AllSessions bool `json:"all_sessions" example:"false"`
+}
+
+// ChangePasswordRequest represents a request to set or change the caller's password
+type ChangePasswordRequest struct {
+	// CurrentPassword is required when the account already has a password
+	CurrentPassword string `json:"current_password" example:"old-password"`
+	NewPassword     string `json:"new_password" example:"correct-horse-battery"`
+}
+
+// RegisterRequest represents a self-service sign up of a worker
+type RegisterRequest struct {
+	Name     string `json:"name" example:"Jane Doe"`
+	Email    string `json:"email" example:"jane@example.com"`
+	Password string `json:"password" example:"correct-horse-battery"`
+}
+
+// RegisterResponse represents the account created by a registration
+type RegisterResponse struct {
+	UserID int    `json:"user_id" example:"7"`
+	Email  string `json:"email" example:"jane@example.com"`
+}
+
+// VerifyEmailRequest carries the token sent in the verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token" example:"Yk3v1o0x6mJ2cU5rN7yA..."`
+}
+
+// ResendVerificationRequest asks for a new verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" example:"jane@example.com"`
+}
+
+// EmailVerification is a pending or consumed email verification token
+type EmailVerification struct {
+	ID        int
+	UserID    int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
 }
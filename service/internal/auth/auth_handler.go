@@ -2,6 +2,8 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/afrianjunior/justpayd/internal/pkg"
@@ -25,6 +27,24 @@ func NewAuthHandler(authService AuthService, logger *zap.SugaredLogger, config *
 
 func (h *AuthHandler) RegisterRoutes(r chi.Router) {
 	r.Post("/login", h.Login)
+	r.Post("/sso/login", h.SSOLogin)
+	r.Post("/refresh", h.Refresh)
+	r.Post("/register", h.Register)
+	// GET is used by the link in the verification email, POST by API clients
+	r.Get("/verify-email", h.VerifyEmail)
+	r.Post("/verify-email", h.VerifyEmail)
+	r.Post("/verify-email/resend", h.ResendVerification)
+}
+
+// RegisterWellKnownRoutes registers the discovery documents other services use to verify our tokens
+func (h *AuthHandler) RegisterWellKnownRoutes(r chi.Router) {
+	r.Get("/jwks.json", h.JWKS)
+}
+
+// RegisterProtectedRoutes registers the auth routes that require an authenticated user
+func (h *AuthHandler) RegisterProtectedRoutes(r chi.Router) {
+	r.Put("/password", h.ChangePassword)
+	r.Post("/logout", h.Logout)
 }
 
 // @Summary User login
@@ -47,26 +67,284 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify user credentials
-	user, err := h.authService.VerifyCredentials(r.Context(), req.Email)
+	user, err := h.authService.VerifyCredentials(r.Context(), req.Email, req.Password)
 	if err != nil {
-		h.logger.Errorw("Invalid credentials", "email", req.Email, "error", err)
-		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid credentials"), http.StatusUnauthorized)
+		var unauthorizedErr pkg.UnauthorizedError
+		if errors.As(err, &unauthorizedErr) {
+			h.logger.Infow("Login rejected", "email", req.Email, "reason", unauthorizedErr.Message)
+			pkg.JsonResponse(w, pkg.NewErrorResponse(unauthorizedErr.Message), http.StatusUnauthorized)
+			return
+		}
+		h.logger.Errorw("Failed to verify credentials", "email", req.Email, "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Authentication failed"), http.StatusInternalServerError)
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.authService.GenerateToken(user.ID)
+	// Start a session and issue the token pair
+	response, err := h.authService.CreateSession(r.Context(), user.ID)
 	if err != nil {
 		h.logger.Errorw("Failed to generate token", "error", err)
 		pkg.JsonResponse(w, pkg.NewErrorResponse("Authentication failed"), http.StatusInternalServerError)
 		return
 	}
 
-	// Return the token and user ID
-	response := LoginResponse{
-		Token:  token,
-		UserID: user.ID,
+	pkg.JsonResponse(w, pkg.SuccessResponse(response), http.StatusOK)
+}
+
+// @Summary SSO login
+// @Description Exchanges an ID token from the configured OpenID Connect provider for a JustPayd token pair.
+// @Description The token's issuer, audience, expiry and signature are verified and its email claim is matched to a user.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body SSOLoginRequest true "ID token"
+// @Success 200 {object} pkg.BaseResponse{data=LoginResponse} "Successfully authenticated"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request format"
+// @Failure 401 {object} pkg.BaseResponse "Invalid ID token or unknown user"
+// @Failure 403 {object} pkg.BaseResponse "SSO login is not enabled"
+// @Failure 500 {object} pkg.BaseResponse "Authentication failed"
+// @Router /auth/sso/login [post]
+func (h *AuthHandler) SSOLogin(w http.ResponseWriter, r *http.Request) {
+	var req SSOLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.authService.VerifyIDToken(r.Context(), req.IDToken)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			h.logger.Infow("SSO login rejected", "reason", msg)
+			pkg.JsonResponse(w, pkg.NewErrorResponse(msg), status)
+			return
+		}
+		h.logger.Errorw("Failed to verify id token", "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Authentication failed"), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := h.authService.CreateSession(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Errorw("Failed to generate token", "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Authentication failed"), http.StatusInternalServerError)
+		return
 	}
 
 	pkg.JsonResponse(w, pkg.SuccessResponse(response), http.StatusOK)
 }
+
+// @Summary Refresh access token
+// @Description Exchanges a refresh token for a new access token and a rotated refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body RefreshRequest true "Refresh token"
+// @Success 200 {object} pkg.BaseResponse{data=LoginResponse} "Successfully refreshed"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request format"
+// @Failure 401 {object} pkg.BaseResponse "Invalid, expired or revoked refresh token"
+// @Failure 500 {object} pkg.BaseResponse "Failed to refresh session"
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.authService.RefreshSession(r.Context(), req.RefreshToken)
+	if err != nil {
+		var unauthorizedErr pkg.UnauthorizedError
+		if errors.As(err, &unauthorizedErr) {
+			pkg.JsonResponse(w, pkg.NewErrorResponse(unauthorizedErr.Message), http.StatusUnauthorized)
+			return
+		}
+		h.logger.Errorw("Failed to refresh session", "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Failed to refresh session"), http.StatusInternalServerError)
+		return
+	}
+
+	pkg.JsonResponse(w, pkg.SuccessResponse(response), http.StatusOK)
+}
+
+// @Summary Set or change password
+// @Description Sets a password for the authenticated user, or changes it when one already exists
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param payload body ChangePasswordRequest true "Password change payload"
+// @Success 200 {object} pkg.BaseResponse "Password updated successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request format or password"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized or wrong current password"
+// @Failure 500 {object} pkg.BaseResponse "Failed to update password"
+// @Router /auth/password [put]
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := pkg.GetUserFromContext(r.Context())
+	if !ok {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("User not authenticated"), http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ChangePassword(r.Context(), user.ID, &req); err != nil {
+		var validationErr pkg.ValidationError
+		var unauthorizedErr pkg.UnauthorizedError
+		switch {
+		case errors.As(err, &validationErr):
+			pkg.JsonResponse(w, pkg.NewErrorResponse(validationErr.Message), http.StatusBadRequest)
+		case errors.As(err, &unauthorizedErr):
+			pkg.JsonResponse(w, pkg.NewErrorResponse(unauthorizedErr.Message), http.StatusUnauthorized)
+		default:
+			h.logger.Errorw("Failed to change password", "user_id", user.ID, "error", err)
+			pkg.JsonResponse(w, pkg.NewErrorResponse("Failed to update password"), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	pkg.JsonResponse(w, pkg.SuccessResponse(map[string]string{"message": "Password updated successfully"}), http.StatusOK)
+}
+
+// @Summary Logout
+// @Description Revokes the current session, or every session of the user when all_sessions is true
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param payload body LogoutRequest false "Logout options"
+// @Success 200 {object} pkg.BaseResponse "Logged out successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request format"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 500 {object} pkg.BaseResponse "Failed to logout"
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	user, ok := pkg.GetUserFromContext(r.Context())
+	if !ok {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("User not authenticated"), http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := pkg.GetSessionIDFromContext(r.Context())
+
+	// The body is optional, an empty one logs out the current session only
+	var req LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), user.ID, sessionID, req.AllSessions); err != nil {
+		h.logger.Errorw("Failed to logout", "user_id", user.ID, "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Failed to logout"), http.StatusInternalServerError)
+		return
+	}
+
+	pkg.JsonResponse(w, pkg.SuccessResponse(map[string]string{"message": "Logged out successfully"}), http.StatusOK)
+}
+
+// @Summary Register
+// @Description Creates a worker account and sends a verification email. The account can log in once the email is verified.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body RegisterRequest true "Registration details"
+// @Success 201 {object} pkg.BaseResponse{data=RegisterResponse} "Account created, verification email sent"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request format or fields"
+// @Failure 403 {object} pkg.BaseResponse "Registration is disabled"
+// @Failure 409 {object} pkg.BaseResponse "Email is already registered"
+// @Failure 500 {object} pkg.BaseResponse "Registration failed"
+// @Router /auth/register [post]
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.authService.Register(r.Context(), &req)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.JsonResponse(w, pkg.NewErrorResponse(msg), status)
+			return
+		}
+		h.logger.Errorw("Failed to register user", "email", req.Email, "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Registration failed"), http.StatusInternalServerError)
+		return
+	}
+
+	pkg.JsonResponse(w, pkg.SuccessResponse(response), http.StatusCreated)
+}
+
+// @Summary Verify email
+// @Description Confirms an email address with the token from the verification email. The token can be passed as a query parameter or in the body.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token query string false "Verification token"
+// @Param payload body VerifyEmailRequest false "Verification token"
+// @Success 200 {object} pkg.BaseResponse "Email verified"
+// @Failure 400 {object} pkg.BaseResponse "Invalid, used or expired token"
+// @Failure 500 {object} pkg.BaseResponse "Verification failed"
+// @Router /auth/verify-email [post]
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	req := VerifyEmailRequest{Token: r.URL.Query().Get("token")}
+	if req.Token == "" && r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.authService.VerifyEmail(r.Context(), req.Token); err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.JsonResponse(w, pkg.NewErrorResponse(msg), status)
+			return
+		}
+		h.logger.Errorw("Failed to verify email", "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Verification failed"), http.StatusInternalServerError)
+		return
+	}
+
+	pkg.JsonResponse(w, pkg.SuccessResponse(map[string]string{"message": "Email verified, you can now log in"}), http.StatusOK)
+}
+
+// @Summary Resend verification email
+// @Description Sends a new verification link. Always succeeds so it cannot be used to check which emails are registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body ResendVerificationRequest true "Account email"
+// @Success 200 {object} pkg.BaseResponse "Verification email sent if the account needs one"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request format"
+// @Failure 500 {object} pkg.BaseResponse "Failed to send verification email"
+// @Router /auth/verify-email/resend [post]
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ResendVerification(r.Context(), req.Email); err != nil {
+		h.logger.Errorw("Failed to resend verification email", "email", req.Email, "error", err)
+		pkg.JsonResponse(w, pkg.NewErrorResponse("Failed to send verification email"), http.StatusInternalServerError)
+		return
+	}
+
+	pkg.JsonResponse(w, pkg.SuccessResponse(map[string]string{"message": "If the account needs verification, an email has been sent"}), http.StatusOK)
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys access tokens are verified with, including keys being rotated out. Empty when tokens are signed with HS256.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} pkg.JWKS "Key set"
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	// Verifiers cache the set, rotated keys are published well before they sign anything
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	pkg.WriteJSON(w, http.StatusOK, h.config.JWT.Keys.JWKS())
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/afrianjunior/justpayd/internal/pkg"
 )
@@ -11,6 +12,34 @@ import (
 type AuthRepository interface {
 	// GetUserByEmail retrieves a user by email for authentication
 	GetUserByEmail(ctx context.Context, email string) (*pkg.User, error)
+	// GetPasswordHash retrieves the stored password hash of a user, empty if none is set
+	GetPasswordHash(ctx context.Context, userID int) (string, error)
+	// UpdatePasswordHash stores a new password hash for a user
+	UpdatePasswordHash(ctx context.Context, userID int, hash string) error
+	// CreateSession stores a new refresh token session
+	CreateSession(ctx context.Context, session *pkg.Session) error
+	// GetSessionByRefreshTokenHash retrieves the session whose current refresh token matches the hash
+	GetSessionByRefreshTokenHash(ctx context.Context, hash string) (*pkg.Session, error)
+	// GetSessionByPreviousTokenHash retrieves the session whose already rotated refresh token matches the hash
+	GetSessionByPreviousTokenHash(ctx context.Context, hash string) (*pkg.Session, error)
+	// RotateSession replaces the refresh token of a session if it still holds oldHash
+	RotateSession(ctx context.Context, id string, oldHash string, newHash string, expiresAt time.Time) error
+	// RevokeSession revokes a single session
+	RevokeSession(ctx context.Context, id string) error
+	// RevokeUserSessions revokes every active session of a user
+	RevokeUserSessions(ctx context.Context, userID int) error
+	// CreateUser inserts a user whose email is not verified yet and returns its ID
+	CreateUser(ctx context.Context, name string, email string, passwordHash string, role string) (int, error)
+	// DeleteUnverifiedUser removes a user whose email was never verified, with their verification tokens
+	DeleteUnverifiedUser(ctx context.Context, userID int) error
+	// CreateSSOUser inserts a user provisioned from an SSO login, without a password and with a verified email
+	CreateSSOUser(ctx context.Context, name string, email string, role string) (int, error)
+	// CreateEmailVerification stores a new verification token, invalidating the user's previous ones
+	CreateEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// GetEmailVerification retrieves an email verification by its token hash
+	GetEmailVerification(ctx context.Context, tokenHash string) (*EmailVerification, error)
+	// MarkEmailVerified consumes the verification token and marks the user's email as verified
+	MarkEmailVerified(ctx context.Context, verificationID int, userID int) error
 }
 
 // authRepository is the implementation of AuthRepository interface
@@ -26,8 +55,8 @@ func NewAuthRepository(db *sql.DB) AuthRepository {
 // GetUserByEmail retrieves a user by email for authentication
 func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*pkg.User, error) {
 	var user pkg.User
-	err := r.db.QueryRowContext(ctx, "SELECT id, name, email, role, created_at FROM users WHERE email = ?", email).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt)
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT id, name, email, role, status, created_at, email_verified_at FROM users WHERE email = ?", email).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Status, &user.CreatedAt, &user.EmailVerifiedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, pkg.ErrNotFound
@@ -36,3 +65,236 @@ func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*pkg
 	}
 	return &user, nil
 }
+
+// GetPasswordHash retrieves the stored password hash of a user, empty if none is set
+func (r *authRepository) GetPasswordHash(ctx context.Context, userID int) (string, error) {
+	var hash sql.NullString
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = ?", userID).Scan(&hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", pkg.ErrNotFound
+		}
+		return "", err
+	}
+	return hash.String, nil
+}
+
+// UpdatePasswordHash stores a new password hash for a user
+func (r *authRepository) UpdatePasswordHash(ctx context.Context, userID int, hash string) error {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", hash, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
+
+// CreateSession stores a new refresh token session
+func (r *authRepository) CreateSession(ctx context.Context, session *pkg.Session) error {
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, refresh_token_hash, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, session.ID, session.UserID, session.RefreshTokenHash, session.ExpiresAt.UTC())
+	return err
+}
+
+// GetSessionByRefreshTokenHash retrieves the session whose current refresh token matches the hash
+func (r *authRepository) GetSessionByRefreshTokenHash(ctx context.Context, hash string) (*pkg.Session, error) {
+	return r.getSession(ctx, "SELECT id, user_id, refresh_token_hash, expires_at, revoked_at, last_used_at, created_at FROM sessions WHERE refresh_token_hash = ?", hash)
+}
+
+// GetSessionByPreviousTokenHash retrieves the session whose already rotated refresh token matches the hash
+func (r *authRepository) GetSessionByPreviousTokenHash(ctx context.Context, hash string) (*pkg.Session, error) {
+	return r.getSession(ctx, "SELECT id, user_id, refresh_token_hash, expires_at, revoked_at, last_used_at, created_at FROM sessions WHERE previous_token_hash = ?", hash)
+}
+
+func (r *authRepository) getSession(ctx context.Context, query string, args ...interface{}) (*pkg.Session, error) {
+	var session pkg.Session
+	var revokedAt, lastUsedAt sql.NullTime
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshTokenHash,
+		&session.ExpiresAt,
+		&revokedAt,
+		&lastUsedAt,
+		&session.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		session.LastUsedAt = &lastUsedAt.Time
+	}
+	return &session, nil
+}
+
+// RotateSession replaces the refresh token of a session if it still holds oldHash
+func (r *authRepository) RotateSession(ctx context.Context, id string, oldHash string, newHash string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, `
+		UPDATE sessions
+		SET refresh_token_hash = ?, previous_token_hash = ?, expires_at = ?, last_used_at = ?
+		WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL
+	`, newHash, oldHash, expiresAt.UTC(), now, id, oldHash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// Another request rotated or revoked the session first
+	if rowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeSession revokes a single session
+func (r *authRepository) RevokeSession(ctx context.Context, id string) error {
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), id)
+	return err
+}
+
+// RevokeUserSessions revokes every active session of a user
+func (r *authRepository) RevokeUserSessions(ctx context.Context, userID int) error {
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	return err
+}
+
+// CreateUser inserts a user whose email is not verified yet and returns its ID
+func (r *authRepository) CreateUser(ctx context.Context, name string, email string, passwordHash string, role string) (int, error) {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx,
+		"INSERT INTO users (name, email, role, password_hash) VALUES (?, ?, ?, ?)",
+		name, email, role, passwordHash,
+	)
+	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return 0, pkg.NewConflictError("email is already registered")
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// CreateSSOUser inserts a user provisioned from an SSO login, without a password and with a verified email
+func (r *authRepository) CreateSSOUser(ctx context.Context, name string, email string, role string) (int, error) {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx,
+		"INSERT INTO users (name, email, role, email_verified_at) VALUES (?, ?, ?, ?)",
+		name, email, role, time.Now().UTC(),
+	)
+	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return 0, pkg.NewConflictError("email is already registered")
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// CreateEmailVerification stores a new verification token, invalidating the user's previous ones
+func (r *authRepository) CreateEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	return pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		now := time.Now().UTC()
+		_, err := tx.ExecContext(ctx, "UPDATE email_verifications SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO email_verifications (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+			userID, tokenHash, expiresAt.UTC(),
+		)
+		return err
+	})
+}
+
+// DeleteUnverifiedUser removes a user whose email was never verified, with their verification
+// tokens. Verified users are left alone.
+func (r *authRepository) DeleteUnverifiedUser(ctx context.Context, userID int) error {
+	return pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ? AND email_verified_at IS NULL", userID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return pkg.ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM email_verifications WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+// GetEmailVerification retrieves an email verification by its token hash
+func (r *authRepository) GetEmailVerification(ctx context.Context, tokenHash string) (*EmailVerification, error) {
+	var verification EmailVerification
+	var usedAt sql.NullTime
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx,
+		"SELECT id, user_id, expires_at, used_at FROM email_verifications WHERE token_hash = ?",
+		tokenHash,
+	).Scan(&verification.ID, &verification.UserID, &verification.ExpiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		verification.UsedAt = &usedAt.Time
+	}
+	return &verification, nil
+}
+
+// MarkEmailVerified consumes the verification token and marks the user's email as verified
+func (r *authRepository) MarkEmailVerified(ctx context.Context, verificationID int, userID int) error {
+	return pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		now := time.Now().UTC()
+		result, err := tx.ExecContext(ctx, "UPDATE email_verifications SET used_at = ? WHERE id = ? AND used_at IS NULL", now, verificationID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// The token was consumed by a concurrent request
+		if rowsAffected == 0 {
+			return pkg.ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", now, userID)
+		return err
+	})
+}
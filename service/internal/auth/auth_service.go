@@ -2,40 +2,387 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/afrianjunior/justpayd/internal/mailer"
 	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/sso"
 )
 
 // AuthService provides authentication-related operations
 type AuthService interface {
 	// VerifyCredentials verifies user credentials and returns a user if valid
-	VerifyCredentials(ctx context.Context, email string) (*pkg.User, error)
-	// GenerateToken generates a JWT token for the authenticated user
-	GenerateToken(userID int) (string, error)
+	VerifyCredentials(ctx context.Context, email string, password string) (*pkg.User, error)
+	// VerifyIDToken verifies an SSO ID token and returns the user it belongs to, provisioning one if allowed
+	VerifyIDToken(ctx context.Context, idToken string) (*pkg.User, error)
+	// CreateSession starts a new session and issues an access and refresh token pair
+	CreateSession(ctx context.Context, userID int) (*LoginResponse, error)
+	// RefreshSession rotates a refresh token and issues a new token pair for the same session
+	RefreshSession(ctx context.Context, refreshToken string) (*LoginResponse, error)
+	// Logout revokes the given session, or every session of the user when allSessions is set
+	Logout(ctx context.Context, userID int, sessionID string, allSessions bool) error
+	// ChangePassword sets or changes the password of a user
+	ChangePassword(ctx context.Context, userID int, req *ChangePasswordRequest) error
+	// Register creates an unverified worker account and emails a verification link
+	Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error)
+	// VerifyEmail consumes a verification token and marks the account as verified
+	VerifyEmail(ctx context.Context, token string) error
+	// ResendVerification emails a new verification link to an unverified account
+	ResendVerification(ctx context.Context, email string) error
 }
 
 // authService is the implementation of AuthService interface
 type authService struct {
 	authRepository AuthRepository
+	mailer         mailer.Mailer
+	verifier       sso.Verifier
+	unitOfWork     pkg.UnitOfWork
 	config         *pkg.Config
 }
 
 // NewAuthService creates a new authentication service
-func NewAuthService(authRepository AuthRepository, config *pkg.Config) AuthService {
+func NewAuthService(authRepository AuthRepository, mailer mailer.Mailer, verifier sso.Verifier, unitOfWork pkg.UnitOfWork, config *pkg.Config) AuthService {
 	return &authService{
 		authRepository: authRepository,
+		mailer:         mailer,
+		verifier:       verifier,
+		unitOfWork:     unitOfWork,
 		config:         config,
 	}
 }
 
-// VerifyCredentials verifies user credentials and returns a user if valid
-func (s *authService) VerifyCredentials(ctx context.Context, email string) (*pkg.User, error) {
-	// In a real application, you would implement password hashing and verification
-	// For demo purposes, we're just checking if the user exists
+// VerifyCredentials verifies user credentials and returns a user if valid. Whether the
+// account is deactivated or unverified is only told to callers who got the password right,
+// so the errors can't be used to probe accounts.
+func (s *authService) VerifyCredentials(ctx context.Context, email string, password string) (*pkg.User, error) {
+	user, err := s.authRepository.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return nil, pkg.NewUnauthorizedError("invalid credentials")
+		}
+		return nil, err
+	}
+
+	hash, err := s.authRepository.GetPasswordHash(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	// Accounts without a password can only use the email-only path, if it is enabled
+	case hash == "":
+		if !s.config.Auth.AllowEmailOnlyLogin || password != "" {
+			return nil, pkg.NewUnauthorizedError("invalid credentials")
+		}
+	default:
+		if err := pkg.CheckPassword(hash, password); err != nil {
+			if errors.Is(err, pkg.ErrPasswordMismatch) {
+				return nil, pkg.NewUnauthorizedError("invalid credentials")
+			}
+			return nil, err
+		}
+	}
+
+	if !user.IsActive() {
+		return nil, pkg.NewUnauthorizedError("account is deactivated")
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, pkg.NewUnauthorizedError("email address has not been verified")
+	}
+	return user, nil
+}
+
+// VerifyIDToken verifies an SSO ID token and returns the user it belongs to, provisioning one if allowed
+func (s *authService) VerifyIDToken(ctx context.Context, idToken string) (*pkg.User, error) {
+	if idToken == "" {
+		return nil, pkg.NewValidationError("id_token is required")
+	}
+
+	identity, err := s.verifier.Verify(ctx, idToken)
+	if err != nil {
+		if errors.Is(err, sso.ErrDisabled) {
+			return nil, pkg.NewForbiddenError("sso login is not enabled")
+		}
+		return nil, err
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, pkg.NewUnauthorizedError("id token has no verified email")
+	}
+
+	email, err := pkg.NormalizeEmail(identity.Email)
+	if err != nil {
+		return nil, pkg.NewUnauthorizedError("id token has an invalid email")
+	}
+
+	user, err := s.authRepository.GetUserByEmail(ctx, email)
+	if errors.Is(err, pkg.ErrNotFound) {
+		if !s.config.OIDC.AutoProvision {
+			return nil, pkg.NewUnauthorizedError("no account exists for this email")
+		}
+		user, err = s.provisionSSOUser(ctx, identity.Name, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive() {
+		return nil, pkg.NewUnauthorizedError("account is deactivated")
+	}
+	return user, nil
+}
+
+func (s *authService) provisionSSOUser(ctx context.Context, name string, email string) (*pkg.User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = email[:strings.Index(email, "@")]
+	}
+
+	if _, err := s.authRepository.CreateSSOUser(ctx, name, email, pkg.RoleWorker); err != nil {
+		return nil, err
+	}
 	return s.authRepository.GetUserByEmail(ctx, email)
 }
 
-// GenerateToken generates a JWT token for the authenticated user
-func (s *authService) GenerateToken(userID int) (string, error) {
-	return pkg.GenerateJWT(userID, s.config)
+// CreateSession starts a new session and issues an access and refresh token pair
+func (s *authService) CreateSession(ctx context.Context, userID int) (*LoginResponse, error) {
+	sessionID, err := pkg.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &pkg.Session{
+		ID:               sessionID,
+		UserID:           userID,
+		RefreshTokenHash: pkg.HashToken(refreshToken),
+		ExpiresAt:        s.refreshExpiry(),
+	}
+	if err := s.authRepository.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(userID, sessionID, refreshToken)
+}
+
+// RefreshSession rotates a refresh token and issues a new token pair for the same session
+func (s *authService) RefreshSession(ctx context.Context, refreshToken string) (*LoginResponse, error) {
+	if refreshToken == "" {
+		return nil, pkg.NewUnauthorizedError("invalid refresh token")
+	}
+	hash := pkg.HashToken(refreshToken)
+
+	session, err := s.authRepository.GetSessionByRefreshTokenHash(ctx, hash)
+	if err != nil {
+		if !errors.Is(err, pkg.ErrNotFound) {
+			return nil, err
+		}
+
+		// A rotated token being presented again means it leaked, so kill the whole session
+		reused, err := s.authRepository.GetSessionByPreviousTokenHash(ctx, hash)
+		if err == nil {
+			if err := s.authRepository.RevokeSession(ctx, reused.ID); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, pkg.ErrNotFound) {
+			return nil, err
+		}
+		return nil, pkg.NewUnauthorizedError("invalid refresh token")
+	}
+
+	if session.RevokedAt != nil {
+		return nil, pkg.NewUnauthorizedError("session has been revoked")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, pkg.NewUnauthorizedError("refresh token has expired")
+	}
+
+	newRefreshToken, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.authRepository.RotateSession(ctx, session.ID, hash, pkg.HashToken(newRefreshToken), s.refreshExpiry())
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return nil, pkg.NewUnauthorizedError("invalid refresh token")
+		}
+		return nil, err
+	}
+
+	return s.issueTokens(session.UserID, session.ID, newRefreshToken)
+}
+
+// Logout revokes the given session, or every session of the user when allSessions is set
+func (s *authService) Logout(ctx context.Context, userID int, sessionID string, allSessions bool) error {
+	if allSessions {
+		return s.authRepository.RevokeUserSessions(ctx, userID)
+	}
+	return s.authRepository.RevokeSession(ctx, sessionID)
+}
+
+func (s *authService) issueTokens(userID int, sessionID string, refreshToken string) (*LoginResponse, error) {
+	token, err := pkg.GenerateJWT(userID, sessionID, s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.config.JWT.Expiration * 60,
+		UserID:       userID,
+	}, nil
+}
+
+func (s *authService) refreshExpiry() time.Time {
+	return time.Now().Add(time.Duration(s.config.JWT.RefreshExpiration) * time.Minute)
+}
+
+// ChangePassword sets or changes the password of a user
+func (s *authService) ChangePassword(ctx context.Context, userID int, req *ChangePasswordRequest) error {
+	currentHash, err := s.authRepository.GetPasswordHash(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Changing an existing password requires proving knowledge of the current one
+	if currentHash != "" {
+		if err := pkg.CheckPassword(currentHash, req.CurrentPassword); err != nil {
+			if errors.Is(err, pkg.ErrPasswordMismatch) {
+				return pkg.NewUnauthorizedError("current password is incorrect")
+			}
+			return err
+		}
+	}
+
+	newHash, err := pkg.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.authRepository.UpdatePasswordHash(ctx, userID, newHash)
+}
+
+// Register creates an unverified worker account and emails a verification link. The account
+// is removed again when the link can't be sent, so a failed email doesn't leave behind an
+// account blocking the email from registering again. The email is sent after the account is
+// committed, a slow mail server must not hold the database's write lock.
+func (s *authService) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	if !s.config.Auth.AllowRegistration {
+		return nil, pkg.NewForbiddenError("registration is disabled")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, pkg.NewValidationError("name is required")
+	}
+	email, err := pkg.NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := pkg.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID int
+	var message *mailer.Message
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		var err error
+		userID, err = s.authRepository.CreateUser(ctx, name, email, passwordHash, pkg.RoleWorker)
+		if err != nil {
+			return err
+		}
+		message, err = s.createVerification(ctx, userID, name, email)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mailer.Send(ctx, message); err != nil {
+		if deleteErr := s.authRepository.DeleteUnverifiedUser(ctx, userID); deleteErr != nil {
+			return nil, errors.Join(err, deleteErr)
+		}
+		return nil, err
+	}
+	return &RegisterResponse{UserID: userID, Email: email}, nil
+}
+
+// VerifyEmail consumes a verification token and marks the account as verified
+func (s *authService) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return pkg.NewValidationError("token is required")
+	}
+
+	verification, err := s.authRepository.GetEmailVerification(ctx, pkg.HashToken(token))
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return pkg.NewValidationError("verification link is invalid")
+		}
+		return err
+	}
+	if verification.UsedAt != nil {
+		return pkg.NewValidationError("verification link has already been used")
+	}
+	if time.Now().After(verification.ExpiresAt) {
+		return pkg.NewValidationError("verification link has expired")
+	}
+
+	err = s.authRepository.MarkEmailVerified(ctx, verification.ID, verification.UserID)
+	if errors.Is(err, pkg.ErrNotFound) {
+		return pkg.NewValidationError("verification link has already been used")
+	}
+	return err
+}
+
+// ResendVerification emails a new verification link if the account exists and is unverified.
+// It reports success either way so it cannot be used to discover registered emails.
+func (s *authService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.authRepository.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerifiedAt != nil || !user.IsActive() {
+		return nil
+	}
+
+	message, err := s.createVerification(ctx, user.ID, user.Name, user.Email)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, message)
+}
+
+// createVerification stores a new verification token for the user and returns the email
+// carrying its link, for the caller to send once the token is committed
+func (s *authService) createVerification(ctx context.Context, userID int, name string, email string) (*mailer.Message, error) {
+	token, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.config.Auth.VerificationExpiration) * time.Minute)
+	if err := s.authRepository.CreateEmailVerification(ctx, userID, pkg.HashToken(token), expiresAt); err != nil {
+		return nil, err
+	}
+
+	link := fmt.Sprintf("%s/api/auth/verify-email?token=%s", strings.TrimRight(s.config.BaseURL, "/"), url.QueryEscape(token))
+	return &mailer.Message{
+		To:      email,
+		Subject: "Verify your JustPayd account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires on %s.\n",
+			name, link, expiresAt.UTC().Format(time.RFC1123),
+		),
+	}, nil
 }
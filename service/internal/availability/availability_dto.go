@@ -0,0 +1,78 @@
+package availability
+
+import (
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// Possible status values for time off
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// weekdays maps the day names of the API to the weekdays stored
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Window is a weekly period a worker can work in. Times are read in the zone of each
+// shift's location.
+type Window struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	Day       string `json:"day" example:"monday"`
+	StartTime string `json:"start_time" example:"09:00:00"`
+	EndTime   string `json:"end_time" example:"17:00:00"`
+	// Overnight is set when the window ends on the next day
+	Overnight bool `json:"overnight"`
+	// Weekday is Day as stored
+	Weekday time.Weekday `json:"-"`
+}
+
+type WindowRequest struct {
+	Day       string `json:"day" example:"monday"`
+	StartTime string `json:"start_time" example:"09:00"`
+	EndTime   string `json:"end_time" example:"17:00"`
+}
+
+// SetWindowsRequest replaces all weekly windows of a worker. An empty list means the
+// worker is available at any time.
+type SetWindowsRequest struct {
+	Windows []WindowRequest `json:"windows"`
+}
+
+// TimeOff is a period a worker asked not to be scheduled in
+type TimeOff struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+	// StartsOn and EndsOn are the first and last day off, in the zone of each shift's location
+	StartsOn   string     `json:"starts_on" example:"2025-08-11"`
+	EndsOn     string     `json:"ends_on" example:"2025-08-15"`
+	Reason     string     `json:"reason" example:"Family holiday"`
+	Status     string     `json:"status"`
+	ReviewedBy *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type TimeOffRequest struct {
+	StartsOn string `json:"starts_on" example:"2025-08-11"`
+	EndsOn   string `json:"ends_on" example:"2025-08-15"`
+	Reason   string `json:"reason" example:"Family holiday"`
+}
+
+// TimeOffFilter is a list query narrowed further by status
+type TimeOffFilter struct {
+	pkg.ListQuery
+	Status string
+}
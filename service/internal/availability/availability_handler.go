@@ -0,0 +1,345 @@
+package availability
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type AvailabilityHandler struct {
+	AvailabilityService AvailabilityService
+	logger              *zap.SugaredLogger
+}
+
+func NewAvailabilityHandler(availabilityService AvailabilityService, logger *zap.SugaredLogger) *AvailabilityHandler {
+	return &AvailabilityHandler{
+		AvailabilityService: availabilityService,
+		logger:              logger,
+	}
+}
+
+func (h *AvailabilityHandler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermAvailabilityManage))
+		r.Get("/me/windows", h.GetMyWindows)
+		r.Put("/me/windows", h.SetMyWindows)
+		r.Get("/me/time_off", h.GetMyTimeOff)
+		r.Post("/me/time_off", h.RequestTimeOff)
+		r.Delete("/me/time_off/{id}", h.CancelTimeOff)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermTimeOffReview))
+		r.Get("/users/{id}/windows", h.GetUserWindows)
+		r.Get("/time_off", h.GetTimeOff)
+		r.Put("/time_off/approve/{id}", h.ApproveTimeOff)
+		r.Put("/time_off/reject/{id}", h.RejectTimeOff)
+	})
+}
+
+// GetMyWindows godoc
+// @Summary Get my weekly availability
+// @Description Lists the weekly windows the authenticated worker can work in. No windows means available at any time.
+// @Tags availability
+// @Produce json
+// @Success 200 {object} pkg.BaseResponse{data=[]Window} "Successfully retrieved the windows"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/me/windows [get]
+func (h *AvailabilityHandler) GetMyWindows(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	h.writeWindows(w, r, userID)
+}
+
+// SetMyWindows godoc
+// @Summary Replace my weekly availability
+// @Description Replaces all weekly windows of the authenticated worker. A window ending at or before its start runs overnight into the next day. Times are read in the zone of each shift's location. An empty list makes the worker available at any time.
+// @Tags availability
+// @Accept json
+// @Produce json
+// @Param payload body SetWindowsRequest true "Weekly windows"
+// @Success 200 {object} pkg.BaseResponse{data=[]Window} "Windows replaced successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 422 {object} pkg.BaseResponse "Invalid windows, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/me/windows [put]
+func (h *AvailabilityHandler) SetMyWindows(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	var payload SetWindowsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	windows, err := h.AvailabilityService.SetWindows(r.Context(), userID, &payload)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error setting the windows of user %d: %v", userID, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update availability"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(windows))
+}
+
+// GetUserWindows godoc
+// @Summary Get the weekly availability of a worker
+// @Description Admin lists the weekly windows a worker can work in. No windows means available at any time.
+// @Tags availability
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} pkg.BaseResponse{data=[]Window} "Successfully retrieved the windows"
+// @Failure 400 {object} pkg.BaseResponse "Invalid user ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/users/{id}/windows [get]
+func (h *AvailabilityHandler) GetUserWindows(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid user ID"))
+		return
+	}
+	h.writeWindows(w, r, userID)
+}
+
+func (h *AvailabilityHandler) writeWindows(w http.ResponseWriter, r *http.Request, userID int) {
+	windows, err := h.AvailabilityService.GetWindows(r.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("Error getting the windows of user %d: %v", userID, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve availability"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(windows))
+}
+
+// GetMyTimeOff godoc
+// @Summary List my time off
+// @Description Lists the time off the authenticated worker asked for, a page at a time
+// @Tags availability
+// @Produce json
+// @Param status query string false "Filter by status (pending, approved, rejected)"
+// @Param from query string false "Only time off ending on or after this day, YYYY-MM-DD"
+// @Param to query string false "Only time off starting on or before this day, YYYY-MM-DD"
+// @Param sort query string false "starts_on, created_at or id, prefixed with - for descending" default(starts_on)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} pkg.BaseResponse{data=[]TimeOff} "Successfully retrieved time off"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/me/time_off [get]
+func (h *AvailabilityHandler) GetMyTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	h.writeTimeOff(w, r, &userID)
+}
+
+// GetTimeOff godoc
+// @Summary List time off
+// @Description Admin lists the time off workers asked for, a page at a time
+// @Tags availability
+// @Produce json
+// @Param status query string false "Filter by status (pending, approved, rejected)"
+// @Param user_id query integer false "Filter by the worker's ID"
+// @Param from query string false "Only time off ending on or after this day, YYYY-MM-DD"
+// @Param to query string false "Only time off starting on or before this day, YYYY-MM-DD"
+// @Param sort query string false "starts_on, created_at or id, prefixed with - for descending" default(starts_on)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} pkg.BaseResponse{data=[]TimeOff} "Successfully retrieved time off"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/time_off [get]
+func (h *AvailabilityHandler) GetTimeOff(w http.ResponseWriter, r *http.Request) {
+	h.writeTimeOff(w, r, nil)
+}
+
+// writeTimeOff lists time off, only the user's own when userID is set
+func (h *AvailabilityHandler) writeTimeOff(w http.ResponseWriter, r *http.Request, userID *int) {
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+	if userID != nil {
+		q.UserID = userID
+	}
+	filter := &TimeOffFilter{ListQuery: *q, Status: r.URL.Query().Get("status")}
+
+	timeOff, page, err := h.AvailabilityService.GetTimeOff(r.Context(), filter)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting time off: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve time off"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(timeOff, page))
+}
+
+// RequestTimeOff godoc
+// @Summary Ask for time off
+// @Description The authenticated worker asks not to be scheduled from starts_on to ends_on, both inclusive. It blocks assignments once an admin approves it.
+// @Tags availability
+// @Accept json
+// @Produce json
+// @Param payload body TimeOffRequest true "Days off"
+// @Success 201 {object} pkg.BaseResponse{data=TimeOff} "Time off requested successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 422 {object} pkg.BaseResponse "Invalid dates, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/me/time_off [post]
+func (h *AvailabilityHandler) RequestTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	var payload TimeOffRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	timeOff, err := h.AvailabilityService.RequestTimeOff(r.Context(), userID, &payload)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error requesting time off for user %d: %v", userID, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to request time off"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(timeOff))
+}
+
+// CancelTimeOff godoc
+// @Summary Withdraw my time off
+// @Description The authenticated worker withdraws time off. Pending time off can be withdrawn at any time, reviewed time off only before it starts.
+// @Tags availability
+// @Produce json
+// @Param id path int true "Time off ID"
+// @Success 200 {object} pkg.BaseResponse "Time off withdrawn successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid time off ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 404 {object} pkg.BaseResponse "Time off not found"
+// @Failure 409 {object} pkg.BaseResponse "Time off has already started"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/me/time_off/{id} [delete]
+func (h *AvailabilityHandler) CancelTimeOff(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid time off ID"))
+		return
+	}
+
+	if err := h.AvailabilityService.CancelTimeOff(r.Context(), userID, id); err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error withdrawing time off %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to withdraw time off"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(nil))
+}
+
+// ApproveTimeOff godoc
+// @Summary Approve time off
+// @Description Admin approves pending time off. The worker can't be assigned shifts on those days afterwards unless forced.
+// @Tags availability
+// @Produce json
+// @Param id path int true "Time off ID"
+// @Success 200 {object} pkg.BaseResponse{data=TimeOff} "Time off approved successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid time off ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Time off not found"
+// @Failure 409 {object} pkg.BaseResponse "Time off has already been reviewed"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/time_off/approve/{id} [put]
+func (h *AvailabilityHandler) ApproveTimeOff(w http.ResponseWriter, r *http.Request) {
+	h.reviewTimeOff(w, r, true)
+}
+
+// RejectTimeOff godoc
+// @Summary Reject time off
+// @Description Admin rejects pending time off
+// @Tags availability
+// @Produce json
+// @Param id path int true "Time off ID"
+// @Success 200 {object} pkg.BaseResponse{data=TimeOff} "Time off rejected successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid time off ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Time off not found"
+// @Failure 409 {object} pkg.BaseResponse "Time off has already been reviewed"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /availability/time_off/reject/{id} [put]
+func (h *AvailabilityHandler) RejectTimeOff(w http.ResponseWriter, r *http.Request) {
+	h.reviewTimeOff(w, r, false)
+}
+
+func (h *AvailabilityHandler) reviewTimeOff(w http.ResponseWriter, r *http.Request, approve bool) {
+	reviewerID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid time off ID"))
+		return
+	}
+
+	timeOff, err := h.AvailabilityService.ReviewTimeOff(r.Context(), id, reviewerID, approve)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error reviewing time off %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to review time off"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(timeOff))
+}
@@ -0,0 +1,292 @@
+package availability
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// AvailabilityRepository defines the interface for availability data operations
+type AvailabilityRepository interface {
+	GetWindows(ctx context.Context, userID int) ([]Window, error)
+	SetWindows(ctx context.Context, userID int, windows []Window) ([]Window, error)
+	CreateTimeOff(ctx context.Context, userID int, req *TimeOffRequest) (*TimeOff, error)
+	GetTimeOff(ctx context.Context, filter *TimeOffFilter) ([]TimeOff, *pkg.Pagination, error)
+	GetTimeOffByID(ctx context.Context, id int) (*TimeOff, error)
+	DeleteTimeOff(ctx context.Context, id int) error
+	ReviewTimeOff(ctx context.Context, id int, status string, reviewerID int) (*TimeOff, error)
+	GetApprovedTimeOff(ctx context.Context, userID int, from string, to string) ([]TimeOff, error)
+}
+
+type availabilityRepository struct {
+	db *sql.DB
+}
+
+// NewAvailabilityRepository creates a new instance of AvailabilityRepository
+func NewAvailabilityRepository(db *sql.DB) AvailabilityRepository {
+	return &availabilityRepository{db: db}
+}
+
+func (r *availabilityRepository) GetWindows(ctx context.Context, userID int) ([]Window, error) {
+	query := `
+		SELECT id, user_id, weekday, start_time, end_time
+		FROM availability_windows
+		WHERE user_id = ?
+		ORDER BY weekday, start_time, id
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []Window{}
+	for rows.Next() {
+		var window Window
+		if err := rows.Scan(&window.ID, &window.UserID, &window.Weekday, &window.StartTime, &window.EndTime); err != nil {
+			return nil, err
+		}
+		setDay(&window)
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+// SetWindows replaces the weekly windows of the user in one transaction
+func (r *availabilityRepository) SetWindows(ctx context.Context, userID int, windows []Window) ([]Window, error) {
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM availability_windows WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+		for _, window := range windows {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO availability_windows (user_id, weekday, start_time, end_time) VALUES (?, ?, ?, ?)",
+				userID, int(window.Weekday), window.StartTime, window.EndTime,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetWindows(ctx, userID)
+}
+
+// setDay fills in the fields derived from the stored weekday and times
+func setDay(window *Window) {
+	for name, weekday := range weekdays {
+		if weekday == window.Weekday {
+			window.Day = name
+		}
+	}
+	window.Overnight = window.EndTime <= window.StartTime
+}
+
+const timeOffQuery = `
+		SELECT
+			t.id,
+			t.user_id,
+			u.name as user_name,
+			t.starts_on,
+			t.ends_on,
+			t.reason,
+			t.status,
+			t.reviewed_by,
+			t.reviewed_at,
+			t.created_at
+		FROM time_off t
+		JOIN users u ON t.user_id = u.id
+	`
+
+// timeOffList applies list queries to timeOffQuery. from and to are handled by GetTimeOff,
+// they match time off overlapping the range rather than starting in it.
+var timeOffList = &pkg.ListSpec[TimeOff]{
+	Sorts: map[string]pkg.SortKey[TimeOff]{
+		"starts_on":  {Column: "t.starts_on", Value: func(t *TimeOff) interface{} { return t.StartsOn }},
+		"created_at": {Column: "t.created_at", Value: func(t *TimeOff) interface{} { return pkg.FormatTimestamp(t.CreatedAt) }},
+		"id":         {Column: "t.id", Value: func(t *TimeOff) interface{} { return t.ID }},
+	},
+	DefaultSort: "starts_on",
+	IDColumn:    "t.id",
+	ID:          func(t *TimeOff) int { return t.ID },
+	User:        "t.user_id",
+}
+
+func (r *availabilityRepository) CreateTimeOff(ctx context.Context, userID int, req *TimeOffRequest) (*TimeOff, error) {
+	query := `
+		INSERT INTO time_off (user_id, starts_on, ends_on, reason, status)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, userID, req.StartsOn, req.EndsOn, req.Reason, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTimeOffByID(ctx, int(id))
+}
+
+func (r *availabilityRepository) GetTimeOff(ctx context.Context, filter *TimeOffFilter) ([]TimeOff, *pkg.Pagination, error) {
+	var args []interface{}
+	where := []string{}
+
+	if filter.Status != "" {
+		where = append(where, "t.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.From != "" {
+		where = append(where, "t.ends_on >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		where = append(where, "t.starts_on <= ?")
+		args = append(args, filter.To)
+	}
+
+	q := filter.ListQuery
+	q.From, q.To = "", ""
+	clause, args, err := timeOffList.Build(&q, where, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, timeOffQuery+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var timeOff []TimeOff
+	for rows.Next() {
+		t, err := scanTimeOff(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		timeOff = append(timeOff, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	timeOff, page := timeOffList.Page(&q, timeOff)
+	return timeOff, page, nil
+}
+
+// GetTimeOffByID returns pkg.ErrNotFound when there is no time off with the ID
+func (r *availabilityRepository) GetTimeOffByID(ctx context.Context, id int) (*TimeOff, error) {
+	return scanTimeOff(pkg.Conn(ctx, r.db).QueryRowContext(ctx, timeOffQuery+" WHERE t.id = ?", id))
+}
+
+func (r *availabilityRepository) DeleteTimeOff(ctx context.Context, id int) error {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, "DELETE FROM time_off WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
+
+// ReviewTimeOff approves or rejects pending time off. Time off that was already reviewed
+// is left as it is and reported as a conflict.
+func (r *availabilityRepository) ReviewTimeOff(ctx context.Context, id int, status string, reviewerID int) (*TimeOff, error) {
+	query := `
+		UPDATE time_off
+		SET status = ?, reviewed_by = ?, reviewed_at = ?
+		WHERE id = ? AND status = ?
+	`
+
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, status, reviewerID, pkg.FormatTimestamp(time.Now()), id, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	timeOff, err := r.GetTimeOffByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, pkg.NewConflictError("time off has already been " + timeOff.Status)
+	}
+	return timeOff, nil
+}
+
+// GetApprovedTimeOff lists the user's approved time off overlapping the dates from to to
+func (r *availabilityRepository) GetApprovedTimeOff(ctx context.Context, userID int, from string, to string) ([]TimeOff, error) {
+	query := timeOffQuery + `
+		WHERE t.user_id = ? AND t.status = ? AND t.starts_on <= ? AND t.ends_on >= ?
+		ORDER BY t.starts_on, t.id
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, userID, StatusApproved, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var timeOff []TimeOff
+	for rows.Next() {
+		t, err := scanTimeOff(rows)
+		if err != nil {
+			return nil, err
+		}
+		timeOff = append(timeOff, *t)
+	}
+	return timeOff, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTimeOff(row rowScanner) (*TimeOff, error) {
+	var t TimeOff
+	var startsOn, endsOn time.Time
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+	if err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.UserName,
+		&startsOn,
+		&endsOn,
+		&t.Reason,
+		&t.Status,
+		&reviewedBy,
+		&reviewedAt,
+		&t.CreatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+	t.StartsOn = startsOn.Format(pkg.DateLayout)
+	t.EndsOn = endsOn.Format(pkg.DateLayout)
+	if reviewedBy.Valid {
+		id := int(reviewedBy.Int64)
+		t.ReviewedBy = &id
+	}
+	if reviewedAt.Valid {
+		t.ReviewedAt = &reviewedAt.Time
+	}
+	return &t, nil
+}
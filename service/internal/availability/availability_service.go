@@ -0,0 +1,201 @@
+package availability
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// AvailabilityService defines the interface for availability business logic
+type AvailabilityService interface {
+	GetWindows(ctx context.Context, userID int) ([]Window, error)
+	SetWindows(ctx context.Context, userID int, req *SetWindowsRequest) ([]Window, error)
+	GetTimeOff(ctx context.Context, filter *TimeOffFilter) ([]TimeOff, *pkg.Pagination, error)
+	RequestTimeOff(ctx context.Context, userID int, req *TimeOffRequest) (*TimeOff, error)
+	CancelTimeOff(ctx context.Context, userID int, id int) error
+	ReviewTimeOff(ctx context.Context, id int, reviewerID int, approve bool) (*TimeOff, error)
+	CheckAvailability(ctx context.Context, userID int, start time.Time, end time.Time) ([]pkg.ScheduleConflict, error)
+}
+
+// maxWindows caps the weekly windows of a worker
+const maxWindows = 50
+
+type availabilityService struct {
+	availabilityRepository AvailabilityRepository
+}
+
+// NewAvailabilityService creates a new instance of AvailabilityService
+func NewAvailabilityService(availabilityRepository AvailabilityRepository) AvailabilityService {
+	return &availabilityService{availabilityRepository: availabilityRepository}
+}
+
+func (s *availabilityService) GetWindows(ctx context.Context, userID int) ([]Window, error) {
+	return s.availabilityRepository.GetWindows(ctx, userID)
+}
+
+// SetWindows replaces the weekly windows of the user
+func (s *availabilityService) SetWindows(ctx context.Context, userID int, req *SetWindowsRequest) ([]Window, error) {
+	if len(req.Windows) > maxWindows {
+		return nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "windows", Message: fmt.Sprintf("cannot have more than %d windows", maxWindows)}})
+	}
+
+	var errs []pkg.FieldError
+	windows := make([]Window, 0, len(req.Windows))
+	for i, item := range req.Windows {
+		field := fmt.Sprintf("windows[%d]", i)
+		window := Window{UserID: userID}
+
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(item.Day))]
+		if !ok {
+			errs = append(errs, pkg.FieldError{Field: field + ".day", Message: "must be a day of the week, e.g. monday"})
+		}
+		window.Weekday = weekday
+
+		start, startErr := pkg.ParseClock(item.StartTime)
+		if startErr != nil {
+			errs = append(errs, pkg.FieldError{Field: field + ".start_time", Message: "must be a time in HH:MM format"})
+		}
+		end, endErr := pkg.ParseClock(item.EndTime)
+		if endErr != nil {
+			errs = append(errs, pkg.FieldError{Field: field + ".end_time", Message: "must be a time in HH:MM format"})
+		}
+		if startErr == nil && endErr == nil && start.Equal(end) {
+			errs = append(errs, pkg.FieldError{Field: field + ".end_time", Message: "must differ from start_time"})
+		}
+		window.StartTime = start.Format(pkg.ClockLayout)
+		window.EndTime = end.Format(pkg.ClockLayout)
+		windows = append(windows, window)
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+
+	return s.availabilityRepository.SetWindows(ctx, userID, windows)
+}
+
+func (s *availabilityService) GetTimeOff(ctx context.Context, filter *TimeOffFilter) ([]TimeOff, *pkg.Pagination, error) {
+	return s.availabilityRepository.GetTimeOff(ctx, filter)
+}
+
+// RequestTimeOff asks for days off, which only count once an admin approves them
+func (s *availabilityService) RequestTimeOff(ctx context.Context, userID int, req *TimeOffRequest) (*TimeOff, error) {
+	req.StartsOn = strings.TrimSpace(req.StartsOn)
+	req.EndsOn = strings.TrimSpace(req.EndsOn)
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	var errs []pkg.FieldError
+	startsOn, startErr := time.Parse(pkg.DateLayout, req.StartsOn)
+	if startErr != nil {
+		errs = append(errs, pkg.FieldError{Field: "starts_on", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	endsOn, endErr := time.Parse(pkg.DateLayout, req.EndsOn)
+	if endErr != nil {
+		errs = append(errs, pkg.FieldError{Field: "ends_on", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	if startErr == nil && endErr == nil && endsOn.Before(startsOn) {
+		errs = append(errs, pkg.FieldError{Field: "ends_on", Message: "must not be before starts_on"})
+	}
+	if len(req.Reason) > 500 {
+		errs = append(errs, pkg.FieldError{Field: "reason", Message: "cannot be longer than 500 characters"})
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+
+	return s.availabilityRepository.CreateTimeOff(ctx, userID, req)
+}
+
+// CancelTimeOff withdraws time off of the user. Reviewed time off can only be withdrawn
+// before it starts.
+func (s *availabilityService) CancelTimeOff(ctx context.Context, userID int, id int) error {
+	timeOff, err := s.availabilityRepository.GetTimeOffByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if timeOff.UserID != userID {
+		return pkg.ErrNotFound
+	}
+	if timeOff.Status != StatusPending && timeOff.StartsOn <= time.Now().Format(pkg.DateLayout) {
+		return pkg.NewConflictError("time off has already started")
+	}
+	return s.availabilityRepository.DeleteTimeOff(ctx, id)
+}
+
+func (s *availabilityService) ReviewTimeOff(ctx context.Context, id int, reviewerID int, approve bool) (*TimeOff, error) {
+	status := StatusRejected
+	if approve {
+		status = StatusApproved
+	}
+	return s.availabilityRepository.ReviewTimeOff(ctx, id, status, reviewerID)
+}
+
+// CheckAvailability lists why the user shouldn't work from start to end: approved time off
+// on one of the days, and the shift falling outside the user's weekly windows. Days and
+// windows are read in the zone of start, which is the zone of the shift's location. Users
+// without windows are available at any time.
+func (s *availabilityService) CheckAvailability(ctx context.Context, userID int, start time.Time, end time.Time) ([]pkg.ScheduleConflict, error) {
+	loc := start.Location()
+	end = end.In(loc)
+	firstDay := start.Format(pkg.DateLayout)
+	// A shift ending at midnight doesn't take up the next day
+	lastDay := end.Add(-time.Nanosecond).Format(pkg.DateLayout)
+
+	var conflicts []pkg.ScheduleConflict
+	timeOff, err := s.availabilityRepository.GetApprovedTimeOff(ctx, userID, firstDay, lastDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the time off of user %d: %w", userID, err)
+	}
+	for _, t := range timeOff {
+		startsOn, _ := time.ParseInLocation(pkg.DateLayout, t.StartsOn, loc)
+		endsOn, _ := time.ParseInLocation(pkg.DateLayout, t.EndsOn, loc)
+		id := t.ID
+		conflicts = append(conflicts, pkg.ScheduleConflict{
+			Kind:      pkg.ConflictTimeOff,
+			TimeOffID: &id,
+			StartAt:   startsOn,
+			EndAt:     endsOn.AddDate(0, 0, 1),
+			Message:   fmt.Sprintf("on approved time off from %s to %s", t.StartsOn, t.EndsOn),
+		})
+	}
+
+	windows, err := s.availabilityRepository.GetWindows(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the availability of user %d: %w", userID, err)
+	}
+	if len(windows) > 0 && !coveredByWindow(windows, start, end) {
+		conflicts = append(conflicts, pkg.ScheduleConflict{
+			Kind:    pkg.ConflictUnavailable,
+			StartAt: start,
+			EndAt:   end,
+			Message: "outside the worker's weekly availability",
+		})
+	}
+	return conflicts, nil
+}
+
+// coveredByWindow reports whether a single occurrence of one of the windows spans start to
+// end. Windows starting the day before are considered too, they may run overnight.
+func coveredByWindow(windows []Window, start time.Time, end time.Time) bool {
+	loc := start.Location()
+	for day := start.AddDate(0, 0, -1); !day.After(start); day = day.AddDate(0, 0, 1) {
+		for _, window := range windows {
+			if window.Weekday != day.Weekday() {
+				continue
+			}
+			startClock, _ := pkg.ParseClock(window.StartTime)
+			endClock, _ := pkg.ParseClock(window.EndTime)
+			windowStart := pkg.AtClock(day, startClock, loc)
+			windowEnd := pkg.AtClock(day, endClock, loc)
+			if window.Overnight {
+				windowEnd = pkg.AtClock(day.AddDate(0, 0, 1), endClock, loc)
+			}
+			if !windowStart.After(start) && !windowEnd.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
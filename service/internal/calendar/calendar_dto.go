@@ -0,0 +1,43 @@
+package calendar
+
+import "time"
+
+// Feed is a secret calendar feed of either a user's assignments or a location's shifts
+type Feed struct {
+	ID         int       `json:"id"`
+	UserID     *int      `json:"user_id"`
+	LocationID *int      `json:"location_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FeedURL is returned when a feed token is issued. The token is only shown once, a lost
+// or leaked URL is replaced by regenerating it.
+type FeedURL struct {
+	Feed
+	// URL is the .ics address to subscribe to
+	URL string `json:"url" example:"https://justpayd.example.com/api/calendar/feeds/3q2-7wE.ics"`
+	// WebcalURL is the same address for calendar apps that subscribe on webcal:// links
+	WebcalURL string `json:"webcal_url" example:"webcal://justpayd.example.com/api/calendar/feeds/3q2-7wE.ics"`
+}
+
+// Event is a shift as shown in a calendar feed
+type Event struct {
+	ShiftID  int
+	StartAt  time.Time
+	EndAt    time.Time
+	Role     string
+	Location string
+	// Assignee is the name of the assigned user, empty for open shifts
+	Assignee  string
+	CreatedAt time.Time
+}
+
+// Calendar is the content of a feed
+type Calendar struct {
+	Name string
+	// TimeZone is shown by calendar apps that display the feed in its own zone
+	TimeZone string
+	// ShowAssignee names the assignee of each shift, for feeds shared by a whole location
+	ShowAssignee bool
+	Events       []Event
+}
@@ -0,0 +1,140 @@
+package calendar
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+type CalendarHandler struct {
+	CalendarService CalendarService
+	logger          *zap.SugaredLogger
+}
+
+func NewCalendarHandler(calendarService CalendarService, logger *zap.SugaredLogger) *CalendarHandler {
+	return &CalendarHandler{
+		CalendarService: calendarService,
+		logger:          logger,
+	}
+}
+
+// RegisterRoutes registers the routes for issuing feed URLs
+func (h *CalendarHandler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermAssignmentsRead))
+		r.Post("/feeds/me", h.RegenerateMyFeed)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftsManage))
+		r.Post("/feeds/locations/{id}", h.RegenerateLocationFeed)
+	})
+}
+
+// RegisterPublicRoutes registers the feeds themselves, which calendar apps fetch without
+// logging in. The secret token in the URL is the only credential.
+func (h *CalendarHandler) RegisterPublicRoutes(r chi.Router) {
+	r.Get("/feeds/{token}.ics", h.GetFeed)
+}
+
+// RegenerateMyFeed godoc
+// @Summary Issue my calendar feed URL
+// @Description Issues a secret .ics URL showing the caller's assignments, to subscribe to from Google or Apple Calendar. The URL is only shown once; calling this again regenerates it and the previous URL stops working.
+// @Tags calendar
+// @Produce json
+// @Success 201 {object} pkg.BaseResponse{data=FeedURL} "Feed URL issued"
+// @Failure 401 {object} pkg.BaseResponse "Not authenticated"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /calendar/feeds/me [post]
+func (h *CalendarHandler) RegenerateMyFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	feed, err := h.CalendarService.RegenerateUserFeed(r.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("Error issuing calendar feed for user %d: %v", userID, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to issue calendar feed"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(feed))
+}
+
+// RegenerateLocationFeed godoc
+// @Summary Issue a location's calendar feed URL
+// @Description Issues a secret .ics URL showing every shift at a location with its assignee. The URL is only shown once; calling this again regenerates it and the previous URL stops working.
+// @Tags calendar
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 201 {object} pkg.BaseResponse{data=FeedURL} "Feed URL issued"
+// @Failure 400 {object} pkg.BaseResponse "Invalid location ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Location not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /calendar/feeds/locations/{id} [post]
+func (h *CalendarHandler) RegenerateLocationFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid location ID"))
+		return
+	}
+
+	feed, err := h.CalendarService.RegenerateLocationFeed(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Location not found"))
+			return
+		}
+		h.logger.Errorf("Error issuing calendar feed for location %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to issue calendar feed"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(feed))
+}
+
+// GetFeed godoc
+// @Summary Calendar feed
+// @Description iCalendar feed of a user's assignments or a location's shifts, from 30 days ago on. Each shift keeps the same UID, so subscribed calendars update moved shifts and drop deleted or unassigned ones on their next refresh.
+// @Tags calendar
+// @Produce text/calendar
+// @Param token path string true "Feed token"
+// @Success 200 {string} string "iCalendar document"
+// @Failure 404 {object} pkg.BaseResponse "Unknown or regenerated token"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /calendar/feeds/{token}.ics [get]
+func (h *CalendarHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	cal, err := h.CalendarService.GetCalendar(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Calendar feed not found"))
+			return
+		}
+		h.logger.Errorf("Error getting calendar feed: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve calendar feed"))
+		return
+	}
+
+	var body bytes.Buffer
+	if err := WriteICS(&body, cal, time.Now()); err != nil {
+		h.logger.Errorf("Error writing calendar feed: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve calendar feed"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="justpayd.ics"`)
+	// The URL is a credential, keep it and the schedule out of shared caches
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := body.WriteTo(w); err != nil {
+		h.logger.Errorf("Error sending calendar feed: %v", err)
+	}
+}
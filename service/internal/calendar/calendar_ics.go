@@ -0,0 +1,100 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icsTimeLayout is the UTC date-time form of RFC 5545
+const icsTimeLayout = "20060102T150405Z"
+
+// icsText escapes the characters RFC 5545 reserves in text values
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// EventUID identifies the event of a shift across feeds and refreshes, so calendar apps
+// update it in place when the shift changes and drop it once it leaves the feed
+func EventUID(shiftID int) string {
+	return fmt.Sprintf("shift-%d@justpayd", shiftID)
+}
+
+// WriteICS writes the calendar as an iCalendar document. Times are written in UTC, which
+// calendar apps show in the zone of the device.
+func WriteICS(w io.Writer, cal *Calendar, now time.Time) error {
+	var b strings.Builder
+	line := func(name string, value string) {
+		b.WriteString(foldLine(name + ":" + value))
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//JustPayd//Shifts//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", icsText.Replace(cal.Name))
+	if cal.TimeZone != "" {
+		line("X-WR-TIMEZONE", cal.TimeZone)
+	}
+	// Ask subscribed apps to check for changes every hour
+	line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	line("X-PUBLISHED-TTL", "PT1H")
+
+	for _, event := range cal.Events {
+		summary := event.Role
+		var description []string
+		if event.Location != "" {
+			description = append(description, "Location: "+event.Location)
+		}
+		if cal.ShowAssignee {
+			if event.Assignee != "" {
+				summary += " - " + event.Assignee
+				description = append(description, "Assigned to: "+event.Assignee)
+			} else {
+				summary += " (open)"
+				description = append(description, "Open shift")
+			}
+		} else if event.Location != "" {
+			summary += " at " + event.Location
+		}
+		description = append(description, fmt.Sprintf("Shift #%d", event.ShiftID))
+
+		line("BEGIN", "VEVENT")
+		line("UID", EventUID(event.ShiftID))
+		line("DTSTAMP", now.UTC().Format(icsTimeLayout))
+		line("CREATED", event.CreatedAt.UTC().Format(icsTimeLayout))
+		line("DTSTART", event.StartAt.UTC().Format(icsTimeLayout))
+		line("DTEND", event.EndAt.UTC().Format(icsTimeLayout))
+		line("SUMMARY", icsText.Replace(summary))
+		if event.Location != "" {
+			line("LOCATION", icsText.Replace(event.Location))
+		}
+		line("DESCRIPTION", icsText.Replace(strings.Join(description, "\n")))
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// foldLine ends a content line with CRLF, folding it into lines of at most 75 octets
+// without splitting a UTF-8 character. Continuation lines start with a space.
+func foldLine(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package calendar
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// CalendarRepository defines the interface for calendar feed data operations
+type CalendarRepository interface {
+	SaveFeed(ctx context.Context, feed *Feed, tokenHash string) (*Feed, error)
+	GetFeedByTokenHash(ctx context.Context, tokenHash string) (*Feed, error)
+	GetUserEvents(ctx context.Context, userID int, since time.Time) ([]Event, error)
+	GetLocationEvents(ctx context.Context, locationID int, since time.Time) ([]Event, error)
+}
+
+type calendarRepository struct {
+	db *sql.DB
+}
+
+// NewCalendarRepository creates a new instance of CalendarRepository
+func NewCalendarRepository(db *sql.DB) CalendarRepository {
+	return &calendarRepository{db: db}
+}
+
+const feedColumns = "id, user_id, location_id, created_at"
+
+// SaveFeed stores the feed of a user or location with a new token, replacing the token
+// of an existing feed so its old URL stops working
+func (r *calendarRepository) SaveFeed(ctx context.Context, feed *Feed, tokenHash string) (*Feed, error) {
+	var saved *Feed
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM calendar_feeds WHERE user_id = ? OR location_id = ?",
+			feed.UserID, feed.LocationID,
+		); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO calendar_feeds (user_id, location_id, token_hash, created_at) VALUES (?, ?, ?, ?)",
+			feed.UserID, feed.LocationID, tokenHash, pkg.FormatTimestamp(time.Now()),
+		)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		saved, err = scanFeed(tx.QueryRowContext(ctx, "SELECT "+feedColumns+" FROM calendar_feeds WHERE id = ?", id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (r *calendarRepository) GetFeedByTokenHash(ctx context.Context, tokenHash string) (*Feed, error) {
+	return scanFeed(pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+feedColumns+" FROM calendar_feeds WHERE token_hash = ?", tokenHash))
+}
+
+// GetUserEvents lists the shifts assigned to a user that end after since. Shifts the user
+// was unassigned from or that were cancelled drop out of the feed.
+func (r *calendarRepository) GetUserEvents(ctx context.Context, userID int, since time.Time) ([]Event, error) {
+	query := `
+		SELECT
+			s.id,
+			s.start_at,
+			s.end_at,
+			s.role,
+			COALESCE(l.name, s.location, '') as location,
+			u.name as assignee,
+			s.created_at
+		FROM assignments a
+		JOIN shifts s ON a.shift_id = s.id
+		JOIN users u ON a.user_id = u.id
+		LEFT JOIN locations l ON s.location_id = l.id
+		WHERE a.user_id = ? AND a.status = 'active' AND s.end_at > ?
+		ORDER BY s.start_at ASC
+	`
+	return r.queryEvents(ctx, query, userID, pkg.FormatTimestamp(since))
+}
+
+// GetLocationEvents lists the shifts at a location that end after since and weren't
+// cancelled, with their assignees
+func (r *calendarRepository) GetLocationEvents(ctx context.Context, locationID int, since time.Time) ([]Event, error) {
+	query := `
+		SELECT
+			s.id,
+			s.start_at,
+			s.end_at,
+			s.role,
+			COALESCE(l.name, s.location, '') as location,
+			COALESCE(u.name, '') as assignee,
+			s.created_at
+		FROM shifts s
+		LEFT JOIN locations l ON s.location_id = l.id
+		LEFT JOIN assignments a ON s.id = a.shift_id AND a.status = 'active'
+		LEFT JOIN users u ON a.user_id = u.id
+		WHERE s.location_id = ? AND s.status = 'scheduled' AND s.end_at > ?
+		ORDER BY s.start_at ASC
+	`
+	return r.queryEvents(ctx, query, locationID, pkg.FormatTimestamp(since))
+}
+
+func (r *calendarRepository) queryEvents(ctx context.Context, query string, args ...interface{}) ([]Event, error) {
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(
+			&event.ShiftID,
+			&event.StartAt,
+			&event.EndAt,
+			&event.Role,
+			&event.Location,
+			&event.Assignee,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFeed(row rowScanner) (*Feed, error) {
+	var feed Feed
+	var userID, locationID sql.NullInt64
+	err := row.Scan(&feed.ID, &userID, &locationID, &feed.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		feed.UserID = &id
+	}
+	if locationID.Valid {
+		id := int(locationID.Int64)
+		feed.LocationID = &id
+	}
+	return &feed, nil
+}
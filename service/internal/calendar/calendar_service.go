@@ -0,0 +1,112 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/locations"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/users"
+)
+
+// CalendarService defines the interface for calendar feed business logic
+type CalendarService interface {
+	RegenerateUserFeed(ctx context.Context, userID int) (*FeedURL, error)
+	RegenerateLocationFeed(ctx context.Context, locationID int) (*FeedURL, error)
+	GetCalendar(ctx context.Context, token string) (*Calendar, error)
+}
+
+// feedHistory is how long finished shifts stay in a feed
+const feedHistory = 30 * 24 * time.Hour
+
+type calendarService struct {
+	calendarRepository CalendarRepository
+	userRepository     users.UserRepository
+	locationRepository locations.LocationRepository
+	config             *pkg.Config
+}
+
+// NewCalendarService creates a new instance of CalendarService
+func NewCalendarService(calendarRepository CalendarRepository, userRepository users.UserRepository, locationRepository locations.LocationRepository, config *pkg.Config) CalendarService {
+	return &calendarService{
+		calendarRepository: calendarRepository,
+		userRepository:     userRepository,
+		locationRepository: locationRepository,
+		config:             config,
+	}
+}
+
+// RegenerateUserFeed issues a new feed URL for a user's assignments. A previous URL stops working.
+func (s *calendarService) RegenerateUserFeed(ctx context.Context, userID int) (*FeedURL, error) {
+	return s.issueFeed(ctx, &Feed{UserID: &userID})
+}
+
+// RegenerateLocationFeed issues a new feed URL for the shifts at a location. A previous URL
+// stops working.
+func (s *calendarService) RegenerateLocationFeed(ctx context.Context, locationID int) (*FeedURL, error) {
+	if _, err := s.locationRepository.GetLocationByID(ctx, locationID); err != nil {
+		return nil, err
+	}
+	return s.issueFeed(ctx, &Feed{LocationID: &locationID})
+}
+
+func (s *calendarService) issueFeed(ctx context.Context, feed *Feed) (*FeedURL, error) {
+	token, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.calendarRepository.SaveFeed(ctx, feed, pkg.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	link := fmt.Sprintf("%s/api/calendar/feeds/%s.ics", strings.TrimRight(s.config.BaseURL, "/"), url.PathEscape(token))
+	webcal := link
+	if i := strings.Index(link, "://"); i >= 0 {
+		webcal = "webcal" + link[i:]
+	}
+	return &FeedURL{Feed: *saved, URL: link, WebcalURL: webcal}, nil
+}
+
+// GetCalendar returns the content of the feed a token belongs to. Feeds of deactivated
+// users are not served.
+func (s *calendarService) GetCalendar(ctx context.Context, token string) (*Calendar, error) {
+	feed, err := s.calendarRepository.GetFeedByTokenHash(ctx, pkg.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-feedHistory)
+
+	if feed.UserID != nil {
+		user, err := s.userRepository.GetUserByID(ctx, *feed.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.Status != pkg.UserStatusActive {
+			return nil, pkg.ErrNotFound
+		}
+		events, err := s.calendarRepository.GetUserEvents(ctx, user.ID, since)
+		if err != nil {
+			return nil, err
+		}
+		return &Calendar{Name: "JustPayd shifts - " + user.Name, Events: events}, nil
+	}
+
+	location, err := s.locationRepository.GetLocationByID(ctx, *feed.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.calendarRepository.GetLocationEvents(ctx, location.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	return &Calendar{
+		Name:         "JustPayd roster - " + location.Name,
+		TimeZone:     location.TimeZone,
+		ShowAssignee: true,
+		Events:       events,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package invitations
+
+import (
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// Possible status values for invitations. Expired is never stored, it is derived
+// from a pending invitation whose expires_at has passed.
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+	StatusExpired  = "expired"
+)
+
+// Invitation represents an admin's invitation for someone to join as a user
+type Invitation struct {
+	ID         int        `json:"id" db:"id"`
+	Email      string     `json:"email" db:"email"`
+	Role       string     `json:"role" db:"role"`
+	Status     string     `json:"status" db:"status"`
+	InvitedBy  int        `json:"invited_by" db:"invited_by"`
+	UserID     *int       `json:"user_id,omitempty" db:"user_id"` // set once accepted
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// IsExpired reports whether a pending invitation can no longer be accepted
+func (i *Invitation) IsExpired() bool {
+	return i.Status == StatusPending && time.Now().After(i.ExpiresAt)
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type AcceptInvitationRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// InvitationFilter is a list query narrowed further by status
+type InvitationFilter struct {
+	pkg.ListQuery
+	// Status defaults to pending; "all" returns every invitation
+	Status string
+}
+
+// InvitationPreview is what an invitee sees before accepting
+type InvitationPreview struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AcceptInvitationResponse struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
@@ -0,0 +1,228 @@
+package invitations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+type InvitationHandler struct {
+	InvitationService InvitationService
+	logger            *zap.SugaredLogger
+}
+
+func NewInvitationHandler(invitationService InvitationService, logger *zap.SugaredLogger) *InvitationHandler {
+	return &InvitationHandler{
+		InvitationService: invitationService,
+		logger:            logger,
+	}
+}
+
+// RegisterRoutes registers the admin routes for managing invitations
+func (h *InvitationHandler) RegisterRoutes(r chi.Router) {
+	r.Use(pkg.RequirePermission(pkg.PermUsersManage))
+	r.Post("/", h.CreateInvitation)
+	r.Get("/", h.ListInvitations)
+	r.Post("/{id}/resend", h.ResendInvitation)
+	r.Delete("/{id}", h.RevokeInvitation)
+}
+
+// RegisterPublicRoutes registers the routes used by invitees, who are not logged in yet
+func (h *InvitationHandler) RegisterPublicRoutes(r chi.Router) {
+	r.Get("/{token}", h.PreviewInvitation)
+	r.Get("/{token}/accept", h.AcceptInvitationPage)
+	r.Post("/{token}/accept", h.AcceptInvitation)
+}
+
+// @Summary Invite a user
+// @Description Admin invites someone by email. The invitee receives a single-use link to set their name and password.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param payload body CreateInvitationRequest true "Invitee email and role (defaults to worker)"
+// @Success 201 {object} pkg.BaseResponse{data=Invitation} "Invitation sent"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 409 {object} pkg.BaseResponse "User exists or invitation already pending"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /invitations [post]
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+	actor, _ := pkg.GetUserFromContext(r.Context())
+
+	invitation, err := h.InvitationService.CreateInvitation(r.Context(), actor.ID, &payload)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error creating invitation: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create invitation"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(invitation))
+}
+
+// @Summary List invitations
+// @Description Admin lists invitations a page at a time, pending ones by default
+// @Tags invitations
+// @Produce json
+// @Param status query string false "Filter by status (pending, accepted, revoked, expired, all)"
+// @Param role query string false "Filter by role (admin, worker)"
+// @Param sort query string false "email or id, prefixed with - for descending" default(-id)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} pkg.BaseResponse{data=[]Invitation} "Successfully retrieved invitations"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /invitations [get]
+func (h *InvitationHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+	filter := &InvitationFilter{ListQuery: *q, Status: r.URL.Query().Get("status")}
+
+	invitations, page, err := h.InvitationService.ListInvitations(r.Context(), filter)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error listing invitations: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve invitations"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(invitations, page))
+}
+
+// @Summary Resend invitation
+// @Description Admin sends a pending or expired invitation again with a new link and a fresh expiry. Earlier links stop working.
+// @Tags invitations
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} pkg.BaseResponse{data=Invitation} "Invitation resent"
+// @Failure 400 {object} pkg.BaseResponse "Invalid invitation ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Invitation not found"
+// @Failure 409 {object} pkg.BaseResponse "Invitation was already accepted or revoked"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /invitations/{id}/resend [post]
+func (h *InvitationHandler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid invitation ID"))
+		return
+	}
+
+	invitation, err := h.InvitationService.ResendInvitation(r.Context(), id)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error resending invitation %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to resend invitation"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(invitation))
+}
+
+// @Summary Revoke invitation
+// @Description Admin revokes a pending invitation so it can no longer be accepted
+// @Tags invitations
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} pkg.BaseResponse{data=Invitation} "Invitation revoked"
+// @Failure 400 {object} pkg.BaseResponse "Invalid invitation ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Invitation not found"
+// @Failure 409 {object} pkg.BaseResponse "Invitation was already accepted or revoked"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /invitations/{id} [delete]
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid invitation ID"))
+		return
+	}
+
+	invitation, err := h.InvitationService.RevokeInvitation(r.Context(), id)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error revoking invitation %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to revoke invitation"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(invitation))
+}
+
+// @Summary Preview invitation
+// @Description Shows the email and role an invitation was issued for, so the invitee can confirm before accepting
+// @Tags auth
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Success 200 {object} pkg.BaseResponse{data=InvitationPreview} "Invitation details"
+// @Failure 400 {object} pkg.BaseResponse "Invalid, expired or used invitation"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /auth/invitations/{token} [get]
+func (h *InvitationHandler) PreviewInvitation(w http.ResponseWriter, r *http.Request) {
+	preview, err := h.InvitationService.PreviewInvitation(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error previewing invitation: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve invitation"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(preview))
+}
+
+// @Summary Accept invitation
+// @Description Creates the invited account with the given name and password. The invitation can only be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param payload body AcceptInvitationRequest true "Name and password for the new account"
+// @Success 201 {object} pkg.BaseResponse{data=AcceptInvitationResponse} "Account created"
+// @Failure 400 {object} pkg.BaseResponse "Invalid payload or invitation"
+// @Failure 409 {object} pkg.BaseResponse "Email is already registered"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /auth/invitations/{token}/accept [post]
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	response, err := h.InvitationService.AcceptInvitation(r.Context(), chi.URLParam(r, "token"), &payload)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error accepting invitation: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to accept invitation"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(response))
+}
@@ -0,0 +1,104 @@
+package invitations
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// acceptPage is what invitees see when they open the link from their invitation email. The
+// form posts JSON to the same URL, which is handled by AcceptInvitation.
+var acceptPage = template.Must(template.New("accept").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Join JustPayd</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 26rem; margin: 3rem auto; padding: 0 1rem; color: #222; }
+label { display: block; margin-top: 1rem; }
+input { width: 100%; padding: .5rem; box-sizing: border-box; }
+button { margin-top: 1.5rem; padding: .6rem 1.2rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Join JustPayd</h1>
+{{if .Error}}
+<p class="error">{{.Error}}</p>
+{{else}}
+<p>You have been invited as <strong>{{.Preview.Role}}</strong> with <strong>{{.Preview.Email}}</strong>. The invitation expires on {{.Expires}}.</p>
+<form id="accept">
+<label>Name <input name="name" autocomplete="name" required></label>
+<label>Password <input name="password" type="password" autocomplete="new-password" required></label>
+<button type="submit">Create account</button>
+</form>
+<p id="result"></p>
+<script>
+document.getElementById("accept").addEventListener("submit", async (event) => {
+	event.preventDefault();
+	const form = event.target;
+	const result = document.getElementById("result");
+	const response = await fetch(window.location.pathname, {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({name: form.name.value, password: form.password.value}),
+	});
+	const body = await response.json().catch(() => ({}));
+	if (response.ok) {
+		form.remove();
+		result.className = "";
+		result.textContent = "Your account is ready, you can now log in.";
+		return;
+	}
+	result.className = "error";
+	result.textContent = body.message || "Failed to accept the invitation";
+});
+</script>
+{{end}}
+</body>
+</html>
+`))
+
+type acceptPageData struct {
+	Preview *InvitationPreview
+	Expires string
+	Error   string
+}
+
+// AcceptInvitationPage renders the page the invitation email links to. Browsers open the link
+// with GET, so it shows a form that accepts the invitation instead of the JSON endpoint.
+//
+// @Summary Invitation page
+// @Description HTML page the invitation email links to. It shows the invitation and a form that posts the name and password to the accept endpoint.
+// @Tags auth
+// @Produce html
+// @Param token path string true "Invitation token"
+// @Success 200 {string} string "Invitation page"
+// @Failure 400 {string} string "Invalid, expired or used invitation"
+// @Failure 500 {string} string "Internal server error"
+// @Router /auth/invitations/{token}/accept [get]
+func (h *InvitationHandler) AcceptInvitationPage(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	data := acceptPageData{}
+	preview, err := h.InvitationService.PreviewInvitation(r.Context(), chi.URLParam(r, "token"))
+	if err == nil {
+		data.Preview = preview
+		data.Expires = preview.ExpiresAt.UTC().Format(time.RFC1123)
+	} else if errStatus, msg, ok := pkg.StatusFromError(err); ok {
+		status, data.Error = errStatus, msg
+	} else {
+		h.logger.Errorf("Error previewing invitation: %v", err)
+		status, data.Error = http.StatusInternalServerError, "Failed to retrieve invitation"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := acceptPage.Execute(w, data); err != nil {
+		h.logger.Errorf("Error rendering the invitation page: %v", err)
+	}
+}
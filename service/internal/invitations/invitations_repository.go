@@ -0,0 +1,252 @@
+package invitations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+type InvitationRepository interface {
+	CreateInvitation(ctx context.Context, invitation *Invitation, tokenHash string) (*Invitation, error)
+	GetInvitationByID(ctx context.Context, id int) (*Invitation, error)
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*Invitation, error)
+	ListInvitations(ctx context.Context, filter *InvitationFilter) ([]Invitation, *pkg.Pagination, error)
+	RenewInvitation(ctx context.Context, id int, tokenHash string, expiresAt time.Time) error
+	RevokeInvitation(ctx context.Context, id int) error
+	AcceptInvitation(ctx context.Context, id int, name string, passwordHash string) (int, error)
+	UserExists(ctx context.Context, email string) (bool, error)
+}
+
+type invitationRepository struct {
+	db *sql.DB
+}
+
+func NewInvitationRepository(db *sql.DB) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+const invitationColumns = "id, email, role, status, invited_by, user_id, expires_at, accepted_at, revoked_at, created_at"
+
+// CreateInvitation stores a new pending invitation. Expired invitations for the same email are
+// revoked first so they don't block a fresh one.
+func (r *invitationRepository) CreateInvitation(ctx context.Context, invitation *Invitation, tokenHash string) (*Invitation, error) {
+	var id int64
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		now := time.Now().UTC()
+		_, err := tx.ExecContext(ctx,
+			"UPDATE invitations SET status = ?, revoked_at = ? WHERE email = ? AND status = ? AND expires_at <= ?",
+			StatusRevoked, now, invitation.Email, StatusPending, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO invitations (email, role, token_hash, status, invited_by, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			invitation.Email, invitation.Role, tokenHash, StatusPending, invitation.InvitedBy, invitation.ExpiresAt.UTC(), now,
+		)
+		if err != nil {
+			if pkg.IsUniqueViolation(err) {
+				return pkg.NewConflictError("a pending invitation already exists for this email")
+			}
+			return err
+		}
+
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetInvitationByID(ctx, int(id))
+}
+
+func (r *invitationRepository) GetInvitationByID(ctx context.Context, id int) (*Invitation, error) {
+	return scanInvitation(pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE id = ?", id))
+}
+
+func (r *invitationRepository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*Invitation, error) {
+	return scanInvitation(pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE token_hash = ?", tokenHash))
+}
+
+// invitationList applies list queries to the invitations table. IDs grow with creation, so
+// the default of -id lists the newest invitations first.
+var invitationList = &pkg.ListSpec[Invitation]{
+	Sorts: map[string]pkg.SortKey[Invitation]{
+		"email": {Column: "email", Value: func(i *Invitation) interface{} { return i.Email }},
+		"id":    {Column: "id", Value: func(i *Invitation) interface{} { return i.ID }},
+	},
+	DefaultSort: "id",
+	DefaultDesc: true,
+	IDColumn:    "id",
+	ID:          func(i *Invitation) int { return i.ID },
+	Role:        "role",
+}
+
+func (r *invitationRepository) ListInvitations(ctx context.Context, filter *InvitationFilter) ([]Invitation, *pkg.Pagination, error) {
+	var where []string
+	var args []interface{}
+	switch filter.Status {
+	case "":
+	case StatusPending:
+		where = append(where, "status = ? AND expires_at > ?")
+		args = append(args, StatusPending, time.Now().UTC())
+	case StatusExpired:
+		where = append(where, "status = ? AND expires_at <= ?")
+		args = append(args, StatusPending, time.Now().UTC())
+	default:
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	clause, args, err := invitationList.Build(&filter.ListQuery, where, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, "SELECT "+invitationColumns+" FROM invitations"+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	invitations, page := invitationList.Page(&filter.ListQuery, invitations)
+	return invitations, page, nil
+}
+
+// RenewInvitation replaces the token of a pending invitation and extends its expiry
+func (r *invitationRepository) RenewInvitation(ctx context.Context, id int, tokenHash string, expiresAt time.Time) error {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx,
+		"UPDATE invitations SET token_hash = ?, expires_at = ? WHERE id = ? AND status = ?",
+		tokenHash, expiresAt.UTC(), id, StatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// RevokeInvitation revokes a pending invitation so its token can no longer be used
+func (r *invitationRepository) RevokeInvitation(ctx context.Context, id int) error {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx,
+		"UPDATE invitations SET status = ?, revoked_at = ? WHERE id = ? AND status = ?",
+		StatusRevoked, time.Now().UTC(), id, StatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// AcceptInvitation consumes a pending invitation and creates the invited user in one transaction.
+// The email counts as verified since the invitee proved they own it by using the token.
+func (r *invitationRepository) AcceptInvitation(ctx context.Context, id int, name string, passwordHash string) (int, error) {
+	var userID int64
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		var email, role string
+		err := tx.QueryRowContext(ctx, "SELECT email, role FROM invitations WHERE id = ? AND status = ?", id, StatusPending).Scan(&email, &role)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return pkg.ErrNotFound
+			}
+			return err
+		}
+
+		now := time.Now().UTC()
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO users (name, email, role, password_hash, email_verified_at) VALUES (?, ?, ?, ?, ?)",
+			name, email, role, passwordHash, now,
+		)
+		if err != nil {
+			if pkg.IsUniqueViolation(err) {
+				return pkg.NewConflictError("email is already registered")
+			}
+			return err
+		}
+		userID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		result, err = tx.ExecContext(ctx,
+			"UPDATE invitations SET status = ?, user_id = ?, accepted_at = ? WHERE id = ? AND status = ?",
+			StatusAccepted, userID, now, id, StatusPending,
+		)
+		if err != nil {
+			return err
+		}
+		return requireAffected(result)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(userID), nil
+}
+
+func (r *invitationRepository) UserExists(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)", email).Scan(&exists)
+	return exists, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInvitation(row rowScanner) (*Invitation, error) {
+	var invitation Invitation
+	var userID sql.NullInt64
+	var acceptedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&invitation.ID, &invitation.Email, &invitation.Role, &invitation.Status, &invitation.InvitedBy,
+		&userID, &invitation.ExpiresAt, &acceptedAt, &revokedAt, &invitation.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if userID.Valid {
+		id := int(userID.Int64)
+		invitation.UserID = &id
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	if revokedAt.Valid {
+		invitation.RevokedAt = &revokedAt.Time
+	}
+	if invitation.IsExpired() {
+		invitation.Status = StatusExpired
+	}
+	return &invitation, nil
+}
+
+// requireAffected turns an update that matched no pending invitation into ErrNotFound
+func requireAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/mailer"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+type InvitationService interface {
+	CreateInvitation(ctx context.Context, actorID int, req *CreateInvitationRequest) (*Invitation, error)
+	ListInvitations(ctx context.Context, filter *InvitationFilter) ([]Invitation, *pkg.Pagination, error)
+	ResendInvitation(ctx context.Context, id int) (*Invitation, error)
+	RevokeInvitation(ctx context.Context, id int) (*Invitation, error)
+	PreviewInvitation(ctx context.Context, token string) (*InvitationPreview, error)
+	AcceptInvitation(ctx context.Context, token string, req *AcceptInvitationRequest) (*AcceptInvitationResponse, error)
+}
+
+type invitationService struct {
+	invitationRepository InvitationRepository
+	mailer               mailer.Mailer
+	config               *pkg.Config
+}
+
+func NewInvitationService(invitationRepository InvitationRepository, mailer mailer.Mailer, config *pkg.Config) InvitationService {
+	return &invitationService{
+		invitationRepository: invitationRepository,
+		mailer:               mailer,
+		config:               config,
+	}
+}
+
+func (s *invitationService) CreateInvitation(ctx context.Context, actorID int, req *CreateInvitationRequest) (*Invitation, error) {
+	email, err := pkg.NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(req.Role)
+	if role == "" {
+		role = pkg.RoleWorker
+	}
+	if role != pkg.RoleAdmin && role != pkg.RoleWorker {
+		return nil, pkg.NewValidationError("role must be one of: admin, worker")
+	}
+
+	exists, err := s.invitationRepository.UserExists(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, pkg.NewConflictError("a user with this email already exists")
+	}
+
+	token, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.invitationRepository.CreateInvitation(ctx, &Invitation{
+		Email:     email,
+		Role:      role,
+		InvitedBy: actorID,
+		ExpiresAt: s.expiry(),
+	}, pkg.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sendInvitation(ctx, invitation, token); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *invitationService) ListInvitations(ctx context.Context, filter *InvitationFilter) ([]Invitation, *pkg.Pagination, error) {
+	switch filter.Status {
+	case "":
+		filter.Status = StatusPending
+	case "all":
+		filter.Status = ""
+	case StatusPending, StatusAccepted, StatusRevoked, StatusExpired:
+	default:
+		return nil, nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "status", Message: "must be one of: pending, accepted, revoked, expired, all"}})
+	}
+
+	return s.invitationRepository.ListInvitations(ctx, filter)
+}
+
+// ResendInvitation issues a new token, which also restarts the expiry, and emails it again.
+// Previously sent links stop working.
+func (s *invitationService) ResendInvitation(ctx context.Context, id int) (*Invitation, error) {
+	if _, err := s.getOpenInvitation(ctx, id); err != nil {
+		return nil, err
+	}
+
+	token, err := pkg.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.invitationRepository.RenewInvitation(ctx, id, pkg.HashToken(token), s.expiry()); err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.invitationRepository.GetInvitationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sendInvitation(ctx, invitation, token); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *invitationService) RevokeInvitation(ctx context.Context, id int) (*Invitation, error) {
+	if _, err := s.getOpenInvitation(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.invitationRepository.RevokeInvitation(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.invitationRepository.GetInvitationByID(ctx, id)
+}
+
+func (s *invitationService) PreviewInvitation(ctx context.Context, token string) (*InvitationPreview, error) {
+	invitation, err := s.getInvitationByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &InvitationPreview{
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt,
+	}, nil
+}
+
+func (s *invitationService) AcceptInvitation(ctx context.Context, token string, req *AcceptInvitationRequest) (*AcceptInvitationResponse, error) {
+	invitation, err := s.getInvitationByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, pkg.NewValidationError("name is required")
+	}
+	passwordHash, err := pkg.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := s.invitationRepository.AcceptInvitation(ctx, invitation.ID, name, passwordHash)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return nil, pkg.NewValidationError("invitation is no longer valid")
+		}
+		return nil, err
+	}
+
+	return &AcceptInvitationResponse{
+		UserID: userID,
+		Email:  invitation.Email,
+		Role:   invitation.Role,
+	}, nil
+}
+
+// getOpenInvitation returns an invitation that admins can still resend or revoke
+func (s *invitationService) getOpenInvitation(ctx context.Context, id int) (*Invitation, error) {
+	invitation, err := s.invitationRepository.GetInvitationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Status != StatusPending && invitation.Status != StatusExpired {
+		return nil, pkg.NewConflictError(fmt.Sprintf("invitation has already been %s", invitation.Status))
+	}
+	return invitation, nil
+}
+
+// getInvitationByToken returns the pending invitation an invitee's token refers to
+func (s *invitationService) getInvitationByToken(ctx context.Context, token string) (*Invitation, error) {
+	invitation, err := s.invitationRepository.GetInvitationByTokenHash(ctx, pkg.HashToken(token))
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return nil, pkg.NewValidationError("invitation is invalid")
+		}
+		return nil, err
+	}
+
+	switch invitation.Status {
+	case StatusPending:
+		return invitation, nil
+	case StatusExpired:
+		return nil, pkg.NewValidationError("invitation has expired")
+	default:
+		return nil, pkg.NewValidationError("invitation is no longer valid")
+	}
+}
+
+func (s *invitationService) expiry() time.Time {
+	return time.Now().Add(time.Duration(s.config.Auth.InvitationExpiration) * time.Minute)
+}
+
+func (s *invitationService) sendInvitation(ctx context.Context, invitation *Invitation, token string) error {
+	link := fmt.Sprintf("%s/api/auth/invitations/%s", strings.TrimRight(s.config.BaseURL, "/"), url.PathEscape(token))
+	return s.mailer.Send(ctx, &mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited to JustPayd",
+		Body: fmt.Sprintf(
+			"Hi,\n\nYou have been invited to join JustPayd with the %s role. Accept the invitation by setting your name and password at:\n\n%s/accept\n\nThe invitation expires on %s.\n",
+			invitation.Role, link, invitation.ExpiresAt.UTC().Format(time.RFC1123),
+		),
+	})
+}
@@ -0,0 +1,22 @@
+package locations
+
+import "time"
+
+// Location is a place shifts are worked at. Its time zone decides how shift times are entered and shown.
+type Location struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// TimeZone is an IANA time zone name
+	TimeZone  string    `json:"time_zone" db:"time_zone" example:"Asia/Jakarta"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateLocationRequest struct {
+	Name     string `json:"name"`
+	TimeZone string `json:"time_zone" example:"Asia/Jakarta"`
+}
+
+type UpdateLocationRequest struct {
+	Name     *string `json:"name"`
+	TimeZone *string `json:"time_zone" example:"Asia/Jakarta"`
+}
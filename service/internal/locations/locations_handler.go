@@ -0,0 +1,208 @@
+package locations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+type LocationHandler struct {
+	LocationService LocationService
+	logger          *zap.SugaredLogger
+}
+
+func NewLocationHandler(locationService LocationService, logger *zap.SugaredLogger) *LocationHandler {
+	return &LocationHandler{
+		LocationService: locationService,
+		logger:          logger,
+	}
+}
+
+// RegisterRoutes registers the location routes. Locations are part of the schedule, so they
+// share the shift permissions.
+func (h *LocationHandler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftsRead))
+		r.Get("/", h.GetLocations)
+		r.Get("/{id}", h.GetLocationByID)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftsManage))
+		r.Post("/", h.CreateLocation)
+		r.Put("/{id}", h.UpdateLocation)
+		r.Delete("/{id}", h.DeleteLocation)
+	})
+}
+
+// @Summary List locations
+// @Description List the locations shifts can be scheduled at, with their time zones, a page at a time
+// @Tags locations
+// @Produce json
+// @Param sort query string false "name or id, prefixed with - for descending" default(name)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} pkg.BaseResponse{data=[]Location} "Successfully retrieved locations"
+// @Failure 422 {object} pkg.BaseResponse "Invalid sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /locations [get]
+func (h *LocationHandler) GetLocations(w http.ResponseWriter, r *http.Request) {
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	locations, page, err := h.LocationService.GetLocations(r.Context(), q)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting locations: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve locations"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(locations, page))
+}
+
+// @Summary Get location
+// @Description Get a location by ID
+// @Tags locations
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {object} pkg.BaseResponse{data=Location} "Successfully retrieved location"
+// @Failure 400 {object} pkg.BaseResponse "Invalid location ID"
+// @Failure 404 {object} pkg.BaseResponse "Location not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /locations/{id} [get]
+func (h *LocationHandler) GetLocationByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid location ID"))
+		return
+	}
+
+	location, err := h.LocationService.GetLocationByID(r.Context(), id)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting location %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve location"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(location))
+}
+
+// @Summary Create location
+// @Description Admin creates a location with an IANA time zone
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param payload body CreateLocationRequest true "Location name and time zone"
+// @Success 201 {object} pkg.BaseResponse{data=Location} "Location created"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 409 {object} pkg.BaseResponse "A location with this name already exists"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /locations [post]
+func (h *LocationHandler) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	var payload CreateLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	location, err := h.LocationService.CreateLocation(r.Context(), &payload)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error creating location: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create location"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(location))
+}
+
+// @Summary Update location
+// @Description Admin renames a location or changes its time zone. Shifts keep their instants, so their local times follow the new zone.
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param id path int true "Location ID"
+// @Param payload body UpdateLocationRequest true "Fields to change"
+// @Success 200 {object} pkg.BaseResponse{data=Location} "Location updated"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Location not found"
+// @Failure 409 {object} pkg.BaseResponse "A location with this name already exists"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /locations/{id} [put]
+func (h *LocationHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid location ID"))
+		return
+	}
+
+	var payload UpdateLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	location, err := h.LocationService.UpdateLocation(r.Context(), id, &payload)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error updating location %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update location"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(location))
+}
+
+// @Summary Delete location
+// @Description Admin deletes a location no shift, shift template or calendar feed refers to
+// @Tags locations
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {object} pkg.BaseResponse "Location deleted"
+// @Failure 400 {object} pkg.BaseResponse "Invalid location ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Location not found"
+// @Failure 409 {object} pkg.BaseResponse "Location still has shifts, shift templates or a calendar feed"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /locations/{id} [delete]
+func (h *LocationHandler) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid location ID"))
+		return
+	}
+
+	if err := h.LocationService.DeleteLocation(r.Context(), id); err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error deleting location %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to delete location"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(map[string]string{"message": "Location deleted successfully"}))
+}
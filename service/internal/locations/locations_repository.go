@@ -0,0 +1,229 @@
+package locations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// LocationRepository defines the interface for location data operations
+type LocationRepository interface {
+	CreateLocation(ctx context.Context, location *Location) (*Location, error)
+	GetLocations(ctx context.Context, q *pkg.ListQuery) ([]Location, *pkg.Pagination, error)
+	GetLocationByID(ctx context.Context, id int) (*Location, error)
+	GetLocationByName(ctx context.Context, name string) (*Location, error)
+	UpdateLocation(ctx context.Context, location *Location) (*Location, error)
+	DeleteLocation(ctx context.Context, id int) error
+}
+
+type locationRepository struct {
+	db *sql.DB
+}
+
+// NewLocationRepository creates a new instance of LocationRepository
+func NewLocationRepository(db *sql.DB) LocationRepository {
+	return &locationRepository{db: db}
+}
+
+const locationColumns = "id, name, time_zone, created_at"
+
+func (r *locationRepository) CreateLocation(ctx context.Context, location *Location) (*Location, error) {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx,
+		"INSERT INTO locations (name, time_zone, created_at) VALUES (?, ?, ?)",
+		location.Name, location.TimeZone, time.Now().UTC(),
+	)
+	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return nil, pkg.NewConflictError("a location with this name already exists")
+		}
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return r.GetLocationByID(ctx, int(id))
+}
+
+// locationList applies list queries to the locations table
+var locationList = &pkg.ListSpec[Location]{
+	Sorts: map[string]pkg.SortKey[Location]{
+		"name": {Column: "name", Value: func(l *Location) interface{} { return l.Name }},
+		"id":   {Column: "id", Value: func(l *Location) interface{} { return l.ID }},
+	},
+	DefaultSort: "name",
+	IDColumn:    "id",
+	ID:          func(l *Location) int { return l.ID },
+}
+
+func (r *locationRepository) GetLocations(ctx context.Context, q *pkg.ListQuery) ([]Location, *pkg.Pagination, error) {
+	clause, args, err := locationList.Build(q, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, "SELECT "+locationColumns+" FROM locations"+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	locations := []Location{}
+	for rows.Next() {
+		location, err := scanLocation(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		locations = append(locations, *location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	locations, page := locationList.Page(q, locations)
+	return locations, page, nil
+}
+
+func (r *locationRepository) GetLocationByID(ctx context.Context, id int) (*Location, error) {
+	return scanLocation(pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+locationColumns+" FROM locations WHERE id = ?", id))
+}
+
+// GetLocationByName looks a location up by name, ignoring case
+func (r *locationRepository) GetLocationByName(ctx context.Context, name string) (*Location, error) {
+	return scanLocation(pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+locationColumns+" FROM locations WHERE name = ?", name))
+}
+
+// UpdateLocation renames a location or changes its time zone. The shifts' own location
+// column is kept in step with the name for readers that don't join locations, and their
+// legacy date, start_time and end_time are rendered again in the new zone.
+func (r *locationRepository) UpdateLocation(ctx context.Context, location *Location) (*Location, error) {
+	loc, err := pkg.LoadTimeZone(location.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE locations SET name = ?, time_zone = ? WHERE id = ?",
+			location.Name, location.TimeZone, location.ID,
+		)
+		if err != nil {
+			if pkg.IsUniqueViolation(err) {
+				return pkg.NewConflictError("a location with this name already exists")
+			}
+			return err
+		}
+		if err := requireAffected(result); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE shifts SET location = ? WHERE location_id = ?", location.Name, location.ID); err != nil {
+			return err
+		}
+		return relocateShifts(ctx, tx, location.ID, loc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetLocationByID(ctx, location.ID)
+}
+
+// relocateShifts renders the legacy date, start_time and end_time of the location's shifts
+// in loc, the list filters on from and to read the date
+func relocateShifts(ctx context.Context, tx pkg.DBTX, locationID int, loc *time.Location) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, start_at, end_at FROM shifts WHERE location_id = ?", locationID)
+	if err != nil {
+		return err
+	}
+	type shiftTimes struct {
+		id         int
+		start, end time.Time
+	}
+	var shifts []shiftTimes
+	for rows.Next() {
+		var shift shiftTimes
+		if err := rows.Scan(&shift.id, &shift.start, &shift.end); err != nil {
+			rows.Close()
+			return err
+		}
+		shifts = append(shifts, shift)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, shift := range shifts {
+		start, end := shift.start.In(loc), shift.end.In(loc)
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE shifts SET date = ?, start_time = ?, end_time = ? WHERE id = ?",
+			start.Format(pkg.DateLayout), start.Format(pkg.ClockLayout), end.Format(pkg.ClockLayout), shift.id,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// locationReferences are the tables whose rows point at a location, with the conflict
+// reported while any of them does. Foreign keys aren't enforced, so they are checked here.
+var locationReferences = []struct {
+	query   string
+	message string
+}{
+	{"SELECT EXISTS(SELECT 1 FROM shifts WHERE location_id = ?)", "location still has shifts"},
+	{"SELECT EXISTS(SELECT 1 FROM shift_templates WHERE location_id = ?)", "location still has shift templates"},
+	{"SELECT EXISTS(SELECT 1 FROM calendar_feeds WHERE location_id = ?)", "location still has a calendar feed"},
+}
+
+// DeleteLocation removes a location that no shift, shift template or calendar feed refers to
+func (r *locationRepository) DeleteLocation(ctx context.Context, id int) error {
+	return pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		for _, reference := range locationReferences {
+			var inUse bool
+			if err := tx.QueryRowContext(ctx, reference.query, id).Scan(&inUse); err != nil {
+				return err
+			}
+			if inUse {
+				return pkg.NewConflictError(reference.message)
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM locations WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		return requireAffected(result)
+	})
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLocation(row rowScanner) (*Location, error) {
+	var location Location
+	err := row.Scan(&location.ID, &location.Name, &location.TimeZone, &location.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+	return &location, nil
+}
+
+func requireAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package locations
+
+import (
+	"context"
+	"strings"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// LocationService defines the interface for location business logic
+type LocationService interface {
+	CreateLocation(ctx context.Context, req *CreateLocationRequest) (*Location, error)
+	GetLocations(ctx context.Context, q *pkg.ListQuery) ([]Location, *pkg.Pagination, error)
+	GetLocationByID(ctx context.Context, id int) (*Location, error)
+	UpdateLocation(ctx context.Context, id int, req *UpdateLocationRequest) (*Location, error)
+	DeleteLocation(ctx context.Context, id int) error
+}
+
+type locationService struct {
+	locationRepository LocationRepository
+}
+
+// NewLocationService creates a new instance of LocationService
+func NewLocationService(locationRepository LocationRepository) LocationService {
+	return &locationService{locationRepository: locationRepository}
+}
+
+func (s *locationService) CreateLocation(ctx context.Context, req *CreateLocationRequest) (*Location, error) {
+	location := &Location{Name: req.Name, TimeZone: req.TimeZone}
+	if err := validateLocation(location); err != nil {
+		return nil, err
+	}
+	return s.locationRepository.CreateLocation(ctx, location)
+}
+
+func (s *locationService) GetLocations(ctx context.Context, q *pkg.ListQuery) ([]Location, *pkg.Pagination, error) {
+	return s.locationRepository.GetLocations(ctx, q)
+}
+
+func (s *locationService) GetLocationByID(ctx context.Context, id int) (*Location, error) {
+	return s.locationRepository.GetLocationByID(ctx, id)
+}
+
+// UpdateLocation changes a location. Shifts keep their start and end instants when the time
+// zone changes, so their local times move with it.
+func (s *locationService) UpdateLocation(ctx context.Context, id int, req *UpdateLocationRequest) (*Location, error) {
+	location, err := s.locationRepository.GetLocationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		location.Name = *req.Name
+	}
+	if req.TimeZone != nil {
+		location.TimeZone = *req.TimeZone
+	}
+	if err := validateLocation(location); err != nil {
+		return nil, err
+	}
+	return s.locationRepository.UpdateLocation(ctx, location)
+}
+
+func (s *locationService) DeleteLocation(ctx context.Context, id int) error {
+	return s.locationRepository.DeleteLocation(ctx, id)
+}
+
+func validateLocation(location *Location) error {
+	var errs []pkg.FieldError
+
+	location.Name = strings.TrimSpace(location.Name)
+	if location.Name == "" {
+		errs = append(errs, pkg.FieldError{Field: "name", Message: "is required"})
+	}
+
+	location.TimeZone = strings.TrimSpace(location.TimeZone)
+	if location.TimeZone == "" {
+		errs = append(errs, pkg.FieldError{Field: "time_zone", Message: "is required"})
+	} else if loc, err := pkg.LoadTimeZone(location.TimeZone); err != nil {
+		errs = append(errs, pkg.FieldError{Field: "time_zone", Message: "must be an IANA time zone such as Asia/Jakarta"})
+	} else {
+		location.TimeZone = loc.String()
+	}
+
+	if len(errs) > 0 {
+		return pkg.NewFieldValidationError(errs)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"go.uber.org/zap"
+)
+
+// Supported mail drivers
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+	DriverLog  = "log"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New creates the mailer selected by config.Mail.Driver
+func New(config *pkg.Config, logger *zap.SugaredLogger) (Mailer, error) {
+	switch config.Mail.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(config.Mail), nil
+	case DriverFile:
+		return NewFileMailer(config.Mail.From, config.Mail.OutputDir)
+	case DriverLog, "":
+		return NewLogMailer(config.Mail.From, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.Mail.Driver)
+	}
+}
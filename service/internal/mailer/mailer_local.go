@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// logMailer writes emails to the application log instead of sending them, for local development
+type logMailer struct {
+	from   string
+	logger *zap.SugaredLogger
+}
+
+// NewLogMailer creates a mailer that only logs the emails it is asked to send
+func NewLogMailer(from string, logger *zap.SugaredLogger) Mailer {
+	return &logMailer{from: from, logger: logger}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	m.logger.Infow("Email not sent (log mail driver)",
+		"from", m.from,
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
+
+// fileMailer writes every email as an .eml file into a directory, for local development
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer creates a mailer that stores emails as files in dir
+func NewFileMailer(from string, dir string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating mail output directory: %w", err)
+	}
+	return &fileMailer{from: from, dir: dir}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg *Message) error {
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s_%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), recipient)
+
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, msg), 0644)
+}
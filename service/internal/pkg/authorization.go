@@ -0,0 +1,96 @@
+package pkg
+
+import "net/http"
+
+// Roles a user can have
+const (
+	RoleAdmin  = "admin"
+	RoleWorker = "worker"
+)
+
+// Permission names an action that can be granted to a role
+type Permission string
+
+const (
+	PermUsersManage         Permission = "users:manage"
+	PermShiftsRead          Permission = "shifts:read"
+	PermShiftsManage        Permission = "shifts:manage"
+	PermShiftRequestsCreate Permission = "shift_requests:create"
+	PermShiftRequestsReview Permission = "shift_requests:review"
+	PermAssignmentsRead     Permission = "assignments:read"
+	PermAssignmentsManage   Permission = "assignments:manage"
+	PermAvailabilityManage  Permission = "availability:manage"
+	PermTimeOffReview       Permission = "time_off:review"
+	PermSwapsCreate         Permission = "swaps:create"
+	PermSwapsReview         Permission = "swaps:review"
+)
+
+// RolePermissions is the permission matrix, it lists what each role is allowed to do.
+// Routes that only need an authenticated user (e.g. changing your own password) are not listed.
+var RolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermUsersManage,
+		PermShiftsRead,
+		PermShiftsManage,
+		PermShiftRequestsReview,
+		PermAssignmentsRead,
+		PermAssignmentsManage,
+		PermTimeOffReview,
+		PermSwapsReview,
+	},
+	RoleWorker: {
+		PermShiftsRead,
+		PermShiftRequestsCreate,
+		PermAssignmentsRead,
+		PermAvailabilityManage,
+		PermSwapsCreate,
+	},
+}
+
+// HasPermission reports whether a role has been granted a permission
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range RolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole only lets through users having one of the given roles.
+// It must be used after JWTAuth so the user is available in the context.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return authorize(func(user *User) bool {
+		for _, role := range roles {
+			if user.Role == role {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePermission only lets through users whose role has been granted the permission.
+// It must be used after JWTAuth so the user is available in the context.
+func RequirePermission(permission Permission) func(http.Handler) http.Handler {
+	return authorize(func(user *User) bool {
+		return HasPermission(user.Role, permission)
+	})
+}
+
+func authorize(allowed func(user *User) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				WriteJSON(w, http.StatusUnauthorized, NewErrorResponse("User not authenticated"))
+				return
+			}
+			if !allowed(user) {
+				WriteJSON(w, http.StatusForbidden, NewErrorResponse("You do not have permission to perform this action"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
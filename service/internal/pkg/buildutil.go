@@ -1,14 +1,144 @@
 package pkg
 
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Environments the application can run in
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// DefaultJWTSecret is the placeholder HS256 secret used when JWT_SECRET is not set.
+// It is only accepted in development.
+const DefaultJWTSecret = "secret"
+
 type Config struct {
-	StoragePath string    `json:"storage_path"`
-	ServerPort  string    `json:"server_port"`
-	LogLevel    string    `json:"log_level"`
-	JWT         JWTConfig `json:"jwt"`
+	Environment string      `json:"environment"` // development or production
+	StoragePath string      `json:"storage_path"`
+	ServerPort  string      `json:"server_port"`
+	LogLevel    string      `json:"log_level"`
+	BaseURL     string      `json:"base_url"` // public URL of the service, used in links sent to users
+	JWT         JWTConfig   `json:"jwt"`
+	Auth        AuthConfig  `json:"auth"`
+	Mail        MailConfig  `json:"mail"`
+	OIDC        OIDCConfig  `json:"oidc"`
+	Shifts      ShiftConfig `json:"shifts"`
+}
+
+// IsDevelopment reports whether the application runs in development mode
+func (c *Config) IsDevelopment() bool {
+	return c.Environment == EnvDevelopment
+}
+
+// Validate refuses configurations that are only safe for local development
+func (c *Config) Validate() error {
+	if c.IsDevelopment() {
+		return nil
+	}
+	if (c.JWT.Algorithm == "" || c.JWT.Algorithm == AlgorithmHS256) && c.JWT.Secret == DefaultJWTSecret {
+		return errors.New("refusing to start with the default JWT secret outside development, set JWT_SECRET or use an asymmetric JWT_ALGORITHM")
+	}
+	if c.OIDC.StubIssuer {
+		return errors.New("refusing to start with the stub OIDC issuer outside development")
+	}
+	return nil
+}
+
+// VerificationKey is a PEM public key file trusted for verification only. KeyID should be the
+// kid the key signed with; like JWTConfig.KeyID it defaults to the key's RFC 7638 thumbprint.
+type VerificationKey struct {
+	KeyID string `json:"key_id"`
+	File  string `json:"file"`
 }
 
 // JWTConfig holds JWT configuration
 type JWTConfig struct {
-	Secret     string `json:"secret"`
-	Expiration int    `json:"expiration"` // time in minutes
+	Secret            string `json:"-"`                  // HS256 only
+	Expiration        int    `json:"expiration"`         // access token lifetime in minutes
+	RefreshExpiration int    `json:"refresh_expiration"` // refresh token lifetime in minutes
+	// Algorithm is HS256, RS256 or EdDSA
+	Algorithm string `json:"algorithm"`
+	// PrivateKeyFile is the PEM key new tokens are signed with (RS256 and EdDSA)
+	PrivateKeyFile string `json:"private_key_file"`
+	// KeyID overrides the kid header, which defaults to the key's RFC 7638 thumbprint
+	KeyID string `json:"key_id"`
+	// VerificationKeys are extra PEM public keys still accepted, e.g. keys being rotated out
+	VerificationKeys []VerificationKey `json:"verification_keys"`
+	// Keys is built from the fields above at startup
+	Keys *KeySet `json:"-"`
+}
+
+// AuthConfig holds login related configuration
+type AuthConfig struct {
+	// AllowEmailOnlyLogin lets users without a password log in with just their email.
+	// It is off unless configured, deployments should only enable it while migrating
+	// accounts to passwords.
+	AllowEmailOnlyLogin bool `json:"allow_email_only_login"`
+	// AllowRegistration enables self-service sign up of workers
+	AllowRegistration bool `json:"allow_registration"`
+	// VerificationExpiration is how long an email verification link stays valid, in minutes
+	VerificationExpiration int `json:"verification_expiration"`
+	// InvitationExpiration is how long an invitation can be accepted, in minutes
+	InvitationExpiration int `json:"invitation_expiration"`
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Driver       string `json:"driver"` // smtp, file or log
+	From         string `json:"from"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     string `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"-"`
+	OutputDir    string `json:"output_dir"` // where the file driver writes emails
+}
+
+// OIDCConfig holds the OpenID Connect provider trusted for SSO login
+type OIDCConfig struct {
+	IssuerURL string `json:"issuer_url"` // SSO login is disabled when empty
+	ClientID  string `json:"client_id"`  // expected audience of ID tokens
+	// JWKSURL overrides the key set URL from the provider's discovery document
+	JWKSURL string `json:"jwks_url"`
+	// AutoProvision creates a worker account for unknown emails instead of rejecting the login
+	AutoProvision bool `json:"auto_provision"`
+	// StubIssuer serves a local test provider under /oidc-stub. Development only.
+	StubIssuer bool `json:"stub_issuer"`
+}
+
+// ShiftDurationLimitHours caps SHIFT_MAX_DURATION_HOURS, no shift may last longer than a week
+const ShiftDurationLimitHours = 7 * 24
+
+// ShiftConfig holds the rules shifts are validated against
+type ShiftConfig struct {
+	// MaxDurationHours is the longest a single shift may last, at most ShiftDurationLimitHours
+	MaxDurationHours int `json:"max_duration_hours"`
+	// MinRestHours is the least time off a worker gets between two of their shifts
+	MinRestHours int `json:"min_rest_hours"`
+	// Roles lists the roles a shift can be created for
+	Roles []string `json:"roles"`
+	// SwapRequiresApproval holds agreed shift swaps until an admin approves them
+	SwapRequiresApproval bool `json:"swap_requires_approval"`
+}
+
+// MinRest is MinRestHours as a duration
+func (c ShiftConfig) MinRest() time.Duration {
+	return time.Duration(c.MinRestHours) * time.Hour
+}
+
+// AllowedRole looks up role case-insensitively and returns it spelled as configured.
+// Every role is allowed when none are configured.
+func (c ShiftConfig) AllowedRole(role string) (string, bool) {
+	if len(c.Roles) == 0 {
+		return role, true
+	}
+	for _, r := range c.Roles {
+		if strings.EqualFold(r, role) {
+			return r, true
+		}
+	}
+	return role, false
 }
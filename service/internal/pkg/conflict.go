@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kinds of schedule conflicts
+const (
+	// ConflictOverlap is a shift running at the same time
+	ConflictOverlap = "overlap"
+	// ConflictMinRest is a shift ending or starting too close to leave the minimum rest
+	ConflictMinRest = "min_rest"
+	// ConflictTimeOff is approved time off of the worker
+	ConflictTimeOff = "time_off"
+	// ConflictUnavailable is a shift falling outside the worker's weekly availability
+	ConflictUnavailable = "unavailable"
+)
+
+// BookedShift is a shift a worker is assigned to or waiting to be approved for
+type BookedShift struct {
+	ShiftID int
+	StartAt time.Time
+	EndAt   time.Time
+	// Pending is set when the worker has only requested the shift
+	Pending bool
+}
+
+// ScheduleConflict is a shift, or time off, of the worker clashing with the shift being
+// assigned. StartAt and EndAt are the period clashing.
+type ScheduleConflict struct {
+	// ShiftID is the clashing shift of overlap and min_rest conflicts
+	ShiftID int `json:"shift_id,omitempty"`
+	// TimeOffID is the clashing time off of time_off conflicts
+	TimeOffID *int   `json:"time_off_id,omitempty"`
+	Kind      string `json:"kind" example:"overlap"`
+	// Pending is set when the worker has only requested the conflicting shift
+	Pending bool      `json:"pending"`
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+	Message string    `json:"message"`
+}
+
+// ScheduleConflictError reports that a worker can't take a shift without clashing with
+// their other shifts, time off or weekly availability
+type ScheduleConflictError struct {
+	Message   string
+	Conflicts []ScheduleConflict
+}
+
+func (e ScheduleConflictError) Error() string {
+	return e.Message
+}
+
+func NewScheduleConflictError(conflicts []ScheduleConflict) ScheduleConflictError {
+	for _, conflict := range conflicts {
+		if conflict.ShiftID != 0 {
+			return ScheduleConflictError{Message: "worker has conflicting shifts", Conflicts: conflicts}
+		}
+	}
+	return ScheduleConflictError{Message: "worker is unavailable at the time of the shift", Conflicts: conflicts}
+}
+
+// RestWindow returns the period a worker's other shifts must stay out of for a shift from
+// start to end to leave them minRest off before and after it
+func RestWindow(start time.Time, end time.Time, minRest time.Duration) (time.Time, time.Time) {
+	return start.Add(-minRest), end.Add(minRest)
+}
+
+// FindScheduleConflicts lists the booked shifts overlapping the shift from start to end, or
+// leaving less than minRest between them and it. Their times are rendered in the zone of
+// start, which is the zone of the shift's location.
+func FindScheduleConflicts(start time.Time, end time.Time, booked []BookedShift, minRest time.Duration) []ScheduleConflict {
+	var conflicts []ScheduleConflict
+	for _, other := range booked {
+		conflict := ScheduleConflict{
+			ShiftID: other.ShiftID,
+			Pending: other.Pending,
+			StartAt: other.StartAt.In(start.Location()),
+			EndAt:   other.EndAt.In(start.Location()),
+		}
+		switch {
+		case other.StartAt.Before(end) && other.EndAt.After(start):
+			conflict.Kind = ConflictOverlap
+			conflict.Message = fmt.Sprintf("overlaps shift %d", other.ShiftID)
+		case !other.StartAt.Before(end) && other.StartAt.Sub(end) < minRest:
+			conflict.Kind = ConflictMinRest
+			conflict.Message = fmt.Sprintf("shift %d starts %s after this one ends, the minimum rest is %s",
+				other.ShiftID, other.StartAt.Sub(end), minRest)
+		case !other.EndAt.After(start) && start.Sub(other.EndAt) < minRest:
+			conflict.Kind = ConflictMinRest
+			conflict.Message = fmt.Sprintf("shift %d ends %s before this one starts, the minimum rest is %s",
+				other.ShiftID, start.Sub(other.EndAt), minRest)
+		default:
+			continue
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindScheduleConflicts(t *testing.T) {
+	day := time.Date(2027, 5, 10, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return day.Add(time.Duration(hour) * time.Hour) }
+	start, end := at(9), at(17)
+	minRest := 8 * time.Hour
+
+	tests := []struct {
+		name   string
+		booked BookedShift
+		want   string
+	}{
+		{name: "same time", booked: BookedShift{ShiftID: 1, StartAt: at(9), EndAt: at(17)}, want: ConflictOverlap},
+		{name: "starts during", booked: BookedShift{ShiftID: 1, StartAt: at(16), EndAt: at(20)}, want: ConflictOverlap},
+		{name: "ends during", booked: BookedShift{ShiftID: 1, StartAt: at(5), EndAt: at(10)}, want: ConflictOverlap},
+		{name: "inside", booked: BookedShift{ShiftID: 1, StartAt: at(11), EndAt: at(12)}, want: ConflictOverlap},
+		{name: "starts right after", booked: BookedShift{ShiftID: 1, StartAt: at(17), EndAt: at(20)}, want: ConflictMinRest},
+		{name: "starts too soon after", booked: BookedShift{ShiftID: 1, StartAt: at(24), EndAt: at(28)}, want: ConflictMinRest},
+		{name: "ends too close before", booked: BookedShift{ShiftID: 1, StartAt: at(-4), EndAt: at(2)}, want: ConflictMinRest},
+		{name: "full rest after", booked: BookedShift{ShiftID: 1, StartAt: at(25), EndAt: at(33)}},
+		{name: "full rest before", booked: BookedShift{ShiftID: 1, StartAt: at(-7), EndAt: at(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts := FindScheduleConflicts(start, end, []BookedShift{tt.booked}, minRest)
+			if tt.want == "" {
+				if len(conflicts) != 0 {
+					t.Fatalf("got %d conflicts, want none: %+v", len(conflicts), conflicts)
+				}
+				return
+			}
+			if len(conflicts) != 1 {
+				t.Fatalf("got %d conflicts, want 1", len(conflicts))
+			}
+			conflict := conflicts[0]
+			if conflict.Kind != tt.want {
+				t.Errorf("Kind = %s, want %s", conflict.Kind, tt.want)
+			}
+			if conflict.ShiftID != tt.booked.ShiftID || !conflict.StartAt.Equal(tt.booked.StartAt) || !conflict.EndAt.Equal(tt.booked.EndAt) {
+				t.Errorf("conflict %+v doesn't describe the booked shift %+v", conflict, tt.booked)
+			}
+		})
+	}
+}
+
+func TestFindScheduleConflictsKeepsPending(t *testing.T) {
+	start := time.Date(2027, 5, 10, 9, 0, 0, 0, time.UTC)
+	end := start.Add(8 * time.Hour)
+	booked := []BookedShift{
+		{ShiftID: 1, StartAt: start, EndAt: end, Pending: true},
+		{ShiftID: 2, StartAt: end.Add(24 * time.Hour), EndAt: end.Add(32 * time.Hour)},
+	}
+
+	conflicts := FindScheduleConflicts(start, end, booked, 0)
+	if len(conflicts) != 1 || conflicts[0].ShiftID != 1 || !conflicts[0].Pending {
+		t.Errorf("got %+v, want only the pending shift 1", conflicts)
+	}
+}
+
+func TestFindScheduleConflictsInZoneOfShift(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2027, 5, 10, 9, 0, 0, 0, jakarta)
+	end := start.Add(8 * time.Hour)
+	booked := []BookedShift{{ShiftID: 1, StartAt: start.UTC(), EndAt: end.UTC()}}
+
+	conflicts := FindScheduleConflicts(start, end, booked, 0)
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(conflicts))
+	}
+	if got := conflicts[0].StartAt.Format(time.RFC3339); got != "2027-05-10T09:00:00+07:00" {
+		t.Errorf("StartAt = %s, want 2027-05-10T09:00:00+07:00", got)
+	}
+}
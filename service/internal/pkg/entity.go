@@ -2,13 +2,27 @@ package pkg
 
 import "time"
 
+// Possible status values for users
+const (
+	UserStatusActive   = "active"
+	UserStatusInactive = "inactive"
+)
+
 // User represents a user in the system
 type User struct {
 	ID        int       `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	Email     string    `json:"email" db:"email"`
-	Role      string    `json:"role" db:"role"` // worker, admin
+	Role      string    `json:"role" db:"role"`     // worker, admin
+	Status    string    `json:"status" db:"status"` // active, inactive
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// EmailVerifiedAt is nil until a self-registered user confirms their email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+}
+
+// IsActive reports whether the user may log in and use the API
+func (u *User) IsActive() bool {
+	return u.Status == UserStatusActive
 }
 
 // Shift represents a work shift in the system
@@ -39,3 +53,14 @@ type Assignment struct {
 	UserID     int       `json:"user_id" db:"user_id"`
 	AssignedAt time.Time `json:"assigned_at" db:"assigned_at"`
 }
+
+// Session represents a refresh token session issued at login
+type Session struct {
+	ID               string     `json:"id" db:"id"`
+	UserID           int        `json:"user_id" db:"user_id"`
+	RefreshTokenHash string     `json:"-" db:"refresh_token_hash"`
+	ExpiresAt        time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
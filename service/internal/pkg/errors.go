@@ -1,6 +1,10 @@
 package pkg
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
 
 // Common errors
 var (
@@ -9,6 +13,14 @@ var (
 
 type ValidationError struct {
 	Message string
+	// Fields lists the individual problems when more than one input field was checked
+	Fields []FieldError
+}
+
+// FieldError describes why a single input field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 func (e ValidationError) Error() string {
@@ -19,6 +31,11 @@ func NewValidationError(message string) ValidationError {
 	return ValidationError{Message: message}
 }
 
+// NewFieldValidationError creates a validation error carrying field-level details
+func NewFieldValidationError(fields []FieldError) ValidationError {
+	return ValidationError{Message: "validation failed", Fields: fields}
+}
+
 type UnauthorizedError struct {
 	Message string
 }
@@ -30,3 +47,37 @@ func (e UnauthorizedError) Error() string {
 func NewUnauthorizedError(message string) UnauthorizedError {
 	return UnauthorizedError{Message: message}
 }
+
+type ForbiddenError struct {
+	Message string
+}
+
+func (e ForbiddenError) Error() string {
+	return e.Message
+}
+
+func NewForbiddenError(message string) ForbiddenError {
+	return ForbiddenError{Message: message}
+}
+
+type ConflictError struct {
+	Message string
+}
+
+func (e ConflictError) Error() string {
+	return e.Message
+}
+
+func NewConflictError(message string) ConflictError {
+	return ConflictError{Message: message}
+}
+
+// IsUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
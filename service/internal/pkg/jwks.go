@@ -0,0 +1,306 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// KeySet holds the key access tokens are signed with and every key they may be verified with.
+// Keeping retired public keys in the verification set lets tokens signed before a key
+// rotation stay valid until they expire.
+type KeySet struct {
+	method     jwt.SigningMethod
+	signingKey interface{}
+	keyID      string
+	// verificationKeys maps a kid to a public key; empty for HS256
+	verificationKeys map[string]crypto.PublicKey
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet builds the key set described by config. HS256 uses the shared secret, RS256 and
+// EdDSA load a PEM private key from PrivateKeyFile plus any extra public keys from
+// VerificationKeys.
+func LoadKeySet(config JWTConfig) (*KeySet, error) {
+	switch config.Algorithm {
+	case AlgorithmHS256, "":
+		if config.Secret == "" {
+			return nil, errors.New("jwt secret is required for HS256")
+		}
+		return &KeySet{method: jwt.SigningMethodHS256, signingKey: []byte(config.Secret)}, nil
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", config.Algorithm)
+	}
+
+	if config.PrivateKeyFile == "" {
+		return nil, fmt.Errorf("a private key file is required for %s", config.Algorithm)
+	}
+	privateKey, err := readPrivateKey(config.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &KeySet{
+		signingKey:       privateKey,
+		verificationKeys: map[string]crypto.PublicKey{},
+	}
+	var publicKey crypto.PublicKey
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		keys.method = jwt.SigningMethodRS256
+		publicKey = &key.PublicKey
+	case ed25519.PrivateKey:
+		keys.method = jwt.SigningMethodEdDSA
+		publicKey = key.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if keys.method.Alg() != config.Algorithm {
+		return nil, fmt.Errorf("private key in %s does not match algorithm %s", config.PrivateKeyFile, config.Algorithm)
+	}
+
+	keys.keyID = config.KeyID
+	if keys.keyID == "" {
+		keys.keyID, err = keyThumbprint(publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys.verificationKeys[keys.keyID] = publicKey
+
+	for _, verificationKey := range config.VerificationKeys {
+		publicKey, err := readPublicKey(verificationKey.File)
+		if err != nil {
+			return nil, err
+		}
+		// A retired key keeps the kid it signed with, or its tokens would no longer verify
+		kid := verificationKey.KeyID
+		if kid == "" {
+			kid, err = keyThumbprint(publicKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+		keys.verificationKeys[kid] = publicKey
+	}
+
+	return keys, nil
+}
+
+// Sign signs claims with the current signing key, setting the kid header for asymmetric keys
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.keyID != "" {
+		token.Header["kid"] = k.keyID
+	}
+	return token.SignedString(k.signingKey)
+}
+
+// Parse verifies a token against the key set and fills claims
+func (k *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	methods := []string{k.method.Alg()}
+	if k.method != jwt.SigningMethodHS256 {
+		// Tokens signed with retired keys may use the other asymmetric algorithm
+		methods = []string{AlgorithmRS256, AlgorithmEdDSA}
+	}
+	return jwt.ParseWithClaims(tokenString, claims, k.keyFunc, jwt.WithValidMethods(methods))
+}
+
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if k.method == jwt.SigningMethodHS256 {
+		return k.signingKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// Guard against a token claiming a different algorithm than its key was made for
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if token.Method.Alg() != AlgorithmRS256 {
+			return nil, errors.New("signing method does not match key")
+		}
+	case ed25519.PublicKey:
+		if token.Method.Alg() != AlgorithmEdDSA {
+			return nil, errors.New("signing method does not match key")
+		}
+	}
+	return key, nil
+}
+
+// JWKS returns the public verification keys. It is empty for HS256, whose secret can't be published.
+func (k *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(k.verificationKeys))
+	for kid := range k.verificationKeys {
+		kids = append(kids, kid)
+	}
+	// The current signing key comes first, retired keys follow in a stable order
+	sort.Slice(kids, func(i, j int) bool {
+		if kids[i] == k.keyID || kids[j] == k.keyID {
+			return kids[i] == k.keyID
+		}
+		return kids[i] < kids[j]
+	})
+
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		jwk, err := publicJWK(k.verificationKeys[kid])
+		if err != nil {
+			continue
+		}
+		jwk.Kid = kid
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func publicJWK(key crypto.PublicKey) (JWK, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: AlgorithmRS256,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: AlgorithmEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// keyThumbprint computes the RFC 7638 thumbprint of a public key, used as its kid
+func keyThumbprint(key crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+
+	// The members must be in lexicographic order with no whitespace
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key in %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// readPublicKey reads a PEM public key. A private key file is accepted as well, only its
+// public half is kept.
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key in %s: %w", path, err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		privateKey, err := readPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type in %s", path)
+		}
+		return signer.Public(), nil
+	}
+}
@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeEd25519Key writes a new PKCS #8 Ed25519 private key to dir and returns its path
+func writeEd25519Key(t *testing.T, dir, name string) string {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeySetRotationKeepsKeyIDs(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeEd25519Key(t, dir, "old.pem")
+	newKey := writeEd25519Key(t, dir, "new.pem")
+
+	before, err := LoadKeySet(JWTConfig{Algorithm: AlgorithmEdDSA, PrivateKeyFile: oldKey, KeyID: "2026-04"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := before.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := LoadKeySet(JWTConfig{
+		Algorithm:        AlgorithmEdDSA,
+		PrivateKeyFile:   newKey,
+		KeyID:            "2026-10",
+		VerificationKeys: []VerificationKey{{KeyID: "2026-04", File: oldKey}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Parse(token, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("token signed before the rotation doesn't verify: %v", err)
+	}
+
+	var kids []string
+	for _, key := range after.JWKS().Keys {
+		kids = append(kids, key.Kid)
+	}
+	if len(kids) != 2 || kids[0] != "2026-10" || kids[1] != "2026-04" {
+		t.Errorf("JWKS kids = %v, want [2026-10 2026-04]", kids)
+	}
+}
+
+func TestKeySetRetiredKeyDefaultsToThumbprint(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeEd25519Key(t, dir, "old.pem")
+	newKey := writeEd25519Key(t, dir, "new.pem")
+
+	before, err := LoadKeySet(JWTConfig{Algorithm: AlgorithmEdDSA, PrivateKeyFile: oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := before.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := LoadKeySet(JWTConfig{
+		Algorithm:        AlgorithmEdDSA,
+		PrivateKeyFile:   newKey,
+		VerificationKeys: []VerificationKey{{File: oldKey}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Parse(token, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("token signed with the thumbprint kid doesn't verify: %v", err)
+	}
+}
@@ -3,7 +3,6 @@ package pkg
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -19,6 +18,8 @@ const (
 	UserIDKey UserContext = "user_id"
 	// UserKey is the key used to store the full user object in the context
 	UserKey UserContext = "user"
+	// SessionIDKey is the key used to store the session the access token belongs to
+	SessionIDKey UserContext = "session_id"
 )
 
 // Claims defines the structure for JWT claims with just user_id
@@ -26,6 +27,8 @@ const (
 type Claims struct {
 	// UserID is the unique identifier of the authenticated user
 	UserID int `json:"user_id" example:"1"`
+	// SessionID links the access token to the refresh session it was issued for
+	SessionID string `json:"sid" example:"3f9a6c1e2b7d4a58"`
 	jwt.RegisteredClaims
 }
 
@@ -46,19 +49,8 @@ func JWTAuth(config *Config, db *sql.DB) func(http.Handler) http.Handler {
 				return
 			}
 
-			fmt.Println("config.JWT.Secret", config.JWT.Secret)
-			fmt.Println("bearerToken[1]", bearerToken[1])
-
-			// Parse the JWT token
-			token, err := jwt.ParseWithClaims(
-				bearerToken[1],
-				&Claims{},
-				func(token *jwt.Token) (interface{}, error) {
-					return []byte(config.JWT.Secret), nil
-				},
-			)
-
-			fmt.Println("token", token)
+			// Parse the JWT token and verify it against the current and retired keys
+			token, err := config.JWT.Keys.Parse(bearerToken[1], &Claims{})
 
 			// Handle any errors
 			if err != nil {
@@ -67,14 +59,32 @@ func JWTAuth(config *Config, db *sql.DB) func(http.Handler) http.Handler {
 			}
 
 			// Validate the token and extract claims
-			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+			if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.SessionID != "" {
 				// Create context with user ID
 				ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+				ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+
+				// Reject tokens whose session was revoked before the token expired
+				var revokedAt sql.NullTime
+				err := db.QueryRowContext(ctx, "SELECT revoked_at FROM sessions WHERE id = ? AND user_id = ?", claims.SessionID, claims.UserID).
+					Scan(&revokedAt)
+				if err != nil {
+					if err == sql.ErrNoRows {
+						http.Error(w, "Session not found", http.StatusUnauthorized)
+						return
+					}
+					http.Error(w, "Error fetching session", http.StatusInternalServerError)
+					return
+				}
+				if revokedAt.Valid {
+					http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+					return
+				}
 
 				// Fetch full user details from database
 				var user User
-				err := db.QueryRowContext(ctx, "SELECT id, name, email, role, created_at FROM users WHERE id = ?", claims.UserID).
-					Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt)
+				err = db.QueryRowContext(ctx, "SELECT id, name, email, role, status, created_at FROM users WHERE id = ?", claims.UserID).
+					Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Status, &user.CreatedAt)
 
 				if err != nil {
 					if err == sql.ErrNoRows {
@@ -84,6 +94,10 @@ func JWTAuth(config *Config, db *sql.DB) func(http.Handler) http.Handler {
 					http.Error(w, "Error fetching user details", http.StatusInternalServerError)
 					return
 				}
+				if !user.IsActive() {
+					http.Error(w, "User account is deactivated", http.StatusUnauthorized)
+					return
+				}
 
 				// Add full user to context
 				ctx = context.WithValue(ctx, UserKey, &user)
@@ -119,19 +133,26 @@ func GetUserFromContext(ctx context.Context) (*User, bool) {
 	return user, ok
 }
 
-func GenerateJWT(userID int, config *Config) (string, error) {
+// GetSessionIDFromContext retrieves the session ID of the access token from the request context
+func GetSessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(SessionIDKey).(string)
+	return sessionID, ok
+}
+
+// GenerateJWT issues a short-lived access token bound to a session
+func GenerateJWT(userID int, sessionID string, config *Config) (string, error) {
 	expirationTime := time.Now().Add(time.Duration(config.JWT.Expiration) * time.Minute)
 
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.JWT.Secret))
+	return config.JWT.Keys.Sign(claims)
 }
 
 // RequireAuth is a convenience wrapper to ensure a route requires authentication
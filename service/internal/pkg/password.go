@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the minimum number of characters accepted for a password
+const MinPasswordLength = 8
+
+// ErrPasswordMismatch is returned when a password does not match its stored hash
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// HashPassword hashes a plain text password using bcrypt
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", NewValidationError("password must be at least 8 characters long")
+	}
+	// bcrypt ignores everything past 72 bytes, so refuse instead of silently truncating
+	if len(password) > 72 {
+		return "", NewValidationError("password must be at most 72 bytes long")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares a plain text password with a bcrypt hash
+func CheckPassword(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
@@ -0,0 +1,282 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of list endpoints
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// ListQuery is the filtering, sorting and paging of a list request. Filters left empty
+// don't narrow the list.
+type ListQuery struct {
+	// From and To are dates, both inclusive, in the time zone of each shift's location
+	From       string
+	To         string
+	LocationID *int
+	Role       string
+	// Assigned keeps only assigned shifts when true and only open shifts when false
+	Assigned *bool
+	UserID   *int
+	// Sort names the sort key and Desc reverses it. Empty picks the list's default.
+	Sort string
+	Desc bool
+	// Limit caps the number of rows returned, 0 returns them all
+	Limit int
+	// Cursor resumes after the last row of a previous page, it is that page's next_cursor
+	Cursor string
+}
+
+// Pagination describes the page of rows in a list response
+type Pagination struct {
+	Limit int `json:"limit"`
+	// Sort is the sort key applied, prefixed with - when descending
+	Sort string `json:"sort" example:"-start_at"`
+	// NextCursor fetches the next page when passed as cursor, it is empty on the last page
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// ParseListQuery reads the list query parameters shared by list endpoints: from, to,
+// location_id, role, assigned, user_id, sort (e.g. start_at or -start_at), limit and cursor.
+// Every invalid parameter is reported as a field error.
+func ParseListQuery(r *http.Request) (*ListQuery, error) {
+	query := r.URL.Query()
+	q := &ListQuery{
+		From:   strings.TrimSpace(query.Get("from")),
+		To:     strings.TrimSpace(query.Get("to")),
+		Role:   strings.TrimSpace(query.Get("role")),
+		Cursor: query.Get("cursor"),
+		Limit:  DefaultListLimit,
+	}
+	var errs []FieldError
+
+	positive := func(field string) *int {
+		value := query.Get(field)
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			errs = append(errs, FieldError{Field: field, Message: "must be a positive integer"})
+			return nil
+		}
+		return &n
+	}
+	q.LocationID = positive("location_id")
+	q.UserID = positive("user_id")
+	if limit := positive("limit"); limit != nil {
+		if *limit > MaxListLimit {
+			errs = append(errs, FieldError{Field: "limit", Message: fmt.Sprintf("cannot be more than %d", MaxListLimit)})
+		}
+		q.Limit = *limit
+	}
+
+	if value := query.Get("assigned"); value != "" {
+		assigned, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "assigned", Message: "must be true or false"})
+		} else {
+			q.Assigned = &assigned
+		}
+	}
+
+	if value := strings.TrimSpace(query.Get("sort")); value != "" {
+		q.Sort = strings.TrimPrefix(value, "-")
+		q.Desc = strings.HasPrefix(value, "-")
+	}
+
+	errs = append(errs, q.Validate()...)
+	if len(errs) > 0 {
+		return nil, NewFieldValidationError(errs)
+	}
+	return q, nil
+}
+
+// Validate checks the date range, each end of which may be left out
+func (q *ListQuery) Validate() []FieldError {
+	var errs []FieldError
+	from, fromErr := time.Parse(DateLayout, q.From)
+	if q.From != "" && fromErr != nil {
+		errs = append(errs, FieldError{Field: "from", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	to, toErr := time.Parse(DateLayout, q.To)
+	if q.To != "" && toErr != nil {
+		errs = append(errs, FieldError{Field: "to", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	if fromErr == nil && toErr == nil && to.Before(from) {
+		errs = append(errs, FieldError{Field: "to", Message: "must not be before from"})
+	}
+	return errs
+}
+
+// SortKey is a column a list can be sorted by
+type SortKey[T any] struct {
+	// Column is the SQL expression sorted on, it must never be NULL
+	Column string
+	// Value returns the column's value for a row as it is stored, so a page can resume after it
+	Value func(row *T) interface{}
+}
+
+// ListSpec describes how a ListQuery applies to the SQL of a list of T. A filter without a
+// column is not supported by the list and rejected when given.
+type ListSpec[T any] struct {
+	Sorts       map[string]SortKey[T]
+	DefaultSort string
+	DefaultDesc bool
+	// IDColumn is the unique column breaking ties between equal sort values, ID reads it from a row
+	IDColumn string
+	ID       func(row *T) int
+
+	// Date is the DATE column compared with from and to
+	Date     string
+	Location string
+	Role     string
+	User     string
+	// Assigned is a SQL condition that holds for assigned shifts
+	Assigned string
+}
+
+// listCursor is the decoded form of a page cursor
+type listCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d,omitempty"`
+	Value interface{} `json:"v"`
+	ID    int         `json:"id"`
+}
+
+// Build returns the WHERE, ORDER BY and LIMIT clauses applying q, to append to the list's
+// SELECT, along with their arguments. where and args are conditions of the list itself,
+// ANDed with the filters. One row more than the limit is fetched so Page can tell whether
+// another page follows.
+func (s *ListSpec[T]) Build(q *ListQuery, where []string, args []interface{}) (string, []interface{}, error) {
+	var errs []FieldError
+	filter := func(field string, column string, given bool, condition string, arg interface{}) {
+		if !given {
+			return
+		}
+		if column == "" {
+			errs = append(errs, FieldError{Field: field, Message: "is not supported by this list"})
+			return
+		}
+		where = append(where, fmt.Sprintf(condition, column))
+		if arg != nil {
+			args = append(args, arg)
+		}
+	}
+	filter("from", s.Date, q.From != "", "%s >= ?", q.From)
+	filter("to", s.Date, q.To != "", "%s <= ?", q.To)
+	if q.LocationID != nil {
+		filter("location_id", s.Location, true, "%s = ?", *q.LocationID)
+	}
+	filter("role", s.Role, q.Role != "", "LOWER(%s) = LOWER(?)", q.Role)
+	if q.UserID != nil {
+		filter("user_id", s.User, true, "%s = ?", *q.UserID)
+	}
+	if q.Assigned != nil {
+		condition := "(%s)"
+		if !*q.Assigned {
+			condition = "NOT (%s)"
+		}
+		filter("assigned", s.Assigned, true, condition, nil)
+	}
+
+	if q.Sort == "" {
+		q.Sort, q.Desc = s.DefaultSort, s.DefaultDesc
+	}
+	key, ok := s.Sorts[q.Sort]
+	if !ok {
+		errs = append(errs, FieldError{Field: "sort", Message: "must be one of: " + strings.Join(s.sortNames(), ", ")})
+	}
+
+	if q.Cursor != "" && ok {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort || cursor.Desc != q.Desc {
+			errs = append(errs, FieldError{Field: "cursor", Message: "is invalid for this sort"})
+		} else {
+			operator := ">"
+			if q.Desc {
+				operator = "<"
+			}
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s %[2]s ?))", key.Column, operator, s.IDColumn))
+			args = append(args, cursor.Value, cursor.Value, cursor.ID)
+		}
+	}
+	if len(errs) > 0 {
+		return "", nil, NewFieldValidationError(errs)
+	}
+
+	var clause strings.Builder
+	if len(where) > 0 {
+		clause.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	direction := "ASC"
+	if q.Desc {
+		direction = "DESC"
+	}
+	fmt.Fprintf(&clause, " ORDER BY %s %s, %s %s", key.Column, direction, s.IDColumn, direction)
+	if q.Limit > 0 {
+		clause.WriteString(" LIMIT ?")
+		args = append(args, q.Limit+1)
+	}
+	return clause.String(), args, nil
+}
+
+// Page trims the extra row Build asked for and describes the page, with the cursor of the
+// next one when more rows follow
+func (s *ListSpec[T]) Page(q *ListQuery, rows []T) ([]T, *Pagination) {
+	page := &Pagination{Limit: q.Limit, Sort: q.Sort}
+	if q.Desc {
+		page.Sort = "-" + q.Sort
+	}
+	if q.Limit <= 0 || len(rows) <= q.Limit {
+		return rows, page
+	}
+
+	rows = rows[:q.Limit]
+	last := &rows[len(rows)-1]
+	page.HasMore = true
+	page.NextCursor = encodeCursor(listCursor{
+		Sort:  q.Sort,
+		Desc:  q.Desc,
+		Value: s.Sorts[q.Sort].Value(last),
+		ID:    s.ID(last),
+	})
+	return rows, page
+}
+
+func (s *ListSpec[T]) sortNames() []string {
+	names := make([]string, 0, len(s.Sorts))
+	for name := range s.Sorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func encodeCursor(cursor listCursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(value string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
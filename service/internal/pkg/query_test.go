@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type listRow struct {
+	ID   int
+	Name string
+}
+
+var testList = &ListSpec[listRow]{
+	Sorts: map[string]SortKey[listRow]{
+		"name": {Column: "name", Value: func(r *listRow) interface{} { return r.Name }},
+		"id":   {Column: "id", Value: func(r *listRow) interface{} { return r.ID }},
+	},
+	DefaultSort: "name",
+	IDColumn:    "id",
+	ID:          func(r *listRow) int { return r.ID },
+	Role:        "role",
+}
+
+func TestListSpecBuild(t *testing.T) {
+	locationID := 3
+	tests := []struct {
+		name       string
+		query      ListQuery
+		wantClause string
+		wantArgs   []interface{}
+		wantFields []string
+	}{
+		{
+			name:       "default sort",
+			query:      ListQuery{Limit: 10},
+			wantClause: " WHERE deleted = 0 ORDER BY name ASC, id ASC LIMIT ?",
+			wantArgs:   []interface{}{11},
+		},
+		{
+			name:       "descending without limit",
+			query:      ListQuery{Sort: "id", Desc: true},
+			wantClause: " WHERE deleted = 0 ORDER BY id DESC, id DESC",
+		},
+		{
+			name:       "supported filter",
+			query:      ListQuery{Role: "Cashier", Limit: 5},
+			wantClause: " WHERE deleted = 0 AND LOWER(role) = LOWER(?) ORDER BY name ASC, id ASC LIMIT ?",
+			wantArgs:   []interface{}{"Cashier", 6},
+		},
+		{
+			name:       "unsupported filters",
+			query:      ListQuery{From: "2027-01-01", LocationID: &locationID},
+			wantFields: []string{"from", "location_id"},
+		},
+		{
+			name:       "unknown sort",
+			query:      ListQuery{Sort: "email"},
+			wantFields: []string{"sort"},
+		},
+		{
+			name:       "garbled cursor",
+			query:      ListQuery{Cursor: "not a cursor"},
+			wantFields: []string{"cursor"},
+		},
+		{
+			name:       "cursor of another sort",
+			query:      ListQuery{Sort: "id", Cursor: encodeCursor(listCursor{Sort: "name", Value: "b", ID: 2})},
+			wantFields: []string{"cursor"},
+		},
+		{
+			name:       "cursor of the other direction",
+			query:      ListQuery{Sort: "name", Cursor: encodeCursor(listCursor{Sort: "name", Desc: true, Value: "b", ID: 2})},
+			wantFields: []string{"cursor"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args, err := testList.Build(&tt.query, []string{"deleted = 0"}, nil)
+			if tt.wantFields != nil {
+				var validationErr ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("err = %v, want a field validation error", err)
+				}
+				var fields []string
+				for _, fieldErr := range validationErr.Fields {
+					fields = append(fields, fieldErr.Field)
+				}
+				if !reflect.DeepEqual(fields, tt.wantFields) {
+					t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clause != tt.wantClause {
+				t.Errorf("clause = %q, want %q", clause, tt.wantClause)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestListSpecPage(t *testing.T) {
+	rows := []listRow{{ID: 1, Name: "a"}, {ID: 4, Name: "b"}, {ID: 2, Name: "c"}}
+
+	q := &ListQuery{Limit: 2}
+	if _, _, err := testList.Build(q, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	page, pagination := testList.Page(q, rows)
+	if len(page) != 2 || !pagination.HasMore || pagination.NextCursor == "" || pagination.Sort != "name" {
+		t.Fatalf("got %v %+v, want the first two rows and a cursor", page, pagination)
+	}
+
+	// The next page resumes after the last row of this one, ties broken by id
+	next := &ListQuery{Limit: 2, Cursor: pagination.NextCursor}
+	clause, args, err := testList.Build(next, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantClause := " WHERE (name > ? OR (name = ? AND id > ?)) ORDER BY name ASC, id ASC LIMIT ?"
+	if clause != wantClause {
+		t.Errorf("clause = %q, want %q", clause, wantClause)
+	}
+	if want := []interface{}{"b", "b", 4, 3}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	last, pagination := testList.Page(next, rows[2:])
+	if len(last) != 1 || pagination.HasMore || pagination.NextCursor != "" {
+		t.Errorf("got %v %+v, want the last row without a cursor", last, pagination)
+	}
+}
+
+func TestListSpecPageDescending(t *testing.T) {
+	q := &ListQuery{Sort: "id", Desc: true, Limit: 1}
+	_, pagination := testList.Page(q, []listRow{{ID: 9}, {ID: 7}})
+	if pagination.Sort != "-id" {
+		t.Errorf("Sort = %s, want -id", pagination.Sort)
+	}
+
+	clause, args, err := testList.Build(&ListQuery{Sort: "id", Desc: true, Limit: 1, Cursor: pagination.NextCursor}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " WHERE (id < ? OR (id = ? AND id < ?)) ORDER BY id DESC, id DESC LIMIT ?"; clause != want {
+		t.Errorf("clause = %q, want %q", clause, want)
+	}
+	// Cursor values come back from JSON as float64
+	if want := []interface{}{float64(9), float64(9), 9, 2}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -16,6 +17,12 @@ type BaseResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	// Errors holds field-level validation details on 422 responses
+	Errors []FieldError `json:"errors,omitempty"`
+	// Pagination describes the page of rows on list responses
+	Pagination *Pagination `json:"pagination,omitempty"`
+	// Conflicts lists the clashing shifts on 409 responses to assigning a worker
+	Conflicts []ScheduleConflict `json:"conflicts,omitempty"`
 }
 
 func JsonResponse(w http.ResponseWriter, d any, c int) {
@@ -69,6 +76,13 @@ func SuccessResponse(data interface{}) BaseResponse {
 	}
 }
 
+// PaginatedResponse creates a standard success response for a page of a list
+func PaginatedResponse(data interface{}, page *Pagination) BaseResponse {
+	response := SuccessResponse(data)
+	response.Pagination = page
+	return response
+}
+
 // NewErrorResponse creates a standard error response with a message
 func NewErrorResponse(message string) BaseResponse {
 	return BaseResponse{
@@ -77,3 +91,50 @@ func NewErrorResponse(message string) BaseResponse {
 		Data:    nil,
 	}
 }
+
+// StatusFromError maps the common service errors to an HTTP status code and a message safe to show clients.
+// ok is false for unexpected errors, which callers should log and report as a 500.
+func StatusFromError(err error) (status int, message string, ok bool) {
+	var validationErr ValidationError
+	var unauthorizedErr UnauthorizedError
+	var forbiddenErr ForbiddenError
+	var conflictErr ConflictError
+	var scheduleConflictErr ScheduleConflictError
+
+	switch {
+	case errors.As(err, &validationErr):
+		// Well-formed input that fails field rules is unprocessable rather than a bad request
+		if len(validationErr.Fields) > 0 {
+			return http.StatusUnprocessableEntity, validationErr.Message, true
+		}
+		return http.StatusBadRequest, validationErr.Message, true
+	case errors.As(err, &unauthorizedErr):
+		return http.StatusUnauthorized, unauthorizedErr.Message, true
+	case errors.As(err, &forbiddenErr):
+		return http.StatusForbidden, forbiddenErr.Message, true
+	case errors.As(err, &conflictErr):
+		return http.StatusConflict, conflictErr.Message, true
+	case errors.As(err, &scheduleConflictErr):
+		return http.StatusConflict, scheduleConflictErr.Message, true
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, "Resource not found", true
+	}
+	return http.StatusInternalServerError, "", false
+}
+
+// ErrorResponseFromError is StatusFromError for handlers that also report field-level validation
+// details and schedule conflicts
+func ErrorResponseFromError(err error) (status int, response BaseResponse, ok bool) {
+	status, message, ok := StatusFromError(err)
+	response = NewErrorResponse(message)
+
+	var validationErr ValidationError
+	if errors.As(err, &validationErr) {
+		response.Errors = validationErr.Fields
+	}
+	var scheduleConflictErr ScheduleConflictError
+	if errors.As(err, &scheduleConflictErr) {
+		response.Conflicts = scheduleConflictErr.Conflicts
+	}
+	return status, response, ok
+}
@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"strings"
+	"time"
+)
+
+// Layouts of the legacy date and wall clock fields of a schedule
+const (
+	DateLayout  = "2006-01-02"
+	ClockLayout = "15:04:05"
+)
+
+// clockLayouts are the accepted formats for wall clock times
+var clockLayouts = []string{ClockLayout, "15:04"}
+
+// ParseClock parses a wall clock time in HH:MM or HH:MM:SS format
+func ParseClock(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	var err error
+	for _, layout := range clockLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// AtClock combines a date with the wall clock time of clock in loc. Times skipped by a
+// daylight saving change are moved forward by the length of the gap, so 02:30 on a day the
+// clocks go from 02:00 to 03:00 is 03:30. Times repeated when the clocks go back are the
+// first of the two.
+func AtClock(date time.Time, clock time.Time, loc *time.Location) time.Time {
+	t := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, loc)
+	if t.Hour() == clock.Hour() && t.Minute() == clock.Minute() && t.Second() == clock.Second() {
+		return t
+	}
+
+	// The clock doesn't exist on that day and time.Date read it with the offset after the
+	// gap. Read with the offset before it, it lands as far past the gap as it was into it.
+	_, before := t.Add(-12 * time.Hour).Zone()
+	wall := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// Schedule is when a shift takes place. The instants are rendered in the zone of the
+// shift's location unless a client asked for another one.
+type Schedule struct {
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+	// DurationMinutes is the time between start_at and end_at
+	DurationMinutes int `json:"duration_minutes"`
+	// TimeZone is the IANA time zone of the shift's location
+	TimeZone string `json:"time_zone" example:"Asia/Jakarta"`
+	// Date, StartTime and EndTime are the legacy form of start_at and end_at, in the same zone
+	Date      string `json:"date"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// Overnight is set when the shift ends on a later day than it starts
+	Overnight bool `json:"overnight"`
+}
+
+// NewSchedule renders a shift running from start to end in the named time zone.
+// Zones that can't be loaded fall back to UTC.
+func NewSchedule(start time.Time, end time.Time, timeZone string) Schedule {
+	loc, err := LoadTimeZone(timeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	s := Schedule{StartAt: start, EndAt: end, TimeZone: loc.String()}
+	s.In(loc)
+	return s
+}
+
+// In renders the schedule in loc. A nil loc keeps the current zone.
+func (s *Schedule) In(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	s.StartAt, s.EndAt = s.StartAt.In(loc), s.EndAt.In(loc)
+	s.DurationMinutes = int(s.EndAt.Sub(s.StartAt) / time.Minute)
+	s.Date = s.StartAt.Format(DateLayout)
+	s.StartTime = s.StartAt.Format(ClockLayout)
+	s.EndTime = s.EndAt.Format(ClockLayout)
+	s.Overnight = s.EndAt.Format(DateLayout) != s.Date
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAtClock(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		date  string
+		clock string
+		loc   *time.Location
+		want  string
+	}{
+		{name: "plain day", date: "2027-03-10", clock: "09:00", loc: newYork, want: "2027-03-10T09:00:00-05:00"},
+		{name: "zone without daylight saving", date: "2027-03-14", clock: "02:30", loc: jakarta, want: "2027-03-14T02:30:00+07:00"},
+		{name: "before the spring gap", date: "2027-03-14", clock: "01:59", loc: newYork, want: "2027-03-14T01:59:00-05:00"},
+		{name: "start of the spring gap", date: "2027-03-14", clock: "02:00", loc: newYork, want: "2027-03-14T03:00:00-04:00"},
+		{name: "inside the spring gap", date: "2027-03-14", clock: "02:30", loc: newYork, want: "2027-03-14T03:30:00-04:00"},
+		{name: "after the spring gap", date: "2027-03-14", clock: "03:00", loc: newYork, want: "2027-03-14T03:00:00-04:00"},
+		{name: "repeated in the autumn", date: "2027-11-07", clock: "01:30", loc: newYork, want: "2027-11-07T01:30:00-04:00"},
+		{name: "after the autumn change", date: "2027-11-07", clock: "02:30", loc: newYork, want: "2027-11-07T02:30:00-05:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := time.Parse(DateLayout, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clock, err := ParseClock(tt.clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := AtClock(date, clock, tt.loc).Format(time.RFC3339); got != tt.want {
+				t.Errorf("AtClock(%s, %s) = %s, want %s", tt.date, tt.clock, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleAcrossSpringGap(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date, _ := time.Parse(DateLayout, "2027-03-14")
+	start, _ := ParseClock("02:30")
+	end, _ := ParseClock("06:00")
+
+	schedule := NewSchedule(AtClock(date, start, newYork), AtClock(date, end, newYork), "America/New_York")
+	if schedule.StartTime != "03:30:00" {
+		t.Errorf("StartTime = %s, want 03:30:00", schedule.StartTime)
+	}
+	if schedule.DurationMinutes != 150 {
+		t.Errorf("DurationMinutes = %d, want 150", schedule.DurationMinutes)
+	}
+}
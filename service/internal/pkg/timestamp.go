@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimestampLayout is the format of instants stored in TIMESTAMP columns that are compared in SQL.
+// Values are always written in UTC so they order correctly as text.
+const TimestampLayout = "2006-01-02 15:04:05"
+
+// FormatTimestamp formats t in UTC using TimestampLayout
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampLayout)
+}
+
+// timeZones caches loaded zones, time.LoadLocation reads the zone database on every call
+var timeZones sync.Map
+
+// LoadTimeZone loads an IANA time zone such as "Asia/Jakarta". An empty name is UTC.
+func LoadTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := timeZones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	// Local depends on the server's settings and is not a zone clients can rely on
+	if name == "Local" {
+		return nil, NewValidationError("unknown time zone " + name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, NewValidationError("unknown time zone " + name)
+	}
+	timeZones.Store(name, loc)
+	return loc, nil
+}
+
+// TimeZoneFromRequest reads the optional tz query parameter times should be rendered in.
+// It returns nil when the parameter is not set.
+func TimeZoneFromRequest(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return nil, nil
+	}
+	return LoadTimeZone(name)
+}
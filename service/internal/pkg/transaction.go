@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX runs queries, it is satisfied by both *sql.DB and *sql.Tx
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// UnitOfWork runs the calls of several repositories in one transaction
+type UnitOfWork interface {
+	// Do calls fn with a context carrying the transaction. The transaction is committed
+	// when fn returns nil and rolled back otherwise. Calls nested in a running unit of work
+	// join its transaction.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type unitOfWork struct {
+	db *sql.DB
+}
+
+// NewUnitOfWork creates a new instance of UnitOfWork
+func NewUnitOfWork(db *sql.DB) UnitOfWork {
+	return &unitOfWork{db: db}
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Conn returns the transaction of the unit of work running in ctx, or db outside of one.
+// Repositories run their queries on it so they take part in the caller's transaction.
+func Conn(ctx context.Context, db *sql.DB) DBTX {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// Transact runs fn in the transaction of the unit of work running in ctx, or in one of its
+// own outside of a unit of work. Repositories writing several rows use it, so their writes
+// are atomic on their own and still take part in the caller's transaction.
+func Transact(ctx context.Context, db *sql.DB, fn func(tx DBTX) error) error {
+	return NewUnitOfWork(db).Do(ctx, func(ctx context.Context) error {
+		return fn(Conn(ctx, db))
+	})
+}
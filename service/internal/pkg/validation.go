@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// NormalizeEmail trims and lower-cases an email address and checks that it is a bare address
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", NewValidationError("email is invalid")
+	}
+	return email, nil
+}
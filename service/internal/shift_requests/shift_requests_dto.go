@@ -1,32 +1,113 @@
 package shift_requests
 
-import "time"
+import (
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/shifts"
+)
 
 // Possible status values for shift requests
 const (
 	StatusPending  = "pending"
 	StatusApproved = "approved"
 	StatusRejected = "rejected"
+	// StatusWithdrawn is a request the worker took back before it was reviewed
+	StatusWithdrawn = "withdrawn"
+	// StatusExpired is a request still pending when the shift started
+	StatusExpired = "expired"
+	// StatusUnassigned is an approved request of a worker later taken off the shift
+	StatusUnassigned = "unassigned"
 )
 
+// transitions lists the statuses each status can move to. Pending requests are reviewed,
+// approved ones end when the worker is unassigned, the others are final.
+var transitions = map[string][]string{
+	StatusPending:  {StatusApproved, StatusRejected, StatusWithdrawn, StatusExpired},
+	StatusApproved: {StatusUnassigned},
+}
+
+// CanTransition reports whether a request with status from may move to status to
+func CanTransition(from string, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ReasonAssignedToOther is the reason given to the other pending requests for a shift
+// when one of them is approved
+const ReasonAssignedToOther = "The shift was assigned to another worker"
+
+// ReasonExpired is the reason given to requests nobody reviewed before the shift started
+const ReasonExpired = "The shift started before the request was reviewed"
+
 type CreateShiftRequestDTO struct {
 	ShiftID int `json:"shift_id" binding:"required"`
 }
 
+// RejectShiftRequestDTO optionally tells the worker why their request was rejected
+type RejectShiftRequestDTO struct {
+	Reason string `json:"reason" example:"We need someone with forklift training"`
+}
+
 type ShiftRequestResponse struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	UserName    string    `json:"user_name"`
-	ShiftID     int       `json:"shift_id"`
-	Status      string    `json:"status"`
-	StartTime   time.Time `json:"start_time"`
-	EndTime     time.Time `json:"end_time"`
-	Date        time.Time `json:"date"`
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+	ShiftID  int    `json:"shift_id"`
+	Status   string `json:"status"`
+	// Reason is why a rejected or expired request was turned down
+	Reason string `json:"reason"`
+	// ReviewedBy is the admin who approved or rejected the request
+	ReviewedBy *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	// The requested shift's schedule, in the zone of its location
+	pkg.Schedule
 	RequestedAt time.Time `json:"requested_at"`
 }
 
+// In renders the request's times in loc. A nil loc keeps the zone of the shift's location.
+func (r *ShiftRequestResponse) In(loc *time.Location) {
+	if loc == nil {
+		loc, _ = pkg.LoadTimeZone(r.TimeZone)
+	}
+	if loc == nil {
+		return
+	}
+	r.Schedule.In(loc)
+	r.RequestedAt = r.RequestedAt.In(loc)
+	if r.ReviewedAt != nil {
+		reviewedAt := r.ReviewedAt.In(loc)
+		r.ReviewedAt = &reviewedAt
+	}
+}
+
+// ShiftRequestFilter is a list query narrowed further by status and shift
 type ShiftRequestFilter struct {
+	pkg.ListQuery
 	Status  string `json:"status"`
-	UserID  int    `json:"user_id"`
 	ShiftID int    `json:"shift_id"`
 }
+
+// Candidate is a pending request for a shift, with what the admin weighs when choosing
+// between the workers who requested it
+type Candidate struct {
+	// Rank orders the candidates from the best fit, starting at 1
+	Rank int `json:"rank"`
+	ShiftRequestResponse
+	// RoleShifts counts the worker's other assignments in the shift's role
+	RoleShifts int `json:"role_shifts"`
+	// WeekMinutes is the time the worker is already assigned in the week of the shift
+	WeekMinutes int `json:"week_minutes"`
+	// Overlaps is set when the worker is assigned to a shift overlapping this one
+	Overlaps bool `json:"overlaps"`
+}
+
+// CandidatesResponse is a shift with the ranked workers who requested it
+type CandidatesResponse struct {
+	Shift      *shifts.ShiftResponse `json:"shift"`
+	Candidates []Candidate           `json:"candidates"`
+}
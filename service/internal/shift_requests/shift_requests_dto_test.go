@@ -0,0 +1,26 @@
+package shift_requests
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	statuses := []string{StatusPending, StatusApproved, StatusRejected, StatusWithdrawn, StatusExpired, StatusUnassigned}
+	allowed := map[[2]string]bool{
+		{StatusPending, StatusApproved}:    true,
+		{StatusPending, StatusRejected}:    true,
+		{StatusPending, StatusWithdrawn}:   true,
+		{StatusPending, StatusExpired}:     true,
+		{StatusApproved, StatusUnassigned}: true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+	if CanTransition("unknown", StatusApproved) {
+		t.Error("CanTransition allows an unknown status to move")
+	}
+}
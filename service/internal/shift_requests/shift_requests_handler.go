@@ -2,9 +2,12 @@ package shift_requests
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
+	"github.com/afrianjunior/justpayd/internal/assignments"
 	"github.com/afrianjunior/justpayd/internal/pkg"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
@@ -23,10 +26,20 @@ func NewShiftRequestHandler(shiftRequestService ShiftRequestService, logger *zap
 }
 
 func (h *ShiftRequestHandler) RegisterRoutes(r chi.Router) {
-	r.Post("/", h.CreateShiftRequest)
-	r.Get("/", h.GetShiftRequests)
-	r.Put("/approve/{id}", h.ApproveShiftRequest)
-	r.Put("/reject/{id}", h.RejectShiftRequest)
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftRequestsCreate))
+		r.Post("/", h.CreateShiftRequest)
+		r.Get("/mine", h.GetMyShiftRequests)
+		r.Put("/withdraw/{id}", h.WithdrawShiftRequest)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftRequestsReview))
+		r.Get("/", h.GetShiftRequests)
+		r.Get("/candidates/{shift_id}", h.GetCandidates)
+		r.Put("/approve/{id}", h.ApproveShiftRequest)
+		r.Put("/reject/{id}", h.RejectShiftRequest)
+	})
 }
 
 // CreateShiftRequest godoc
@@ -39,6 +52,9 @@ func (h *ShiftRequestHandler) RegisterRoutes(r chi.Router) {
 // @Success 201 {object} pkg.BaseResponse{data=ShiftRequestResponse} "Shift request created successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
 // @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 404 {object} pkg.BaseResponse "Shift not found"
+// @Failure 409 {object} pkg.BaseResponse "Already requested this shift, the shift was cancelled or has started, or it conflicts with the caller's shifts listed in conflicts"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shift_requests [post]
 func (h *ShiftRequestHandler) CreateShiftRequest(w http.ResponseWriter, r *http.Request) {
@@ -50,13 +66,6 @@ func (h *ShiftRequestHandler) CreateShiftRequest(w http.ResponseWriter, r *http.
 	}
 	userID := user.ID
 
-	// Get user role from context (assuming it's set by auth middleware)
-	userRole := user.Role
-	if userRole != "worker" {
-		pkg.WriteJSON(w, http.StatusForbidden, pkg.NewErrorResponse("Only wokrers can create shift requests"))
-		return
-	}
-
 	var payload CreateShiftRequestDTO
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
@@ -65,8 +74,16 @@ func (h *ShiftRequestHandler) CreateShiftRequest(w http.ResponseWriter, r *http.
 
 	request, err := h.ShiftRequestService.CreateShiftRequest(r.Context(), userID, payload.ShiftID, &payload)
 	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Shift not found"))
+			return
+		}
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error creating shift request: %v", err)
-		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse(err.Error()))
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create shift request"))
 		return
 	}
 	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(request))
@@ -74,48 +91,87 @@ func (h *ShiftRequestHandler) CreateShiftRequest(w http.ResponseWriter, r *http.
 
 // GetShiftRequests godoc
 // @Summary List all shift requests
-// @Description Admin gets all shift requests, can filter by status, user_id, and shift_id
+// @Description Admin gets shift requests a page at a time, can filter by status, shift and the shared list filters
 // @Tags shift-requests
 // @Produce json
-// @Param status query string false "Filter by status (pending, approved, rejected)"
-// @Param user_id query integer false "Filter by user ID"
+// @Param status query string false "Filter by status (pending, approved, rejected, withdrawn, expired)"
 // @Param shift_id query integer false "Filter by shift ID"
+// @Param user_id query integer false "Filter by the requesting user's ID"
+// @Param from query string false "First day of the shift, YYYY-MM-DD in the zone of its location"
+// @Param to query string false "Last day of the shift, YYYY-MM-DD in the zone of its location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param assigned query bool false "Only requests for assigned shifts when true, for open shifts when false"
+// @Param sort query string false "requested_at, start_at, status, user_name or id, prefixed with - for descending" default(-requested_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
 // @Success 200 {object} pkg.BaseResponse{data=[]ShiftRequestResponse} "Successfully retrieved shift requests"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
 // @Failure 401 {object} pkg.BaseResponse "Unauthorized"
 // @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shift_requests [get]
 func (h *ShiftRequestHandler) GetShiftRequests(w http.ResponseWriter, r *http.Request) {
-	// Get user role from context (assuming it's set by auth middleware)
-	user, ok := pkg.GetUserFromContext(r.Context())
+	h.writeShiftRequests(w, r, nil)
+}
+
+// GetMyShiftRequests godoc
+// @Summary List my shift requests
+// @Description Worker lists their shift requests a page at a time, with why rejected or expired ones were turned down
+// @Tags shift-requests
+// @Produce json
+// @Param status query string false "Filter by status (pending, approved, rejected, withdrawn, expired)"
+// @Param shift_id query integer false "Filter by shift ID"
+// @Param from query string false "First day of the shift, YYYY-MM-DD in the zone of its location"
+// @Param to query string false "Last day of the shift, YYYY-MM-DD in the zone of its location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param sort query string false "requested_at, start_at, status, user_name or id, prefixed with - for descending" default(-requested_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=[]ShiftRequestResponse} "Successfully retrieved shift requests"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_requests/mine [get]
+func (h *ShiftRequestHandler) GetMyShiftRequests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
 	if !ok {
 		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
 		return
 	}
-	userRole := user.Role
-	if userRole != "admin" {
-		pkg.WriteJSON(w, http.StatusForbidden, pkg.NewErrorResponse("Only admins can view all shift requests"))
+	h.writeShiftRequests(w, r, &userID)
+}
+
+// writeShiftRequests lists shift requests, only those of the user when userID is set
+func (h *ShiftRequestHandler) writeShiftRequests(w http.ResponseWriter, r *http.Request, userID *int) {
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
 		return
 	}
 
-	// Get filters from query params
-	filter := &ShiftRequestFilter{}
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+	if userID != nil {
+		q.UserID = userID
+	}
+	filter := &ShiftRequestFilter{ListQuery: *q}
 
 	// Get status filter if provided
 	if status := r.URL.Query().Get("status"); status != "" {
 		filter.Status = status
 	}
 
-	// Get user_id filter if provided
-	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
-		userID, err := strconv.Atoi(userIDStr)
-		if err == nil && userID > 0 {
-			filter.UserID = userID
-		} else if err != nil {
-			h.logger.Warnf("Invalid user_id parameter: %s", userIDStr)
-		}
-	}
-
 	// Get shift_id filter if provided
 	if shiftIDStr := r.URL.Query().Get("shift_id"); shiftIDStr != "" {
 		shiftID, err := strconv.Atoi(shiftIDStr)
@@ -126,41 +182,86 @@ func (h *ShiftRequestHandler) GetShiftRequests(w http.ResponseWriter, r *http.Re
 		}
 	}
 
-	requests, err := h.ShiftRequestService.GetShiftRequests(r.Context(), filter)
+	requests, page, err := h.ShiftRequestService.GetShiftRequests(r.Context(), filter)
 	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error getting shift requests: %v", err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve shift requests"))
 		return
 	}
-	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(requests))
+	for i := range requests {
+		requests[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(requests, page))
+}
+
+// GetCandidates godoc
+// @Summary Rank the workers who requested a shift
+// @Description Lists the pending requests for a shift, best fit first: workers free at the time of the shift, then those who worked the role more often, then those with fewer minutes assigned that week, then those who asked first.
+// @Tags shift-requests
+// @Produce json
+// @Param shift_id path int true "Shift ID"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of the shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=CandidatesResponse} "Successfully ranked the candidates"
+// @Failure 400 {object} pkg.BaseResponse "Invalid shift ID or unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Shift not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_requests/candidates/{shift_id} [get]
+func (h *ShiftRequestHandler) GetCandidates(w http.ResponseWriter, r *http.Request) {
+	shiftID, err := strconv.Atoi(chi.URLParam(r, "shift_id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid shift ID"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	candidates, err := h.ShiftRequestService.GetCandidates(r.Context(), shiftID)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Shift not found"))
+			return
+		}
+		h.logger.Errorf("Error ranking candidates for shift %d: %v", shiftID, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve candidates"))
+		return
+	}
+	candidates.Shift.In(tz)
+	for i := range candidates.Candidates {
+		candidates.Candidates[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(candidates))
 }
 
 // ApproveShiftRequest godoc
 // @Summary Admin approves shift request
-// @Description Admin approves shift request by ID
+// @Description Admin approves a pending shift request by ID and assigns the shift to the worker. The other pending requests for the shift are rejected, telling those workers it was assigned to someone else. All of it happens in one transaction, so nothing changes when the shift is already assigned.
 // @Tags shift-requests
 // @Produce json
 // @Param id path int true "Shift Request ID"
+// @Param force query bool false "Approve despite the worker's conflicting shifts, the override is recorded"
 // @Success 200 {object} pkg.BaseResponse{data=ShiftRequestResponse} "Shift request approved successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request ID"
 // @Failure 401 {object} pkg.BaseResponse "Unauthorized"
 // @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
 // @Failure 404 {object} pkg.BaseResponse "Shift request not found"
+// @Failure 409 {object} pkg.BaseResponse "Request isn't pending or the shift has started, shift is already assigned, or the worker has conflicting shifts listed in conflicts"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shift_requests/approve/{id} [put]
 func (h *ShiftRequestHandler) ApproveShiftRequest(w http.ResponseWriter, r *http.Request) {
-	// Get user role from context (assuming it's set by auth middleware)
-	user, ok := pkg.GetUserFromContext(r.Context())
+	reviewerID, ok := pkg.GetUserIDFromContext(r.Context())
 	if !ok {
 		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
 		return
 	}
-	userRole := user.Role
-	if !ok || userRole != "admin" {
-		pkg.WriteJSON(w, http.StatusForbidden, pkg.NewErrorResponse("Only admins can approve shift requests"))
-		return
-	}
-
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -168,8 +269,19 @@ func (h *ShiftRequestHandler) ApproveShiftRequest(w http.ResponseWriter, r *http
 		return
 	}
 
-	request, err := h.ShiftRequestService.ApproveShiftRequest(r.Context(), id)
+	override, err := assignments.OverrideFromRequest(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	request, err := h.ShiftRequestService.ApproveShiftRequest(r.Context(), id, reviewerID, override)
 	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error approving shift request %d: %v", id, err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to approve shift request"))
 		return
@@ -183,30 +295,26 @@ func (h *ShiftRequestHandler) ApproveShiftRequest(w http.ResponseWriter, r *http
 
 // RejectShiftRequest godoc
 // @Summary Admin rejects shift request
-// @Description Admin rejects shift request by ID
+// @Description Admin rejects a pending shift request by ID, optionally telling the worker why. The reason and the reviewer are kept on the request.
 // @Tags shift-requests
+// @Accept json
 // @Produce json
 // @Param id path int true "Shift Request ID"
+// @Param payload body RejectShiftRequestDTO false "Reason for the rejection"
 // @Success 200 {object} pkg.BaseResponse{data=ShiftRequestResponse} "Shift request rejected successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request ID"
 // @Failure 401 {object} pkg.BaseResponse "Unauthorized"
 // @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
 // @Failure 404 {object} pkg.BaseResponse "Shift request not found"
+// @Failure 409 {object} pkg.BaseResponse "Request isn't pending or the shift has started"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shift_requests/reject/{id} [put]
 func (h *ShiftRequestHandler) RejectShiftRequest(w http.ResponseWriter, r *http.Request) {
-	// Get user role from context (assuming it's set by auth middleware)
-	user, ok := pkg.GetUserFromContext(r.Context())
+	reviewerID, ok := pkg.GetUserIDFromContext(r.Context())
 	if !ok {
 		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
 		return
 	}
-	userRole := user.Role
-	if !ok || userRole != "admin" {
-		pkg.WriteJSON(w, http.StatusForbidden, pkg.NewErrorResponse("Only admins can reject shift requests"))
-		return
-	}
-
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -214,8 +322,19 @@ func (h *ShiftRequestHandler) RejectShiftRequest(w http.ResponseWriter, r *http.
 		return
 	}
 
-	request, err := h.ShiftRequestService.RejectShiftRequest(r.Context(), id)
+	// The body is optional, an empty one rejects without a reason
+	var payload RejectShiftRequestDTO
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	request, err := h.ShiftRequestService.RejectShiftRequest(r.Context(), id, reviewerID, &payload)
 	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error rejecting shift request %d: %v", id, err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to reject shift request"))
 		return
@@ -226,3 +345,46 @@ func (h *ShiftRequestHandler) RejectShiftRequest(w http.ResponseWriter, r *http.
 	}
 	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(request))
 }
+
+// WithdrawShiftRequest godoc
+// @Summary Withdraw my shift request
+// @Description Worker takes back their pending shift request before it is reviewed and the shift starts. They may request the shift again later.
+// @Tags shift-requests
+// @Produce json
+// @Param id path int true "Shift Request ID"
+// @Success 200 {object} pkg.BaseResponse{data=ShiftRequestResponse} "Shift request withdrawn successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 404 {object} pkg.BaseResponse "Shift request not found"
+// @Failure 409 {object} pkg.BaseResponse "Request isn't pending or the shift has started"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_requests/withdraw/{id} [put]
+func (h *ShiftRequestHandler) WithdrawShiftRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid shift request ID"))
+		return
+	}
+
+	request, err := h.ShiftRequestService.WithdrawShiftRequest(r.Context(), id, userID)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error withdrawing shift request %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to withdraw shift request"))
+		return
+	}
+	if request == nil {
+		pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Shift request not found"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(request))
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"strings"
 	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/shifts"
 )
 
 // ShiftRequestRepository defines the interface for shift request data operations
 type ShiftRequestRepository interface {
 	CreateShiftRequest(ctx context.Context, userID int, shiftID int, req *CreateShiftRequestDTO) (*ShiftRequestResponse, error)
-	GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, error)
+	GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, *pkg.Pagination, error)
 	GetShiftRequestByID(ctx context.Context, id int) (*ShiftRequestResponse, error)
-	UpdateShiftRequestStatus(ctx context.Context, id int, status string) (*ShiftRequestResponse, error)
+	UpdateShiftRequestStatus(ctx context.Context, id int, from string, to string, reviewedBy *int, reason string) (*ShiftRequestResponse, error)
+	GetCandidates(ctx context.Context, shift *shifts.ShiftResponse, weekStart time.Time, weekEnd time.Time) ([]Candidate, error)
+	RejectPendingRequests(ctx context.Context, shiftID int, exceptID int, reviewedBy int, reason string) (int, error)
+	ExpirePendingRequests(ctx context.Context, now time.Time) (int, error)
+	ReleaseApprovedRequest(ctx context.Context, shiftID int, userID int, releasedBy int, reason string) error
+	GetPendingShifts(ctx context.Context, userID int, from time.Time, to time.Time, excludeShiftID int) ([]pkg.BookedShift, error)
 }
 
 type shiftRequestRepository struct {
@@ -32,9 +38,7 @@ func (r *shiftRequestRepository) CreateShiftRequest(ctx context.Context, userID
 		VALUES (?, ?, ?)
 	`
 
-	fmt.Println("Creating shift request for shift ID:", shiftID, "and user ID:", userID)
-
-	result, err := r.db.ExecContext(
+	result, err := pkg.Conn(ctx, r.db).ExecContext(
 		ctx,
 		query,
 		shiftID,
@@ -43,6 +47,9 @@ func (r *shiftRequestRepository) CreateShiftRequest(ctx context.Context, userID
 	)
 
 	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return nil, pkg.NewConflictError("You have already requested this shift")
+		}
 		return nil, err
 	}
 
@@ -52,343 +59,354 @@ func (r *shiftRequestRepository) CreateShiftRequest(ctx context.Context, userID
 		return nil, err
 	}
 
-	// Create a response
-	var response ShiftRequestResponse
-	response.ID = int(id)
-	response.ShiftID = shiftID
-	response.UserID = userID
-	response.Status = StatusPending
-	// Note: requested_at is set by the database, we'll get it when we fetch the full request
-
-	// Get user name
-	userQuery := `SELECT name FROM users WHERE id = ?`
-	err = r.db.QueryRowContext(ctx, userQuery, userID).Scan(&response.UserName)
-	if err != nil {
-		// If we can't get the user name, just return what we have
-		return &response, nil
-	}
-
-	// Get shift date, start time, and end time
-	shiftQuery := `
-		SELECT date, start_time, end_time
-		FROM shifts
-		WHERE id = ?
-	`
-
-	var dateStr, startTimeStr, endTimeStr string
-	err = r.db.QueryRowContext(ctx, shiftQuery, shiftID).Scan(
-		&dateStr,
-		&startTimeStr,
-		&endTimeStr,
-	)
-
-	if err != nil {
-		// If we can't get the shift details, just return what we have
-		return &response, nil
-	}
-
-	// Parse the date and time strings
-	layout := time.RFC3339
-	date, err := time.Parse(layout, dateStr)
-	if err != nil {
-		// Try other common formats
-		layouts := []string{"2006-01-02", "2006/01/02", "2006-01-02T15:04:05Z"}
-		for _, l := range layouts {
-			date, err = time.Parse(l, dateStr)
-			if err == nil {
-				break
-			}
-		}
-	}
-	response.Date = date
-
-	// Parse start time
-	startTime, err := time.Parse(layout, startTimeStr)
-	if err != nil {
-		// Try common time formats
-		timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-		for _, l := range timeLayouts {
-			startTime, err = time.Parse(l, startTimeStr)
-			if err == nil {
-				break
-			}
-		}
-	}
-	response.StartTime = startTime
-
-	// Parse end time
-	endTime, err := time.Parse(layout, endTimeStr)
-	if err != nil {
-		// Try common time formats
-		timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-		for _, l := range timeLayouts {
-			endTime, err = time.Parse(l, endTimeStr)
-			if err == nil {
-				break
-			}
-		}
-	}
-	response.EndTime = endTime
-
-	return &response, nil
+	// Get the full request, requested_at is set by the database
+	return r.GetShiftRequestByID(ctx, int(id))
 }
 
-func (r *shiftRequestRepository) GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, error) {
-	query := `
+const shiftRequestQuery = `
 		SELECT
 			sr.id,
 			sr.user_id,
 			sr.shift_id,
 			u.name as user_name,
 			sr.status,
+			COALESCE(sr.reason, '') as reason,
+			sr.reviewed_by,
+			sr.reviewed_at,
 			sr.requested_at,
-			s.date,
-			s.start_time,
-			s.end_time
+			s.start_at,
+			s.end_at,
+			COALESCE(l.time_zone, 'UTC') as time_zone
 		FROM shift_requests sr
 		JOIN shifts s ON sr.shift_id = s.id
 		JOIN users u ON sr.user_id = u.id
+		LEFT JOIN locations l ON s.location_id = l.id
 	`
 
-	// Add filtering if status or userID is provided
+// shiftRequestList applies list queries to shiftRequestQuery
+var shiftRequestList = &pkg.ListSpec[ShiftRequestResponse]{
+	Sorts: map[string]pkg.SortKey[ShiftRequestResponse]{
+		"requested_at": {Column: "sr.requested_at", Value: func(r *ShiftRequestResponse) interface{} { return pkg.FormatTimestamp(r.RequestedAt) }},
+		"start_at":     {Column: "s.start_at", Value: func(r *ShiftRequestResponse) interface{} { return pkg.FormatTimestamp(r.StartAt) }},
+		"status":       {Column: "sr.status", Value: func(r *ShiftRequestResponse) interface{} { return r.Status }},
+		"user_name":    {Column: "u.name", Value: func(r *ShiftRequestResponse) interface{} { return r.UserName }},
+		"id":           {Column: "sr.id", Value: func(r *ShiftRequestResponse) interface{} { return r.ID }},
+	},
+	DefaultSort: "requested_at",
+	DefaultDesc: true,
+	IDColumn:    "sr.id",
+	ID:          func(r *ShiftRequestResponse) int { return r.ID },
+	Date:        "s.date",
+	Location:    "s.location_id",
+	Role:        "s.role",
+	User:        "sr.user_id",
+	Assigned:    "EXISTS (SELECT 1 FROM assignments a WHERE a.shift_id = sr.shift_id AND a.status = 'active')",
+}
+
+func (r *shiftRequestRepository) GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, *pkg.Pagination, error) {
 	var args []interface{}
 	where := []string{}
 
-	if filter != nil {
-		if filter.Status != "" {
-			where = append(where, "sr.status = ?")
-			args = append(args, filter.Status)
-		}
-
-		if filter.UserID > 0 {
-			where = append(where, "sr.user_id = ?")
-			args = append(args, filter.UserID)
-		}
-
-		if filter.ShiftID > 0 {
-			where = append(where, "sr.shift_id = ?")
-			args = append(args, filter.ShiftID)
-		}
+	if filter.Status != "" {
+		where = append(where, "sr.status = ?")
+		args = append(args, filter.Status)
 	}
-
-	if len(where) > 0 {
-		query += " WHERE " + strings.Join(where, " AND ")
+	if filter.ShiftID > 0 {
+		where = append(where, "sr.shift_id = ?")
+		args = append(args, filter.ShiftID)
 	}
 
-	query += " ORDER BY sr.requested_at DESC"
+	clause, args, err := shiftRequestList.Build(&filter.ListQuery, where, args)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, shiftRequestQuery+clause, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var requests []ShiftRequestResponse
 	for rows.Next() {
-		var request ShiftRequestResponse
-		var dateStr, startTimeStr, endTimeStr string
-
-		if err := rows.Scan(
-			&request.ID,
-			&request.UserID,
-			&request.ShiftID,
-			&request.UserName,
-			&request.Status,
-			&request.RequestedAt,
-			&dateStr,
-			&startTimeStr,
-			&endTimeStr,
-		); err != nil {
-			return nil, err
-		}
-
-		// Parse string dates/times into time.Time objects
-		// Try standard ISO 8601 format first (which SQLite may use)
-		layout := time.RFC3339
-		date, err := time.Parse(layout, dateStr)
+		request, err := scanShiftRequest(rows)
 		if err != nil {
-			// Try other common formats
-			layouts := []string{"2006-01-02", "2006/01/02", "2006-01-02T15:04:05Z"}
-			for _, l := range layouts {
-				date, err = time.Parse(l, dateStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse date string %q: %v\n", dateStr, err)
-			}
+			return nil, nil, err
 		}
-		request.Date = date
+		requests = append(requests, *request)
+	}
 
-		// Parse time strings - try with complete ISO format first
-		timeLayout := time.RFC3339
-		startTime, err := time.Parse(timeLayout, startTimeStr)
-		if err != nil {
-			// Try common time formats
-			timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-			for _, l := range timeLayouts {
-				startTime, err = time.Parse(l, startTimeStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse start time string %q: %v\n", startTimeStr, err)
-			}
-		}
-		request.StartTime = startTime
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
 
-		endTime, err := time.Parse(timeLayout, endTimeStr)
-		if err != nil {
-			// Try common time formats
-			timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-			for _, l := range timeLayouts {
-				endTime, err = time.Parse(l, endTimeStr)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				fmt.Printf("Failed to parse end time string %q: %v\n", endTimeStr, err)
-			}
+	requests, page := shiftRequestList.Page(&filter.ListQuery, requests)
+	return requests, page, nil
+}
+
+func (r *shiftRequestRepository) GetShiftRequestByID(ctx context.Context, id int) (*ShiftRequestResponse, error) {
+	query := shiftRequestQuery + " WHERE sr.id = ?"
+
+	request, err := scanShiftRequest(pkg.Conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Not found
 		}
-		request.EndTime = endTime
+		return nil, err
+	}
+	return request, nil
+}
 
-		requests = append(requests, request)
+// UpdateShiftRequestStatus moves a request from one status to another with the reason for
+// it, which may be empty. The reviewer is recorded when set. A request that is no longer in
+// status from is left as it is and reported as a conflict.
+func (r *shiftRequestRepository) UpdateShiftRequestStatus(ctx context.Context, id int, from string, to string, reviewedBy *int, reason string) (*ShiftRequestResponse, error) {
+	query := `
+		UPDATE shift_requests
+		SET status = ?, reason = NULLIF(?, ''), reviewed_by = ?, reviewed_at = ?
+		WHERE id = ? AND status = ?
+	`
+
+	var reviewedAt *string
+	if reviewedBy != nil {
+		now := pkg.FormatTimestamp(time.Now())
+		reviewedAt = &now
 	}
 
-	if err := rows.Err(); err != nil {
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, to, reason, reviewedBy, reviewedAt, id, from)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
 		return nil, err
 	}
 
-	return requests, nil
+	request, err := r.GetShiftRequestByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, nil // Not found
+	}
+	if rowsAffected == 0 {
+		return nil, pkg.NewConflictError("The request was already " + request.Status)
+	}
+	return request, nil
 }
 
-func (r *shiftRequestRepository) GetShiftRequestByID(ctx context.Context, id int) (*ShiftRequestResponse, error) {
+// GetCandidates lists the pending requests for the shift with the numbers candidates are
+// ranked by. Only assignments starting from weekStart until weekEnd count towards
+// WeekMinutes.
+func (r *shiftRequestRepository) GetCandidates(ctx context.Context, shift *shifts.ShiftResponse, weekStart time.Time, weekEnd time.Time) ([]Candidate, error) {
 	query := `
 		SELECT
+			(
+				SELECT COUNT(*) FROM assignments a JOIN shifts rs ON a.shift_id = rs.id
+				WHERE a.user_id = sr.user_id AND a.status = 'active' AND rs.id <> sr.shift_id AND LOWER(rs.role) = LOWER(?)
+			) as role_shifts,
+			(
+				SELECT CAST(COALESCE(SUM(ROUND((julianday(ws.end_at) - julianday(ws.start_at)) * 1440)), 0) AS INTEGER)
+				FROM assignments a JOIN shifts ws ON a.shift_id = ws.id
+				WHERE a.user_id = sr.user_id AND a.status = 'active' AND ws.id <> sr.shift_id AND ws.start_at >= ? AND ws.start_at < ?
+			) as week_minutes,
+			EXISTS (
+				SELECT 1 FROM assignments a JOIN shifts os ON a.shift_id = os.id
+				WHERE a.user_id = sr.user_id AND a.status = 'active' AND os.id <> sr.shift_id AND os.start_at < ? AND os.end_at > ?
+			) as overlaps,
 			sr.id,
 			sr.user_id,
 			sr.shift_id,
 			u.name as user_name,
 			sr.status,
+			COALESCE(sr.reason, '') as reason,
+			sr.reviewed_by,
+			sr.reviewed_at,
 			sr.requested_at,
-			s.date,
-			s.start_time,
-			s.end_time
+			s.start_at,
+			s.end_at,
+			COALESCE(l.time_zone, 'UTC') as time_zone
 		FROM shift_requests sr
 		JOIN shifts s ON sr.shift_id = s.id
 		JOIN users u ON sr.user_id = u.id
-		WHERE sr.id = ?
+		LEFT JOIN locations l ON s.location_id = l.id
+		WHERE sr.shift_id = ? AND sr.status = ?
 	`
 
-	var request ShiftRequestResponse
-	var dateStr, startTimeStr, endTimeStr string
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&request.ID,
-		&request.UserID,
-		&request.ShiftID,
-		&request.UserName,
-		&request.Status,
-		&request.RequestedAt,
-		&dateStr,
-		&startTimeStr,
-		&endTimeStr,
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query,
+		shift.Role,
+		pkg.FormatTimestamp(weekStart),
+		pkg.FormatTimestamp(weekEnd),
+		pkg.FormatTimestamp(shift.EndAt),
+		pkg.FormatTimestamp(shift.StartAt),
+		shift.ID,
+		StatusPending,
 	)
-
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // Not found
-		}
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Parse string dates/times into time.Time objects
-	// Try standard ISO 8601 format first (which SQLite may use)
-	layout := time.RFC3339
-	date, err := time.Parse(layout, dateStr)
-	if err != nil {
-		// Try other common formats
-		layouts := []string{"2006-01-02", "2006/01/02", "2006-01-02T15:04:05Z"}
-		for _, l := range layouts {
-			date, err = time.Parse(l, dateStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse date string %q: %v\n", dateStr, err)
+	candidates := []Candidate{}
+	for rows.Next() {
+		var candidate Candidate
+		var startAt, endAt time.Time
+		var timeZone string
+		var reviewedBy sql.NullInt64
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(
+			&candidate.RoleShifts,
+			&candidate.WeekMinutes,
+			&candidate.Overlaps,
+			&candidate.ID,
+			&candidate.UserID,
+			&candidate.ShiftID,
+			&candidate.UserName,
+			&candidate.Status,
+			&candidate.Reason,
+			&reviewedBy,
+			&reviewedAt,
+			&candidate.RequestedAt,
+			&startAt,
+			&endAt,
+			&timeZone,
+		); err != nil {
+			return nil, err
 		}
+		candidate.Schedule = pkg.NewSchedule(startAt, endAt, timeZone)
+		setReview(&candidate.ShiftRequestResponse, reviewedBy, reviewedAt)
+		candidate.In(nil)
+		candidates = append(candidates, candidate)
 	}
-	request.Date = date
+	return candidates, rows.Err()
+}
 
-	// Parse time strings - try with complete ISO format first
-	timeLayout := time.RFC3339
-	startTime, err := time.Parse(timeLayout, startTimeStr)
+// RejectPendingRequests rejects every pending request for the shift but exceptID on behalf
+// of the reviewer, giving them the reason, and returns how many were rejected
+func (r *shiftRequestRepository) RejectPendingRequests(ctx context.Context, shiftID int, exceptID int, reviewedBy int, reason string) (int, error) {
+	query := `
+		UPDATE shift_requests
+		SET status = ?, reason = ?, reviewed_by = ?, reviewed_at = ?
+		WHERE shift_id = ? AND id <> ? AND status = ?
+	`
+
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query,
+		StatusRejected, reason, reviewedBy, pkg.FormatTimestamp(time.Now()), shiftID, exceptID, StatusPending)
 	if err != nil {
-		// Try common time formats
-		timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-		for _, l := range timeLayouts {
-			startTime, err = time.Parse(l, startTimeStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse start time string %q: %v\n", startTimeStr, err)
-		}
+		return 0, err
 	}
-	request.StartTime = startTime
-
-	endTime, err := time.Parse(timeLayout, endTimeStr)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		// Try common time formats
-		timeLayouts := []string{"15:04:05", "15:04", "15:04:05Z"}
-		for _, l := range timeLayouts {
-			endTime, err = time.Parse(l, endTimeStr)
-			if err == nil {
-				break
-			}
-		}
-		if err != nil {
-			fmt.Printf("Failed to parse end time string %q: %v\n", endTimeStr, err)
-		}
+		return 0, err
 	}
-	request.EndTime = endTime
-
-	return &request, nil
+	return int(rowsAffected), nil
 }
 
-func (r *shiftRequestRepository) UpdateShiftRequestStatus(ctx context.Context, id int, status string) (*ShiftRequestResponse, error) {
-	// First check if the request exists
-	request, err := r.GetShiftRequestByID(ctx, id)
+// ExpirePendingRequests expires the pending requests for shifts starting at or before now
+// and returns how many expired
+func (r *shiftRequestRepository) ExpirePendingRequests(ctx context.Context, now time.Time) (int, error) {
+	query := `
+		UPDATE shift_requests
+		SET status = ?, reason = ?
+		WHERE status = ? AND shift_id IN (SELECT id FROM shifts WHERE start_at <= ?)
+	`
+
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, StatusExpired, ReasonExpired, StatusPending, pkg.FormatTimestamp(now))
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	if request == nil {
-		return nil, nil // Not found
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
+	return int(rowsAffected), nil
+}
 
-	// Update the status - remove the RETURNING clause for SQLite compatibility
+// ReleaseApprovedRequest marks the approved request of the user for the shift unassigned,
+// recording who took them off it and why. It does nothing when there is none, e.g. for
+// shifts assigned without a request.
+func (r *shiftRequestRepository) ReleaseApprovedRequest(ctx context.Context, shiftID int, userID int, releasedBy int, reason string) error {
 	query := `
 		UPDATE shift_requests
-		SET status = ?
-		WHERE id = ?
+		SET status = ?, reason = ?, reviewed_by = ?, reviewed_at = ?
+		WHERE shift_id = ? AND user_id = ? AND status = ?
 	`
 
-	_, err = r.db.ExecContext(
-		ctx,
-		query,
-		status,
-		id,
-	)
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query,
+		StatusUnassigned, reason, releasedBy, pkg.FormatTimestamp(time.Now()), shiftID, userID, StatusApproved)
+	return err
+}
 
+// GetPendingShifts lists the shifts the user has pending requests for that overlap from to
+// to, leaving out the shift with excludeShiftID
+func (r *shiftRequestRepository) GetPendingShifts(ctx context.Context, userID int, from time.Time, to time.Time, excludeShiftID int) ([]pkg.BookedShift, error) {
+	query := `
+		SELECT s.id, s.start_at, s.end_at
+		FROM shift_requests sr
+		JOIN shifts s ON sr.shift_id = s.id
+		WHERE sr.user_id = ? AND sr.status = ? AND s.id <> ? AND s.start_at < ? AND s.end_at > ?
+		ORDER BY s.start_at
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, userID, StatusPending, excludeShiftID, pkg.FormatTimestamp(to), pkg.FormatTimestamp(from))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var shifts []pkg.BookedShift
+	for rows.Next() {
+		shift := pkg.BookedShift{Pending: true}
+		if err := rows.Scan(&shift.ShiftID, &shift.StartAt, &shift.EndAt); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, shift)
+	}
+	return shifts, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanShiftRequest reads a row of shiftRequestQuery, rendering its times in the zone of the shift's location
+func scanShiftRequest(row rowScanner) (*ShiftRequestResponse, error) {
+	var request ShiftRequestResponse
+	var startAt, endAt time.Time
+	var timeZone string
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+
+	if err := row.Scan(
+		&request.ID,
+		&request.UserID,
+		&request.ShiftID,
+		&request.UserName,
+		&request.Status,
+		&request.Reason,
+		&reviewedBy,
+		&reviewedAt,
+		&request.RequestedAt,
+		&startAt,
+		&endAt,
+		&timeZone,
+	); err != nil {
+		return nil, err
+	}
 
-	// Get the updated request
-	return r.GetShiftRequestByID(ctx, id)
+	request.Schedule = pkg.NewSchedule(startAt, endAt, timeZone)
+	setReview(&request, reviewedBy, reviewedAt)
+	request.In(nil)
+	return &request, nil
+}
+
+// setReview fills in who reviewed the request and when, if anyone did
+func setReview(request *ShiftRequestResponse, reviewedBy sql.NullInt64, reviewedAt sql.NullTime) {
+	if reviewedBy.Valid {
+		id := int(reviewedBy.Int64)
+		request.ReviewedBy = &id
+	}
+	if reviewedAt.Valid {
+		request.ReviewedAt = &reviewedAt.Time
+	}
 }
@@ -0,0 +1,79 @@
+package shift_requests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+func TestExpirePendingRequests(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Every connection to :memory: opens a database of its own
+	db.SetMaxOpenConns(1)
+
+	now := time.Date(2027, 5, 10, 12, 0, 0, 0, time.UTC)
+	setup := []string{
+		"CREATE TABLE shifts (id INTEGER PRIMARY KEY, start_at TIMESTAMP NOT NULL)",
+		"CREATE TABLE shift_requests (id INTEGER PRIMARY KEY, shift_id INTEGER NOT NULL, status TEXT NOT NULL, reason TEXT)",
+	}
+	for _, query := range setup {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shifts := map[int]time.Time{1: now.Add(-time.Hour), 2: now, 3: now.Add(time.Minute)}
+	for id, startAt := range shifts {
+		if _, err := db.Exec("INSERT INTO shifts (id, start_at) VALUES (?, ?)", id, pkg.FormatTimestamp(startAt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := []struct {
+		id      int
+		shiftID int
+		status  string
+		want    string
+	}{
+		{id: 1, shiftID: 1, status: StatusPending, want: StatusExpired},
+		{id: 2, shiftID: 2, status: StatusPending, want: StatusExpired},
+		{id: 3, shiftID: 3, status: StatusPending, want: StatusPending},
+		{id: 4, shiftID: 1, status: StatusApproved, want: StatusApproved},
+		{id: 5, shiftID: 1, status: StatusWithdrawn, want: StatusWithdrawn},
+	}
+	for _, request := range requests {
+		if _, err := db.Exec("INSERT INTO shift_requests (id, shift_id, status) VALUES (?, ?, ?)", request.id, request.shiftID, request.status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := NewShiftRequestRepository(db).ExpirePendingRequests(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 2 {
+		t.Errorf("expired %d requests, want 2", expired)
+	}
+
+	for _, request := range requests {
+		var status string
+		var reason sql.NullString
+		if err := db.QueryRow("SELECT status, reason FROM shift_requests WHERE id = ?", request.id).Scan(&status, &reason); err != nil {
+			t.Fatal(err)
+		}
+		if status != request.want {
+			t.Errorf("request %d is %s, want %s", request.id, status, request.want)
+		}
+		if status == StatusExpired && reason.String != ReasonExpired {
+			t.Errorf("request %d has reason %q, want %q", request.id, reason.String, ReasonExpired)
+		}
+	}
+}
@@ -2,91 +2,291 @@ package shift_requests
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/afrianjunior/justpayd/internal/assignments"
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/shifts"
 )
 
 // ShiftRequestService defines the interface for shift request business logic
 type ShiftRequestService interface {
 	CreateShiftRequest(ctx context.Context, userID int, shiftID int, req *CreateShiftRequestDTO) (*ShiftRequestResponse, error)
-	GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, error)
-	ApproveShiftRequest(ctx context.Context, id int) (*ShiftRequestResponse, error)
-	RejectShiftRequest(ctx context.Context, id int) (*ShiftRequestResponse, error)
+	GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, *pkg.Pagination, error)
+	GetCandidates(ctx context.Context, shiftID int) (*CandidatesResponse, error)
+	ApproveShiftRequest(ctx context.Context, id int, reviewerID int, override *assignments.Override) (*ShiftRequestResponse, error)
+	RejectShiftRequest(ctx context.Context, id int, reviewerID int, req *RejectShiftRequestDTO) (*ShiftRequestResponse, error)
+	WithdrawShiftRequest(ctx context.Context, id int, userID int) (*ShiftRequestResponse, error)
 }
 
 type shiftRequestService struct {
 	shiftRequestRepository ShiftRequestRepository
 	assignmentRepository   assignments.AssignmentRepository
+	shiftRepository        shifts.ShiftRepository
+	availabilityService    availability.AvailabilityService
+	unitOfWork             pkg.UnitOfWork
+	config                 *pkg.Config
 }
 
 // NewShiftRequestService creates a new instance of ShiftRequestService
 func NewShiftRequestService(
 	shiftRequestRepository ShiftRequestRepository,
 	assignmentRepository assignments.AssignmentRepository,
+	shiftRepository shifts.ShiftRepository,
+	availabilityService availability.AvailabilityService,
+	unitOfWork pkg.UnitOfWork,
+	config *pkg.Config,
 ) ShiftRequestService {
 	return &shiftRequestService{
 		shiftRequestRepository: shiftRequestRepository,
 		assignmentRepository:   assignmentRepository,
+		shiftRepository:        shiftRepository,
+		availabilityService:    availabilityService,
+		unitOfWork:             unitOfWork,
+		config:                 config,
 	}
 }
 
+// CreateShiftRequest records a pending request for the shift. Several workers may request
+// the same shift, the admin picks one of them when approving.
 func (s *shiftRequestService) CreateShiftRequest(ctx context.Context, userID int, shiftID int, req *CreateShiftRequestDTO) (*ShiftRequestResponse, error) {
-	// Check if this user has already requested this shift
+	shift, err := s.shiftRepository.GetShiftByID(ctx, shiftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shift %d: %w", shiftID, err)
+	}
+	if shift == nil {
+		return nil, pkg.ErrNotFound
+	}
+	if shift.IsCancelled() {
+		return nil, pkg.NewConflictError("The shift was cancelled")
+	}
+	if !shift.StartAt.After(time.Now()) {
+		return nil, pkg.NewConflictError("The shift has already started")
+	}
+	if err := s.expirePendingRequests(ctx); err != nil {
+		return nil, err
+	}
+
+	// Check if this user is waiting on a request for this shift. Workers may ask again once
+	// their request was turned down, withdrawn, or they were taken off the shift.
 	filter := &ShiftRequestFilter{
-		ShiftID: shiftID,
+		ListQuery: pkg.ListQuery{UserID: &userID},
+		Status:    StatusPending,
+		ShiftID:   shiftID,
 	}
 
-	existingRequests, err := s.shiftRequestRepository.GetShiftRequests(ctx, filter)
+	existingRequests, _, err := s.shiftRequestRepository.GetShiftRequests(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing shift requests: %w", err)
 	}
-
-	// If this user has already requested this shift, don't create a new one
 	if len(existingRequests) > 0 {
-		return nil, fmt.Errorf("someone else have already requested this shift")
+		return nil, pkg.NewConflictError("You have already requested this shift")
+	}
+
+	booked, err := s.assignmentRepository.GetBookedShifts(ctx, userID, shift.StartAt, shift.EndAt, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the shifts of user %d: %w", userID, err)
+	}
+	for _, b := range booked {
+		if b.ShiftID == shiftID {
+			return nil, pkg.NewConflictError("You are already assigned to this shift")
+		}
+	}
+
+	// Workers can't ask for shifts clashing with their assignments or their other requests
+	minRest := s.config.Shifts.MinRest()
+	conflicts, err := assignments.FindConflicts(ctx, s.assignmentRepository, userID, shiftID, shift.StartAt, shift.EndAt, minRest)
+	if err != nil {
+		return nil, err
+	}
+	from, to := pkg.RestWindow(shift.StartAt, shift.EndAt, minRest)
+	pending, err := s.shiftRequestRepository.GetPendingShifts(ctx, userID, from, to, shiftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the pending requests of user %d: %w", userID, err)
+	}
+	conflicts = append(conflicts, pkg.FindScheduleConflicts(shift.StartAt, shift.EndAt, pending, minRest)...)
+
+	// Approved time off blocks the request. Workers may still offer to work outside their
+	// weekly availability, the admin is told about it when approving.
+	unavailable, err := s.availabilityService.CheckAvailability(ctx, userID, shift.StartAt, shift.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, conflict := range unavailable {
+		if conflict.Kind == pkg.ConflictTimeOff {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, pkg.NewScheduleConflictError(conflicts)
 	}
 
-	// If no existing requests from this user, proceed with creating a new request
 	return s.shiftRequestRepository.CreateShiftRequest(ctx, userID, shiftID, req)
 }
 
-func (s *shiftRequestService) GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, error) {
+func (s *shiftRequestService) GetShiftRequests(ctx context.Context, filter *ShiftRequestFilter) ([]ShiftRequestResponse, *pkg.Pagination, error) {
+	switch filter.Status {
+	case "", StatusPending, StatusApproved, StatusRejected, StatusWithdrawn, StatusExpired, StatusUnassigned:
+	default:
+		return nil, nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "status", Message: "must be pending, approved, rejected, withdrawn, expired or unassigned"}})
+	}
+	if err := s.expirePendingRequests(ctx); err != nil {
+		return nil, nil, err
+	}
 	return s.shiftRequestRepository.GetShiftRequests(ctx, filter)
 }
 
-func (s *shiftRequestService) ApproveShiftRequest(ctx context.Context, id int) (*ShiftRequestResponse, error) {
-	// First, update the shift request status
-	updatedRequest, err := s.shiftRequestRepository.UpdateShiftRequestStatus(ctx, id, StatusApproved)
+// expirePendingRequests expires the requests nobody reviewed before their shift started.
+// It runs before requests are read or change status, so nobody sees or acts on them pending.
+func (s *shiftRequestService) expirePendingRequests(ctx context.Context) error {
+	if _, err := s.shiftRequestRepository.ExpirePendingRequests(ctx, time.Now()); err != nil {
+		return fmt.Errorf("failed to expire pending shift requests: %w", err)
+	}
+	return nil
+}
+
+// GetCandidates ranks the pending requests for a shift. Workers free at the time of the
+// shift come first, then those who worked the role more often, then those with fewer
+// minutes already assigned that week, and finally those who asked first.
+func (s *shiftRequestService) GetCandidates(ctx context.Context, shiftID int) (*CandidatesResponse, error) {
+	shift, err := s.shiftRepository.GetShiftByID(ctx, shiftID)
 	if err != nil {
+		return nil, fmt.Errorf("failed to get shift %d: %w", shiftID, err)
+	}
+	if shift == nil {
+		return nil, pkg.ErrNotFound
+	}
+	if err := s.expirePendingRequests(ctx); err != nil {
 		return nil, err
 	}
 
-	// If update was successful, create an assignment
-	if updatedRequest != nil {
-		assignmentReq := &assignments.CreateAssignmentRequest{
-			ShiftID: updatedRequest.ShiftID,
-			UserID:  updatedRequest.UserID,
+	// The week runs from Monday to Sunday in the zone of the shift's location
+	day := shift.StartAt
+	weekStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location()).
+		AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+
+	candidates, err := s.shiftRequestRepository.GetCandidates(ctx, shift, weekStart, weekEnd)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Overlaps != b.Overlaps {
+			return !a.Overlaps
+		}
+		if a.RoleShifts != b.RoleShifts {
+			return a.RoleShifts > b.RoleShifts
+		}
+		if a.WeekMinutes != b.WeekMinutes {
+			return a.WeekMinutes < b.WeekMinutes
+		}
+		if !a.RequestedAt.Equal(b.RequestedAt) {
+			return a.RequestedAt.Before(b.RequestedAt)
 		}
+		return a.ID < b.ID
+	})
+	for i := range candidates {
+		candidates[i].Rank = i + 1
+	}
+	return &CandidatesResponse{Shift: shift, Candidates: candidates}, nil
+}
+
+// transition moves the request to status to, as long as its current status allows it.
+// Pending requests for shifts that already started can't be reviewed or withdrawn anymore,
+// they expire first. The reviewer is recorded when set. A nil request means it wasn't found.
+func (s *shiftRequestService) transition(ctx context.Context, id int, to string, reviewerID *int, reason string) (*ShiftRequestResponse, error) {
+	if err := s.expirePendingRequests(ctx); err != nil {
+		return nil, err
+	}
+	request, err := s.shiftRequestRepository.GetShiftRequestByID(ctx, id)
+	if err != nil || request == nil {
+		return nil, err
+	}
+	if request.Status == StatusExpired {
+		return nil, pkg.NewConflictError("The request expired when the shift started")
+	}
+	if !CanTransition(request.Status, to) {
+		return nil, pkg.NewConflictError("The request was already " + request.Status)
+	}
+	return s.shiftRequestRepository.UpdateShiftRequestStatus(ctx, id, request.Status, to, reviewerID, reason)
+}
+
+// ApproveShiftRequest approves the pending request, assigns the shift to the worker and
+// rejects the other pending requests for the shift, all in one transaction. Nothing changes
+// when the shift is already assigned, which is reported as a conflict, nor when the worker
+// has conflicting assignments or is unavailable, unless the admin overrides them.
+func (s *shiftRequestService) ApproveShiftRequest(ctx context.Context, id int, reviewerID int, override *assignments.Override) (*ShiftRequestResponse, error) {
+	// Refusing a stale request rolls back the unit of work, expire it before as well
+	if err := s.expirePendingRequests(ctx); err != nil {
+		return nil, err
+	}
 
-		assignment, err := s.assignmentRepository.CreateAssignment(ctx, assignmentReq)
+	var approved *ShiftRequestResponse
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		request, err := s.transition(ctx, id, StatusApproved, &reviewerID, "")
 		if err != nil {
-			// Log the error but don't fail the request approval
-			// In a production app, you might want to handle this differently, maybe with a retry mechanism
-			// or by rolling back the status update
-			fmt.Printf("Failed to create assignment for shift request %d: %v\n", id, err)
-		} else if assignment != nil {
-			fmt.Printf("Created assignment ID %d for shift request %d (Shift: %d, User: %d)\n",
-				assignment.ID, id, updatedRequest.ShiftID, updatedRequest.UserID)
-		} else {
-			fmt.Printf("Created assignment for shift request %d, but could not retrieve details\n", id)
+			return err
 		}
+		if request == nil {
+			return nil // Not found
+		}
+
+		conflicts, err := assignments.FindConflicts(ctx, s.assignmentRepository, request.UserID, request.ShiftID, request.StartAt, request.EndAt, s.config.Shifts.MinRest())
+		if err != nil {
+			return err
+		}
+		unavailable, err := s.availabilityService.CheckAvailability(ctx, request.UserID, request.StartAt, request.EndAt)
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, unavailable...)
+		if err := assignments.ResolveConflicts(ctx, s.assignmentRepository, request.ShiftID, request.UserID, conflicts, override); err != nil {
+			return err
+		}
+
+		if _, err := s.assignmentRepository.CreateAssignment(ctx, &assignments.CreateAssignmentRequest{
+			ShiftID: request.ShiftID,
+			UserID:  request.UserID,
+		}); err != nil {
+			var conflictErr pkg.ConflictError
+			if errors.As(err, &conflictErr) {
+				return pkg.NewConflictError("The shift is already assigned to another worker")
+			}
+			return fmt.Errorf("failed to assign shift %d: %w", request.ShiftID, err)
+		}
+
+		if _, err := s.shiftRequestRepository.RejectPendingRequests(ctx, request.ShiftID, id, reviewerID, ReasonAssignedToOther); err != nil {
+			return fmt.Errorf("failed to reject the other requests for shift %d: %w", request.ShiftID, err)
+		}
+		approved = request
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return approved, nil
+}
 
-	return updatedRequest, nil
+// RejectShiftRequest rejects the pending request, keeping the reason for the worker
+func (s *shiftRequestService) RejectShiftRequest(ctx context.Context, id int, reviewerID int, req *RejectShiftRequestDTO) (*ShiftRequestResponse, error) {
+	return s.transition(ctx, id, StatusRejected, &reviewerID, strings.TrimSpace(req.Reason))
 }
 
-func (s *shiftRequestService) RejectShiftRequest(ctx context.Context, id int) (*ShiftRequestResponse, error) {
-	// You could add additional business logic here before rejecting
-	return s.shiftRequestRepository.UpdateShiftRequestStatus(ctx, id, StatusRejected)
+// WithdrawShiftRequest takes back a pending request of the user. Requests of other workers
+// are reported as not found.
+func (s *shiftRequestService) WithdrawShiftRequest(ctx context.Context, id int, userID int) (*ShiftRequestResponse, error) {
+	request, err := s.shiftRequestRepository.GetShiftRequestByID(ctx, id)
+	if err != nil || request == nil {
+		return nil, err
+	}
+	if request.UserID != userID {
+		return nil, nil // Not found
+	}
+	return s.transition(ctx, id, StatusWithdrawn, nil, "")
 }
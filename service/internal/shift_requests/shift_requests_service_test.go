@@ -0,0 +1,284 @@
+package shift_requests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/afrianjunior/justpayd/internal/assignments"
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/shifts"
+)
+
+// Users seeded by newServiceTest
+const (
+	testAdminID   = 1
+	testWorkerID  = 2
+	testWorker2ID = 3
+	testWorker3ID = 4
+)
+
+type serviceTest struct {
+	db      *sql.DB
+	service ShiftRequestService
+	ctx     context.Context
+}
+
+// newServiceTest migrates an in-memory database, seeds an admin and three workers and wires
+// the service the way the REST server does
+func newServiceTest(t *testing.T) *serviceTest {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// Every connection to :memory: opens a database of its own. It also makes any query
+	// escaping the unit of work block instead of passing unnoticed.
+	db.SetMaxOpenConns(1)
+
+	migrations, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		query, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(query)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(migration), err)
+		}
+	}
+
+	seed := []string{
+		"INSERT INTO users (id, name, email, role) VALUES (1, 'Admin', 'admin@example.com', 'admin')",
+		"INSERT INTO users (id, name, email, role) VALUES (2, 'Ayu', 'ayu@example.com', 'worker')",
+		"INSERT INTO users (id, name, email, role) VALUES (3, 'Budi', 'budi@example.com', 'worker')",
+		"INSERT INTO users (id, name, email, role) VALUES (4, 'Citra', 'citra@example.com', 'worker')",
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &pkg.Config{}
+	config.Shifts.MinRestHours = 8
+	assignmentRepository := assignments.NewAssignmentRepository(db)
+	service := NewShiftRequestService(
+		NewShiftRequestRepository(db),
+		assignmentRepository,
+		shifts.NewShiftRepository(db),
+		availability.NewAvailabilityService(availability.NewAvailabilityRepository(db)),
+		pkg.NewUnitOfWork(db),
+		config,
+	)
+	return &serviceTest{db: db, service: service, ctx: context.Background()}
+}
+
+// addShift stores an eight hour cashier shift starting at start and returns its ID
+func (st *serviceTest) addShift(t *testing.T, start time.Time) int {
+	t.Helper()
+	start = start.UTC()
+	end := start.Add(8 * time.Hour)
+	result, err := st.db.Exec(
+		"INSERT INTO shifts (start_at, end_at, date, start_time, end_time, role) VALUES (?, ?, ?, ?, ?, 'cashier')",
+		pkg.FormatTimestamp(start), pkg.FormatTimestamp(end),
+		start.Format(pkg.DateLayout), start.Format(pkg.ClockLayout), end.Format(pkg.ClockLayout),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func (st *serviceTest) request(t *testing.T, userID int, shiftID int) int {
+	t.Helper()
+	request, err := st.service.CreateShiftRequest(st.ctx, userID, shiftID, &CreateShiftRequestDTO{ShiftID: shiftID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request.ID
+}
+
+// status returns the stored status, reason and reviewer of a request
+func (st *serviceTest) status(t *testing.T, id int) (string, string, *int) {
+	t.Helper()
+	var status string
+	var reason sql.NullString
+	var reviewedBy sql.NullInt64
+	if err := st.db.QueryRow("SELECT status, reason, reviewed_by FROM shift_requests WHERE id = ?", id).Scan(&status, &reason, &reviewedBy); err != nil {
+		t.Fatal(err)
+	}
+	if !reviewedBy.Valid {
+		return status, reason.String, nil
+	}
+	reviewer := int(reviewedBy.Int64)
+	return status, reason.String, &reviewer
+}
+
+// assignee returns the worker actively assigned to the shift, 0 when it is open
+func (st *serviceTest) assignee(t *testing.T, shiftID int) int {
+	t.Helper()
+	var userID int
+	err := st.db.QueryRow("SELECT user_id FROM assignments WHERE shift_id = ? AND status = 'active'", shiftID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func isConflict(err error) bool {
+	var conflictErr pkg.ConflictError
+	return errors.As(err, &conflictErr)
+}
+
+func TestApproveShiftRequestRejectsOtherRequests(t *testing.T) {
+	st := newServiceTest(t)
+	shiftID := st.addShift(t, time.Now().Add(48*time.Hour))
+	otherShiftID := st.addShift(t, time.Now().Add(96*time.Hour))
+
+	approvedID := st.request(t, testWorkerID, shiftID)
+	rejectedID := st.request(t, testWorker2ID, shiftID)
+	withdrawnID := st.request(t, testWorker3ID, shiftID)
+	if _, err := st.service.WithdrawShiftRequest(st.ctx, withdrawnID, testWorker3ID); err != nil {
+		t.Fatal(err)
+	}
+	otherShiftRequestID := st.request(t, testWorker2ID, otherShiftID)
+
+	approved, err := st.service.ApproveShiftRequest(st.ctx, approvedID, testAdminID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved == nil || approved.Status != StatusApproved {
+		t.Fatalf("approved = %+v, want an approved request", approved)
+	}
+	if got := st.assignee(t, shiftID); got != testWorkerID {
+		t.Errorf("shift is assigned to %d, want %d", got, testWorkerID)
+	}
+
+	tests := []struct {
+		name       string
+		id         int
+		wantStatus string
+		wantReason string
+		reviewed   bool
+	}{
+		{name: "approved request", id: approvedID, wantStatus: StatusApproved, reviewed: true},
+		{name: "other pending request", id: rejectedID, wantStatus: StatusRejected, wantReason: ReasonAssignedToOther, reviewed: true},
+		{name: "withdrawn request", id: withdrawnID, wantStatus: StatusWithdrawn},
+		{name: "request for another shift", id: otherShiftRequestID, wantStatus: StatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, reason, reviewedBy := st.status(t, tt.id)
+			if status != tt.wantStatus || reason != tt.wantReason {
+				t.Errorf("request is %s (%q), want %s (%q)", status, reason, tt.wantStatus, tt.wantReason)
+			}
+			if tt.reviewed && (reviewedBy == nil || *reviewedBy != testAdminID) {
+				t.Errorf("reviewed_by = %v, want %d", reviewedBy, testAdminID)
+			}
+			if !tt.reviewed && reviewedBy != nil {
+				t.Errorf("reviewed_by = %d, want none", *reviewedBy)
+			}
+		})
+	}
+}
+
+func TestApproveShiftRequestShiftTaken(t *testing.T) {
+	st := newServiceTest(t)
+	shiftID := st.addShift(t, time.Now().Add(48*time.Hour))
+	requestID := st.request(t, testWorkerID, shiftID)
+	if _, err := st.db.Exec("INSERT INTO assignments (shift_id, user_id) VALUES (?, ?)", shiftID, testWorker2ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := st.service.ApproveShiftRequest(st.ctx, requestID, testAdminID, nil)
+	if !isConflict(err) {
+		t.Fatalf("err = %v, want a conflict", err)
+	}
+
+	// The unit of work rolled back, the request can still be reviewed
+	if status, _, reviewedBy := st.status(t, requestID); status != StatusPending || reviewedBy != nil {
+		t.Errorf("request is %s reviewed by %v, want pending and unreviewed", status, reviewedBy)
+	}
+	if got := st.assignee(t, shiftID); got != testWorker2ID {
+		t.Errorf("shift is assigned to %d, want %d", got, testWorker2ID)
+	}
+}
+
+func TestApproveShiftRequestTwice(t *testing.T) {
+	st := newServiceTest(t)
+	shiftID := st.addShift(t, time.Now().Add(48*time.Hour))
+	requestID := st.request(t, testWorkerID, shiftID)
+	if _, err := st.service.ApproveShiftRequest(st.ctx, requestID, testAdminID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.service.ApproveShiftRequest(st.ctx, requestID, testAdminID, nil); !isConflict(err) {
+		t.Errorf("err = %v, want a conflict", err)
+	}
+}
+
+func TestWithdrawShiftRequest(t *testing.T) {
+	st := newServiceTest(t)
+	shiftID := st.addShift(t, time.Now().Add(48*time.Hour))
+	requestID := st.request(t, testWorkerID, shiftID)
+
+	// Requests of other workers are reported as not found and left alone
+	request, err := st.service.WithdrawShiftRequest(st.ctx, requestID, testWorker2ID)
+	if err != nil || request != nil {
+		t.Fatalf("got %+v, %v, want not found", request, err)
+	}
+	if status, _, _ := st.status(t, requestID); status != StatusPending {
+		t.Fatalf("request is %s, want pending", status)
+	}
+
+	request, err = st.service.WithdrawShiftRequest(st.ctx, requestID, testWorkerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request == nil || request.Status != StatusWithdrawn {
+		t.Fatalf("request = %+v, want a withdrawn request", request)
+	}
+
+	if _, err := st.service.WithdrawShiftRequest(st.ctx, requestID, testWorkerID); !isConflict(err) {
+		t.Errorf("withdrawing again: err = %v, want a conflict", err)
+	}
+	if _, err := st.service.ApproveShiftRequest(st.ctx, requestID, testAdminID, nil); !isConflict(err) {
+		t.Errorf("approving a withdrawn request: err = %v, want a conflict", err)
+	}
+}
+
+func TestCreateShiftRequestTwice(t *testing.T) {
+	st := newServiceTest(t)
+	shiftID := st.addShift(t, time.Now().Add(48*time.Hour))
+	requestID := st.request(t, testWorkerID, shiftID)
+
+	if _, err := st.service.CreateShiftRequest(st.ctx, testWorkerID, shiftID, &CreateShiftRequestDTO{ShiftID: shiftID}); !isConflict(err) {
+		t.Fatalf("err = %v, want a conflict while the request is pending", err)
+	}
+
+	// Once withdrawn the worker may ask again
+	if _, err := st.service.WithdrawShiftRequest(st.ctx, requestID, testWorkerID); err != nil {
+		t.Fatal(err)
+	}
+	st.request(t, testWorkerID, shiftID)
+}
@@ -0,0 +1,151 @@
+package shift_templates
+
+import (
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// Kinds of per-occurrence exceptions
+const (
+	ExceptionSkip   = "skip"
+	ExceptionModify = "modify"
+)
+
+// ShiftTemplate describes a recurring shift. Occurrences are the days matched by RRule from
+// StartsOn up to and including Until, each running from StartTime to EndTime in the time zone
+// of the location.
+type ShiftTemplate struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name" example:"Weekday cashier"`
+	Role       string `json:"role" example:"cashier"`
+	LocationID *int   `json:"location_id"`
+	Location   string `json:"location"`
+	TimeZone   string `json:"time_zone" example:"Asia/Jakarta"`
+	StartTime  string `json:"start_time" example:"09:00:00"`
+	EndTime    string `json:"end_time" example:"17:00:00"`
+	// Overnight is set when occurrences end the day after they start
+	Overnight bool `json:"overnight"`
+	// RRule is an iCalendar recurrence rule without DTSTART and UNTIL
+	RRule    string  `json:"rrule" example:"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"`
+	StartsOn string  `json:"starts_on" example:"2025-06-02"`
+	Until    *string `json:"until" example:"2025-12-31"`
+	// ParentID is the template this one was split from by a "this and following" edit
+	ParentID   *int                `json:"parent_id,omitempty"`
+	Exceptions []TemplateException `json:"exceptions"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+// TemplateException skips or changes a single occurrence
+type TemplateException struct {
+	Date string `json:"date" example:"2025-08-17"`
+	// Kind is skip or modify
+	Kind string `json:"kind" example:"modify"`
+	// StartTime, EndTime and Role replace the template's values for a modified occurrence
+	StartTime *string `json:"start_time,omitempty"`
+	EndTime   *string `json:"end_time,omitempty"`
+	Role      *string `json:"role,omitempty"`
+}
+
+type CreateShiftTemplateRequest struct {
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	LocationID *int   `json:"location_id"`
+	StartTime  string `json:"start_time" example:"09:00"`
+	EndTime    string `json:"end_time" example:"17:00"`
+	// Overnight must be set when end_time falls on the next day
+	Overnight bool   `json:"overnight"`
+	RRule     string `json:"rrule" example:"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"`
+	StartsOn  string `json:"starts_on" example:"2025-06-02"`
+	Until     string `json:"until" example:"2025-12-31"`
+}
+
+// UpdateShiftTemplateRequest changes a template. Without From the whole series changes,
+// with it only the occurrence on From and the following ones do.
+type UpdateShiftTemplateRequest struct {
+	From       string  `json:"from" example:"2025-09-01"`
+	Name       *string `json:"name"`
+	Role       *string `json:"role"`
+	LocationID *int    `json:"location_id"`
+	StartTime  *string `json:"start_time"`
+	EndTime    *string `json:"end_time"`
+	Overnight  *bool   `json:"overnight"`
+	RRule      *string `json:"rrule"`
+	// Until ends the series on this date, an empty string makes it open ended
+	Until *string `json:"until"`
+}
+
+type ExceptionRequest struct {
+	// Kind is skip or modify
+	Kind      string  `json:"kind" example:"modify"`
+	StartTime *string `json:"start_time"`
+	EndTime   *string `json:"end_time"`
+	// Overnight must be set when the modified end_time falls on the next day
+	Overnight bool    `json:"overnight"`
+	Role      *string `json:"role"`
+}
+
+// Occurrence is one day of a template, with its exception applied
+type Occurrence struct {
+	// OccurrenceDate is the day in the template's recurrence, in the location's time zone
+	OccurrenceDate string `json:"occurrence_date"`
+	pkg.Schedule
+	Role     string `json:"role"`
+	Skipped  bool   `json:"skipped"`
+	Modified bool   `json:"modified"`
+	// ShiftID is set once the occurrence was materialized into a shift
+	ShiftID *int `json:"shift_id"`
+}
+
+type MaterializeRequest struct {
+	From string `json:"from" example:"2025-06-01"`
+	To   string `json:"to" example:"2025-06-30"`
+}
+
+type MaterializeResponse struct {
+	// CreatedShiftIDs are the shifts created for occurrences that had none yet
+	CreatedShiftIDs []int `json:"created_shift_ids"`
+	// AlreadyMaterialized counts occurrences in the window that already had a shift
+	AlreadyMaterialized int `json:"already_materialized"`
+	// Skipped counts occurrences in the window skipped by an exception
+	Skipped int `json:"skipped"`
+}
+
+// ReasonOccurrenceRemoved is why a shift workers requested or were assigned is cancelled
+// when its template no longer has its occurrence
+const ReasonOccurrenceRemoved = "The occurrence was removed from its template"
+
+// MaterializedShift is a shift created from an occurrence
+type MaterializedShift struct {
+	ShiftID        int
+	OccurrenceDate string
+	StartAt        time.Time
+	EndAt          time.Time
+	// AssigneeID is the user with the active assignment of the shift, nil when it is open
+	AssigneeID *int
+}
+
+// ShiftSync brings the shifts materialized from a template in line with a changed schedule
+type ShiftSync struct {
+	// Update holds occurrences whose shift gets the new times, role and location
+	Update []Occurrence
+	// Delete lists unassigned shifts whose occurrence is gone. Those with past requests or
+	// assignments are cancelled rather than deleted.
+	Delete []int
+	// Detach lists assigned shifts whose occurrence is gone. They are kept as one-off shifts.
+	Detach []int
+	// Keep lists shifts that already started. They keep their times and only move to the
+	// changed template.
+	Keep []int
+	// By is the admin making the change, recorded on the shifts and requests it cancels
+	By int
+}
+
+// TemplateChange is an edit to a template and the shift changes it causes
+type TemplateChange struct {
+	// Template is the template as it is stored after the change
+	Template *ShiftTemplate
+	// Split is the template created by a "this and following" edit, nil when the whole series changed
+	Split *ShiftTemplate
+	Sync  ShiftSync
+}
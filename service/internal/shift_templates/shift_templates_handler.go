@@ -0,0 +1,408 @@
+package shift_templates
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/afrianjunior/justpayd/internal/assignments"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+type ShiftTemplateHandler struct {
+	ShiftTemplateService ShiftTemplateService
+	logger               *zap.SugaredLogger
+}
+
+func NewShiftTemplateHandler(shiftTemplateService ShiftTemplateService, logger *zap.SugaredLogger) *ShiftTemplateHandler {
+	return &ShiftTemplateHandler{
+		ShiftTemplateService: shiftTemplateService,
+		logger:               logger,
+	}
+}
+
+// RegisterRoutes registers the shift template routes. Templates create shifts, so every
+// route needs the permission to manage them.
+func (h *ShiftTemplateHandler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftsManage))
+		r.Post("/", h.CreateTemplate)
+		r.Get("/", h.GetTemplates)
+		r.Get("/{id}", h.GetTemplateByID)
+		r.Put("/{id}", h.UpdateTemplate)
+		r.Delete("/{id}", h.DeleteTemplate)
+		r.Get("/{id}/occurrences", h.GetOccurrences)
+		r.Post("/{id}/materialize", h.Materialize)
+		r.Put("/{id}/exceptions/{date}", h.SetException)
+		r.Delete("/{id}/exceptions/{date}", h.DeleteException)
+	})
+}
+
+// @Summary Create shift template
+// @Description Admin creates a recurring shift. The RRULE picks the days, start_time and end_time are wall clock times at the location.
+// @Tags shift_templates
+// @Accept json
+// @Produce json
+// @Param payload body CreateShiftTemplateRequest true "Template"
+// @Success 201 {object} pkg.BaseResponse{data=ShiftTemplate} "Template created"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates [post]
+func (h *ShiftTemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var payload CreateShiftTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	template, err := h.ShiftTemplateService.CreateTemplate(r.Context(), &payload)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error creating shift template: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create shift template"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(template))
+}
+
+// @Summary List shift templates
+// @Description List the recurring shifts with their exceptions, a page at a time
+// @Tags shift_templates
+// @Produce json
+// @Param location_id query integer false "Filter by location ID"
+// @Param role query string false "Filter by role, ignoring case"
+// @Param sort query string false "name, starts_on or id, prefixed with - for descending" default(name)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} pkg.BaseResponse{data=[]ShiftTemplate} "Successfully retrieved templates"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates [get]
+func (h *ShiftTemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	templates, page, err := h.ShiftTemplateService.GetTemplates(r.Context(), q)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting shift templates: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve shift templates"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(templates, page))
+}
+
+// @Summary Get shift template
+// @Description Get a shift template by ID
+// @Tags shift_templates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} pkg.BaseResponse{data=ShiftTemplate} "Successfully retrieved template"
+// @Failure 400 {object} pkg.BaseResponse "Invalid template ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id} [get]
+func (h *ShiftTemplateHandler) GetTemplateByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+
+	template, err := h.ShiftTemplateService.GetTemplateByID(r.Context(), id)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve shift template"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(template))
+}
+
+// @Summary Update shift template
+// @Description Admin changes a template. Without from the whole series changes. With from only the occurrences on and after it do: the template ends the day before and a new template, returned here, continues the series. Upcoming materialized shifts follow the change, shifts that already started keep their times. Shifts whose occurrence is gone are deleted, or kept as one-off shifts when assigned. Moving an assigned shift is refused when it clashes with the assignee's schedule, unless forced.
+// @Tags shift_templates
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param force query bool false "Move assigned shifts despite conflicts, the overrides are recorded"
+// @Param payload body UpdateShiftTemplateRequest true "Fields to change"
+// @Success 200 {object} pkg.BaseResponse{data=ShiftTemplate} "Template updated"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template not found"
+// @Failure 409 {object} pkg.BaseResponse "A moved shift clashes with its assignee's schedule, see conflicts"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id} [put]
+func (h *ShiftTemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+
+	var payload UpdateShiftTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	override, err := assignments.OverrideFromRequest(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	template, err := h.ShiftTemplateService.UpdateTemplate(r.Context(), id, &payload, userID, override)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error updating shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update shift template"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(template))
+}
+
+// @Summary Delete shift template
+// @Description Admin deletes a template and its exceptions. Shifts already materialized from it are kept.
+// @Tags shift_templates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} pkg.BaseResponse "Template deleted"
+// @Failure 400 {object} pkg.BaseResponse "Invalid template ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id} [delete]
+func (h *ShiftTemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+
+	if err := h.ShiftTemplateService.DeleteTemplate(r.Context(), id); err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error deleting shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to delete shift template"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(map[string]string{"message": "Shift template deleted successfully"}))
+}
+
+// @Summary Preview occurrences
+// @Description Lists the occurrences of a template between from and to inclusive, at most 366 days, with exceptions applied and the shift each one was materialized into
+// @Tags shift_templates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param from query string true "First day, YYYY-MM-DD"
+// @Param to query string true "Last day, YYYY-MM-DD"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of the template's location"
+// @Success 200 {object} pkg.BaseResponse{data=[]Occurrence} "Successfully retrieved occurrences"
+// @Failure 400 {object} pkg.BaseResponse "Invalid template ID or unknown time zone"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template not found"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id}/occurrences [get]
+func (h *ShiftTemplateHandler) GetOccurrences(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	occurrences, err := h.ShiftTemplateService.GetOccurrences(r.Context(), id, r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting occurrences of shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve occurrences"))
+		return
+	}
+	for i := range occurrences {
+		occurrences[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(occurrences))
+}
+
+// @Summary Materialize occurrences
+// @Description Admin creates shifts for the occurrences between from and to inclusive, at most 366 days. Occurrences that already have a shift or are skipped are left out, so windows may overlap.
+// @Tags shift_templates
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param payload body MaterializeRequest true "Date window"
+// @Success 200 {object} pkg.BaseResponse{data=MaterializeResponse} "Occurrences materialized"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template not found"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id}/materialize [post]
+func (h *ShiftTemplateHandler) Materialize(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+
+	var payload MaterializeRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	result, err := h.ShiftTemplateService.Materialize(r.Context(), id, &payload)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error materializing shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to materialize occurrences"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(result))
+}
+
+// @Summary Set occurrence exception
+// @Description Admin skips or modifies the occurrence on date. A materialized shift that didn't start yet follows: a skipped one is deleted, which is refused while someone is assigned to it, and moving an assigned one is refused when it clashes with the assignee's schedule, unless forced.
+// @Tags shift_templates
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param date path string true "Occurrence date, YYYY-MM-DD"
+// @Param force query bool false "Move an assigned shift despite conflicts, the override is recorded"
+// @Param payload body ExceptionRequest true "Exception"
+// @Success 200 {object} pkg.BaseResponse{data=ShiftTemplate} "Exception saved"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template not found"
+// @Failure 409 {object} pkg.BaseResponse "Occurrence is assigned, or the moved shift clashes with its assignee's schedule, see conflicts"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id}/exceptions/{date} [put]
+func (h *ShiftTemplateHandler) SetException(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+
+	var payload ExceptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload"))
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	override, err := assignments.OverrideFromRequest(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	template, err := h.ShiftTemplateService.SetException(r.Context(), id, chi.URLParam(r, "date"), &payload, userID, override)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error saving exception of shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to save exception"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(template))
+}
+
+// @Summary Remove occurrence exception
+// @Description Admin restores the occurrence on date, and its materialized shift if it didn't start yet, to the template's schedule. Moving an assigned shift is refused when it clashes with the assignee's schedule, unless forced.
+// @Tags shift_templates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param date path string true "Occurrence date, YYYY-MM-DD"
+// @Param force query bool false "Move an assigned shift despite conflicts, the override is recorded"
+// @Success 200 {object} pkg.BaseResponse{data=ShiftTemplate} "Exception removed"
+// @Failure 400 {object} pkg.BaseResponse "Invalid template ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Template or exception not found"
+// @Failure 409 {object} pkg.BaseResponse "The moved shift clashes with its assignee's schedule, see conflicts"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shift_templates/{id}/exceptions/{date} [delete]
+func (h *ShiftTemplateHandler) DeleteException(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid template ID"))
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	override, err := assignments.OverrideFromRequest(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	template, err := h.ShiftTemplateService.DeleteException(r.Context(), id, chi.URLParam(r, "date"), userID, override)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error removing exception of shift template %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to remove exception"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(template))
+}
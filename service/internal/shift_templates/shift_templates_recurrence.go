@@ -0,0 +1,288 @@
+package shift_templates
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// maxWindowDays bounds the date windows occurrences are previewed and materialized for
+const maxWindowDays = 366
+
+// parseRule parses a template's RRULE. The rule only picks days, the time of day comes from
+// the template and the first and last day from starts_on and until.
+func parseRule(rule string) (*rrule.ROption, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if strings.Contains(strings.ToUpper(rule), "DTSTART") {
+		return nil, errors.New("must not contain DTSTART, set starts_on instead")
+	}
+	opt, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, errors.New("must be an RRULE such as FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR")
+	}
+
+	switch {
+	case opt.Freq == rrule.HOURLY || opt.Freq == rrule.MINUTELY || opt.Freq == rrule.SECONDLY:
+		return nil, errors.New("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+	case len(opt.Byhour) > 0 || len(opt.Byminute) > 0 || len(opt.Bysecond) > 0:
+		return nil, errors.New("must not contain BYHOUR, BYMINUTE or BYSECOND, set start_time instead")
+	case !opt.Until.IsZero() || opt.Count > 0:
+		return nil, errors.New("must not contain UNTIL or COUNT, set until instead")
+	}
+	return opt, nil
+}
+
+// occurrenceDates returns the days of the template's recurrence between from and to inclusive
+func occurrenceDates(t *ShiftTemplate, from time.Time, to time.Time) ([]time.Time, error) {
+	opt, err := parseRule(t.RRule)
+	if err != nil {
+		return nil, err
+	}
+	opt.Dtstart, err = time.Parse(pkg.DateLayout, t.StartsOn)
+	if err != nil {
+		return nil, err
+	}
+	if t.Until != nil {
+		if opt.Until, err = time.Parse(pkg.DateLayout, *t.Until); err != nil {
+			return nil, err
+		}
+	}
+
+	rule, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, err
+	}
+	return rule.Between(from, to, true), nil
+}
+
+// occurrences expands the template between from and to inclusive, applying its exceptions
+func occurrences(t *ShiftTemplate, from time.Time, to time.Time) ([]Occurrence, error) {
+	dates, err := occurrenceDates(t, from, to)
+	if err != nil {
+		return nil, err
+	}
+	zone, err := pkg.LoadTimeZone(t.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions := make(map[string]*TemplateException, len(t.Exceptions))
+	for i := range t.Exceptions {
+		exceptions[t.Exceptions[i].Date] = &t.Exceptions[i]
+	}
+
+	result := make([]Occurrence, 0, len(dates))
+	for _, date := range dates {
+		occurrence, err := buildOccurrence(t, date, zone, exceptions[date.Format(pkg.DateLayout)])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, occurrence)
+	}
+	return result, nil
+}
+
+func buildOccurrence(t *ShiftTemplate, date time.Time, zone *time.Location, exception *TemplateException) (Occurrence, error) {
+	occurrence := Occurrence{OccurrenceDate: date.Format(pkg.DateLayout), Role: t.Role}
+	startValue, endValue := t.StartTime, t.EndTime
+
+	if exception != nil {
+		switch exception.Kind {
+		case ExceptionSkip:
+			occurrence.Skipped = true
+		case ExceptionModify:
+			occurrence.Modified = true
+			if exception.StartTime != nil {
+				startValue = *exception.StartTime
+			}
+			if exception.EndTime != nil {
+				endValue = *exception.EndTime
+			}
+			if exception.Role != nil {
+				occurrence.Role = *exception.Role
+			}
+		}
+	}
+
+	start, err := pkg.ParseClock(startValue)
+	if err != nil {
+		return occurrence, err
+	}
+	end, err := pkg.ParseClock(endValue)
+	if err != nil {
+		return occurrence, err
+	}
+	startAt := pkg.AtClock(date, start, zone)
+	endAt := pkg.AtClock(date, end, zone)
+	if !endAt.After(startAt) {
+		endAt = pkg.AtClock(date.AddDate(0, 0, 1), end, zone)
+	}
+	occurrence.Schedule = pkg.NewSchedule(startAt, endAt, t.TimeZone)
+	return occurrence, nil
+}
+
+// planSync works out what happens to materialized shifts when their template's schedule
+// becomes t. Shifts whose occurrence still exists get its new times, the others are deleted
+// or, when someone is assigned to them, detached from the template. Shifts that started
+// before now are history and keep their times.
+func planSync(t *ShiftTemplate, materialized []MaterializedShift, now time.Time) (ShiftSync, error) {
+	var sync ShiftSync
+	var upcoming []MaterializedShift
+	for _, shift := range materialized {
+		if shift.StartAt.After(now) {
+			upcoming = append(upcoming, shift)
+		} else {
+			sync.Keep = append(sync.Keep, shift.ShiftID)
+		}
+	}
+	materialized = upcoming
+	if len(materialized) == 0 {
+		return sync, nil
+	}
+
+	first, err := time.Parse(pkg.DateLayout, materialized[0].OccurrenceDate)
+	if err != nil {
+		return sync, err
+	}
+	last, err := time.Parse(pkg.DateLayout, materialized[len(materialized)-1].OccurrenceDate)
+	if err != nil {
+		return sync, err
+	}
+	planned, err := occurrences(t, first, last)
+	if err != nil {
+		return sync, err
+	}
+	byDate := make(map[string]Occurrence, len(planned))
+	for _, occurrence := range planned {
+		byDate[occurrence.OccurrenceDate] = occurrence
+	}
+
+	for _, shift := range materialized {
+		occurrence, ok := byDate[shift.OccurrenceDate]
+		switch {
+		case ok && !occurrence.Skipped:
+			shiftID := shift.ShiftID
+			occurrence.ShiftID = &shiftID
+			sync.Update = append(sync.Update, occurrence)
+		case shift.AssigneeID != nil:
+			sync.Detach = append(sync.Detach, shift.ShiftID)
+		default:
+			sync.Delete = append(sync.Delete, shift.ShiftID)
+		}
+	}
+	return sync, nil
+}
+
+// validateTemplate checks a template against the shift rules and normalizes its fields.
+// overnight confirms that occurrences end the next day.
+func validateTemplate(config pkg.ShiftConfig, t *ShiftTemplate, overnight bool) []pkg.FieldError {
+	var errs []pkg.FieldError
+
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		errs = append(errs, pkg.FieldError{Field: "name", Message: "is required"})
+	}
+
+	t.Role = strings.TrimSpace(t.Role)
+	if t.Role == "" {
+		errs = append(errs, pkg.FieldError{Field: "role", Message: "is required"})
+	} else if role, ok := config.AllowedRole(t.Role); ok {
+		t.Role = role
+	} else {
+		errs = append(errs, pkg.FieldError{Field: "role", Message: "must be one of: " + strings.Join(config.Roles, ", ")})
+	}
+
+	var clockErrs []pkg.FieldError
+	t.StartTime, t.EndTime, t.Overnight, clockErrs = validateClocks(config, t.StartTime, t.EndTime, overnight)
+	errs = append(errs, clockErrs...)
+
+	t.RRule = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(t.RRule), "RRULE:"))
+	if t.RRule == "" {
+		errs = append(errs, pkg.FieldError{Field: "rrule", Message: "is required"})
+	} else if _, err := parseRule(t.RRule); err != nil {
+		errs = append(errs, pkg.FieldError{Field: "rrule", Message: err.Error()})
+	}
+
+	startsOn, err := time.Parse(pkg.DateLayout, strings.TrimSpace(t.StartsOn))
+	if err != nil {
+		errs = append(errs, pkg.FieldError{Field: "starts_on", Message: "must be a date in YYYY-MM-DD format"})
+	} else {
+		t.StartsOn = startsOn.Format(pkg.DateLayout)
+	}
+	if t.Until != nil {
+		until, err := time.Parse(pkg.DateLayout, strings.TrimSpace(*t.Until))
+		switch {
+		case err != nil:
+			errs = append(errs, pkg.FieldError{Field: "until", Message: "must be a date in YYYY-MM-DD format"})
+		case until.Before(startsOn):
+			errs = append(errs, pkg.FieldError{Field: "until", Message: "must not be before starts_on"})
+		default:
+			value := until.Format(pkg.DateLayout)
+			t.Until = &value
+		}
+	}
+	return errs
+}
+
+// validateClocks checks a start and end wall clock time pair and normalizes both to HH:MM:SS.
+// An end at or before the start is only accepted as an overnight shift.
+func validateClocks(config pkg.ShiftConfig, startValue string, endValue string, overnight bool) (string, string, bool, []pkg.FieldError) {
+	var errs []pkg.FieldError
+	start, startErr := pkg.ParseClock(startValue)
+	if startErr != nil {
+		errs = append(errs, pkg.FieldError{Field: "start_time", Message: "must be a time in HH:MM or HH:MM:SS format"})
+	}
+	end, endErr := pkg.ParseClock(endValue)
+	if endErr != nil {
+		errs = append(errs, pkg.FieldError{Field: "end_time", Message: "must be a time in HH:MM or HH:MM:SS format"})
+	}
+	if len(errs) > 0 {
+		return startValue, endValue, overnight, errs
+	}
+
+	duration := end.Sub(start)
+	switch {
+	case duration <= 0 && !overnight:
+		errs = append(errs, pkg.FieldError{Field: "end_time", Message: "must be after start_time, set overnight for shifts ending the next day"})
+	case duration > 0 && overnight:
+		errs = append(errs, pkg.FieldError{Field: "overnight", Message: "is only allowed when end_time is not after start_time"})
+	default:
+		if duration <= 0 {
+			duration += 24 * time.Hour
+		}
+		if config.MaxDurationHours > 0 && duration > time.Duration(config.MaxDurationHours)*time.Hour {
+			errs = append(errs, pkg.FieldError{Field: "end_time", Message: fmt.Sprintf("shift cannot be longer than %d hours", config.MaxDurationHours)})
+		}
+	}
+	return start.Format(pkg.ClockLayout), end.Format(pkg.ClockLayout), duration <= 0 || overnight, errs
+}
+
+// parseWindow parses an inclusive from and to date window
+func parseWindow(fromValue string, toValue string) (time.Time, time.Time, error) {
+	var errs []pkg.FieldError
+	from, err := time.Parse(pkg.DateLayout, strings.TrimSpace(fromValue))
+	if err != nil {
+		errs = append(errs, pkg.FieldError{Field: "from", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	to, err := time.Parse(pkg.DateLayout, strings.TrimSpace(toValue))
+	if err != nil {
+		errs = append(errs, pkg.FieldError{Field: "to", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	if len(errs) == 0 {
+		switch {
+		case to.Before(from):
+			errs = append(errs, pkg.FieldError{Field: "to", Message: "must not be before from"})
+		case to.Sub(from) >= maxWindowDays*24*time.Hour:
+			errs = append(errs, pkg.FieldError{Field: "to", Message: fmt.Sprintf("window cannot be longer than %d days", maxWindowDays)})
+		}
+	}
+	if len(errs) > 0 {
+		return from, to, pkg.NewFieldValidationError(errs)
+	}
+	return from, to, nil
+}
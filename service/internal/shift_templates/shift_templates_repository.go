@@ -0,0 +1,525 @@
+package shift_templates
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// ShiftTemplateRepository defines the interface for shift template data operations
+type ShiftTemplateRepository interface {
+	CreateTemplate(ctx context.Context, template *ShiftTemplate) (*ShiftTemplate, error)
+	GetTemplates(ctx context.Context, q *pkg.ListQuery) ([]ShiftTemplate, *pkg.Pagination, error)
+	GetTemplateByID(ctx context.Context, id int) (*ShiftTemplate, error)
+	SaveTemplateChange(ctx context.Context, change *TemplateChange, from string) (*ShiftTemplate, error)
+	DeleteTemplate(ctx context.Context, id int) error
+	SaveException(ctx context.Context, template *ShiftTemplate, exception *TemplateException, sync ShiftSync) (*ShiftTemplate, error)
+	DeleteException(ctx context.Context, template *ShiftTemplate, date string, sync ShiftSync) (*ShiftTemplate, error)
+	GetMaterializedShifts(ctx context.Context, templateID int, from string, to string) ([]MaterializedShift, error)
+	CreateShifts(ctx context.Context, template *ShiftTemplate, occurrences []Occurrence) ([]int, error)
+}
+
+type shiftTemplateRepository struct {
+	db *sql.DB
+}
+
+// NewShiftTemplateRepository creates a new instance of ShiftTemplateRepository
+func NewShiftTemplateRepository(db *sql.DB) ShiftTemplateRepository {
+	return &shiftTemplateRepository{db: db}
+}
+
+const templateQuery = `
+	SELECT
+		t.id,
+		t.name,
+		t.role,
+		t.location_id,
+		COALESCE(l.name, '') as location,
+		COALESCE(l.time_zone, 'UTC') as time_zone,
+		t.start_time,
+		t.end_time,
+		t.rrule,
+		t.starts_on,
+		t.until,
+		t.parent_id,
+		t.created_at
+	FROM shift_templates t
+	LEFT JOIN locations l ON t.location_id = l.id
+`
+
+func (r *shiftTemplateRepository) CreateTemplate(ctx context.Context, template *ShiftTemplate) (*ShiftTemplate, error) {
+	id, err := insertTemplate(ctx, pkg.Conn(ctx, r.db), template)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTemplateByID(ctx, id)
+}
+
+// templateList applies list queries to templateQuery
+var templateList = &pkg.ListSpec[ShiftTemplate]{
+	Sorts: map[string]pkg.SortKey[ShiftTemplate]{
+		"name":      {Column: "t.name", Value: func(t *ShiftTemplate) interface{} { return t.Name }},
+		"starts_on": {Column: "t.starts_on", Value: func(t *ShiftTemplate) interface{} { return t.StartsOn }},
+		"id":        {Column: "t.id", Value: func(t *ShiftTemplate) interface{} { return t.ID }},
+	},
+	DefaultSort: "name",
+	IDColumn:    "t.id",
+	ID:          func(t *ShiftTemplate) int { return t.ID },
+	Location:    "t.location_id",
+	Role:        "t.role",
+}
+
+func (r *shiftTemplateRepository) GetTemplates(ctx context.Context, q *pkg.ListQuery) ([]ShiftTemplate, *pkg.Pagination, error) {
+	clause, args, err := templateList.Build(q, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, templateQuery+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	templates := []ShiftTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		templates = append(templates, *template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	templates, page := templateList.Page(q, templates)
+	for i := range templates {
+		if templates[i].Exceptions, err = r.getExceptions(ctx, templates[i].ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return templates, page, nil
+}
+
+func (r *shiftTemplateRepository) GetTemplateByID(ctx context.Context, id int) (*ShiftTemplate, error) {
+	template, err := scanTemplate(pkg.Conn(ctx, r.db).QueryRowContext(ctx, templateQuery+" WHERE t.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	if template.Exceptions, err = r.getExceptions(ctx, id); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (r *shiftTemplateRepository) getExceptions(ctx context.Context, templateID int) ([]TemplateException, error) {
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, `
+		SELECT occurrence_date, kind, start_time, end_time, role
+		FROM shift_template_exceptions
+		WHERE template_id = ?
+		ORDER BY occurrence_date
+	`, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []TemplateException{}
+	for rows.Next() {
+		var exception TemplateException
+		var date time.Time
+		var startTime, endTime, role sql.NullString
+		if err := rows.Scan(&date, &exception.Kind, &startTime, &endTime, &role); err != nil {
+			return nil, err
+		}
+		exception.Date = date.Format(pkg.DateLayout)
+		exception.StartTime = nullableString(startTime)
+		exception.EndTime = nullableString(endTime)
+		exception.Role = nullableString(role)
+		exceptions = append(exceptions, exception)
+	}
+	return exceptions, rows.Err()
+}
+
+// SaveTemplateChange stores an edited template together with the changes to its shifts.
+// For a "this and following" edit the original template ends the day before from, the
+// split template takes over the exceptions from then on and the synced shifts are moved to it.
+func (r *shiftTemplateRepository) SaveTemplateChange(ctx context.Context, change *TemplateChange, from string) (*ShiftTemplate, error) {
+	target := change.Template
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		if change.Split == nil {
+			result, err := tx.ExecContext(ctx, `
+				UPDATE shift_templates
+				SET name = ?, role = ?, location_id = ?, start_time = ?, end_time = ?, rrule = ?, until = ?
+				WHERE id = ?
+			`,
+				target.Name, target.Role, target.LocationID, target.StartTime, target.EndTime, target.RRule, target.Until, target.ID,
+			)
+			if err != nil {
+				return err
+			}
+			if err := requireAffected(result); err != nil {
+				return err
+			}
+		} else {
+			result, err := tx.ExecContext(ctx, "UPDATE shift_templates SET until = ? WHERE id = ?", change.Template.Until, change.Template.ID)
+			if err != nil {
+				return err
+			}
+			if err := requireAffected(result); err != nil {
+				return err
+			}
+
+			target = change.Split
+			if target.ID, err = insertTemplate(ctx, tx, target); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE shift_template_exceptions SET template_id = ? WHERE template_id = ? AND occurrence_date >= ?",
+				target.ID, change.Template.ID, from,
+			); err != nil {
+				return err
+			}
+		}
+
+		return applySync(ctx, tx, target, change.Sync)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTemplateByID(ctx, target.ID)
+}
+
+// DeleteTemplate removes a template and its exceptions. Shifts already materialized from it
+// are kept as one-off shifts.
+func (r *shiftTemplateRepository) DeleteTemplate(ctx context.Context, id int) error {
+	return pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		for _, query := range []string{
+			"UPDATE shifts SET template_id = NULL, occurrence_date = NULL WHERE template_id = ?",
+			"DELETE FROM shift_template_exceptions WHERE template_id = ?",
+			"UPDATE shift_templates SET parent_id = NULL WHERE parent_id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM shift_templates WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		return requireAffected(result)
+	})
+}
+
+// SaveException adds or replaces the exception for one occurrence and updates its shift
+func (r *shiftTemplateRepository) SaveException(ctx context.Context, template *ShiftTemplate, exception *TemplateException, sync ShiftSync) (*ShiftTemplate, error) {
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO shift_template_exceptions (template_id, occurrence_date, kind, start_time, end_time, role, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (template_id, occurrence_date) DO UPDATE SET
+				kind = excluded.kind,
+				start_time = excluded.start_time,
+				end_time = excluded.end_time,
+				role = excluded.role
+		`,
+			template.ID, exception.Date, exception.Kind, exception.StartTime, exception.EndTime, exception.Role, pkg.FormatTimestamp(time.Now()),
+		); err != nil {
+			return err
+		}
+		return applySync(ctx, tx, template, sync)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTemplateByID(ctx, template.ID)
+}
+
+// DeleteException removes the exception for one occurrence and restores its shift
+func (r *shiftTemplateRepository) DeleteException(ctx context.Context, template *ShiftTemplate, date string, sync ShiftSync) (*ShiftTemplate, error) {
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		result, err := tx.ExecContext(ctx,
+			"DELETE FROM shift_template_exceptions WHERE template_id = ? AND occurrence_date = ?",
+			template.ID, date,
+		)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(result); err != nil {
+			return err
+		}
+		return applySync(ctx, tx, template, sync)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTemplateByID(ctx, template.ID)
+}
+
+// GetMaterializedShifts lists the shifts created from a template's occurrences between from
+// and to inclusive, in date order. An empty to means no upper bound.
+func (r *shiftTemplateRepository) GetMaterializedShifts(ctx context.Context, templateID int, from string, to string) ([]MaterializedShift, error) {
+	query := `
+		SELECT
+			s.id,
+			s.occurrence_date,
+			s.start_at,
+			s.end_at,
+			(SELECT a.user_id FROM assignments a WHERE a.shift_id = s.id AND a.status = 'active') as assignee_id
+		FROM shifts s
+		WHERE s.template_id = ? AND s.occurrence_date >= ?
+	`
+	args := []interface{}{templateID, from}
+	if to != "" {
+		query += " AND s.occurrence_date <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY s.occurrence_date"
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shifts []MaterializedShift
+	for rows.Next() {
+		var shift MaterializedShift
+		var date time.Time
+		var assigneeID sql.NullInt64
+		if err := rows.Scan(&shift.ShiftID, &date, &shift.StartAt, &shift.EndAt, &assigneeID); err != nil {
+			return nil, err
+		}
+		shift.OccurrenceDate = date.Format(pkg.DateLayout)
+		shift.AssigneeID = nullableInt(assigneeID)
+		shifts = append(shifts, shift)
+	}
+	return shifts, rows.Err()
+}
+
+// CreateShifts materializes occurrences into shifts. Occurrences that already have a shift are
+// left alone, so materializing overlapping windows is safe. It returns the new shift IDs.
+func (r *shiftTemplateRepository) CreateShifts(ctx context.Context, template *ShiftTemplate, occurrences []Occurrence) ([]int, error) {
+	ids := []int{}
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		for _, occurrence := range occurrences {
+			result, err := tx.ExecContext(ctx, `
+				INSERT INTO shifts (start_at, end_at, date, start_time, end_time, role, location_id, location, template_id, occurrence_date)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (template_id, occurrence_date) DO NOTHING
+			`,
+				pkg.FormatTimestamp(occurrence.StartAt),
+				pkg.FormatTimestamp(occurrence.EndAt),
+				occurrence.Date,
+				occurrence.StartTime,
+				occurrence.EndTime,
+				occurrence.Role,
+				template.LocationID,
+				template.Location,
+				template.ID,
+				occurrence.OccurrenceDate,
+			)
+			if err != nil {
+				return err
+			}
+			if rowsAffected, err := result.RowsAffected(); err != nil {
+				return err
+			} else if rowsAffected == 0 {
+				continue
+			}
+
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			ids = append(ids, int(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertTemplate(ctx context.Context, db execer, template *ShiftTemplate) (int, error) {
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO shift_templates (name, role, location_id, start_time, end_time, rrule, starts_on, until, parent_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		template.Name,
+		template.Role,
+		template.LocationID,
+		template.StartTime,
+		template.EndTime,
+		template.RRule,
+		template.StartsOn,
+		template.Until,
+		template.ParentID,
+		pkg.FormatTimestamp(time.Now()),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// applySync writes a ShiftSync, linking the updated and kept shifts to template
+func applySync(ctx context.Context, tx pkg.DBTX, template *ShiftTemplate, sync ShiftSync) error {
+	for _, occurrence := range sync.Update {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE shifts
+			SET start_at = ?, end_at = ?, date = ?, start_time = ?, end_time = ?, role = ?, location_id = ?, location = ?, template_id = ?
+			WHERE id = ?
+		`,
+			pkg.FormatTimestamp(occurrence.StartAt),
+			pkg.FormatTimestamp(occurrence.EndAt),
+			occurrence.Date,
+			occurrence.StartTime,
+			occurrence.EndTime,
+			occurrence.Role,
+			template.LocationID,
+			template.Location,
+			template.ID,
+			*occurrence.ShiftID,
+		); err != nil {
+			return err
+		}
+	}
+	for _, id := range sync.Keep {
+		if _, err := tx.ExecContext(ctx, "UPDATE shifts SET template_id = ? WHERE id = ?", template.ID, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range sync.Detach {
+		if _, err := tx.ExecContext(ctx, "UPDATE shifts SET template_id = NULL, occurrence_date = NULL WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	for _, id := range sync.Delete {
+		if err := removeShift(ctx, tx, id, sync.By); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeShift deletes an unassigned shift whose occurrence is gone. A shift workers requested
+// or were assigned before is cancelled and detached instead, so it stays in their history,
+// and its pending requests are rejected by the admin removing the occurrence.
+func removeShift(ctx context.Context, tx pkg.DBTX, id int, removedBy int) error {
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM shifts
+		WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM assignments a WHERE a.shift_id = shifts.id)
+			AND NOT EXISTS (SELECT 1 FROM shift_requests sr WHERE sr.shift_id = shifts.id)
+	`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	now := pkg.FormatTimestamp(time.Now())
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE shifts
+		SET template_id = NULL, occurrence_date = NULL, status = 'cancelled',
+			cancelled_at = COALESCE(cancelled_at, ?), cancelled_by = COALESCE(cancelled_by, ?),
+			cancel_reason = COALESCE(cancel_reason, ?)
+		WHERE id = ?
+	`, now, removedBy, ReasonOccurrenceRemoved, id); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE shift_requests
+		SET status = 'rejected', reason = ?, reviewed_by = ?, reviewed_at = ?
+		WHERE shift_id = ? AND status = 'pending'
+	`, ReasonOccurrenceRemoved, removedBy, now, id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTemplate(row rowScanner) (*ShiftTemplate, error) {
+	var template ShiftTemplate
+	var locationID, parentID sql.NullInt64
+	var startsOn time.Time
+	var until sql.NullTime
+	err := row.Scan(
+		&template.ID,
+		&template.Name,
+		&template.Role,
+		&locationID,
+		&template.Location,
+		&template.TimeZone,
+		&template.StartTime,
+		&template.EndTime,
+		&template.RRule,
+		&startsOn,
+		&until,
+		&parentID,
+		&template.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+
+	template.LocationID = nullableInt(locationID)
+	template.ParentID = nullableInt(parentID)
+	template.StartsOn = startsOn.Format(pkg.DateLayout)
+	if until.Valid {
+		value := until.Time.Format(pkg.DateLayout)
+		template.Until = &value
+	}
+	template.Overnight = template.EndTime <= template.StartTime
+	return &template, nil
+}
+
+func nullableInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	i := int(value.Int64)
+	return &i
+}
+
+func nullableString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
+
+func requireAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return pkg.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+package shift_templates
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/assignments"
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/locations"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// ShiftTemplateService defines the interface for shift template business logic
+type ShiftTemplateService interface {
+	CreateTemplate(ctx context.Context, req *CreateShiftTemplateRequest) (*ShiftTemplate, error)
+	GetTemplates(ctx context.Context, q *pkg.ListQuery) ([]ShiftTemplate, *pkg.Pagination, error)
+	GetTemplateByID(ctx context.Context, id int) (*ShiftTemplate, error)
+	UpdateTemplate(ctx context.Context, id int, req *UpdateShiftTemplateRequest, changedBy int, override *assignments.Override) (*ShiftTemplate, error)
+	DeleteTemplate(ctx context.Context, id int) error
+	GetOccurrences(ctx context.Context, id int, from string, to string) ([]Occurrence, error)
+	Materialize(ctx context.Context, id int, req *MaterializeRequest) (*MaterializeResponse, error)
+	SetException(ctx context.Context, id int, date string, req *ExceptionRequest, changedBy int, override *assignments.Override) (*ShiftTemplate, error)
+	DeleteException(ctx context.Context, id int, date string, changedBy int, override *assignments.Override) (*ShiftTemplate, error)
+}
+
+type shiftTemplateService struct {
+	templateRepository   ShiftTemplateRepository
+	locationRepository   locations.LocationRepository
+	assignmentRepository assignments.AssignmentRepository
+	availabilityService  availability.AvailabilityService
+	unitOfWork           pkg.UnitOfWork
+	config               *pkg.Config
+}
+
+// NewShiftTemplateService creates a new instance of ShiftTemplateService
+func NewShiftTemplateService(
+	templateRepository ShiftTemplateRepository,
+	locationRepository locations.LocationRepository,
+	assignmentRepository assignments.AssignmentRepository,
+	availabilityService availability.AvailabilityService,
+	unitOfWork pkg.UnitOfWork,
+	config *pkg.Config,
+) ShiftTemplateService {
+	return &shiftTemplateService{
+		templateRepository:   templateRepository,
+		locationRepository:   locationRepository,
+		assignmentRepository: assignmentRepository,
+		availabilityService:  availabilityService,
+		unitOfWork:           unitOfWork,
+		config:               config,
+	}
+}
+
+func (s *shiftTemplateService) CreateTemplate(ctx context.Context, req *CreateShiftTemplateRequest) (*ShiftTemplate, error) {
+	template := &ShiftTemplate{
+		Name:      req.Name,
+		Role:      req.Role,
+		TimeZone:  time.UTC.String(),
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		RRule:     req.RRule,
+		StartsOn:  req.StartsOn,
+	}
+	if strings.TrimSpace(req.Until) != "" {
+		template.Until = &req.Until
+	}
+
+	errs, err := s.resolveLocation(ctx, template, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	errs = append(errs, validateTemplate(s.config.Shifts, template, req.Overnight)...)
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+	return s.templateRepository.CreateTemplate(ctx, template)
+}
+
+func (s *shiftTemplateService) GetTemplates(ctx context.Context, q *pkg.ListQuery) ([]ShiftTemplate, *pkg.Pagination, error) {
+	return s.templateRepository.GetTemplates(ctx, q)
+}
+
+func (s *shiftTemplateService) GetTemplateByID(ctx context.Context, id int) (*ShiftTemplate, error) {
+	return s.templateRepository.GetTemplateByID(ctx, id)
+}
+
+// UpdateTemplate changes the whole series, or with req.From the occurrences on and after it.
+// The latter ends the template the day before and continues the series in a new template.
+// Upcoming shifts of the changed occurrences follow the new schedule, see syncShifts.
+func (s *shiftTemplateService) UpdateTemplate(ctx context.Context, id int, req *UpdateShiftTemplateRequest, changedBy int, override *assignments.Override) (*ShiftTemplate, error) {
+	current, err := s.templateRepository.GetTemplateByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *current
+	if req.Name != nil {
+		next.Name = *req.Name
+	}
+	if req.Role != nil {
+		next.Role = *req.Role
+	}
+	if req.StartTime != nil {
+		next.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		next.EndTime = *req.EndTime
+	}
+	if req.RRule != nil {
+		next.RRule = *req.RRule
+	}
+	if req.Until != nil {
+		next.Until = optional(*req.Until)
+	}
+	overnight := current.Overnight
+	if req.Overnight != nil {
+		overnight = *req.Overnight
+	}
+
+	errs, err := s.resolveLocation(ctx, &next, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := strings.TrimSpace(req.From)
+	split := from != "" && from > current.StartsOn
+	if split {
+		errs = append(errs, s.splitAt(current, &next, from, req.RRule != nil)...)
+	}
+	errs = append(errs, validateTemplate(s.config.Shifts, &next, overnight)...)
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+
+	change := &TemplateChange{Template: &next}
+	if split {
+		until := next.StartsOn
+		if day, err := time.Parse(pkg.DateLayout, next.StartsOn); err == nil {
+			until = day.AddDate(0, 0, -1).Format(pkg.DateLayout)
+		}
+		current.Until = &until
+		change.Template, change.Split = current, &next
+	} else {
+		from = current.StartsOn
+	}
+
+	var saved *ShiftTemplate
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		materialized, err := s.templateRepository.GetMaterializedShifts(ctx, id, from, "")
+		if err != nil {
+			return err
+		}
+		if change.Sync, err = s.syncShifts(ctx, &next, materialized, changedBy, override); err != nil {
+			return err
+		}
+		saved, err = s.templateRepository.SaveTemplateChange(ctx, change, from)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// splitAt turns next into the template continuing current from the given day. It keeps the
+// rhythm of the series by starting on its first occurrence on or after from, unless the
+// rule itself changes.
+func (s *shiftTemplateService) splitAt(current *ShiftTemplate, next *ShiftTemplate, from string, ruleChanged bool) []pkg.FieldError {
+	day, err := time.Parse(pkg.DateLayout, from)
+	if err != nil {
+		return []pkg.FieldError{{Field: "from", Message: "must be a date in YYYY-MM-DD format"}}
+	}
+	if current.Until != nil && from > *current.Until {
+		return []pkg.FieldError{{Field: "from", Message: "must not be after the end of the series"}}
+	}
+
+	next.ID = 0
+	next.ParentID = &current.ID
+	next.StartsOn = from
+	if !ruleChanged {
+		dates, err := occurrenceDates(current, day, day.AddDate(0, 0, maxWindowDays))
+		if err != nil || len(dates) == 0 {
+			return []pkg.FieldError{{Field: "from", Message: "must be followed by an occurrence of the series"}}
+		}
+		next.StartsOn = dates[0].Format(pkg.DateLayout)
+	}
+
+	next.Exceptions = nil
+	for _, exception := range current.Exceptions {
+		if exception.Date >= from {
+			next.Exceptions = append(next.Exceptions, exception)
+		}
+	}
+	return nil
+}
+
+// DeleteTemplate removes a template. Its materialized shifts are kept as one-off shifts.
+func (s *shiftTemplateService) DeleteTemplate(ctx context.Context, id int) error {
+	return s.templateRepository.DeleteTemplate(ctx, id)
+}
+
+// GetOccurrences previews the occurrences of a template between from and to inclusive,
+// with the shift each one was materialized into
+func (s *shiftTemplateService) GetOccurrences(ctx context.Context, id int, from string, to string) ([]Occurrence, error) {
+	template, err := s.templateRepository.GetTemplateByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := parseWindow(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := occurrences(template, start, end)
+	if err != nil {
+		return nil, err
+	}
+	materialized, err := s.templateRepository.GetMaterializedShifts(ctx, id, start.Format(pkg.DateLayout), end.Format(pkg.DateLayout))
+	if err != nil {
+		return nil, err
+	}
+	shiftIDs := make(map[string]int, len(materialized))
+	for _, shift := range materialized {
+		shiftIDs[shift.OccurrenceDate] = shift.ShiftID
+	}
+	for i := range result {
+		if shiftID, ok := shiftIDs[result[i].OccurrenceDate]; ok {
+			result[i].ShiftID = &shiftID
+		}
+	}
+	return result, nil
+}
+
+// Materialize creates shifts for the occurrences between from and to inclusive that don't
+// have one yet. Skipped occurrences get no shift.
+func (s *shiftTemplateService) Materialize(ctx context.Context, id int, req *MaterializeRequest) (*MaterializeResponse, error) {
+	template, err := s.templateRepository.GetTemplateByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := parseWindow(req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	planned, err := occurrences(template, start, end)
+	if err != nil {
+		return nil, err
+	}
+	materialized, err := s.templateRepository.GetMaterializedShifts(ctx, id, start.Format(pkg.DateLayout), end.Format(pkg.DateLayout))
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(materialized))
+	for _, shift := range materialized {
+		existing[shift.OccurrenceDate] = true
+	}
+
+	response := &MaterializeResponse{}
+	var pending []Occurrence
+	for _, occurrence := range planned {
+		switch {
+		case occurrence.Skipped:
+			response.Skipped++
+		case existing[occurrence.OccurrenceDate]:
+			response.AlreadyMaterialized++
+		default:
+			pending = append(pending, occurrence)
+		}
+	}
+
+	if response.CreatedShiftIDs, err = s.templateRepository.CreateShifts(ctx, template, pending); err != nil {
+		return nil, err
+	}
+	// Occurrences materialized concurrently are not created twice
+	response.AlreadyMaterialized += len(pending) - len(response.CreatedShiftIDs)
+	return response, nil
+}
+
+// SetException skips or changes a single occurrence, and its shift if it was materialized.
+// An assigned shift can't be skipped, the assignment has to be removed first.
+func (s *shiftTemplateService) SetException(ctx context.Context, id int, date string, req *ExceptionRequest, changedBy int, override *assignments.Override) (*ShiftTemplate, error) {
+	template, err := s.templateRepository.GetTemplateByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	exception := &TemplateException{Date: date, Kind: strings.ToLower(strings.TrimSpace(req.Kind))}
+	errs := s.checkOccurrence(template, date)
+	switch exception.Kind {
+	case ExceptionSkip:
+	case ExceptionModify:
+		errs = append(errs, s.validateModification(template, exception, req)...)
+	default:
+		errs = append(errs, pkg.FieldError{Field: "kind", Message: "must be skip or modify"})
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+
+	var saved *ShiftTemplate
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		materialized, err := s.templateRepository.GetMaterializedShifts(ctx, id, date, date)
+		if err != nil {
+			return err
+		}
+		if exception.Kind == ExceptionSkip && len(materialized) > 0 && materialized[0].AssigneeID != nil {
+			return pkg.NewConflictError("occurrence is assigned, remove the assignment before skipping it")
+		}
+
+		withException := *template
+		withException.Exceptions = []TemplateException{*exception}
+		sync, err := s.syncShifts(ctx, &withException, materialized, changedBy, override)
+		if err != nil {
+			return err
+		}
+		saved, err = s.templateRepository.SaveException(ctx, template, exception, sync)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// DeleteException restores an occurrence, and its shift if it was materialized, to the
+// template's schedule
+func (s *shiftTemplateService) DeleteException(ctx context.Context, id int, date string, changedBy int, override *assignments.Override) (*ShiftTemplate, error) {
+	template, err := s.templateRepository.GetTemplateByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved *ShiftTemplate
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		materialized, err := s.templateRepository.GetMaterializedShifts(ctx, id, date, date)
+		if err != nil {
+			return err
+		}
+		withoutException := *template
+		withoutException.Exceptions = nil
+		sync, err := s.syncShifts(ctx, &withoutException, materialized, changedBy, override)
+		if err != nil {
+			return err
+		}
+		saved, err = s.templateRepository.DeleteException(ctx, template, date, sync)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// syncShifts plans how the materialized shifts follow the schedule of t. Shifts that already
+// started are left as they are. An assignee whose upcoming shift moves is checked like
+// assigning them would be, so the move is refused when it overlaps their other shifts,
+// leaves them less than the minimum rest or falls outside their availability, unless an
+// admin overrides it. It belongs in the unit of work saving the change.
+func (s *shiftTemplateService) syncShifts(ctx context.Context, t *ShiftTemplate, materialized []MaterializedShift, changedBy int, override *assignments.Override) (ShiftSync, error) {
+	sync, err := planSync(t, materialized, time.Now())
+	if err != nil {
+		return sync, err
+	}
+	sync.By = changedBy
+
+	byID := make(map[int]MaterializedShift, len(materialized))
+	for _, shift := range materialized {
+		byID[shift.ShiftID] = shift
+	}
+	// moved holds the new times of the assigned shifts the change moves
+	var moved []pkg.BookedShift
+	movedIDs := make(map[int]bool)
+	for _, occurrence := range sync.Update {
+		shift := byID[*occurrence.ShiftID]
+		if shift.AssigneeID == nil || (shift.StartAt.Equal(occurrence.StartAt) && shift.EndAt.Equal(occurrence.EndAt)) {
+			continue
+		}
+		moved = append(moved, pkg.BookedShift{ShiftID: shift.ShiftID, StartAt: occurrence.StartAt, EndAt: occurrence.EndAt})
+		movedIDs[shift.ShiftID] = true
+	}
+
+	minRest := s.config.Shifts.MinRest()
+	for _, shift := range moved {
+		userID := *byID[shift.ShiftID].AssigneeID
+		found, err := assignments.FindConflicts(ctx, s.assignmentRepository, userID, shift.ShiftID, shift.StartAt, shift.EndAt, minRest)
+		if err != nil {
+			return sync, err
+		}
+		// Other shifts of the series moving along are checked at their new times
+		var conflicts []pkg.ScheduleConflict
+		for _, conflict := range found {
+			if !movedIDs[conflict.ShiftID] {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		var siblings []pkg.BookedShift
+		for _, other := range moved {
+			if other.ShiftID != shift.ShiftID && *byID[other.ShiftID].AssigneeID == userID {
+				siblings = append(siblings, other)
+			}
+		}
+		conflicts = append(conflicts, pkg.FindScheduleConflicts(shift.StartAt, shift.EndAt, siblings, minRest)...)
+
+		unavailable, err := s.availabilityService.CheckAvailability(ctx, userID, shift.StartAt, shift.EndAt)
+		if err != nil {
+			return sync, err
+		}
+		conflicts = append(conflicts, unavailable...)
+		if err := assignments.ResolveConflicts(ctx, s.assignmentRepository, shift.ShiftID, userID, conflicts, override); err != nil {
+			return sync, err
+		}
+	}
+	return sync, nil
+}
+
+// checkOccurrence reports an error unless the template has an occurrence on date
+func (s *shiftTemplateService) checkOccurrence(template *ShiftTemplate, date string) []pkg.FieldError {
+	day, err := time.Parse(pkg.DateLayout, date)
+	if err != nil {
+		return []pkg.FieldError{{Field: "date", Message: "must be a date in YYYY-MM-DD format"}}
+	}
+	dates, err := occurrenceDates(template, day, day)
+	if err != nil || len(dates) == 0 {
+		return []pkg.FieldError{{Field: "date", Message: "is not an occurrence of the template"}}
+	}
+	return nil
+}
+
+// validateModification fills a modify exception from req. Times left out keep the
+// template's, and the resulting occurrence is held to the same rules as the template.
+func (s *shiftTemplateService) validateModification(template *ShiftTemplate, exception *TemplateException, req *ExceptionRequest) []pkg.FieldError {
+	if req.StartTime == nil && req.EndTime == nil && req.Role == nil {
+		return []pkg.FieldError{{Field: "kind", Message: "modify needs start_time, end_time or role"}}
+	}
+
+	var errs []pkg.FieldError
+	if req.StartTime != nil || req.EndTime != nil {
+		startValue, endValue := template.StartTime, template.EndTime
+		if req.StartTime != nil {
+			startValue = *req.StartTime
+		}
+		if req.EndTime != nil {
+			endValue = *req.EndTime
+		}
+		start, end, _, clockErrs := validateClocks(s.config.Shifts, startValue, endValue, req.Overnight)
+		errs = append(errs, clockErrs...)
+		exception.StartTime, exception.EndTime = &start, &end
+	}
+
+	if req.Role != nil {
+		if role, ok := s.config.Shifts.AllowedRole(strings.TrimSpace(*req.Role)); ok && role != "" {
+			exception.Role = &role
+		} else {
+			errs = append(errs, pkg.FieldError{Field: "role", Message: "must be one of: " + strings.Join(s.config.Shifts.Roles, ", ")})
+		}
+	}
+	return errs
+}
+
+// resolveLocation points template at the location with the given id. Leaving it out keeps
+// the current one.
+func (s *shiftTemplateService) resolveLocation(ctx context.Context, template *ShiftTemplate, id *int) ([]pkg.FieldError, error) {
+	if id == nil {
+		return nil, nil
+	}
+	location, err := s.locationRepository.GetLocationByID(ctx, *id)
+	if errors.Is(err, pkg.ErrNotFound) {
+		return []pkg.FieldError{{Field: "location_id", Message: "does not exist"}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	template.LocationID, template.Location, template.TimeZone = &location.ID, location.Name, location.TimeZone
+	return nil, nil
+}
+
+// optional treats an empty string as a value that was not given
+func optional(value string) *string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return &value
+}
@@ -1,31 +1,265 @@
 package shifts
 
-import "time"
+import (
+	"time"
 
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// CreateShiftRequest schedules a shift either with start_at and end_at or with the legacy
+// date, start_time and end_time triplet, which is read in the time zone of the location
 type CreateShiftRequest struct {
-	Date      string `json:"date" binding:"required"`
-	StartTime string `json:"start_time" binding:"required"`
-	EndTime   string `json:"end_time" binding:"required"`
-	Role      string `json:"role" binding:"required"`
-	Location  string `json:"location"`
+	// StartAt and EndAt are RFC 3339 timestamps and may span several days
+	StartAt    string `json:"start_at" example:"2025-06-01T22:00:00+07:00"`
+	EndAt      string `json:"end_at" example:"2025-06-02T06:00:00+07:00"`
+	Date       string `json:"date"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	Role       string `json:"role" binding:"required"`
+	LocationID *int   `json:"location_id"`
+	// Location picks a location by name when location_id is not given
+	Location string `json:"location"`
+	// Overnight must be set for legacy triplets whose end_time falls on the next day
+	Overnight bool `json:"overnight"`
 }
 
 type UpdateShiftRequest struct {
-	Date      *string `json:"date"`
-	StartTime *string `json:"start_time"`
-	EndTime   *string `json:"end_time"`
-	Role      *string `json:"role"`
-	Location  *string `json:"location"`
+	StartAt    *string `json:"start_at"`
+	EndAt      *string `json:"end_at"`
+	Date       *string `json:"date"`
+	StartTime  *string `json:"start_time"`
+	EndTime    *string `json:"end_time"`
+	Role       *string `json:"role"`
+	LocationID *int    `json:"location_id"`
+	// Location picks a location by name when location_id is not given, empty clears it
+	Location *string `json:"location"`
+	// Overnight defaults to whether the current shift ends the next day
+	Overnight *bool `json:"overnight"`
+}
+
+// Shift is a shift as stored, with its schedule resolved to instants
+type Shift struct {
+	// ID is zero until the shift is stored
+	ID         int
+	StartAt    time.Time
+	EndAt      time.Time
+	Role       string
+	LocationID *int
+	// Location is the location's name, copied for readers that don't join locations
+	Location string
+	// Zone is the location's time zone, the legacy date and time columns are written in it
+	Zone *time.Location
 }
 
 type ShiftResponse struct {
-	ID         int       `json:"id"`
-	Date       string    `json:"date"`
-	StartTime  string    `json:"start_time"`
-	EndTime    string    `json:"end_time"`
+	ID int `json:"id"`
+	pkg.Schedule
 	Role       string    `json:"role"`
 	Assignee   string    `json:"assignee"`
 	IsAssigned bool      `json:"is_assigned"`
+	LocationID *int      `json:"location_id"`
 	Location   string    `json:"location"`
+	Status     string    `json:"status" example:"scheduled"`
 	CreatedAt  time.Time `json:"created_at"`
+	// CancelledAt, CancelledBy and CancelReason are only set on cancelled shifts
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy  *int       `json:"cancelled_by,omitempty"`
+	CancelReason string     `json:"cancel_reason,omitempty"`
+}
+
+// IsCancelled reports whether the shift was cancelled
+func (s *ShiftResponse) IsCancelled() bool {
+	return s.Status == StatusCancelled
+}
+
+// ShiftFilter is a list query narrowed further by status
+type ShiftFilter struct {
+	pkg.ListQuery
+	// Status defaults to scheduled, cancelled shifts are only listed when asked for
+	Status string
+}
+
+// Possible status values for shifts
+const (
+	StatusScheduled = "scheduled"
+	StatusCancelled = "cancelled"
+)
+
+// ReasonShiftCancelled is the reason given to the pending requests for a shift when it is
+// cancelled, and to its assignment when the admin didn't give one
+const ReasonShiftCancelled = "The shift was cancelled"
+
+// CancelShiftRequest optionally tells the workers why the shift was cancelled
+type CancelShiftRequest struct {
+	Reason string `json:"reason" example:"The store is closed for inventory"`
+}
+
+// Cancellation is an admin cancelling shifts
+type Cancellation struct {
+	ByUserID int
+	Reason   string
+}
+
+// OpenShiftResponse is an open shift a worker can request
+type OpenShiftResponse struct {
+	ShiftResponse
+	// PendingRequests counts the requests of other workers awaiting review
+	PendingRequests int `json:"pending_requests"`
+}
+
+// Formats the schedule can be exported as
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+	ExportFormatPDF  = "pdf"
+)
+
+// Outcomes of an item in a bulk request
+const (
+	BulkCreated   = "created"
+	BulkUpdated   = "updated"
+	BulkCancelled = "cancelled"
+	// BulkInvalid items failed validation and were not applied
+	BulkInvalid = "invalid"
+	// BulkFailed items were valid but could not be saved
+	BulkFailed = "failed"
+)
+
+type BulkCreateShiftsRequest struct {
+	Shifts []CreateShiftRequest `json:"shifts"`
+}
+
+// BulkUpdateShiftItem changes the shift with the given ID, like PUT /api/shifts/{id}
+type BulkUpdateShiftItem struct {
+	ID int `json:"id"`
+	UpdateShiftRequest
+}
+
+type BulkUpdateShiftsRequest struct {
+	Shifts []BulkUpdateShiftItem `json:"shifts"`
+}
+
+type BulkDeleteShiftsRequest struct {
+	IDs []int `json:"ids"`
+	// Reason is given to every shift cancelled
+	Reason string `json:"reason"`
+}
+
+// BulkShiftResult is the outcome of one item of a bulk request, in request order
+type BulkShiftResult struct {
+	Index int `json:"index"`
+	// ID is the shift the item created, updated or cancelled
+	ID     *int             `json:"id"`
+	Status string           `json:"status" example:"created"`
+	Shift  *ShiftResponse   `json:"shift,omitempty"`
+	Errors []pkg.FieldError `json:"errors,omitempty"`
+	// Err is the unexpected error behind a failed item, for logging
+	Err error `json:"-"`
+}
+
+type BulkShiftResponse struct {
+	// Atomic is set when the items were applied in a single transaction
+	Atomic    bool              `json:"atomic"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BulkShiftResult `json:"results"`
+}
+
+// Kinds of conflicts an imported row can have
+const (
+	// ConflictDuplicateShift is a shift with the same times, role and location
+	ConflictDuplicateShift = "duplicate_shift"
+	// ConflictAssigneeOverlap is another shift of the assignee overlapping the row
+	ConflictAssigneeOverlap = "assignee_overlap"
+	// ConflictAssigneeMinRest is another shift of the assignee leaving less than the minimum
+	// rest before or after the row
+	ConflictAssigneeMinRest = "assignee_min_rest"
+	// ConflictAssigneeTimeOff is approved time off of the assignee on the day of the row
+	ConflictAssigneeTimeOff = "assignee_time_off"
+	// ConflictAssigneeUnavailable is the row falling outside the assignee's weekly availability
+	ConflictAssigneeUnavailable = "assignee_unavailable"
+)
+
+// assigneeConflictKinds maps the schedule conflicts of an assignee to import conflicts
+var assigneeConflictKinds = map[string]string{
+	pkg.ConflictOverlap:     ConflictAssigneeOverlap,
+	pkg.ConflictMinRest:     ConflictAssigneeMinRest,
+	pkg.ConflictTimeOff:     ConflictAssigneeTimeOff,
+	pkg.ConflictUnavailable: ConflictAssigneeUnavailable,
+}
+
+// ImportOverride forces a roster in despite the conflicts of its assignees
+type ImportOverride struct {
+	// ByUserID is the admin forcing the import
+	ByUserID int
+}
+
+// ImportReport describes what importing a roster does, or did once committed
+type ImportReport struct {
+	Format string `json:"format" example:"csv"`
+	// Committed is set when the shifts were created, which only happens when every row is
+	// valid and free of conflicts, or its conflicts were overridden
+	Committed bool `json:"committed"`
+	// Forced is set when an admin overrode the conflicts of assignees
+	Forced      bool        `json:"forced"`
+	TotalRows   int         `json:"total_rows"`
+	InvalidRows int         `json:"invalid_rows"`
+	Conflicts   int         `json:"conflicts"`
+	Rows        []ImportRow `json:"rows"`
+}
+
+// HasProblems reports whether any row is invalid or conflicts with the schedule. With
+// force, conflicts an admin may override don't count.
+func (r *ImportReport) HasProblems(force bool) bool {
+	if r.InvalidRows > 0 {
+		return true
+	}
+	for _, row := range r.Rows {
+		for _, conflict := range row.Conflicts {
+			if !force || !conflict.Overridable {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ImportRow is one row of an imported roster
+type ImportRow struct {
+	// Row is the line in the file, counting the header as 1
+	Row           int    `json:"row"`
+	Date          string `json:"date"`
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Role          string `json:"role"`
+	Location      string `json:"location"`
+	AssigneeEmail string `json:"assignee_email"`
+	// Schedule is the resolved schedule of a valid row
+	Schedule  *pkg.Schedule    `json:"schedule,omitempty"`
+	Errors    []pkg.FieldError `json:"errors,omitempty"`
+	Conflicts []ImportConflict `json:"conflicts,omitempty"`
+	// ShiftID is the shift created for the row once committed
+	ShiftID *int `json:"shift_id,omitempty"`
+}
+
+// ImportConflict is a clash between a row and the schedule, or another row of the file
+type ImportConflict struct {
+	Kind    string `json:"kind" example:"assignee_overlap"`
+	Message string `json:"message"`
+	// ShiftID is the existing shift the row clashes with
+	ShiftID *int `json:"shift_id,omitempty"`
+	// Row is the other row of the file the row clashes with
+	Row *int `json:"row,omitempty"`
+	// Overridable is set for conflicts of the assignee, which an admin may force the import
+	// through with. Duplicate shifts are never imported.
+	Overridable bool `json:"overridable"`
+}
+
+// ScheduledShift is an existing shift as far as import conflicts are concerned
+type ScheduledShift struct {
+	ID         int
+	StartAt    time.Time
+	EndAt      time.Time
+	Role       string
+	LocationID *int
 }
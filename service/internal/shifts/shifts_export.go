@@ -0,0 +1,287 @@
+package shifts
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// exportColumns are the header of CSV and XLSX exports
+var exportColumns = []string{
+	"shift_id", "date", "start_time", "end_time", "start_at", "end_at",
+	"duration_minutes", "time_zone", "location", "role", "assignee",
+}
+
+// exportContentTypes maps the export formats to the content type of the file
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:  "text/csv; charset=utf-8",
+	ExportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ExportFormatPDF:  "application/pdf",
+}
+
+// ExportContentType returns the content type of an export format, or "" for unknown formats
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// WriteExport writes the shifts in the given format. Shifts are expected in the order
+// ExportShifts returns them, grouped by location and sorted by start.
+func WriteExport(w io.Writer, format string, shifts []ShiftResponse, q *pkg.ListQuery) error {
+	switch format {
+	case ExportFormatCSV:
+		return writeCSV(w, shifts)
+	case ExportFormatXLSX:
+		return writeXLSX(w, shifts)
+	case ExportFormatPDF:
+		return writeRosterPDF(w, shifts, q)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// sortForExport groups the shifts by location, with shifts without a location last, and
+// sorts each group by start
+func sortForExport(shifts []ShiftResponse) {
+	sort.SliceStable(shifts, func(i, j int) bool {
+		a, b := shifts[i], shifts[j]
+		if a.Location != b.Location {
+			if a.Location == "" || b.Location == "" {
+				return b.Location == ""
+			}
+			return a.Location < b.Location
+		}
+		if !a.StartAt.Equal(b.StartAt) {
+			return a.StartAt.Before(b.StartAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// spreadsheetCell keeps a free text value from being read as a formula by spreadsheet apps.
+// Workers choose their own names, so a name like =HYPERLINK(...) must stay text.
+func spreadsheetCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func exportRecord(shift *ShiftResponse) []string {
+	return []string{
+		strconv.Itoa(shift.ID),
+		shift.Date,
+		shift.StartTime,
+		shift.EndTime,
+		shift.StartAt.Format(time.RFC3339),
+		shift.EndAt.Format(time.RFC3339),
+		strconv.Itoa(shift.DurationMinutes),
+		shift.TimeZone,
+		spreadsheetCell(shift.Location),
+		spreadsheetCell(shift.Role),
+		spreadsheetCell(shift.Assignee),
+	}
+}
+
+func writeCSV(w io.Writer, shifts []ShiftResponse) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+	for i := range shifts {
+		if err := writer.Write(exportRecord(&shifts[i])); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeXLSX(w io.Writer, shifts []ShiftResponse) error {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+
+	const sheet = "Shifts"
+	if err := workbook.SetSheetName(workbook.GetSheetName(0), sheet); err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column
+	}
+	if err := workbook.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+	bold, err := workbook.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	lastColumn, err := excelize.ColumnNumberToName(len(exportColumns))
+	if err != nil {
+		return err
+	}
+	if err := workbook.SetCellStyle(sheet, "A1", lastColumn+"1", bold); err != nil {
+		return err
+	}
+
+	for i := range shifts {
+		record := exportRecord(&shifts[i])
+		row := make([]interface{}, len(record))
+		for j, value := range record {
+			row[j] = value
+		}
+		// Keep the numeric columns numeric so they can be summed
+		row[0], row[6] = shifts[i].ID, shifts[i].DurationMinutes
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := workbook.SetSheetRow(sheet, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	if err := workbook.SetColWidth(sheet, "A", lastColumn, 14); err != nil {
+		return err
+	}
+	if err := workbook.SetColWidth(sheet, "E", "F", 26); err != nil {
+		return err
+	}
+	if err := workbook.SetPanes(sheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return err
+	}
+	return workbook.Write(w)
+}
+
+// rosterWeek is the page of the printed roster showing one location for one week
+type rosterWeek struct {
+	location string
+	monday   time.Time
+	shifts   []ShiftResponse
+}
+
+// startOfWeek returns the Monday of the week the date falls in
+func startOfWeek(date time.Time) time.Time {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+}
+
+// rosterWeeks splits sorted shifts into one page per location and week. Shifts belong to
+// the day they start on.
+func rosterWeeks(shifts []ShiftResponse) []rosterWeek {
+	var weeks []rosterWeek
+	for _, shift := range shifts {
+		monday := startOfWeek(shift.StartAt)
+		if n := len(weeks); n == 0 || weeks[n-1].location != shift.Location || !weeks[n-1].monday.Equal(monday) {
+			weeks = append(weeks, rosterWeek{location: shift.Location, monday: monday})
+		}
+		weeks[len(weeks)-1].shifts = append(weeks[len(weeks)-1].shifts, shift)
+	}
+	return weeks
+}
+
+// writeRosterPDF prints a weekly roster, one landscape page per location and week listing
+// the shifts of each day with their assignees
+func writeRosterPDF(w io.Writer, shifts []ShiftResponse, q *pkg.ListQuery) error {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	// The core fonts only cover cp1252, names are translated to it
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle("Roster", true)
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 6, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	weeks := rosterWeeks(shifts)
+	if len(weeks) == 0 {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 10, "Roster", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(0, 8, fmt.Sprintf("No shifts scheduled from %s to %s", q.From, q.To), "", 1, "L", false, 0, "")
+		return pdf.Output(w)
+	}
+
+	widths := []float64{45, 45, 60, 123}
+	for _, week := range weeks {
+		location := week.location
+		if location == "" {
+			location = "No location"
+		}
+		sunday := week.monday.AddDate(0, 0, 6)
+
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 10, tr("Roster - "+location), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, fmt.Sprintf("Week of %s to %s, times in %s",
+			week.monday.Format("Mon 2 Jan 2006"), sunday.Format("Mon 2 Jan 2006"), week.shifts[0].StartAt.Location()),
+			"", 1, "L", false, 0, "")
+		pdf.Ln(3)
+
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(230, 230, 230)
+		for i, title := range []string{"Day", "Time", "Role", "Assignee"} {
+			pdf.CellFormat(widths[i], 8, title, "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+
+		next := 0
+		for day := week.monday; !day.After(sunday); day = day.AddDate(0, 0, 1) {
+			date := day.Format(pkg.DateLayout)
+			label := day.Format("Mon 2 Jan")
+			if next == len(week.shifts) || week.shifts[next].Date != date {
+				pdf.SetFont("Helvetica", "B", 10)
+				pdf.CellFormat(widths[0], 7, label, "1", 0, "L", false, 0, "")
+				pdf.SetFont("Helvetica", "I", 10)
+				pdf.SetTextColor(130, 130, 130)
+				pdf.CellFormat(widths[1]+widths[2]+widths[3], 7, "No shifts", "1", 1, "L", false, 0, "")
+				pdf.SetTextColor(0, 0, 0)
+				continue
+			}
+			for ; next < len(week.shifts) && week.shifts[next].Date == date; next++ {
+				shift := week.shifts[next]
+				pdf.SetFont("Helvetica", "B", 10)
+				pdf.CellFormat(widths[0], 7, label, "1", 0, "L", false, 0, "")
+				label = ""
+				pdf.SetFont("Helvetica", "", 10)
+				pdf.CellFormat(widths[1], 7, rosterTime(&shift), "1", 0, "L", false, 0, "")
+				pdf.CellFormat(widths[2], 7, tr(shift.Role), "1", 0, "L", false, 0, "")
+				assignee := shift.Assignee
+				if assignee == "" {
+					pdf.SetFont("Helvetica", "I", 10)
+					assignee = "Open"
+				}
+				pdf.CellFormat(widths[3], 7, tr(assignee), "1", 1, "L", false, 0, "")
+			}
+		}
+	}
+	return pdf.Output(w)
+}
+
+// rosterTime formats the hours of a shift, marking how many days later it ends
+func rosterTime(shift *ShiftResponse) string {
+	text := shift.StartAt.Format("15:04") + " - " + shift.EndAt.Format("15:04")
+	start, _ := time.Parse(pkg.DateLayout, shift.Date)
+	end, _ := time.Parse(pkg.DateLayout, shift.EndAt.Format(pkg.DateLayout))
+	if days := int(end.Sub(start).Hours() / 24); days > 0 {
+		text += fmt.Sprintf(" (+%dd)", days)
+	}
+	return text
+}
@@ -0,0 +1,88 @@
+package shifts
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+func TestSpreadsheetCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "Ayu", want: "Ayu"},
+		{value: "", want: ""},
+		{value: "=HYPERLINK(\"http://evil\",\"x\")", want: "'=HYPERLINK(\"http://evil\",\"x\")"},
+		{value: "+1", want: "'+1"},
+		{value: "-1", want: "'-1"},
+		{value: "@SUM(A1:A2)", want: "'@SUM(A1:A2)"},
+		{value: "\tcmd", want: "'\tcmd"},
+		{value: "\rcmd", want: "'\rcmd"},
+		{value: "a=b", want: "a=b"},
+	}
+	for _, tt := range tests {
+		if got := spreadsheetCell(tt.value); got != tt.want {
+			t.Errorf("spreadsheetCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExportKeepsFormulasAsText(t *testing.T) {
+	start := time.Date(2027, 5, 10, 9, 0, 0, 0, time.UTC)
+	shifts := []ShiftResponse{{
+		ID:       1,
+		Role:     "cashier",
+		Location: "@Store",
+		Assignee: "=HYPERLINK(\"http://evil\",\"x\")",
+		Schedule: pkg.NewSchedule(start, start.Add(8*time.Hour), "UTC"),
+	}}
+	wantLocation, wantAssignee := "'@Store", "'=HYPERLINK(\"http://evil\",\"x\")"
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteExport(&buf, ExportFormatCSV, shifts, &pkg.ListQuery{}); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		row := records[1]
+		if row[8] != wantLocation || row[10] != wantAssignee {
+			t.Errorf("location, assignee = %q, %q, want %q, %q", row[8], row[10], wantLocation, wantAssignee)
+		}
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteExport(&buf, ExportFormatXLSX, shifts, &pkg.ListQuery{}); err != nil {
+			t.Fatal(err)
+		}
+		workbook, err := excelize.OpenReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer workbook.Close()
+
+		formula, err := workbook.GetCellFormula("Shifts", "K2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formula != "" {
+			t.Errorf("assignee cell holds the formula %q", formula)
+		}
+		assignee, err := workbook.GetCellValue("Shifts", "K2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assignee != wantAssignee {
+			t.Errorf("assignee = %q, want %q", assignee, wantAssignee)
+		}
+	})
+}
@@ -1,9 +1,15 @@
 package shifts
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/afrianjunior/justpayd/internal/pkg"
 	"github.com/go-chi/chi/v5"
@@ -23,11 +29,28 @@ func NewShiftHandler(shiftService ShiftService, logger *zap.SugaredLogger) *Shif
 }
 
 func (h *ShiftHandler) RegisterRoutes(r chi.Router) {
-	r.Get("/", h.GetShifts)
-	r.Post("/", h.CreateShift) // Assuming admin check is handled by middleware or in service
-	r.Get("/{id}", h.GetShiftByID)
-	r.Put("/{id}", h.UpdateShift)
-	r.Delete("/{id}", h.DeleteShift)
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftsRead))
+		r.Get("/", h.GetShifts)
+		r.Get("/export", h.ExportShifts)
+		r.Get("/{id}", h.GetShiftByID)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftRequestsCreate))
+		r.Get("/open", h.GetOpenShifts)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermShiftsManage))
+		r.Post("/", h.CreateShift)
+		r.Put("/{id}", h.UpdateShift)
+		r.Delete("/{id}", h.CancelShift)
+		r.Post("/bulk", h.BulkCreateShifts)
+		r.Put("/bulk", h.BulkUpdateShifts)
+		r.Delete("/bulk", h.BulkCancelShifts)
+		r.Post("/import", h.ImportShifts)
+	})
 }
 
 // GetShifts godoc
@@ -35,17 +58,174 @@ func (h *ShiftHandler) RegisterRoutes(r chi.Router) {
 // @Description List semua shift
 // @Tags shifts
 // @Produce json
+// @Param from query string false "First day, YYYY-MM-DD in the zone of each shift's location"
+// @Param to query string false "Last day, YYYY-MM-DD in the zone of each shift's location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param assigned query bool false "Only assigned shifts when true, only open shifts when false"
+// @Param user_id query int false "Only shifts assigned to this user"
+// @Param status query string false "scheduled or cancelled" default(scheduled)
+// @Param sort query string false "start_at, end_at, created_at, role, location or id, prefixed with - for descending" default(-start_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
 // @Success 200 {object} pkg.BaseResponse{data=[]ShiftResponse} "Successfully retrieved shifts"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shifts [get]
 func (h *ShiftHandler) GetShifts(w http.ResponseWriter, r *http.Request) {
-	shifts, err := h.ShiftService.GetShifts(r.Context())
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	filter := &ShiftFilter{ListQuery: *q, Status: strings.TrimSpace(r.URL.Query().Get("status"))}
+
+	shifts, page, err := h.ShiftService.GetShifts(r.Context(), filter)
 	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error getting shifts: %v", err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve shifts"))
 		return
 	}
-	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(shifts))
+	for i := range shifts {
+		shifts[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(shifts, page))
+}
+
+// GetOpenShifts godoc
+// @Summary List open shifts I can pick up
+// @Description Lists the unassigned future shifts for roles the caller has worked before, leaving out shifts the caller already requested and shifts overlapping the caller's assignments. Each shift counts the pending requests of other workers.
+// @Tags shifts
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD in the zone of each shift's location"
+// @Param to query string false "Last day, YYYY-MM-DD in the zone of each shift's location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param sort query string false "start_at, pending_requests or id, prefixed with - for descending" default(start_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=[]OpenShiftResponse} "Successfully retrieved open shifts"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Not authenticated"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Cannot request shifts"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shifts/open [get]
+func (h *ShiftHandler) GetOpenShifts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	shifts, page, err := h.ShiftService.GetOpenShifts(r.Context(), userID, q)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error getting open shifts for user %d: %v", userID, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve open shifts"))
+		return
+	}
+	for i := range shifts {
+		shifts[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(shifts, page))
+}
+
+// ExportShifts godoc
+// @Summary Export the schedule
+// @Description Downloads the shifts with their assignees as CSV, XLSX or a printable PDF roster with one page per location and week. Without from and to the current week is exported.
+// @Tags shifts
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param format query string true "csv, xlsx or pdf"
+// @Param from query string false "First day, YYYY-MM-DD in the zone of each shift's location"
+// @Param to query string false "Last day, YYYY-MM-DD in the zone of each shift's location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param assigned query bool false "Only assigned shifts when true, only open shifts when false"
+// @Param user_id query int false "Only shifts assigned to this user"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {file} file "The exported schedule"
+// @Failure 400 {object} pkg.BaseResponse "Unknown format or time zone"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter or date range, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shifts/export [get]
+func (h *ShiftHandler) ExportShifts(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	contentType := ExportContentType(format)
+	if contentType == "" {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid format parameter, must be csv, xlsx or pdf"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	shifts, err := h.ShiftService.ExportShifts(r.Context(), q)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error exporting shifts: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to export shifts"))
+		return
+	}
+	for i := range shifts {
+		shifts[i].In(tz)
+	}
+
+	// Render before writing headers so a failure can still be reported as JSON
+	var file bytes.Buffer
+	if err := WriteExport(&file, format, shifts, q); err != nil {
+		h.logger.Errorf("Error writing %s export: %v", format, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to export shifts"))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="shifts_%s_%s.%s"`, q.From, q.To, format))
+	w.Header().Set("Content-Length", strconv.Itoa(file.Len()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := file.WriteTo(w); err != nil {
+		h.logger.Errorf("Error sending %s export: %v", format, err)
+	}
 }
 
 // CreateShift godoc
@@ -55,11 +235,20 @@ func (h *ShiftHandler) GetShifts(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param payload body CreateShiftRequest true "Shift creation payload"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
 // @Success 201 {object} pkg.BaseResponse{data=ShiftResponse} "Shift created successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shifts [post]
 func (h *ShiftHandler) CreateShift(w http.ResponseWriter, r *http.Request) {
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
 	var payload CreateShiftRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
@@ -68,10 +257,15 @@ func (h *ShiftHandler) CreateShift(w http.ResponseWriter, r *http.Request) {
 
 	shift, err := h.ShiftService.CreateShift(r.Context(), &payload)
 	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error creating shift: %v", err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create shift"))
 		return
 	}
+	shift.In(tz)
 	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(shift))
 }
 
@@ -81,8 +275,9 @@ func (h *ShiftHandler) CreateShift(w http.ResponseWriter, r *http.Request) {
 // @Tags shifts
 // @Produce json
 // @Param id path int true "Shift ID"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
 // @Success 200 {object} pkg.BaseResponse{data=ShiftResponse} "Successfully retrieved shift detail"
-// @Failure 400 {object} pkg.BaseResponse "Invalid shift ID"
+// @Failure 400 {object} pkg.BaseResponse "Invalid shift ID or unknown time zone"
 // @Failure 404 {object} pkg.BaseResponse "Shift not found"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shifts/{id} [get]
@@ -93,6 +288,11 @@ func (h *ShiftHandler) GetShiftByID(w http.ResponseWriter, r *http.Request) {
 		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid shift ID"))
 		return
 	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
 
 	shift, err := h.ShiftService.GetShiftByID(r.Context(), id)
 	if err != nil {
@@ -105,6 +305,7 @@ func (h *ShiftHandler) GetShiftByID(w http.ResponseWriter, r *http.Request) {
 		pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Shift not found"))
 		return
 	}
+	shift.In(tz)
 	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(shift))
 }
 
@@ -116,9 +317,12 @@ func (h *ShiftHandler) GetShiftByID(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path int true "Shift ID"
 // @Param payload body UpdateShiftRequest true "Shift update payload"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
 // @Success 200 {object} pkg.BaseResponse{data=ShiftResponse} "Shift updated successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request payload or shift ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
 // @Failure 404 {object} pkg.BaseResponse "Shift not found"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the fields"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shifts/{id} [put]
 func (h *ShiftHandler) UpdateShift(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +332,11 @@ func (h *ShiftHandler) UpdateShift(w http.ResponseWriter, r *http.Request) {
 		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid shift ID"))
 		return
 	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
 
 	var payload UpdateShiftRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -137,7 +346,10 @@ func (h *ShiftHandler) UpdateShift(w http.ResponseWriter, r *http.Request) {
 
 	shift, err := h.ShiftService.UpdateShift(r.Context(), id, &payload)
 	if err != nil {
-		// TODO: Differentiate between not found and other errors
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
 		h.logger.Errorf("Error updating shift ID %d: %v", id, err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update shift"))
 		return
@@ -146,34 +358,334 @@ func (h *ShiftHandler) UpdateShift(w http.ResponseWriter, r *http.Request) {
 		pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Shift not found or update failed"))
 		return
 	}
+	shift.In(tz)
 	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(shift))
 }
 
-// DeleteShift godoc
-// @Summary Hapus shift
-// @Description Menghapus shift berdasarkan ID
+// CancelShift godoc
+// @Summary Cancel a shift
+// @Description Cancels the shift rather than deleting it, so it stays in the history of the workers who had it. Its assignment and the swaps offering it are cancelled and its pending requests are rejected. The body is optional.
 // @Tags shifts
+// @Accept json
 // @Produce json
 // @Param id path int true "Shift ID"
-// @Success 200 {object} pkg.BaseResponse "Shift deleted successfully"
-// @Failure 400 {object} pkg.BaseResponse "Invalid shift ID"
+// @Param payload body CancelShiftRequest false "Why the shift is cancelled"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of the shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=ShiftResponse} "Shift cancelled successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid shift ID, request payload or time zone"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
 // @Failure 404 {object} pkg.BaseResponse "Shift not found"
+// @Failure 409 {object} pkg.BaseResponse "Shift is already cancelled"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /shifts/{id} [delete]
-func (h *ShiftHandler) DeleteShift(w http.ResponseWriter, r *http.Request) {
+func (h *ShiftHandler) CancelShift(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid shift ID"))
 		return
 	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	var payload CancelShiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
 
-	err = h.ShiftService.DeleteShift(r.Context(), id)
+	shift, err := h.ShiftService.CancelShift(r.Context(), id, &Cancellation{ByUserID: userID, Reason: payload.Reason})
 	if err != nil {
-		// TODO: Differentiate between not found and other errors
-		h.logger.Errorf("Error deleting shift ID %d: %v", id, err)
-		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to delete shift"))
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Shift not found"))
+			return
+		}
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error cancelling shift ID %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to cancel shift"))
 		return
 	}
-	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(map[string]string{"message": "Shift deleted successfully"}))
+	shift.In(tz)
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(shift))
+}
+
+// BulkCreateShifts godoc
+// @Summary Admin creates shifts in bulk
+// @Description Creates up to 500 shifts. All items are validated first. By default they are created in one transaction, and any invalid item rejects the whole request with a 422 naming it, e.g. shifts[2].end_at. With atomic=false the valid items are created one by one and the response reports each item.
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param payload body BulkCreateShiftsRequest true "Shifts to create"
+// @Param atomic query bool false "Apply all items or none, defaults to true"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=BulkShiftResponse} "Per-item report of a request with atomic=false"
+// @Success 201 {object} pkg.BaseResponse{data=BulkShiftResponse} "All shifts created"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the items"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shifts/bulk [post]
+func (h *ShiftHandler) BulkCreateShifts(w http.ResponseWriter, r *http.Request) {
+	atomic, tz, ok := bulkOptions(w, r)
+	if !ok {
+		return
+	}
+
+	var payload BulkCreateShiftsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	result, err := h.ShiftService.BulkCreateShifts(r.Context(), payload.Shifts, atomic)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error creating shifts in bulk: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create shifts"))
+		return
+	}
+
+	status := http.StatusOK
+	if atomic {
+		status = http.StatusCreated
+	}
+	h.writeBulkResult(w, status, result, tz)
+}
+
+// BulkUpdateShifts godoc
+// @Summary Admin updates shifts in bulk
+// @Description Updates up to 500 shifts, each item taking the fields of PUT /shifts/{id} plus its id. Items are validated and applied like in POST /shifts/bulk.
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param payload body BulkUpdateShiftsRequest true "Shifts to update"
+// @Param atomic query bool false "Apply all items or none, defaults to true"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=BulkShiftResponse} "Shifts updated, or the per-item report with atomic=false"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the items"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shifts/bulk [put]
+func (h *ShiftHandler) BulkUpdateShifts(w http.ResponseWriter, r *http.Request) {
+	atomic, tz, ok := bulkOptions(w, r)
+	if !ok {
+		return
+	}
+
+	var payload BulkUpdateShiftsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	result, err := h.ShiftService.BulkUpdateShifts(r.Context(), payload.Shifts, atomic)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error updating shifts in bulk: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update shifts"))
+		return
+	}
+	h.writeBulkResult(w, http.StatusOK, result, tz)
+}
+
+// BulkCancelShifts godoc
+// @Summary Admin cancels shifts in bulk
+// @Description Cancels up to 500 shifts by ID, like DELETE /shifts/{id}, with the same optional reason. Unknown and already cancelled IDs are reported as ids[n]. Items are applied like in POST /shifts/bulk.
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param payload body BulkDeleteShiftsRequest true "IDs of the shifts to cancel"
+// @Param atomic query bool false "Apply all items or none, defaults to true"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=BulkShiftResponse} "Shifts cancelled, or the per-item report with atomic=false"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Validation failed, see errors for the items"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shifts/bulk [delete]
+func (h *ShiftHandler) BulkCancelShifts(w http.ResponseWriter, r *http.Request) {
+	atomic, tz, ok := bulkOptions(w, r)
+	if !ok {
+		return
+	}
+
+	var payload BulkDeleteShiftsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	result, err := h.ShiftService.BulkCancelShifts(r.Context(), payload.IDs, &Cancellation{ByUserID: userID, Reason: payload.Reason}, atomic)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error cancelling shifts in bulk: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to cancel shifts"))
+		return
+	}
+	h.writeBulkResult(w, http.StatusOK, result, tz)
+}
+
+// maxImportBytes caps the size of an uploaded roster
+const maxImportBytes = 10 << 20
+
+// ImportShifts godoc
+// @Summary Admin imports a roster
+// @Description Reads a CSV or XLSX roster with the columns date, start, end and role, and optionally location (by name) and assignee_email. A row ending at or before its start time ends the next day. By default this is a dry run reporting each row's validation errors and its conflicts with existing shifts, the assignee's other shifts, time off and weekly availability, and other rows. With commit=true the shifts are created and assigned in one transaction, but only if no row has an error or conflict. With force=true as well, conflicts of assignees are overridden and recorded like a forced assignment.
+// @Tags shifts
+// @Accept multipart/form-data
+// @Accept text/csv
+// @Produce json
+// @Param file formData file false "Roster as .csv or .xlsx, or send the file as the request body"
+// @Param commit query bool false "Create the shifts instead of a dry run"
+// @Param force query bool false "Override the conflicts of assignees"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=ImportReport} "Dry run report"
+// @Success 201 {object} pkg.BaseResponse{data=ImportReport} "Roster imported"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 413 {object} pkg.BaseResponse "File too large"
+// @Failure 422 {object} pkg.BaseResponse{data=ImportReport} "Unreadable file, or rows with errors or conflicts and nothing was imported"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /shifts/import [post]
+func (h *ShiftHandler) ImportShifts(w http.ResponseWriter, r *http.Request) {
+	commit := false
+	if value := r.URL.Query().Get("commit"); value != "" {
+		var err error
+		if commit, err = strconv.ParseBool(value); err != nil {
+			pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("commit must be true or false"))
+			return
+		}
+	}
+	var override *ImportOverride
+	if value := r.URL.Query().Get("force"); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid force parameter, must be true or false"))
+			return
+		}
+		if force {
+			userID, ok := pkg.GetUserIDFromContext(r.Context())
+			if !ok {
+				pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+				return
+			}
+			override = &ImportOverride{ByUserID: userID}
+		}
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var file io.Reader = r.Body
+	format := DetectImportFormat("", r.Header.Get("Content-Type"))
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		upload, header, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				pkg.WriteJSON(w, http.StatusRequestEntityTooLarge, pkg.NewErrorResponse("File too large"))
+				return
+			}
+			pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Upload the roster in the file field"))
+			return
+		}
+		defer upload.Close()
+		file = upload
+		format = DetectImportFormat(header.Filename, header.Header.Get("Content-Type"))
+	}
+
+	report, err := h.ShiftService.ImportShifts(r.Context(), format, file, commit, override)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			pkg.WriteJSON(w, http.StatusRequestEntityTooLarge, pkg.NewErrorResponse("File too large"))
+			return
+		}
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error importing roster: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to import roster"))
+		return
+	}
+
+	for i := range report.Rows {
+		if report.Rows[i].Schedule != nil {
+			report.Rows[i].Schedule.In(tz)
+		}
+	}
+	switch {
+	case report.Committed:
+		pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(report))
+	case commit:
+		response := pkg.NewErrorResponse("roster has errors or conflicts, nothing was imported")
+		response.Data = report
+		pkg.WriteJSON(w, http.StatusUnprocessableEntity, response)
+	default:
+		pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(report))
+	}
+}
+
+// bulkOptions reads the atomic and tz query parameters of a bulk request, answering with a
+// 400 when either is invalid
+func bulkOptions(w http.ResponseWriter, r *http.Request) (bool, *time.Location, bool) {
+	atomic := true
+	if value := r.URL.Query().Get("atomic"); value != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(value); err != nil {
+			pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("atomic must be true or false"))
+			return false, nil, false
+		}
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return false, nil, false
+	}
+	return atomic, tz, true
+}
+
+func (h *ShiftHandler) writeBulkResult(w http.ResponseWriter, status int, result *BulkShiftResponse, tz *time.Location) {
+	for i := range result.Results {
+		item := &result.Results[i]
+		if item.Err != nil {
+			h.logger.Errorf("Error applying item %d of bulk shift request: %v", item.Index, item.Err)
+		}
+		if item.Shift != nil {
+			item.Shift.In(tz)
+		}
+	}
+	pkg.WriteJSON(w, status, pkg.SuccessResponse(result))
 }
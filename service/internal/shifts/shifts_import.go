@@ -0,0 +1,343 @@
+package shifts
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// Formats a roster can be imported from
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatXLSX = "xlsx"
+)
+
+// maxImportRows caps the number of shifts in one imported roster
+const maxImportRows = 2000
+
+// importColumns maps the accepted header names to the column they fill
+var importColumns = map[string]string{
+	"date":           "date",
+	"start":          "start",
+	"start_time":     "start",
+	"end":            "end",
+	"end_time":       "end",
+	"role":           "role",
+	"location":       "location",
+	"assignee_email": "assignee_email",
+	"assignee":       "assignee_email",
+	"email":          "assignee_email",
+}
+
+// importFields maps the fields reported by shift validation to the roster columns
+var importFields = map[string]string{
+	"start_at":   "start",
+	"end_at":     "end",
+	"start_time": "start",
+	"end_time":   "end",
+	"overnight":  "end",
+}
+
+// readRoster reads the rows of a roster. The first row names the columns, date, start, end
+// and role are required and location and assignee_email optional. Blank rows are skipped.
+func readRoster(format string, file io.Reader) ([]ImportRow, error) {
+	var records [][]string
+	var err error
+	switch format {
+	case ImportFormatCSV:
+		records, err = readCSV(file)
+	case ImportFormatXLSX:
+		records, err = readXLSX(file)
+	default:
+		return nil, fileError("must be a csv or xlsx file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fileError("is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, header := range records[0] {
+		if column := importColumn(header); column != "" {
+			columns[column] = i
+		}
+	}
+	for _, column := range []string{"date", "start", "end", "role"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fileError("is missing the " + column + " column")
+		}
+	}
+
+	cell := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []ImportRow
+	for i, record := range records[1:] {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, fileError(fmt.Sprintf("cannot have more than %d rows", maxImportRows))
+		}
+		rows = append(rows, ImportRow{
+			Row:           i + 2,
+			Date:          cell(record, "date"),
+			Start:         cell(record, "start"),
+			End:           cell(record, "end"),
+			Role:          cell(record, "role"),
+			Location:      cell(record, "location"),
+			AssigneeEmail: cell(record, "assignee_email"),
+		})
+	}
+	if len(rows) == 0 {
+		return nil, fileError("has no rows")
+	}
+	return rows, nil
+}
+
+// importColumn returns the column a header names, or "" for unknown headers
+func importColumn(header string) string {
+	header = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))
+	return importColumns[strings.ReplaceAll(header, " ", "_")]
+}
+
+func readCSV(file io.Reader) ([][]string, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fileError(fmt.Sprintf("is not valid CSV: %v", parseErr))
+		}
+		return nil, err
+	}
+	return records, nil
+}
+
+// readXLSX reads the first sheet of a workbook. Date and time cells are converted from
+// spreadsheet serial numbers, so they don't depend on the cell's display format.
+func readXLSX(file io.Reader) ([][]string, error) {
+	workbook, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, fileError("is not a valid xlsx file")
+	}
+	defer workbook.Close()
+
+	sheets := workbook.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fileError("has no sheets")
+	}
+	rows, err := workbook.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fileError("is not a valid xlsx file")
+	}
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	var dateColumn, startColumn, endColumn = -1, -1, -1
+	for i, header := range rows[0] {
+		switch importColumn(header) {
+		case "date":
+			dateColumn = i
+		case "start":
+			startColumn = i
+		case "end":
+			endColumn = i
+		}
+	}
+	for _, row := range rows[1:] {
+		for i := range row {
+			serial, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+			if err != nil {
+				continue
+			}
+			switch i {
+			case dateColumn:
+				if date, err := excelize.ExcelDateToTime(serial, false); err == nil {
+					row[i] = date.Format(pkg.DateLayout)
+				}
+			case startColumn, endColumn:
+				_, fraction := math.Modf(serial)
+				seconds := math.Round(fraction * 24 * 60 * 60)
+				row[i] = time.Time{}.Add(time.Duration(seconds) * time.Second).Format(pkg.ClockLayout)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// DetectImportFormat picks the roster format from the file name, falling back to the
+// content type
+func DetectImportFormat(filename string, contentType string) string {
+	switch {
+	case strings.HasSuffix(strings.ToLower(filename), ".csv"):
+		return ImportFormatCSV
+	case strings.HasSuffix(strings.ToLower(filename), ".xlsx"):
+		return ImportFormatXLSX
+	case strings.HasPrefix(contentType, "text/csv"):
+		return ImportFormatCSV
+	case strings.HasPrefix(contentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"):
+		return ImportFormatXLSX
+	}
+	return ""
+}
+
+// shiftRequestFromRow turns a roster row into a shift request. A row ending at or before its
+// start time ends the next day.
+func shiftRequestFromRow(row *ImportRow) *CreateShiftRequest {
+	req := &CreateShiftRequest{
+		Date:      row.Date,
+		StartTime: row.Start,
+		EndTime:   row.End,
+		Role:      row.Role,
+		Location:  row.Location,
+	}
+	start, startErr := pkg.ParseClock(row.Start)
+	end, endErr := pkg.ParseClock(row.End)
+	req.Overnight = startErr == nil && endErr == nil && !end.After(start)
+	return req
+}
+
+// missingCells reports the required cells a row leaves empty
+func missingCells(row *ImportRow) []pkg.FieldError {
+	var errs []pkg.FieldError
+	for _, cell := range []struct {
+		column string
+		value  string
+	}{
+		{"date", row.Date},
+		{"start", row.Start},
+		{"end", row.End},
+		{"role", row.Role},
+	} {
+		if cell.value == "" {
+			errs = append(errs, pkg.FieldError{Field: cell.column, Message: "is required"})
+		}
+	}
+	return errs
+}
+
+// importFieldErrors renames the fields of shift validation errors to roster columns and
+// adds them to the errors of the row, leaving out columns already reported as missing
+func importFieldErrors(row *ImportRow, errs []pkg.FieldError) {
+	reported := make(map[string]bool, len(row.Errors))
+	for _, err := range row.Errors {
+		reported[err.Field] = true
+	}
+	for _, err := range errs {
+		if column, ok := importFields[err.Field]; ok {
+			err.Field = column
+		}
+		if !reported[err.Field] {
+			row.Errors = append(row.Errors, err)
+			reported[err.Field] = true
+		}
+	}
+}
+
+// importedShift is a valid row ready to be stored
+type importedShift struct {
+	row        *ImportRow
+	shift      *Shift
+	assigneeID *int
+	// conflicts of the assignee, recorded as an override when an admin forces the import
+	conflicts []assigneeConflict
+}
+
+// assigneeConflict is a schedule conflict of the assignee of a row, with an existing shift or
+// the shift of another row, which only gets its ID once created
+type assigneeConflict struct {
+	pkg.ScheduleConflict
+	other *importedShift
+}
+
+// addAssigneeConflict reports a schedule conflict of the assignee of the row
+func (a *importedShift) addAssigneeConflict(conflict assigneeConflict) {
+	reported := ImportConflict{
+		Kind:        assigneeConflictKinds[conflict.Kind],
+		Message:     conflict.Message,
+		Overridable: true,
+	}
+	if conflict.other != nil {
+		row := conflict.other.row.Row
+		reported.Row = &row
+	} else if conflict.ShiftID != 0 {
+		id := conflict.ShiftID
+		reported.ShiftID = &id
+	}
+	a.row.Conflicts = append(a.row.Conflicts, reported)
+	a.conflicts = append(a.conflicts, conflict)
+}
+
+// findImportConflicts checks the valid rows against the existing shifts and each other. A
+// row conflicts when a shift with the same times, role and location exists, or when its
+// assignee works another row overlapping it or leaving less than minRest between them.
+// Conflicts of assignees with their existing shifts are checked by the AssignmentChecker.
+func findImportConflicts(imported []importedShift, existing []ScheduledShift, minRest time.Duration) {
+	for i := range imported {
+		a := &imported[i]
+		for _, shift := range existing {
+			id := shift.ID
+			if sameShift(a.shift, shift.StartAt, shift.EndAt, shift.Role, shift.LocationID) {
+				a.row.Conflicts = append(a.row.Conflicts, ImportConflict{
+					Kind:    ConflictDuplicateShift,
+					Message: fmt.Sprintf("shift %d already has the same time, role and location", id),
+					ShiftID: &id,
+				})
+			}
+		}
+
+		for j := range imported[:i] {
+			b := &imported[j]
+			row := b.row.Row
+			if sameShift(a.shift, b.shift.StartAt, b.shift.EndAt, b.shift.Role, b.shift.LocationID) {
+				a.row.Conflicts = append(a.row.Conflicts, ImportConflict{
+					Kind:    ConflictDuplicateShift,
+					Message: fmt.Sprintf("row %d has the same time, role and location", row),
+					Row:     &row,
+				})
+			}
+			if a.assigneeID == nil || b.assigneeID == nil || *a.assigneeID != *b.assigneeID {
+				continue
+			}
+			booked := []pkg.BookedShift{{StartAt: b.shift.StartAt, EndAt: b.shift.EndAt}}
+			for _, conflict := range pkg.FindScheduleConflicts(a.shift.StartAt, a.shift.EndAt, booked, minRest) {
+				if conflict.Kind == pkg.ConflictOverlap {
+					conflict.Message = fmt.Sprintf("assignee also works row %d at this time", row)
+				} else {
+					conflict.Message = fmt.Sprintf("assignee also works row %d, leaving less than the minimum rest of %s", row, minRest)
+				}
+				a.addAssigneeConflict(assigneeConflict{ScheduleConflict: conflict, other: b})
+			}
+		}
+	}
+}
+
+func sameShift(shift *Shift, startAt time.Time, endAt time.Time, role string, locationID *int) bool {
+	sameLocation := (shift.LocationID == nil && locationID == nil) ||
+		(shift.LocationID != nil && locationID != nil && *shift.LocationID == *locationID)
+	return shift.StartAt.Equal(startAt) && shift.EndAt.Equal(endAt) && strings.EqualFold(shift.Role, role) && sameLocation
+}
+
+func fileError(message string) error {
+	return pkg.NewFieldValidationError([]pkg.FieldError{{Field: "file", Message: message}})
+}
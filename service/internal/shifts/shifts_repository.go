@@ -4,15 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
 )
 
 // ShiftRepository defines the interface for shift data operations
 type ShiftRepository interface {
-	CreateShift(ctx context.Context, shift *CreateShiftRequest) (*ShiftResponse, error)
-	GetShifts(ctx context.Context) ([]ShiftResponse, error)
+	CreateShift(ctx context.Context, shift *Shift) (*ShiftResponse, error)
+	GetShifts(ctx context.Context, filter *ShiftFilter) ([]ShiftResponse, *pkg.Pagination, error)
+	GetOpenShifts(ctx context.Context, userID int, since time.Time, q *pkg.ListQuery) ([]OpenShiftResponse, *pkg.Pagination, error)
 	GetShiftByID(ctx context.Context, id int) (*ShiftResponse, error)
-	UpdateShift(ctx context.Context, id int, shift *UpdateShiftRequest) (*ShiftResponse, error)
-	DeleteShift(ctx context.Context, id int) error
+	UpdateShift(ctx context.Context, id int, shift *Shift) (*ShiftResponse, error)
+	CancelShift(ctx context.Context, id int, cancellation *Cancellation) error
+	CreateShifts(ctx context.Context, shifts []*Shift) ([]int, error)
+	UpdateShifts(ctx context.Context, shifts []*Shift) error
+	GetScheduledShifts(ctx context.Context, from time.Time, to time.Time) ([]ScheduledShift, error)
+	ImportShifts(ctx context.Context, shifts []*Shift, assigneeIDs []*int) ([]int, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
 type shiftRepository struct {
@@ -24,77 +36,156 @@ func NewShiftRepository(db *sql.DB) ShiftRepository {
 	return &shiftRepository{db: db}
 }
 
-func (r *shiftRepository) CreateShift(ctx context.Context, shift *CreateShiftRequest) (*ShiftResponse, error) {
+func (r *shiftRepository) CreateShift(ctx context.Context, shift *Shift) (*ShiftResponse, error) {
+	id, err := insertShift(ctx, pkg.Conn(ctx, r.db), shift)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the full shift details
+	return r.GetShiftByID(ctx, id)
+}
+
+// CreateShifts inserts all shifts in one transaction and returns their IDs in order
+func (r *shiftRepository) CreateShifts(ctx context.Context, shifts []*Shift) ([]int, error) {
+	ids := make([]int, 0, len(shifts))
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		for _, shift := range shifts {
+			id, err := insertShift(ctx, tx, shift)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func insertShift(ctx context.Context, db execer, shift *Shift) (int, error) {
+	// date, start_time and end_time are kept in sync with the instants for older readers
 	query := `
-		INSERT INTO shifts (date, start_time, end_time, role, location)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO shifts (start_at, end_at, date, start_time, end_time, role, location_id, location)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := r.db.ExecContext(
+	start, end := shift.StartAt.In(shift.Zone), shift.EndAt.In(shift.Zone)
+	result, err := db.ExecContext(
 		ctx,
 		query,
-		shift.Date,
-		shift.StartTime,
-		shift.EndTime,
+		pkg.FormatTimestamp(shift.StartAt),
+		pkg.FormatTimestamp(shift.EndAt),
+		start.Format(pkg.DateLayout),
+		start.Format(pkg.ClockLayout),
+		end.Format(pkg.ClockLayout),
 		shift.Role,
+		shift.LocationID,
 		shift.Location,
 	)
-
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	// Get the ID of the inserted row
 	id, err := result.LastInsertId()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return int(id), nil
+}
 
-	// Get the full shift details
-	return r.GetShiftByID(ctx, int(id))
+// shiftList applies list queries to shiftQuery
+var shiftList = &pkg.ListSpec[ShiftResponse]{
+	Sorts: map[string]pkg.SortKey[ShiftResponse]{
+		"start_at":   {Column: "s.start_at", Value: func(s *ShiftResponse) interface{} { return pkg.FormatTimestamp(s.StartAt) }},
+		"end_at":     {Column: "s.end_at", Value: func(s *ShiftResponse) interface{} { return pkg.FormatTimestamp(s.EndAt) }},
+		"created_at": {Column: "s.created_at", Value: func(s *ShiftResponse) interface{} { return pkg.FormatTimestamp(s.CreatedAt) }},
+		"role":       {Column: "s.role", Value: func(s *ShiftResponse) interface{} { return s.Role }},
+		"location":   {Column: "COALESCE(l.name, s.location, '')", Value: func(s *ShiftResponse) interface{} { return s.Location }},
+		"id":         {Column: "s.id", Value: func(s *ShiftResponse) interface{} { return s.ID }},
+	},
+	DefaultSort: "start_at",
+	DefaultDesc: true,
+	IDColumn:    "s.id",
+	ID:          func(s *ShiftResponse) int { return s.ID },
+	// date is the start date in the location's zone, see insertShift
+	Date:     "s.date",
+	Location: "s.location_id",
+	Role:     "s.role",
+	User:     "a.user_id",
+	Assigned: "a.user_id IS NOT NULL",
 }
 
-func (r *shiftRepository) GetShifts(ctx context.Context) ([]ShiftResponse, error) {
-	query := `
+const shiftQuery = `
 		SELECT
 			s.id,
-			s.date,
-			s.start_time,
-			s.end_time,
+			s.start_at,
+			s.end_at,
 			s.role,
-			s.location,
+			s.location_id,
+			COALESCE(l.name, s.location, '') as location,
+			COALESCE(l.time_zone, 'UTC') as time_zone,
 			s.created_at,
+			s.status,
+			s.cancelled_at,
+			s.cancelled_by,
+			COALESCE(s.cancel_reason, '') as cancel_reason,
 			u.name as assignee,
 			a.user_id IS NOT NULL as is_assigned
 		FROM shifts s
-		LEFT JOIN assignments a ON s.id = a.shift_id
+		LEFT JOIN locations l ON s.location_id = l.id
+		LEFT JOIN assignments a ON s.id = a.shift_id AND a.status = 'active'
 		LEFT JOIN users u ON a.user_id = u.id
-		ORDER BY s.date DESC, s.start_time ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query)
+func (r *shiftRepository) GetShifts(ctx context.Context, filter *ShiftFilter) ([]ShiftResponse, *pkg.Pagination, error) {
+	status := filter.Status
+	if status == "" {
+		status = StatusScheduled
+	}
+
+	q := &filter.ListQuery
+	clause, args, err := shiftList.Build(q, []string{"s.status = ?"}, []interface{}{status})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, shiftQuery+clause, args...)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var shifts []ShiftResponse
 	for rows.Next() {
 		var shift ShiftResponse
+		var startAt, endAt time.Time
+		var locationID sql.NullInt64
+		var timeZone string
+		var cancelledAt sql.NullTime
+		var cancelledBy sql.NullInt64
 		var assigneeNullable sql.NullString // Use NullString to handle NULL values
 
 		if err := rows.Scan(
 			&shift.ID,
-			&shift.Date,
-			&shift.StartTime,
-			&shift.EndTime,
+			&startAt,
+			&endAt,
 			&shift.Role,
+			&locationID,
 			&shift.Location,
+			&timeZone,
 			&shift.CreatedAt,
+			&shift.Status,
+			&cancelledAt,
+			&cancelledBy,
+			&shift.CancelReason,
 			&assigneeNullable, // Scan into nullable string
 			&shift.IsAssigned,
 		); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// Convert nullable string to regular string
@@ -103,33 +194,155 @@ func (r *shiftRepository) GetShifts(ctx context.Context) ([]ShiftResponse, error
 		} else {
 			shift.Assignee = "" // Empty string for NULL
 		}
+		setSchedule(&shift, startAt, endAt, timeZone, locationID)
+		setCancellation(&shift, cancelledAt, cancelledBy)
 
 		shifts = append(shifts, shift)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return shifts, nil
+	shifts, page := shiftList.Page(q, shifts)
+	return shifts, page, nil
+}
+
+// pendingRequestsColumn counts the pending requests for a shift of openShiftQuery
+const pendingRequestsColumn = "(SELECT COUNT(*) FROM shift_requests sr WHERE sr.shift_id = s.id AND sr.status = 'pending')"
+
+// openShiftList applies list queries to openShiftQuery. The user and assigned filters
+// don't apply, the list is always the caller's open shifts.
+var openShiftList = &pkg.ListSpec[OpenShiftResponse]{
+	Sorts: map[string]pkg.SortKey[OpenShiftResponse]{
+		"start_at":         {Column: "s.start_at", Value: func(s *OpenShiftResponse) interface{} { return pkg.FormatTimestamp(s.StartAt) }},
+		"pending_requests": {Column: pendingRequestsColumn, Value: func(s *OpenShiftResponse) interface{} { return s.PendingRequests }},
+		"id":               {Column: "s.id", Value: func(s *OpenShiftResponse) interface{} { return s.ID }},
+	},
+	DefaultSort: "start_at",
+	IDColumn:    "s.id",
+	ID:          func(s *OpenShiftResponse) int { return s.ID },
+	Date:        "s.date",
+	Location:    "s.location_id",
+	Role:        "s.role",
+}
+
+const openShiftQuery = `
+		SELECT
+			s.id,
+			s.start_at,
+			s.end_at,
+			s.role,
+			s.location_id,
+			COALESCE(l.name, s.location, '') as location,
+			COALESCE(l.time_zone, 'UTC') as time_zone,
+			s.created_at,
+			s.status,
+			` + pendingRequestsColumn + ` as pending_requests
+		FROM shifts s
+		LEFT JOIN locations l ON s.location_id = l.id
+	`
+
+// GetOpenShifts lists the unassigned shifts starting after since that the user can pick
+// up: those for a role the user has been assigned before, that the user hasn't requested
+// yet and that don't overlap one of the user's assignments
+func (r *shiftRepository) GetOpenShifts(ctx context.Context, userID int, since time.Time, q *pkg.ListQuery) ([]OpenShiftResponse, *pkg.Pagination, error) {
+	where := []string{
+		"s.start_at > ?",
+		"s.status = 'scheduled'",
+		"NOT EXISTS (SELECT 1 FROM assignments a WHERE a.shift_id = s.id AND a.status = 'active')",
+		`LOWER(s.role) IN (
+			SELECT LOWER(ps.role) FROM assignments pa JOIN shifts ps ON pa.shift_id = ps.id
+			WHERE pa.user_id = ? AND pa.status = 'active'
+		)`,
+		"NOT EXISTS (SELECT 1 FROM shift_requests sr WHERE sr.shift_id = s.id AND sr.user_id = ? AND sr.status = 'pending')",
+		`NOT EXISTS (
+			SELECT 1 FROM assignments oa JOIN shifts os ON oa.shift_id = os.id
+			WHERE oa.user_id = ? AND oa.status = 'active' AND os.start_at < s.end_at AND os.end_at > s.start_at
+		)`,
+	}
+	args := []interface{}{pkg.FormatTimestamp(since), userID, userID, userID}
+	clause, args, err := openShiftList.Build(q, where, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, openShiftQuery+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var shifts []OpenShiftResponse
+	for rows.Next() {
+		var shift OpenShiftResponse
+		var startAt, endAt time.Time
+		var locationID sql.NullInt64
+		var timeZone string
+		if err := rows.Scan(
+			&shift.ID,
+			&startAt,
+			&endAt,
+			&shift.Role,
+			&locationID,
+			&shift.Location,
+			&timeZone,
+			&shift.CreatedAt,
+			&shift.Status,
+			&shift.PendingRequests,
+		); err != nil {
+			return nil, nil, err
+		}
+		setSchedule(&shift.ShiftResponse, startAt, endAt, timeZone, locationID)
+		shifts = append(shifts, shift)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	shifts, page := openShiftList.Page(q, shifts)
+	return shifts, page, nil
 }
 
 func (r *shiftRepository) GetShiftByID(ctx context.Context, id int) (*ShiftResponse, error) {
 	query := `
-		SELECT id, date, start_time, end_time, role, location, created_at
-		FROM shifts
-		WHERE id = ?
+		SELECT
+			s.id,
+			s.start_at,
+			s.end_at,
+			s.role,
+			s.location_id,
+			COALESCE(l.name, s.location, '') as location,
+			COALESCE(l.time_zone, 'UTC') as time_zone,
+			s.created_at,
+			s.status,
+			s.cancelled_at,
+			s.cancelled_by,
+			COALESCE(s.cancel_reason, '') as cancel_reason
+		FROM shifts s
+		LEFT JOIN locations l ON s.location_id = l.id
+		WHERE s.id = ?
 	`
 
 	var shift ShiftResponse
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	var startAt, endAt time.Time
+	var locationID sql.NullInt64
+	var timeZone string
+	var cancelledAt sql.NullTime
+	var cancelledBy sql.NullInt64
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
 		&shift.ID,
-		&shift.Date,
-		&shift.StartTime,
-		&shift.EndTime,
+		&startAt,
+		&endAt,
 		&shift.Role,
+		&locationID,
 		&shift.Location,
+		&timeZone,
 		&shift.CreatedAt,
+		&shift.Status,
+		&cancelledAt,
+		&cancelledBy,
+		&shift.CancelReason,
 	)
 
 	if err != nil {
@@ -138,94 +351,175 @@ func (r *shiftRepository) GetShiftByID(ctx context.Context, id int) (*ShiftRespo
 		}
 		return nil, err
 	}
+	setSchedule(&shift, startAt, endAt, timeZone, locationID)
+	setCancellation(&shift, cancelledAt, cancelledBy)
 
 	return &shift, nil
 }
 
-func (r *shiftRepository) UpdateShift(ctx context.Context, id int, shift *UpdateShiftRequest) (*ShiftResponse, error) {
-	// First, get the current shift to use existing values for fields not being updated
-	current, err := r.GetShiftByID(ctx, id)
+// setCancellation fills in who cancelled the shift and when, if it was cancelled
+func setCancellation(shift *ShiftResponse, cancelledAt sql.NullTime, cancelledBy sql.NullInt64) {
+	if cancelledAt.Valid {
+		shift.CancelledAt = &cancelledAt.Time
+	}
+	if cancelledBy.Valid {
+		id := int(cancelledBy.Int64)
+		shift.CancelledBy = &id
+	}
+}
+
+// setSchedule renders the stored instants in the time zone of the shift's location
+func setSchedule(shift *ShiftResponse, startAt time.Time, endAt time.Time, timeZone string, locationID sql.NullInt64) {
+	shift.Schedule = pkg.NewSchedule(startAt, endAt, timeZone)
+	if locationID.Valid {
+		id := int(locationID.Int64)
+		shift.LocationID = &id
+	}
+}
+
+func (r *shiftRepository) UpdateShift(ctx context.Context, id int, shift *Shift) (*ShiftResponse, error) {
+	rowsAffected, err := updateShift(ctx, pkg.Conn(ctx, r.db), id, shift)
 	if err != nil {
 		return nil, err
 	}
-	if current == nil {
+	if rowsAffected == 0 {
 		return nil, nil // Shift not found
 	}
 
-	// Apply updates only to fields that are provided
-	date := current.Date
-	startTime := current.StartTime
-	endTime := current.EndTime
-	role := current.Role
-	location := current.Location
+	// Get the updated shift
+	return r.GetShiftByID(ctx, id)
+}
 
-	if shift.Date != nil {
-		date = *shift.Date
-	}
-	if shift.StartTime != nil {
-		startTime = *shift.StartTime
-	}
-	if shift.EndTime != nil {
-		endTime = *shift.EndTime
-	}
-	if shift.Role != nil {
-		role = *shift.Role
-	}
-	if shift.Location != nil {
-		location = *shift.Location
-	}
+// UpdateShifts stores all shifts, identified by their ID, in one transaction. Nothing is
+// changed when one of them doesn't exist.
+func (r *shiftRepository) UpdateShifts(ctx context.Context, shifts []*Shift) error {
+	return pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		for _, shift := range shifts {
+			rowsAffected, err := updateShift(ctx, tx, shift.ID, shift)
+			if err != nil {
+				return err
+			}
+			if rowsAffected == 0 {
+				return pkg.ErrNotFound
+			}
+		}
+		return nil
+	})
+}
 
-	// Update the shift
+func updateShift(ctx context.Context, db execer, id int, shift *Shift) (int64, error) {
 	query := `
 		UPDATE shifts
-		SET date = ?, start_time = ?, end_time = ?, role = ?, location = ?
+		SET start_at = ?, end_at = ?, date = ?, start_time = ?, end_time = ?, role = ?, location_id = ?, location = ?
 		WHERE id = ?
 	`
 
-	_, err = r.db.ExecContext(
+	start, end := shift.StartAt.In(shift.Zone), shift.EndAt.In(shift.Zone)
+	result, err := db.ExecContext(
 		ctx,
 		query,
-		date,
-		startTime,
-		endTime,
-		role,
-		location,
+		pkg.FormatTimestamp(shift.StartAt),
+		pkg.FormatTimestamp(shift.EndAt),
+		start.Format(pkg.DateLayout),
+		start.Format(pkg.ClockLayout),
+		end.Format(pkg.ClockLayout),
+		shift.Role,
+		shift.LocationID,
+		shift.Location,
 		id,
 	)
-
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-
-	// Get the updated shift
-	return r.GetShiftByID(ctx, id)
+	return result.RowsAffected()
 }
 
-func (r *shiftRepository) DeleteShift(ctx context.Context, id int) error {
-	// Check if the shift exists first
-	exists, err := r.GetShiftByID(ctx, id)
+// CancelShift marks the shift cancelled rather than deleting it, so the workers who had it
+// keep their history. A shift that was already cancelled is reported as a conflict.
+func (r *shiftRepository) CancelShift(ctx context.Context, id int, cancellation *Cancellation) error {
+	db := pkg.Conn(ctx, r.db)
+	var status string
+	err := db.QueryRowContext(ctx, "SELECT status FROM shifts WHERE id = ?", id).Scan(&status)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return pkg.ErrNotFound
+		}
 		return err
 	}
-	if exists == nil {
-		return errors.New("shift not found")
+	if status == StatusCancelled {
+		return pkg.NewConflictError("shift is already cancelled")
 	}
 
-	// Delete the shift
-	query := "DELETE FROM shifts WHERE id = ?"
-	result, err := r.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
+	_, err = db.ExecContext(ctx, `
+		UPDATE shifts
+		SET status = ?, cancelled_at = ?, cancelled_by = ?, cancel_reason = ?
+		WHERE id = ?
+	`, StatusCancelled, pkg.FormatTimestamp(time.Now()), cancellation.ByUserID, nullable(cancellation.Reason), id)
+	return err
+}
+
+// nullable stores an empty string as NULL
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
 	}
+	return value
+}
+
+// GetScheduledShifts lists the shifts overlapping from to to that weren't cancelled
+func (r *shiftRepository) GetScheduledShifts(ctx context.Context, from time.Time, to time.Time) ([]ScheduledShift, error) {
+	query := `
+		SELECT s.id, s.start_at, s.end_at, s.role, s.location_id
+		FROM shifts s
+		WHERE s.status = 'scheduled' AND s.start_at < ? AND s.end_at > ?
+	`
 
-	rowsAffected, err := result.RowsAffected()
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, pkg.FormatTimestamp(to), pkg.FormatTimestamp(from))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if rowsAffected == 0 {
-		return errors.New("shift not found or could not be deleted")
+	var shifts []ScheduledShift
+	for rows.Next() {
+		var shift ScheduledShift
+		var locationID sql.NullInt64
+		if err := rows.Scan(&shift.ID, &shift.StartAt, &shift.EndAt, &shift.Role, &locationID); err != nil {
+			return nil, err
+		}
+		if locationID.Valid {
+			id := int(locationID.Int64)
+			shift.LocationID = &id
+		}
+		shifts = append(shifts, shift)
 	}
+	return shifts, rows.Err()
+}
 
-	return nil
+// ImportShifts creates shifts and assigns them in one transaction. assigneeIDs holds the
+// user to assign to each shift, nil leaves it open.
+func (r *shiftRepository) ImportShifts(ctx context.Context, shifts []*Shift, assigneeIDs []*int) ([]int, error) {
+	ids := make([]int, 0, len(shifts))
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		for i, shift := range shifts {
+			id, err := insertShift(ctx, tx, shift)
+			if err != nil {
+				return err
+			}
+			if assigneeIDs[i] != nil {
+				if _, err := tx.ExecContext(ctx,
+					"INSERT INTO assignments (shift_id, user_id, assigned_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+					id, *assigneeIDs[i],
+				); err != nil {
+					return err
+				}
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
@@ -1,32 +1,177 @@
 package shifts
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/locations"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/users"
+)
 
 // ShiftService defines the interface for shift business logic
 type ShiftService interface {
 	CreateShift(ctx context.Context, req *CreateShiftRequest) (*ShiftResponse, error)
-	GetShifts(ctx context.Context) ([]ShiftResponse, error)
+	GetShifts(ctx context.Context, filter *ShiftFilter) ([]ShiftResponse, *pkg.Pagination, error)
+	GetOpenShifts(ctx context.Context, userID int, q *pkg.ListQuery) ([]OpenShiftResponse, *pkg.Pagination, error)
+	ExportShifts(ctx context.Context, q *pkg.ListQuery) ([]ShiftResponse, error)
 	GetShiftByID(ctx context.Context, id int) (*ShiftResponse, error)
 	UpdateShift(ctx context.Context, id int, req *UpdateShiftRequest) (*ShiftResponse, error)
-	DeleteShift(ctx context.Context, id int) error
+	CancelShift(ctx context.Context, id int, cancellation *Cancellation) (*ShiftResponse, error)
+	BulkCreateShifts(ctx context.Context, reqs []CreateShiftRequest, atomic bool) (*BulkShiftResponse, error)
+	BulkUpdateShifts(ctx context.Context, reqs []BulkUpdateShiftItem, atomic bool) (*BulkShiftResponse, error)
+	BulkCancelShifts(ctx context.Context, ids []int, cancellation *Cancellation, atomic bool) (*BulkShiftResponse, error)
+	ImportShifts(ctx context.Context, format string, file io.Reader, commit bool, override *ImportOverride) (*ImportReport, error)
+}
+
+// AssignmentChecker finds the schedule conflicts of giving a worker a shift, like assigning
+// them does, and records the ones an admin overrides. The assignments package implements it,
+// assignments depend on shifts and not the other way around.
+type AssignmentChecker interface {
+	FindConflicts(ctx context.Context, userID int, start time.Time, end time.Time) ([]pkg.ScheduleConflict, error)
+	RecordOverride(ctx context.Context, shiftID int, userID int, overriddenBy int, conflicts []pkg.ScheduleConflict) error
+}
+
+// AssignmentCanceller cancels the active assignment of a cancelled shift, along with the swaps
+// offering it. The assignments repository implements it.
+type AssignmentCanceller interface {
+	CancelShiftAssignment(ctx context.Context, shiftID int, cancelledBy int, reason string) error
 }
 
+// RequestRejecter rejects the pending requests for a cancelled shift. The shift requests
+// repository implements it.
+type RequestRejecter interface {
+	RejectPendingRequests(ctx context.Context, shiftID int, exceptID int, reviewedBy int, reason string) (int, error)
+}
+
+// maxBulkItems caps the number of items in one bulk request
+const maxBulkItems = 500
+
+// maxExportDays bounds the date range of an export
+const maxExportDays = 366
+
 type shiftService struct {
-	shiftRepository ShiftRepository
+	shiftRepository     ShiftRepository
+	locationRepository  locations.LocationRepository
+	userRepository      users.UserRepository
+	assignmentChecker   AssignmentChecker
+	assignmentCanceller AssignmentCanceller
+	requestRejecter     RequestRejecter
+	availabilityService availability.AvailabilityService
+	unitOfWork          pkg.UnitOfWork
+	config              *pkg.Config
 }
 
 // NewShiftService creates a new instance of ShiftService
-func NewShiftService(shiftRepository ShiftRepository) ShiftService {
-	return &shiftService{shiftRepository: shiftRepository}
+func NewShiftService(
+	shiftRepository ShiftRepository,
+	locationRepository locations.LocationRepository,
+	userRepository users.UserRepository,
+	assignmentChecker AssignmentChecker,
+	assignmentCanceller AssignmentCanceller,
+	requestRejecter RequestRejecter,
+	availabilityService availability.AvailabilityService,
+	unitOfWork pkg.UnitOfWork,
+	config *pkg.Config,
+) ShiftService {
+	return &shiftService{
+		shiftRepository:     shiftRepository,
+		locationRepository:  locationRepository,
+		userRepository:      userRepository,
+		assignmentChecker:   assignmentChecker,
+		assignmentCanceller: assignmentCanceller,
+		requestRejecter:     requestRejecter,
+		availabilityService: availabilityService,
+		unitOfWork:          unitOfWork,
+		config:              config,
+	}
 }
 
 func (s *shiftService) CreateShift(ctx context.Context, req *CreateShiftRequest) (*ShiftResponse, error) {
-	// TODO: Add validation or other business logic here if needed
-	return s.shiftRepository.CreateShift(ctx, req)
+	shift, errs, err := s.prepareCreate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+	return s.shiftRepository.CreateShift(ctx, shift)
 }
 
-func (s *shiftService) GetShifts(ctx context.Context) ([]ShiftResponse, error) {
-	return s.shiftRepository.GetShifts(ctx)
+// prepareCreate builds the shift to store for req, along with what's wrong with it
+func (s *shiftService) prepareCreate(ctx context.Context, req *CreateShiftRequest) (*Shift, []pkg.FieldError, error) {
+	in := scheduleInput{
+		StartAt:   optional(req.StartAt),
+		EndAt:     optional(req.EndAt),
+		Date:      optional(req.Date),
+		StartTime: optional(req.StartTime),
+		EndTime:   optional(req.EndTime),
+	}
+	if req.Overnight {
+		in.Overnight = &req.Overnight
+	}
+
+	shift := &Shift{Role: req.Role, Zone: time.UTC}
+	errs, err := s.resolveLocation(ctx, shift, req.LocationID, optional(req.Location))
+	if err != nil {
+		return nil, nil, err
+	}
+	errs = append(errs, validateShift(s.config.Shifts, shift, in, shift.Zone, true)...)
+	return shift, errs, nil
+}
+
+func (s *shiftService) GetShifts(ctx context.Context, filter *ShiftFilter) ([]ShiftResponse, *pkg.Pagination, error) {
+	if filter.Status != "" && filter.Status != StatusScheduled && filter.Status != StatusCancelled {
+		return nil, nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "status", Message: "must be scheduled or cancelled"}})
+	}
+	return s.shiftRepository.GetShifts(ctx, filter)
+}
+
+// GetOpenShifts lists the future open shifts the user could request
+func (s *shiftService) GetOpenShifts(ctx context.Context, userID int, q *pkg.ListQuery) ([]OpenShiftResponse, *pkg.Pagination, error) {
+	return s.shiftRepository.GetOpenShifts(ctx, userID, time.Now(), q)
+}
+
+// ExportShifts lists the shifts to export, grouped by location and sorted by start. The
+// export is never paged and leaves out cancelled shifts. Without from and to it covers the current week, Monday to Sunday.
+func (s *shiftService) ExportShifts(ctx context.Context, q *pkg.ListQuery) ([]ShiftResponse, error) {
+	if q.From == "" && q.To == "" {
+		monday := startOfWeek(time.Now())
+		q.From = monday.Format(pkg.DateLayout)
+		q.To = monday.AddDate(0, 0, 6).Format(pkg.DateLayout)
+	}
+	q.Limit, q.Cursor = 0, ""
+
+	errs := q.Validate()
+	if len(errs) == 0 {
+		switch {
+		case q.From == "":
+			errs = append(errs, pkg.FieldError{Field: "from", Message: "is required with to"})
+		case q.To == "":
+			errs = append(errs, pkg.FieldError{Field: "to", Message: "is required with from"})
+		default:
+			from, _ := time.Parse(pkg.DateLayout, q.From)
+			to, _ := time.Parse(pkg.DateLayout, q.To)
+			if to.Sub(from) >= maxExportDays*24*time.Hour {
+				errs = append(errs, pkg.FieldError{Field: "to", Message: fmt.Sprintf("range cannot be longer than %d days", maxExportDays)})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+
+	shifts, _, err := s.shiftRepository.GetShifts(ctx, &ShiftFilter{ListQuery: *q})
+	if err != nil {
+		return nil, err
+	}
+	sortForExport(shifts)
+	return shifts, nil
 }
 
 func (s *shiftService) GetShiftByID(ctx context.Context, id int) (*ShiftResponse, error) {
@@ -34,10 +179,525 @@ func (s *shiftService) GetShiftByID(ctx context.Context, id int) (*ShiftResponse
 }
 
 func (s *shiftService) UpdateShift(ctx context.Context, id int, req *UpdateShiftRequest) (*ShiftResponse, error) {
-	// TODO: Add validation or other business logic here if needed
-	return s.shiftRepository.UpdateShift(ctx, id, req)
+	shift, errs, err := s.prepareUpdate(ctx, id, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+	return s.shiftRepository.UpdateShift(ctx, id, shift)
+}
+
+// prepareUpdate merges req into the shift with the given ID, reporting what's wrong with
+// the result. It returns pkg.ErrNotFound when the shift doesn't exist and a conflict when it
+// was cancelled.
+func (s *shiftService) prepareUpdate(ctx context.Context, id int, req *UpdateShiftRequest) (*Shift, []pkg.FieldError, error) {
+	current, err := s.shiftRepository.GetShiftByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if current == nil {
+		return nil, nil, pkg.ErrNotFound
+	}
+	if current.IsCancelled() {
+		return nil, nil, pkg.NewConflictError("shift is cancelled")
+	}
+
+	// The rules span several fields, so the merged shift is validated as a whole
+	zone, err := pkg.LoadTimeZone(current.TimeZone)
+	if err != nil {
+		zone = time.UTC
+	}
+	shift := &Shift{
+		ID:         id,
+		StartAt:    current.StartAt,
+		EndAt:      current.EndAt,
+		Role:       current.Role,
+		LocationID: current.LocationID,
+		Location:   current.Location,
+		Zone:       zone,
+	}
+	if req.Role != nil {
+		shift.Role = *req.Role
+	}
+	errs, err := s.resolveLocation(ctx, shift, req.LocationID, req.Location)
+	if err != nil {
+		return nil, nil, err
+	}
+	in := scheduleInput{
+		StartAt:   req.StartAt,
+		EndAt:     req.EndAt,
+		Date:      req.Date,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Overnight: req.Overnight,
+	}
+
+	errs = append(errs, validateShift(s.config.Shifts, shift, in, shift.Zone, req.Role != nil)...)
+	return shift, errs, nil
+}
+
+// CancelShift cancels the shift, its assignment and the swaps offering it, and rejects its
+// pending requests. The shift is kept, so is the history of the workers who had it.
+func (s *shiftService) CancelShift(ctx context.Context, id int, cancellation *Cancellation) (*ShiftResponse, error) {
+	cancellation.Reason = strings.TrimSpace(cancellation.Reason)
+	if err := s.cancelShift(ctx, id, cancellation); err != nil {
+		return nil, err
+	}
+	return s.shiftRepository.GetShiftByID(ctx, id)
+}
+
+// cancelShift cancels the shift and what depends on it in one unit of work. The assignment
+// ends with the reason given, or ReasonShiftCancelled without one.
+func (s *shiftService) cancelShift(ctx context.Context, id int, cancellation *Cancellation) error {
+	reason := cancellation.Reason
+	if reason == "" {
+		reason = ReasonShiftCancelled
+	}
+	return s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.shiftRepository.CancelShift(ctx, id, cancellation); err != nil {
+			return err
+		}
+		if err := s.assignmentCanceller.CancelShiftAssignment(ctx, id, cancellation.ByUserID, reason); err != nil {
+			return err
+		}
+		_, err := s.requestRejecter.RejectPendingRequests(ctx, id, 0, cancellation.ByUserID, ReasonShiftCancelled)
+		return err
+	})
+}
+
+// BulkCreateShifts creates shifts the way CreateShift does, see applyBulk for how the items
+// are applied
+func (s *shiftService) BulkCreateShifts(ctx context.Context, reqs []CreateShiftRequest, atomic bool) (*BulkShiftResponse, error) {
+	if err := checkBulkSize("shifts", len(reqs)); err != nil {
+		return nil, err
+	}
+
+	shifts := make([]*Shift, len(reqs))
+	results := make([]BulkShiftResult, len(reqs))
+	for i := range reqs {
+		shift, errs, err := s.prepareCreate(ctx, &reqs[i])
+		if err != nil {
+			return nil, err
+		}
+		shifts[i] = shift
+		results[i] = newBulkResult(i, nil, errs)
+	}
+
+	return s.applyBulk(ctx, "shifts", results, atomic, bulkOperation{
+		status: BulkCreated,
+		all: func(ctx context.Context) ([]int, error) {
+			return s.shiftRepository.CreateShifts(ctx, shifts)
+		},
+		one: func(ctx context.Context, i int) error {
+			created, err := s.shiftRepository.CreateShift(ctx, shifts[i])
+			if err == nil {
+				results[i].ID = &created.ID
+			}
+			return err
+		},
+	})
+}
+
+// BulkUpdateShifts updates shifts the way UpdateShift does, see applyBulk for how the items
+// are applied
+func (s *shiftService) BulkUpdateShifts(ctx context.Context, reqs []BulkUpdateShiftItem, atomic bool) (*BulkShiftResponse, error) {
+	if err := checkBulkSize("shifts", len(reqs)); err != nil {
+		return nil, err
+	}
+
+	shifts := make([]*Shift, len(reqs))
+	results := make([]BulkShiftResult, len(reqs))
+	seen := make(map[int]bool, len(reqs))
+	for i := range reqs {
+		id := reqs[i].ID
+		var errs []pkg.FieldError
+		shift, fieldErrs, err := s.prepareUpdate(ctx, id, &reqs[i].UpdateShiftRequest)
+		var conflictErr pkg.ConflictError
+		switch {
+		case errors.Is(err, pkg.ErrNotFound):
+			errs = append(errs, pkg.FieldError{Field: "id", Message: "does not exist"})
+		case errors.As(err, &conflictErr):
+			errs = append(errs, pkg.FieldError{Field: "id", Message: "is a cancelled shift"})
+		case err != nil:
+			return nil, err
+		case seen[id]:
+			errs = append(errs, pkg.FieldError{Field: "id", Message: "is listed more than once"})
+		default:
+			errs = fieldErrs
+		}
+		seen[id] = true
+		shifts[i] = shift
+		results[i] = newBulkResult(i, &id, errs)
+	}
+
+	return s.applyBulk(ctx, "shifts", results, atomic, bulkOperation{
+		status: BulkUpdated,
+		all: func(ctx context.Context) ([]int, error) {
+			ids := make([]int, len(shifts))
+			for i, shift := range shifts {
+				ids[i] = shift.ID
+			}
+			return ids, s.shiftRepository.UpdateShifts(ctx, shifts)
+		},
+		one: func(ctx context.Context, i int) error {
+			updated, err := s.shiftRepository.UpdateShift(ctx, shifts[i].ID, shifts[i])
+			if err == nil && updated == nil {
+				return pkg.ErrNotFound
+			}
+			return err
+		},
+	})
+}
+
+// BulkCancelShifts cancels shifts by ID the way CancelShift does, see applyBulk for how the
+// items are applied
+func (s *shiftService) BulkCancelShifts(ctx context.Context, ids []int, cancellation *Cancellation, atomic bool) (*BulkShiftResponse, error) {
+	if err := checkBulkSize("ids", len(ids)); err != nil {
+		return nil, err
+	}
+	cancellation.Reason = strings.TrimSpace(cancellation.Reason)
+
+	results := make([]BulkShiftResult, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for i := range ids {
+		var errs []pkg.FieldError
+		shift, err := s.shiftRepository.GetShiftByID(ctx, ids[i])
+		switch {
+		case err != nil:
+			return nil, err
+		case shift == nil:
+			errs = append(errs, pkg.FieldError{Message: "does not exist"})
+		case shift.IsCancelled():
+			errs = append(errs, pkg.FieldError{Message: "is already cancelled"})
+		case seen[ids[i]]:
+			errs = append(errs, pkg.FieldError{Message: "is listed more than once"})
+		}
+		seen[ids[i]] = true
+		results[i] = newBulkResult(i, &ids[i], errs)
+	}
+
+	return s.applyBulk(ctx, "ids", results, atomic, bulkOperation{
+		status: BulkCancelled,
+		all: func(ctx context.Context) ([]int, error) {
+			return ids, s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+				for _, id := range ids {
+					if err := s.cancelShift(ctx, id, cancellation); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+		one: func(ctx context.Context, i int) error {
+			return s.cancelShift(ctx, ids[i], cancellation)
+		},
+	})
+}
+
+// bulkOperation applies the items of a bulk request
+type bulkOperation struct {
+	// status is reported for the items that were applied
+	status string
+	// all applies every item in one transaction and returns the IDs of their shifts in order
+	all func(ctx context.Context) ([]int, error)
+	// one applies item i on its own
+	one func(ctx context.Context, i int) error
+}
+
+// applyBulk applies a bulk request whose items were validated into results. An atomic
+// request is refused with a 422 naming each invalid item, as in shifts[2].end_at, when any
+// item is invalid, and otherwise applied in a single transaction. Without atomic the valid
+// items are applied one by one and each result reports how its item went.
+func (s *shiftService) applyBulk(ctx context.Context, field string, results []BulkShiftResult, atomic bool, op bulkOperation) (*BulkShiftResponse, error) {
+	if atomic {
+		var errs []pkg.FieldError
+		for _, result := range results {
+			for _, fieldErr := range result.Errors {
+				name := fmt.Sprintf("%s[%d]", field, result.Index)
+				if fieldErr.Field != "" {
+					name += "." + fieldErr.Field
+				}
+				errs = append(errs, pkg.FieldError{Field: name, Message: fieldErr.Message})
+			}
+		}
+		if len(errs) > 0 {
+			return nil, pkg.NewFieldValidationError(errs)
+		}
+
+		ids, err := op.all(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range results {
+			id := ids[i]
+			results[i].ID, results[i].Status = &id, op.status
+		}
+	} else {
+		for i := range results {
+			if results[i].Status == BulkInvalid {
+				continue
+			}
+			err := op.one(ctx, i)
+			switch {
+			case errors.Is(err, pkg.ErrNotFound):
+				results[i].Status = BulkInvalid
+				results[i].Errors = []pkg.FieldError{{Field: "id", Message: "does not exist"}}
+			case err != nil:
+				results[i].Status, results[i].Err = BulkFailed, err
+				results[i].Errors = []pkg.FieldError{{Message: "could not be saved"}}
+			default:
+				results[i].Status = op.status
+			}
+		}
+	}
+
+	response := &BulkShiftResponse{Atomic: atomic, Results: results}
+	for i := range results {
+		if results[i].Status != op.status {
+			response.Failed++
+			continue
+		}
+		response.Succeeded++
+		shift, err := s.shiftRepository.GetShiftByID(ctx, *results[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		results[i].Shift = shift
+	}
+	return response, nil
+}
+
+func newBulkResult(index int, id *int, errs []pkg.FieldError) BulkShiftResult {
+	result := BulkShiftResult{Index: index, ID: id, Errors: errs}
+	if len(errs) > 0 {
+		result.Status = BulkInvalid
+	}
+	return result
+}
+
+func checkBulkSize(field string, n int) error {
+	switch {
+	case n == 0:
+		return pkg.NewFieldValidationError([]pkg.FieldError{{Field: field, Message: "is required"}})
+	case n > maxBulkItems:
+		return pkg.NewFieldValidationError([]pkg.FieldError{{Field: field, Message: fmt.Sprintf("cannot have more than %d items", maxBulkItems)}})
+	}
+	return nil
+}
+
+// ImportShifts reads a roster and checks every row like POST /api/shifts would, and valid
+// rows for conflicts with the schedule, their assignees' shifts, time off and availability
+// like POST /api/assignments would.
+// Only with commit, and only when no row has a problem, are the shifts created and assigned,
+// all in one transaction. An override lets the conflicts of assignees through, recording
+// them like a forced assignment.
+func (s *shiftService) ImportShifts(ctx context.Context, format string, file io.Reader, commit bool, override *ImportOverride) (*ImportReport, error) {
+	rows, err := readRoster(format, file)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Format: format, TotalRows: len(rows), Rows: rows}
+	var imported []importedShift
+	assignees := make(map[string]*int)
+	for i := range rows {
+		row := &rows[i]
+		row.Errors = missingCells(row)
+		shift, errs, err := s.prepareCreate(ctx, shiftRequestFromRow(row))
+		if err != nil {
+			return nil, err
+		}
+		assigneeID, assigneeErr, err := s.resolveAssignee(ctx, row.AssigneeEmail, assignees)
+		if err != nil {
+			return nil, err
+		}
+		if assigneeErr != nil {
+			errs = append(errs, *assigneeErr)
+		}
+		if importFieldErrors(row, errs); len(row.Errors) > 0 {
+			report.InvalidRows++
+			continue
+		}
+
+		schedule := pkg.NewSchedule(shift.StartAt, shift.EndAt, shift.Zone.String())
+		row.Schedule = &schedule
+		imported = append(imported, importedShift{row: row, shift: shift, assigneeID: assigneeID})
+	}
+
+	if !commit {
+		if err := s.findImportConflicts(ctx, report, imported); err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+
+	// The schedule is checked again in the transaction storing the shifts, so nothing booked
+	// in between slips through
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := s.findImportConflicts(ctx, report, imported); err != nil {
+			return err
+		}
+		if report.HasProblems(override != nil) {
+			return nil
+		}
+
+		shifts := make([]*Shift, len(imported))
+		assigneeIDs := make([]*int, len(imported))
+		for i, item := range imported {
+			shifts[i], assigneeIDs[i] = item.shift, item.assigneeID
+		}
+		ids, err := s.shiftRepository.ImportShifts(ctx, shifts, assigneeIDs)
+		if err != nil {
+			return err
+		}
+		for i := range imported {
+			imported[i].row.ShiftID = &ids[i]
+		}
+
+		for _, item := range imported {
+			if len(item.conflicts) == 0 {
+				continue
+			}
+			conflicts := make([]pkg.ScheduleConflict, len(item.conflicts))
+			for i, conflict := range item.conflicts {
+				conflicts[i] = conflict.ScheduleConflict
+				if conflict.other != nil {
+					conflicts[i].ShiftID = *conflict.other.row.ShiftID
+				}
+			}
+			if err := s.assignmentChecker.RecordOverride(ctx, *item.row.ShiftID, *item.assigneeID, override.ByUserID, conflicts); err != nil {
+				return err
+			}
+			report.Forced = true
+		}
+		report.Committed = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// findImportConflicts reports the conflicts of the imported rows with the schedule and each
+// other, and the conflicts of their assignees with their shifts, time off and availability
+func (s *shiftService) findImportConflicts(ctx context.Context, report *ImportReport, imported []importedShift) error {
+	if len(imported) == 0 {
+		return nil
+	}
+
+	from, to := imported[0].shift.StartAt, imported[0].shift.EndAt
+	for _, item := range imported[1:] {
+		if item.shift.StartAt.Before(from) {
+			from = item.shift.StartAt
+		}
+		if item.shift.EndAt.After(to) {
+			to = item.shift.EndAt
+		}
+	}
+	existing, err := s.shiftRepository.GetScheduledShifts(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	for i := range imported {
+		item := &imported[i]
+		if item.assigneeID == nil {
+			continue
+		}
+		conflicts, err := s.assignmentChecker.FindConflicts(ctx, *item.assigneeID, item.shift.StartAt, item.shift.EndAt)
+		if err != nil {
+			return err
+		}
+		unavailable, err := s.availabilityService.CheckAvailability(ctx, *item.assigneeID, item.shift.StartAt.In(item.shift.Zone), item.shift.EndAt)
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, unavailable...)
+		for _, conflict := range conflicts {
+			item.addAssigneeConflict(assigneeConflict{ScheduleConflict: conflict})
+		}
+	}
+	findImportConflicts(imported, existing, s.config.Shifts.MinRest())
+
+	for _, item := range imported {
+		report.Conflicts += len(item.row.Conflicts)
+	}
+	return nil
+}
+
+// resolveAssignee looks up the active user with the given email, caching lookups in seen.
+// An empty email leaves the shift open.
+func (s *shiftService) resolveAssignee(ctx context.Context, email string, seen map[string]*int) (*int, *pkg.FieldError, error) {
+	if email == "" {
+		return nil, nil, nil
+	}
+	normalized, err := pkg.NormalizeEmail(email)
+	if err != nil {
+		return nil, &pkg.FieldError{Field: "assignee_email", Message: "must be an email address"}, nil
+	}
+	if id, ok := seen[normalized]; ok {
+		if id == nil {
+			return nil, &pkg.FieldError{Field: "assignee_email", Message: "must be the email of an active user"}, nil
+		}
+		return id, nil, nil
+	}
+
+	user, err := s.userRepository.GetUserByEmail(ctx, normalized)
+	switch {
+	case errors.Is(err, pkg.ErrNotFound):
+		user = nil
+	case err != nil:
+		return nil, nil, err
+	}
+	if user == nil || !user.IsActive() {
+		seen[normalized] = nil
+		return nil, &pkg.FieldError{Field: "assignee_email", Message: "must be the email of an active user"}, nil
+	}
+	seen[normalized] = &user.ID
+	return &user.ID, nil, nil
+}
+
+// resolveLocation points shift at the location picked by id, or by name when no id is given.
+// An empty name removes the location. Leaving both out keeps the current one.
+func (s *shiftService) resolveLocation(ctx context.Context, shift *Shift, id *int, name *string) ([]pkg.FieldError, error) {
+	var location *locations.Location
+	var err error
+	switch {
+	case id != nil:
+		location, err = s.locationRepository.GetLocationByID(ctx, *id)
+		if errors.Is(err, pkg.ErrNotFound) {
+			return []pkg.FieldError{{Field: "location_id", Message: "does not exist"}}, nil
+		}
+	case name != nil && strings.TrimSpace(*name) == "":
+		shift.LocationID, shift.Location, shift.Zone = nil, "", time.UTC
+		return nil, nil
+	case name != nil:
+		location, err = s.locationRepository.GetLocationByName(ctx, strings.TrimSpace(*name))
+		if errors.Is(err, pkg.ErrNotFound) {
+			return []pkg.FieldError{{Field: "location", Message: "must be the name of an existing location"}}, nil
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zone, err := pkg.LoadTimeZone(location.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	shift.LocationID, shift.Location, shift.Zone = &location.ID, location.Name, zone
+	return nil, nil
 }
 
-func (s *shiftService) DeleteShift(ctx context.Context, id int) error {
-	return s.shiftRepository.DeleteShift(ctx, id)
+// optional treats an empty string as a field that was not given
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
 }
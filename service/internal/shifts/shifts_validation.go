@@ -0,0 +1,176 @@
+package shifts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// scheduleInput is the schedule part of a create or update request. Nil fields are not given.
+type scheduleInput struct {
+	StartAt   *string
+	EndAt     *string
+	Date      *string
+	StartTime *string
+	EndTime   *string
+	Overnight *bool
+}
+
+func (in scheduleInput) usesInstants() bool {
+	return in.StartAt != nil || in.EndAt != nil
+}
+
+func (in scheduleInput) usesTriplet() bool {
+	return in.Date != nil || in.StartTime != nil || in.EndTime != nil || in.Overnight != nil
+}
+
+// validateShift applies the schedule in to shift, which holds the current values on updates
+// and is zero on creates, then checks the result against the configured rules. Legacy
+// triplets are read in zone, the time zone of the shift's location. The role is only checked
+// when checkRole is set, so shifts created before a role was removed from the allowed list
+// can still be rescheduled.
+func validateShift(config pkg.ShiftConfig, shift *Shift, in scheduleInput, zone *time.Location, checkRole bool) []pkg.FieldError {
+	var errs []pkg.FieldError
+
+	if in.usesInstants() || in.usesTriplet() || shift.StartAt.IsZero() {
+		errs = append(errs, resolveSchedule(config, shift, in, zone)...)
+	}
+
+	shift.Role = strings.TrimSpace(shift.Role)
+	if checkRole {
+		if shift.Role == "" {
+			errs = append(errs, pkg.FieldError{Field: "role", Message: "is required"})
+		} else if role, ok := config.AllowedRole(shift.Role); ok {
+			shift.Role = role
+		} else {
+			errs = append(errs, pkg.FieldError{Field: "role", Message: "must be one of: " + strings.Join(config.Roles, ", ")})
+		}
+	}
+
+	return errs
+}
+
+// resolveSchedule sets the start and end instants of shift from in and checks the duration.
+// Errors are reported against the fields of the form the schedule was given in.
+func resolveSchedule(config pkg.ShiftConfig, shift *Shift, in scheduleInput, zone *time.Location) []pkg.FieldError {
+	var errs []pkg.FieldError
+	endField := "end_at"
+
+	switch {
+	case in.usesInstants() && in.usesTriplet():
+		return []pkg.FieldError{{Field: "start_at", Message: "cannot be combined with date, start_time, end_time or overnight"}}
+	case in.usesTriplet():
+		endField = "end_time"
+		errs = resolveTriplet(shift, in, zone)
+	default:
+		errs = resolveInstants(shift, in)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	duration := shift.EndAt.Sub(shift.StartAt)
+	maxDuration := time.Duration(config.MaxDurationHours) * time.Hour
+	switch {
+	case duration <= 0:
+		field := "start_at"
+		if endField == "end_time" {
+			field = "start_time"
+		}
+		errs = append(errs, pkg.FieldError{Field: endField, Message: "must be after " + field})
+	case config.MaxDurationHours > 0 && duration > maxDuration:
+		errs = append(errs, pkg.FieldError{Field: endField, Message: fmt.Sprintf("shift cannot be longer than %d hours", config.MaxDurationHours)})
+	}
+	return errs
+}
+
+// resolveInstants reads start_at and end_at as RFC 3339 timestamps. Either may be left out on
+// updates to keep the current value.
+func resolveInstants(shift *Shift, in scheduleInput) []pkg.FieldError {
+	var errs []pkg.FieldError
+	for _, f := range []struct {
+		name  string
+		value *string
+		dest  *time.Time
+	}{
+		{"start_at", in.StartAt, &shift.StartAt},
+		{"end_at", in.EndAt, &shift.EndAt},
+	} {
+		if f.value == nil || strings.TrimSpace(*f.value) == "" {
+			if f.dest.IsZero() {
+				errs = append(errs, pkg.FieldError{Field: f.name, Message: "is required, or give date, start_time and end_time"})
+			}
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(*f.value))
+		if err != nil {
+			errs = append(errs, pkg.FieldError{Field: f.name, Message: "must be an RFC 3339 timestamp"})
+			continue
+		}
+		*f.dest = t.UTC().Truncate(time.Second)
+	}
+	return errs
+}
+
+// resolveTriplet reads the legacy date, start_time and end_time as wall clock times in zone,
+// filling the ones left out from the current schedule. A shift ending at or before its start
+// time ends the next day, which must be confirmed with overnight unless the current shift
+// already does. Durations are measured between the instants, so a night shift across a
+// daylight saving change is an hour shorter or longer than its wall clock times suggest.
+func resolveTriplet(shift *Shift, in scheduleInput, zone *time.Location) []pkg.FieldError {
+	var errs []pkg.FieldError
+
+	var dateValue, startValue, endValue string
+	overnight := false
+	if !shift.StartAt.IsZero() {
+		start, end := shift.StartAt.In(zone), shift.EndAt.In(zone)
+		dateValue = start.Format(pkg.DateLayout)
+		startValue = start.Format(pkg.ClockLayout)
+		endValue = end.Format(pkg.ClockLayout)
+		overnight = end.Format(pkg.DateLayout) != dateValue
+	}
+	if in.Date != nil {
+		dateValue = *in.Date
+	}
+	if in.StartTime != nil {
+		startValue = *in.StartTime
+	}
+	if in.EndTime != nil {
+		endValue = *in.EndTime
+	}
+	if in.Overnight != nil {
+		overnight = *in.Overnight
+	}
+
+	date, err := time.Parse(pkg.DateLayout, strings.TrimSpace(dateValue))
+	if err != nil {
+		errs = append(errs, pkg.FieldError{Field: "date", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	start, startErr := pkg.ParseClock(startValue)
+	if startErr != nil {
+		errs = append(errs, pkg.FieldError{Field: "start_time", Message: "must be a time in HH:MM or HH:MM:SS format"})
+	}
+	end, endErr := pkg.ParseClock(endValue)
+	if endErr != nil {
+		errs = append(errs, pkg.FieldError{Field: "end_time", Message: "must be a time in HH:MM or HH:MM:SS format"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	startAt := pkg.AtClock(date, start, zone)
+	endAt := pkg.AtClock(date, end, zone)
+	if !endAt.After(startAt) {
+		if !overnight {
+			return []pkg.FieldError{{Field: "end_time", Message: "must be after start_time, set overnight for shifts ending the next day"}}
+		}
+		endAt = pkg.AtClock(date.AddDate(0, 0, 1), end, zone)
+	} else if in.Overnight != nil && *in.Overnight {
+		return []pkg.FieldError{{Field: "overnight", Message: "is only allowed when end_time is not after start_time"}}
+	}
+
+	shift.StartAt, shift.EndAt = startAt.UTC(), endAt.UTC()
+	return nil
+}
@@ -0,0 +1,129 @@
+package sso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+const stubKeyID = "stub-1"
+
+// StubIssuer is a minimal OpenID Connect provider for local development and tests.
+// It serves discovery and JWKS documents and mints ID tokens for any email it is asked for,
+// so it must never be enabled in production.
+type StubIssuer struct {
+	issuer   string
+	clientID string
+	key      *rsa.PrivateKey
+}
+
+// NewStubIssuer creates a stub issuer with a freshly generated signing key.
+// issuer must be the public URL the stub's Handler is mounted at.
+func NewStubIssuer(issuer string, clientID string) (*StubIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &StubIssuer{
+		issuer:   strings.TrimRight(issuer, "/"),
+		clientID: clientID,
+		key:      key,
+	}, nil
+}
+
+// StubTokenRequest asks the stub issuer for an ID token
+type StubTokenRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// Audience defaults to the configured client ID
+	Audience string `json:"audience,omitempty"`
+}
+
+// StubTokenResponse holds an ID token minted by the stub issuer
+type StubTokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// Handler serves the stub issuer's endpoints
+func (s *StubIssuer) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/.well-known/openid-configuration", s.discovery)
+	r.Get("/jwks", s.jwks)
+	r.Post("/token", s.token)
+	return r
+}
+
+// IssueIDToken mints a signed ID token for the given email
+func (s *StubIssuer) IssueIDToken(email string, name string, audience string) (string, error) {
+	if audience == "" {
+		audience = s.clientID
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.issuer,
+		"sub":            "stub|" + strings.ToLower(email),
+		"aud":            audience,
+		"email":          email,
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(10 * time.Minute).Unix(),
+	}
+	if name != "" {
+		claims["name"] = name
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = stubKeyID
+	return token.SignedString(s.key)
+}
+
+func (s *StubIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	pkg.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (s *StubIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	pkg.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": stubKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *StubIssuer) token(w http.ResponseWriter, r *http.Request) {
+	var req StubTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("email is required"))
+		return
+	}
+
+	idToken, err := s.IssueIDToken(req.Email, req.Name, req.Audience)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to issue id token"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, StubTokenResponse{IDToken: idToken})
+}
@@ -0,0 +1,112 @@
+package sso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// newStubServer serves a stub issuer whose issuer URL is the test server's own
+func newStubServer(t *testing.T) (*StubIssuer, *httptest.Server) {
+	t.Helper()
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	stub, err := NewStubIssuer(server.URL, "justpayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = stub.Handler()
+	return stub, server
+}
+
+func TestStubIssuerTokensVerify(t *testing.T) {
+	stub, server := newStubServer(t)
+	verifier := NewVerifier(pkg.OIDCConfig{IssuerURL: server.URL, ClientID: "justpayd"})
+
+	tests := []struct {
+		name      string
+		audience  string
+		wantError bool
+	}{
+		{name: "configured client", audience: ""},
+		{name: "same client named", audience: "justpayd"},
+		{name: "another client", audience: "someone-else", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idToken, err := stub.IssueIDToken("Worker@Example.com", "Worker", tt.audience)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := verifier.Verify(context.Background(), idToken)
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("Verify accepted a token for another audience")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Issuer != server.URL || identity.Subject != "stub|worker@example.com" {
+				t.Errorf("identity = %+v, want issuer %s and subject stub|worker@example.com", identity, server.URL)
+			}
+			if identity.Email != "Worker@Example.com" || !identity.EmailVerified || identity.Name != "Worker" {
+				t.Errorf("identity = %+v, want the verified email and name asked for", identity)
+			}
+		})
+	}
+}
+
+func TestStubIssuerTokenEndpoint(t *testing.T) {
+	_, server := newStubServer(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "email given", body: `{"email":"worker@example.com"}`, wantStatus: http.StatusOK},
+		{name: "email missing", body: `{"name":"Worker"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid json", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/token", "application/json", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var token StubTokenResponse
+			if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+				t.Fatal(err)
+			}
+			if token.IDToken == "" {
+				t.Error("no id_token in the response")
+			}
+		})
+	}
+}
+
+func TestDisabledVerifier(t *testing.T) {
+	if _, err := NewVerifier(pkg.OIDCConfig{}).Verify(context.Background(), "token"); err != ErrDisabled {
+		t.Errorf("err = %v, want ErrDisabled", err)
+	}
+}
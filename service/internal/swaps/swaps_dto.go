@@ -0,0 +1,133 @@
+package swaps
+
+import (
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// Possible status values for shift swaps
+const (
+	// StatusOpen is an offer waiting for a colleague to take it
+	StatusOpen = "open"
+	// StatusProposed is a colleague offering one of their shifts in return, waiting for the
+	// worker who made the offer to agree
+	StatusProposed = "proposed"
+	// StatusAccepted is a swap both workers agreed to, waiting for an admin to approve it
+	StatusAccepted  = "accepted"
+	StatusCompleted = "completed"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+)
+
+// Kinds of shift swaps
+const (
+	// KindGiveAway hands the shift over without anything in return
+	KindGiveAway = "give_away"
+	// KindSwap exchanges the shift for one of the taker's
+	KindSwap = "swap"
+)
+
+// Actions recorded in the history of a swap
+const (
+	ActionOffered   = "offered"
+	ActionProposed  = "proposed"
+	ActionAccepted  = "accepted"
+	ActionDeclined  = "declined"
+	ActionCancelled = "cancelled"
+	ActionApproved  = "approved"
+	ActionRejected  = "rejected"
+	ActionCompleted = "completed"
+)
+
+// SwapShift is an assigned shift changing hands in a swap
+type SwapShift struct {
+	AssignmentID int    `json:"assignment_id"`
+	ShiftID      int    `json:"shift_id"`
+	Role         string `json:"role"`
+	// The shift's schedule, in the zone of its location
+	pkg.Schedule
+}
+
+type SwapResponse struct {
+	ID     int    `json:"id"`
+	Kind   string `json:"kind" example:"give_away"`
+	Status string `json:"status" example:"open"`
+	// Shift is offered by OfferedBy and goes to TakenBy
+	Shift         SwapShift `json:"shift"`
+	OfferedBy     int       `json:"offered_by"`
+	OfferedByName string    `json:"offered_by_name"`
+	// OfferedTo is the only colleague who can take the offer, anyone eligible can when nil
+	OfferedTo   *int   `json:"offered_to"`
+	TakenBy     *int   `json:"taken_by"`
+	TakenByName string `json:"taken_by_name,omitempty"`
+	// CounterShift is offered by TakenBy in return and goes to OfferedBy, nil for a give-away
+	CounterShift *SwapShift `json:"counter_shift,omitempty"`
+	Note         string     `json:"note"`
+	// Reason is why an admin rejected the swap
+	Reason     string     `json:"reason,omitempty"`
+	ReviewedBy *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// Events is what happened to the swap, oldest first. It is only filled in when getting a
+	// single swap.
+	Events []SwapEvent `json:"events,omitempty"`
+}
+
+// In renders the swap's times in loc. A nil loc keeps the zone of each shift's location.
+func (s *SwapResponse) In(loc *time.Location) {
+	s.Shift.In(loc)
+	if s.CounterShift != nil {
+		s.CounterShift.In(loc)
+	}
+}
+
+// In renders the shift's times in loc. A nil loc keeps the zone of the shift's location.
+func (s *SwapShift) In(loc *time.Location) {
+	if loc == nil {
+		loc, _ = pkg.LoadTimeZone(s.TimeZone)
+	}
+	s.Schedule.In(loc)
+}
+
+// IsParty reports whether the user offered, took or was offered the swap
+func (s *SwapResponse) IsParty(userID int) bool {
+	return s.OfferedBy == userID ||
+		(s.TakenBy != nil && *s.TakenBy == userID) ||
+		(s.OfferedTo != nil && *s.OfferedTo == userID)
+}
+
+// SwapEvent is a step in the history of a swap
+type SwapEvent struct {
+	Action    string    `json:"action" example:"offered"`
+	ActorID   int       `json:"actor_id"`
+	ActorName string    `json:"actor_name"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OfferSwapRequest struct {
+	AssignmentID int `json:"assignment_id"`
+	// OfferedTo limits the offer to one colleague
+	OfferedTo *int   `json:"offered_to"`
+	Note      string `json:"note" example:"Family dinner, happy to take one of your weekend shifts"`
+}
+
+// AcceptSwapRequest takes an offer. Giving AssignmentID proposes that shift in return
+// instead, which the worker who made the offer has to agree to.
+type AcceptSwapRequest struct {
+	AssignmentID *int   `json:"assignment_id"`
+	Note         string `json:"note"`
+}
+
+type RejectSwapRequest struct {
+	Reason string `json:"reason" example:"Not enough cooks on the weekend"`
+}
+
+// SwapFilter is a list query narrowed further by status. Its user filter matches both
+// workers of a swap.
+type SwapFilter struct {
+	pkg.ListQuery
+	Status string
+}
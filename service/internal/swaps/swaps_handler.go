@@ -0,0 +1,465 @@
+package swaps
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/afrianjunior/justpayd/internal/assignments"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type SwapHandler struct {
+	SwapService SwapService
+	logger      *zap.SugaredLogger
+}
+
+func NewSwapHandler(swapService SwapService, logger *zap.SugaredLogger) *SwapHandler {
+	return &SwapHandler{
+		SwapService: swapService,
+		logger:      logger,
+	}
+}
+
+func (h *SwapHandler) RegisterRoutes(r chi.Router) {
+	// Everyone can look up a swap, the service hides those the caller isn't part of
+	r.Get("/{id}", h.GetSwap)
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermSwapsCreate))
+		r.Post("/", h.OfferSwap)
+		r.Get("/mine", h.GetMySwaps)
+		r.Get("/open", h.GetOpenSwaps)
+		r.Put("/accept/{id}", h.AcceptSwap)
+		r.Put("/confirm/{id}", h.ConfirmSwap)
+		r.Put("/decline/{id}", h.DeclineSwap)
+		r.Put("/cancel/{id}", h.CancelSwap)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermSwapsReview))
+		r.Get("/", h.GetSwaps)
+		r.Put("/approve/{id}", h.ApproveSwap)
+		r.Put("/reject/{id}", h.RejectSwap)
+	})
+}
+
+// OfferSwap godoc
+// @Summary Offer a shift
+// @Description Worker offers one of their upcoming assigned shifts to their colleagues, or only to the one in offered_to. Colleagues can take it as it is or propose one of their shifts in return.
+// @Tags swaps
+// @Accept json
+// @Produce json
+// @Param payload body OfferSwapRequest true "Shift to offer"
+// @Success 201 {object} pkg.BaseResponse{data=SwapResponse} "Shift offered successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker, or not the caller's shift"
+// @Failure 404 {object} pkg.BaseResponse "Assignment not found"
+// @Failure 409 {object} pkg.BaseResponse "The shift has started or is already on offer"
+// @Failure 422 {object} pkg.BaseResponse "Invalid offer, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps [post]
+func (h *SwapHandler) OfferSwap(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+
+	var payload OfferSwapRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	swap, err := h.SwapService.OfferSwap(r.Context(), userID, &payload)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Assignment not found"))
+			return
+		}
+		h.writeError(w, err, "Failed to offer the shift")
+		return
+	}
+	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(swap))
+}
+
+// GetSwaps godoc
+// @Summary List all swaps
+// @Description Admin lists shift swaps a page at a time. The shared filters apply to the offered shift.
+// @Tags swaps
+// @Produce json
+// @Param status query string false "Filter by status (open, proposed, accepted, completed, rejected, cancelled)"
+// @Param user_id query int false "Only swaps offered or taken by this user"
+// @Param from query string false "First day of the offered shift, YYYY-MM-DD in the zone of its location"
+// @Param to query string false "Last day of the offered shift, YYYY-MM-DD in the zone of its location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param sort query string false "created_at, start_at or id, prefixed with - for descending" default(-created_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=[]SwapResponse} "Successfully retrieved swaps"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps [get]
+func (h *SwapHandler) GetSwaps(w http.ResponseWriter, r *http.Request) {
+	h.writeSwaps(w, r, nil)
+}
+
+// GetMySwaps godoc
+// @Summary List my swaps
+// @Description Worker lists the swaps they offered or took, a page at a time
+// @Tags swaps
+// @Produce json
+// @Param status query string false "Filter by status (open, proposed, accepted, completed, rejected, cancelled)"
+// @Param from query string false "First day of the offered shift, YYYY-MM-DD in the zone of its location"
+// @Param to query string false "Last day of the offered shift, YYYY-MM-DD in the zone of its location"
+// @Param sort query string false "created_at, start_at or id, prefixed with - for descending" default(-created_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=[]SwapResponse} "Successfully retrieved swaps"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/mine [get]
+func (h *SwapHandler) GetMySwaps(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	h.writeSwaps(w, r, &userID)
+}
+
+// writeSwaps lists swaps, only those of the user when userID is set
+func (h *SwapHandler) writeSwaps(w http.ResponseWriter, r *http.Request, userID *int) {
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+	if userID != nil {
+		q.UserID = userID
+	}
+	filter := &SwapFilter{ListQuery: *q, Status: r.URL.Query().Get("status")}
+
+	swaps, page, err := h.SwapService.GetSwaps(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err, "Failed to retrieve swaps")
+		return
+	}
+	for i := range swaps {
+		swaps[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(swaps, page))
+}
+
+// GetOpenSwaps godoc
+// @Summary List offers I can take
+// @Description Worker lists the open offers of their colleagues for upcoming shifts, made to anyone or to them, for roles they have worked before
+// @Tags swaps
+// @Produce json
+// @Param from query string false "First day of the offered shift, YYYY-MM-DD in the zone of its location"
+// @Param to query string false "Last day of the offered shift, YYYY-MM-DD in the zone of its location"
+// @Param location_id query int false "Only shifts at this location"
+// @Param role query string false "Only shifts for this role"
+// @Param sort query string false "created_at, start_at or id, prefixed with - for descending" default(-created_at)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=[]SwapResponse} "Successfully retrieved the offers"
+// @Failure 400 {object} pkg.BaseResponse "Unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/open [get]
+func (h *SwapHandler) GetOpenSwaps(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	swaps, page, err := h.SwapService.GetOpenSwaps(r.Context(), userID, q)
+	if err != nil {
+		h.writeError(w, err, "Failed to retrieve the offers")
+		return
+	}
+	for i := range swaps {
+		swaps[i].In(tz)
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(swaps, page))
+}
+
+// GetSwap godoc
+// @Summary Get a swap
+// @Description Gets a swap with its history. Workers can get the swaps they are part of and the open offers made to anyone, admins any swap.
+// @Tags swaps
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Param tz query string false "IANA time zone to render times in, defaults to the zone of each shift's location"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Successfully retrieved the swap"
+// @Failure 400 {object} pkg.BaseResponse "Invalid swap ID or unknown time zone"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/{id} [get]
+func (h *SwapHandler) GetSwap(w http.ResponseWriter, r *http.Request) {
+	user, ok := pkg.GetUserFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid swap ID"))
+		return
+	}
+	tz, err := pkg.TimeZoneFromRequest(r)
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse(err.Error()))
+		return
+	}
+
+	swap, err := h.SwapService.GetSwap(r.Context(), id, user)
+	if err != nil {
+		h.writeError(w, err, "Failed to retrieve the swap")
+		return
+	}
+	swap.In(tz)
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(swap))
+}
+
+// AcceptSwap godoc
+// @Summary Take an offer
+// @Description Worker takes an open offer as it is, or proposes one of their upcoming shifts in return by giving assignment_id. Taking it accepts the swap, a proposal waits for the worker who made the offer. Both workers must have worked the role of the shift they get, and be free and available for it. Accepted swaps are applied right away unless they need an admin's approval.
+// @Tags swaps
+// @Accept json
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Param payload body AcceptSwapRequest false "Shift proposed in return"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Offer taken successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload or swap ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker, or a worker hasn't worked the role"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 409 {object} pkg.BaseResponse "The swap is no longer open, or a worker has conflicts listed in conflicts"
+// @Failure 422 {object} pkg.BaseResponse "Invalid assignment, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/accept/{id} [put]
+func (h *SwapHandler) AcceptSwap(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.actorAndID(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional, an empty one takes the shift as it is
+	var payload AcceptSwapRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	swap, err := h.SwapService.AcceptSwap(r.Context(), id, userID, &payload)
+	h.writeSwap(w, swap, err, "Failed to take the offer")
+}
+
+// ConfirmSwap godoc
+// @Summary Agree to a proposal
+// @Description Worker who made the offer agrees to the shift a colleague proposed in return. The swap is applied right away unless it needs an admin's approval.
+// @Tags swaps
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Proposal accepted successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid swap ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 409 {object} pkg.BaseResponse "There is no proposal, or a worker has conflicts listed in conflicts"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/confirm/{id} [put]
+func (h *SwapHandler) ConfirmSwap(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.actorAndID(w, r)
+	if !ok {
+		return
+	}
+	swap, err := h.SwapService.ConfirmSwap(r.Context(), id, userID)
+	h.writeSwap(w, swap, err, "Failed to accept the proposal")
+}
+
+// DeclineSwap godoc
+// @Summary Decline a proposal
+// @Description Worker who made the offer turns down the shift a colleague proposed in return, the offer is open again
+// @Tags swaps
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Proposal declined successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid swap ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 409 {object} pkg.BaseResponse "There is no proposal to answer"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/decline/{id} [put]
+func (h *SwapHandler) DeclineSwap(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.actorAndID(w, r)
+	if !ok {
+		return
+	}
+	swap, err := h.SwapService.DeclineSwap(r.Context(), id, userID)
+	h.writeSwap(w, swap, err, "Failed to decline the proposal")
+}
+
+// CancelSwap godoc
+// @Summary Withdraw an offer
+// @Description Worker withdraws their offer, as long as it hasn't been applied or rejected
+// @Tags swaps
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Offer withdrawn successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid swap ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not a worker"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 409 {object} pkg.BaseResponse "The swap is already completed, rejected or cancelled"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/cancel/{id} [put]
+func (h *SwapHandler) CancelSwap(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.actorAndID(w, r)
+	if !ok {
+		return
+	}
+	swap, err := h.SwapService.CancelSwap(r.Context(), id, userID)
+	h.writeSwap(w, swap, err, "Failed to withdraw the offer")
+}
+
+// ApproveSwap godoc
+// @Summary Approve a swap
+// @Description Admin approves a swap both workers agreed to. The shifts change hands in one transaction and each hand-over is kept in the assignment's history.
+// @Tags swaps
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Param force query bool false "Approve despite the workers' conflicts, the override is recorded"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Swap approved successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid swap ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 409 {object} pkg.BaseResponse "The swap isn't accepted, a shift was reassigned or has started, or a worker has conflicts listed in conflicts"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/approve/{id} [put]
+func (h *SwapHandler) ApproveSwap(w http.ResponseWriter, r *http.Request) {
+	reviewerID, id, ok := h.actorAndID(w, r)
+	if !ok {
+		return
+	}
+	override, err := assignments.OverrideFromRequest(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+
+	swap, err := h.SwapService.ApproveSwap(r.Context(), id, reviewerID, override)
+	h.writeSwap(w, swap, err, "Failed to approve the swap")
+}
+
+// RejectSwap godoc
+// @Summary Reject a swap
+// @Description Admin rejects a swap both workers agreed to, optionally telling them why. Both keep their shifts.
+// @Tags swaps
+// @Accept json
+// @Produce json
+// @Param id path int true "Swap ID"
+// @Param payload body RejectSwapRequest false "Reason for the rejection"
+// @Success 200 {object} pkg.BaseResponse{data=SwapResponse} "Swap rejected successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload or swap ID"
+// @Failure 401 {object} pkg.BaseResponse "Unauthorized"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "Swap not found"
+// @Failure 409 {object} pkg.BaseResponse "The swap isn't accepted"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /swaps/reject/{id} [put]
+func (h *SwapHandler) RejectSwap(w http.ResponseWriter, r *http.Request) {
+	reviewerID, id, ok := h.actorAndID(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional, an empty one rejects without a reason
+	var payload RejectSwapRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	swap, err := h.SwapService.RejectSwap(r.Context(), id, reviewerID, &payload)
+	h.writeSwap(w, swap, err, "Failed to reject the swap")
+}
+
+// actorAndID reads the authenticated user and the swap ID of the path, writing the error
+// response when either is missing
+func (h *SwapHandler) actorAndID(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return 0, 0, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid swap ID"))
+		return 0, 0, false
+	}
+	return userID, id, true
+}
+
+func (h *SwapHandler) writeSwap(w http.ResponseWriter, swap *SwapResponse, err error, failure string) {
+	if err != nil {
+		h.writeError(w, err, failure)
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(swap))
+}
+
+func (h *SwapHandler) writeError(w http.ResponseWriter, err error, failure string) {
+	if errors.Is(err, pkg.ErrNotFound) {
+		pkg.WriteJSON(w, http.StatusNotFound, pkg.NewErrorResponse("Swap not found"))
+		return
+	}
+	if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+	h.logger.Errorf("%s: %v", failure, err)
+	pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse(failure))
+}
@@ -0,0 +1,339 @@
+package swaps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/pkg"
+)
+
+// SwapRepository defines the interface for shift swap data operations
+type SwapRepository interface {
+	CreateSwap(ctx context.Context, offeredBy int, req *OfferSwapRequest) (int, error)
+	GetSwaps(ctx context.Context, filter *SwapFilter) ([]SwapResponse, *pkg.Pagination, error)
+	GetOpenSwaps(ctx context.Context, userID int, since time.Time, q *pkg.ListQuery) ([]SwapResponse, *pkg.Pagination, error)
+	GetSwapByID(ctx context.Context, id int) (*SwapResponse, error)
+	UpdateSwap(ctx context.Context, swap *SwapResponse, fromStatus string) error
+	AddEvent(ctx context.Context, swapID int, action string, actorID int, note string) error
+	GetEvents(ctx context.Context, swapID int) ([]SwapEvent, error)
+	HasWorkedRole(ctx context.Context, userID int, role string) (bool, error)
+}
+
+type swapRepository struct {
+	db *sql.DB
+}
+
+// NewSwapRepository creates a new instance of SwapRepository
+func NewSwapRepository(db *sql.DB) SwapRepository {
+	return &swapRepository{db: db}
+}
+
+const swapQuery = `
+		SELECT
+			sw.id,
+			sw.status,
+			sw.assignment_id,
+			a.shift_id,
+			s.role,
+			s.start_at,
+			s.end_at,
+			COALESCE(l.time_zone, 'UTC') as time_zone,
+			sw.offered_by,
+			ou.name as offered_by_name,
+			sw.offered_to,
+			sw.taken_by,
+			COALESCE(tu.name, '') as taken_by_name,
+			sw.counter_assignment_id,
+			ca.shift_id,
+			cs.role,
+			cs.start_at,
+			cs.end_at,
+			COALESCE(cl.time_zone, 'UTC') as counter_time_zone,
+			sw.note,
+			COALESCE(sw.reason, '') as reason,
+			sw.reviewed_by,
+			sw.reviewed_at,
+			sw.created_at,
+			sw.updated_at
+		FROM shift_swaps sw
+		JOIN assignments a ON sw.assignment_id = a.id
+		JOIN shifts s ON a.shift_id = s.id
+		LEFT JOIN locations l ON s.location_id = l.id
+		JOIN users ou ON sw.offered_by = ou.id
+		LEFT JOIN users tu ON sw.taken_by = tu.id
+		LEFT JOIN assignments ca ON sw.counter_assignment_id = ca.id
+		LEFT JOIN shifts cs ON ca.shift_id = cs.id
+		LEFT JOIN locations cl ON cs.location_id = cl.id
+	`
+
+// swapList applies list queries to swapQuery, filtering on the offered shift. The user
+// filter is applied by GetSwaps as it matches either worker.
+var swapList = &pkg.ListSpec[SwapResponse]{
+	Sorts: map[string]pkg.SortKey[SwapResponse]{
+		"created_at": {Column: "sw.created_at", Value: func(s *SwapResponse) interface{} { return pkg.FormatTimestamp(s.CreatedAt) }},
+		"start_at":   {Column: "s.start_at", Value: func(s *SwapResponse) interface{} { return pkg.FormatTimestamp(s.Shift.StartAt) }},
+		"id":         {Column: "sw.id", Value: func(s *SwapResponse) interface{} { return s.ID }},
+	},
+	DefaultSort: "created_at",
+	DefaultDesc: true,
+	IDColumn:    "sw.id",
+	ID:          func(s *SwapResponse) int { return s.ID },
+	Date:        "s.date",
+	Location:    "s.location_id",
+	Role:        "s.role",
+}
+
+func (r *swapRepository) CreateSwap(ctx context.Context, offeredBy int, req *OfferSwapRequest) (int, error) {
+	query := `
+		INSERT INTO shift_swaps (assignment_id, offered_by, offered_to, note, status)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, req.AssignmentID, offeredBy, req.OfferedTo, req.Note, StatusOpen)
+	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return 0, pkg.NewConflictError("the shift is already on offer")
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *swapRepository) GetSwaps(ctx context.Context, filter *SwapFilter) ([]SwapResponse, *pkg.Pagination, error) {
+	var args []interface{}
+	where := []string{}
+
+	if filter.Status != "" {
+		where = append(where, "sw.status = ?")
+		args = append(args, filter.Status)
+	}
+	q := filter.ListQuery
+	if q.UserID != nil {
+		where = append(where, "(sw.offered_by = ? OR sw.taken_by = ?)")
+		args = append(args, *q.UserID, *q.UserID)
+		q.UserID = nil
+	}
+
+	return r.listSwaps(ctx, &q, where, args)
+}
+
+// GetOpenSwaps lists the offers starting after since that the user can take: open offers
+// of other workers, made to anyone or to the user, for a role the user has been assigned
+// before
+func (r *swapRepository) GetOpenSwaps(ctx context.Context, userID int, since time.Time, q *pkg.ListQuery) ([]SwapResponse, *pkg.Pagination, error) {
+	where := []string{
+		"sw.status = ?",
+		"sw.offered_by <> ?",
+		"(sw.offered_to IS NULL OR sw.offered_to = ?)",
+		"s.start_at > ?",
+		`LOWER(s.role) IN (
+			SELECT LOWER(ps.role) FROM assignments pa JOIN shifts ps ON pa.shift_id = ps.id
+			WHERE pa.user_id = ? AND pa.status = 'active'
+		)`,
+	}
+	args := []interface{}{StatusOpen, userID, userID, pkg.FormatTimestamp(since), userID}
+	return r.listSwaps(ctx, q, where, args)
+}
+
+func (r *swapRepository) listSwaps(ctx context.Context, q *pkg.ListQuery, where []string, args []interface{}) ([]SwapResponse, *pkg.Pagination, error) {
+	clause, args, err := swapList.Build(q, where, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, swapQuery+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var swaps []SwapResponse
+	for rows.Next() {
+		swap, err := scanSwap(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		swaps = append(swaps, *swap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	swaps, page := swapList.Page(q, swaps)
+	return swaps, page, nil
+}
+
+// GetSwapByID returns pkg.ErrNotFound when there is no swap with the ID
+func (r *swapRepository) GetSwapByID(ctx context.Context, id int) (*SwapResponse, error) {
+	return scanSwap(pkg.Conn(ctx, r.db).QueryRowContext(ctx, swapQuery+" WHERE sw.id = ?", id))
+}
+
+// UpdateSwap saves the status, taker, counter shift and review of the swap, provided it is
+// still in fromStatus. A swap that moved on in the meantime is reported as a conflict.
+func (r *swapRepository) UpdateSwap(ctx context.Context, swap *SwapResponse, fromStatus string) error {
+	query := `
+		UPDATE shift_swaps
+		SET status = ?, taken_by = ?, counter_assignment_id = ?, reason = ?, reviewed_by = ?, reviewed_at = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`
+
+	var counterAssignmentID *int
+	if swap.CounterShift != nil {
+		counterAssignmentID = &swap.CounterShift.AssignmentID
+	}
+	var reason, reviewedAt *string
+	if swap.Reason != "" {
+		reason = &swap.Reason
+	}
+	if swap.ReviewedAt != nil {
+		formatted := pkg.FormatTimestamp(*swap.ReviewedAt)
+		reviewedAt = &formatted
+	}
+
+	result, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query,
+		swap.Status, swap.TakenBy, counterAssignmentID, reason, swap.ReviewedBy, reviewedAt,
+		pkg.FormatTimestamp(time.Now()), swap.ID, fromStatus)
+	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return pkg.NewConflictError("the shift is already on offer")
+		}
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return pkg.NewConflictError("the swap has changed in the meantime, reload it and try again")
+	}
+	return nil
+}
+
+func (r *swapRepository) AddEvent(ctx context.Context, swapID int, action string, actorID int, note string) error {
+	query := `
+		INSERT INTO shift_swap_events (swap_id, action, actor_id, note)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, query, swapID, action, actorID, note)
+	return err
+}
+
+// GetEvents lists what happened to the swap, oldest first
+func (r *swapRepository) GetEvents(ctx context.Context, swapID int) ([]SwapEvent, error) {
+	query := `
+		SELECT e.action, e.actor_id, u.name, e.note, e.created_at
+		FROM shift_swap_events e
+		JOIN users u ON e.actor_id = u.id
+		WHERE e.swap_id = ?
+		ORDER BY e.created_at, e.id
+	`
+
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, swapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []SwapEvent
+	for rows.Next() {
+		var event SwapEvent
+		if err := rows.Scan(&event.Action, &event.ActorID, &event.ActorName, &event.Note, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// HasWorkedRole reports whether the user has been assigned a shift for the role before
+func (r *swapRepository) HasWorkedRole(ctx context.Context, userID int, role string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM assignments a JOIN shifts s ON a.shift_id = s.id
+			WHERE a.user_id = ? AND a.status = 'active' AND LOWER(s.role) = LOWER(?)
+		)
+	`
+	var worked bool
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, query, userID, role).Scan(&worked)
+	return worked, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSwap reads a row of swapQuery, rendering its times in the zone of each shift's location
+func scanSwap(row rowScanner) (*SwapResponse, error) {
+	var swap SwapResponse
+	var startAt, endAt time.Time
+	var timeZone, counterTimeZone string
+	var offeredTo, takenBy, counterAssignmentID, counterShiftID, reviewedBy sql.NullInt64
+	var counterRole sql.NullString
+	var counterStartAt, counterEndAt, reviewedAt sql.NullTime
+
+	if err := row.Scan(
+		&swap.ID,
+		&swap.Status,
+		&swap.Shift.AssignmentID,
+		&swap.Shift.ShiftID,
+		&swap.Shift.Role,
+		&startAt,
+		&endAt,
+		&timeZone,
+		&swap.OfferedBy,
+		&swap.OfferedByName,
+		&offeredTo,
+		&takenBy,
+		&swap.TakenByName,
+		&counterAssignmentID,
+		&counterShiftID,
+		&counterRole,
+		&counterStartAt,
+		&counterEndAt,
+		&counterTimeZone,
+		&swap.Note,
+		&swap.Reason,
+		&reviewedBy,
+		&reviewedAt,
+		&swap.CreatedAt,
+		&swap.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+
+	swap.Kind = KindGiveAway
+	swap.Shift.Schedule = pkg.NewSchedule(startAt, endAt, timeZone)
+	swap.OfferedTo = nullableID(offeredTo)
+	swap.TakenBy = nullableID(takenBy)
+	swap.ReviewedBy = nullableID(reviewedBy)
+	if counterAssignmentID.Valid {
+		swap.Kind = KindSwap
+		swap.CounterShift = &SwapShift{
+			AssignmentID: int(counterAssignmentID.Int64),
+			ShiftID:      int(counterShiftID.Int64),
+			Role:         counterRole.String,
+			Schedule:     pkg.NewSchedule(counterStartAt.Time, counterEndAt.Time, counterTimeZone),
+		}
+	}
+	if reviewedAt.Valid {
+		swap.ReviewedAt = &reviewedAt.Time
+	}
+	return &swap, nil
+}
+
+func nullableID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	value := int(id.Int64)
+	return &value
+}
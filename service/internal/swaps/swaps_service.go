@@ -0,0 +1,530 @@
+package swaps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afrianjunior/justpayd/internal/assignments"
+	"github.com/afrianjunior/justpayd/internal/availability"
+	"github.com/afrianjunior/justpayd/internal/pkg"
+	"github.com/afrianjunior/justpayd/internal/users"
+)
+
+// SwapService defines the interface for shift swap business logic. A swap starts open when
+// a worker offers one of their assigned shifts. A colleague either takes it, which accepts
+// it, or proposes one of their own shifts in return, which the worker who made the offer
+// confirms or declines. Accepted swaps are applied right away, or once an admin approves
+// them when swaps require approval.
+type SwapService interface {
+	OfferSwap(ctx context.Context, userID int, req *OfferSwapRequest) (*SwapResponse, error)
+	GetSwaps(ctx context.Context, filter *SwapFilter) ([]SwapResponse, *pkg.Pagination, error)
+	GetOpenSwaps(ctx context.Context, userID int, q *pkg.ListQuery) ([]SwapResponse, *pkg.Pagination, error)
+	GetSwap(ctx context.Context, id int, user *pkg.User) (*SwapResponse, error)
+	AcceptSwap(ctx context.Context, id int, userID int, req *AcceptSwapRequest) (*SwapResponse, error)
+	ConfirmSwap(ctx context.Context, id int, userID int) (*SwapResponse, error)
+	DeclineSwap(ctx context.Context, id int, userID int) (*SwapResponse, error)
+	CancelSwap(ctx context.Context, id int, userID int) (*SwapResponse, error)
+	ApproveSwap(ctx context.Context, id int, reviewerID int, override *assignments.Override) (*SwapResponse, error)
+	RejectSwap(ctx context.Context, id int, reviewerID int, req *RejectSwapRequest) (*SwapResponse, error)
+}
+
+type swapService struct {
+	swapRepository       SwapRepository
+	assignmentRepository assignments.AssignmentRepository
+	userRepository       users.UserRepository
+	availabilityService  availability.AvailabilityService
+	requestReleaser      assignments.RequestReleaser
+	unitOfWork           pkg.UnitOfWork
+	config               *pkg.Config
+}
+
+// NewSwapService creates a new instance of SwapService
+func NewSwapService(
+	swapRepository SwapRepository,
+	assignmentRepository assignments.AssignmentRepository,
+	userRepository users.UserRepository,
+	availabilityService availability.AvailabilityService,
+	requestReleaser assignments.RequestReleaser,
+	unitOfWork pkg.UnitOfWork,
+	config *pkg.Config,
+) SwapService {
+	return &swapService{
+		swapRepository:       swapRepository,
+		assignmentRepository: assignmentRepository,
+		userRepository:       userRepository,
+		availabilityService:  availabilityService,
+		requestReleaser:      requestReleaser,
+		unitOfWork:           unitOfWork,
+		config:               config,
+	}
+}
+
+// OfferSwap offers one of the user's upcoming shifts to their colleagues, or to the one in
+// req.OfferedTo
+func (s *swapService) OfferSwap(ctx context.Context, userID int, req *OfferSwapRequest) (*SwapResponse, error) {
+	req.Note = strings.TrimSpace(req.Note)
+
+	var errs []pkg.FieldError
+	if req.AssignmentID <= 0 {
+		errs = append(errs, pkg.FieldError{Field: "assignment_id", Message: "is required"})
+	}
+	if req.OfferedTo != nil {
+		if err := s.checkColleague(ctx, userID, *req.OfferedTo); err != nil {
+			errs = append(errs, pkg.FieldError{Field: "offered_to", Message: err.Error()})
+		}
+	}
+	if len(req.Note) > 500 {
+		errs = append(errs, pkg.FieldError{Field: "note", Message: "cannot be longer than 500 characters"})
+	}
+	if len(errs) > 0 {
+		return nil, pkg.NewFieldValidationError(errs)
+	}
+
+	if _, err := s.ownUpcomingAssignment(ctx, req.AssignmentID, userID); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		var err error
+		id, err = s.swapRepository.CreateSwap(ctx, userID, req)
+		if err != nil {
+			return err
+		}
+		return s.swapRepository.AddEvent(ctx, id, ActionOffered, userID, req.Note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+// checkColleague tells why an offer can't be made to the colleague, if it can't
+func (s *swapService) checkColleague(ctx context.Context, userID int, colleagueID int) error {
+	if colleagueID == userID {
+		return errors.New("cannot be yourself")
+	}
+	colleague, err := s.userRepository.GetUserByID(ctx, colleagueID)
+	if err != nil {
+		if errors.Is(err, pkg.ErrNotFound) {
+			return errors.New("must be an existing worker")
+		}
+		return err
+	}
+	if !colleague.IsActive() || !pkg.HasPermission(colleague.Role, pkg.PermSwapsCreate) {
+		return errors.New("must be an active worker")
+	}
+	return nil
+}
+
+// ownUpcomingAssignment returns the assignment, provided it is active, belongs to the user
+// and its shift hasn't started yet
+func (s *swapService) ownUpcomingAssignment(ctx context.Context, assignmentID int, userID int) (*assignments.AssignmentResponse, error) {
+	assignment, err := s.assignmentRepository.GetAssignmentByID(ctx, assignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment %d: %w", assignmentID, err)
+	}
+	if assignment == nil {
+		return nil, pkg.ErrNotFound
+	}
+	if assignment.UserID != userID {
+		return nil, pkg.NewForbiddenError("You can only swap your own shifts")
+	}
+	if !assignment.IsActive() {
+		return nil, pkg.NewConflictError("The assignment was " + assignment.Status)
+	}
+	if !assignment.StartAt.After(time.Now()) {
+		return nil, pkg.NewConflictError("The shift has already started")
+	}
+	return assignment, nil
+}
+
+func (s *swapService) GetSwaps(ctx context.Context, filter *SwapFilter) ([]SwapResponse, *pkg.Pagination, error) {
+	return s.swapRepository.GetSwaps(ctx, filter)
+}
+
+func (s *swapService) GetOpenSwaps(ctx context.Context, userID int, q *pkg.ListQuery) ([]SwapResponse, *pkg.Pagination, error) {
+	return s.swapRepository.GetOpenSwaps(ctx, userID, time.Now(), q)
+}
+
+// GetSwap returns the swap with its history. Workers only see the swaps they are part of
+// and the open offers made to anyone.
+func (s *swapService) GetSwap(ctx context.Context, id int, user *pkg.User) (*SwapResponse, error) {
+	swap, err := s.swapRepository.GetSwapByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	visible := pkg.HasPermission(user.Role, pkg.PermSwapsReview) ||
+		swap.IsParty(user.ID) ||
+		(swap.Status == StatusOpen && swap.OfferedTo == nil)
+	if !visible {
+		return nil, pkg.ErrNotFound
+	}
+
+	swap.Events, err = s.swapRepository.GetEvents(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the history of swap %d: %w", id, err)
+	}
+	return swap, nil
+}
+
+// AcceptSwap takes an open offer. Without an assignment in req the user takes the shift as
+// it is, otherwise they propose that shift of theirs in return.
+func (s *swapService) AcceptSwap(ctx context.Context, id int, userID int, req *AcceptSwapRequest) (*SwapResponse, error) {
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > 500 {
+		return nil, pkg.NewFieldValidationError([]pkg.FieldError{{Field: "note", Message: "cannot be longer than 500 characters"}})
+	}
+
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		swap, err := s.swapRepository.GetSwapByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if swap.Status != StatusOpen {
+			return pkg.NewConflictError("The swap is " + swap.Status + ", only open offers can be taken")
+		}
+		if swap.OfferedBy == userID {
+			return pkg.NewConflictError("You cannot take your own offer")
+		}
+		if swap.OfferedTo != nil && *swap.OfferedTo != userID {
+			return pkg.ErrNotFound
+		}
+		if !swap.Shift.StartAt.After(time.Now()) {
+			return pkg.NewConflictError("The shift has already started")
+		}
+		if err := s.checkRole(ctx, userID, swap.Shift.Role, "You haven't worked as "+swap.Shift.Role+" before"); err != nil {
+			return err
+		}
+		swap.TakenBy = &userID
+
+		if req.AssignmentID == nil {
+			if err := s.checkConflicts(ctx, swap); err != nil {
+				return err
+			}
+			swap.Status = StatusAccepted
+			if err := s.swapRepository.UpdateSwap(ctx, swap, StatusOpen); err != nil {
+				return err
+			}
+			if err := s.swapRepository.AddEvent(ctx, id, ActionAccepted, userID, req.Note); err != nil {
+				return err
+			}
+			return s.applyUnlessReviewed(ctx, swap, userID)
+		}
+
+		counter, err := s.ownUpcomingAssignment(ctx, *req.AssignmentID, userID)
+		if err != nil {
+			if errors.Is(err, pkg.ErrNotFound) {
+				return pkg.NewFieldValidationError([]pkg.FieldError{{Field: "assignment_id", Message: "must be one of your assignments"}})
+			}
+			return err
+		}
+		if err := s.checkRole(ctx, swap.OfferedBy, counter.Role, swap.OfferedByName+" hasn't worked as "+counter.Role+" before"); err != nil {
+			return err
+		}
+		swap.CounterShift = &SwapShift{AssignmentID: counter.ID, ShiftID: counter.ShiftID}
+		swap.Status = StatusProposed
+		if err := s.swapRepository.UpdateSwap(ctx, swap, StatusOpen); err != nil {
+			return err
+		}
+		return s.swapRepository.AddEvent(ctx, id, ActionProposed, userID, req.Note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+// checkRole refuses the swap with message when the worker has never been assigned the role
+func (s *swapService) checkRole(ctx context.Context, userID int, role string, message string) error {
+	worked, err := s.swapRepository.HasWorkedRole(ctx, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to check the roles of user %d: %w", userID, err)
+	}
+	if !worked {
+		return pkg.NewForbiddenError(message)
+	}
+	return nil
+}
+
+// ConfirmSwap agrees to the shift a colleague proposed in return for the offer
+func (s *swapService) ConfirmSwap(ctx context.Context, id int, userID int) (*SwapResponse, error) {
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		swap, err := s.proposalOf(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkConflicts(ctx, swap); err != nil {
+			return err
+		}
+		swap.Status = StatusAccepted
+		if err := s.swapRepository.UpdateSwap(ctx, swap, StatusProposed); err != nil {
+			return err
+		}
+		if err := s.swapRepository.AddEvent(ctx, id, ActionAccepted, userID, ""); err != nil {
+			return err
+		}
+		return s.applyUnlessReviewed(ctx, swap, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+// DeclineSwap turns down the shift a colleague proposed in return, opening the offer again
+func (s *swapService) DeclineSwap(ctx context.Context, id int, userID int) (*SwapResponse, error) {
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		swap, err := s.proposalOf(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		swap.Status = StatusOpen
+		swap.TakenBy = nil
+		swap.CounterShift = nil
+		if err := s.swapRepository.UpdateSwap(ctx, swap, StatusProposed); err != nil {
+			return err
+		}
+		return s.swapRepository.AddEvent(ctx, id, ActionDeclined, userID, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+// proposalOf returns the swap, provided the user made the offer and a colleague proposed a
+// shift in return
+func (s *swapService) proposalOf(ctx context.Context, id int, userID int) (*SwapResponse, error) {
+	swap, err := s.swapRepository.GetSwapByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if swap.OfferedBy != userID {
+		return nil, pkg.ErrNotFound
+	}
+	if swap.Status != StatusProposed {
+		return nil, pkg.NewConflictError("The swap is " + swap.Status + ", there is no proposal to answer")
+	}
+	return swap, nil
+}
+
+// CancelSwap withdraws an offer of the user that hasn't been applied yet
+func (s *swapService) CancelSwap(ctx context.Context, id int, userID int) (*SwapResponse, error) {
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		swap, err := s.swapRepository.GetSwapByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if swap.OfferedBy != userID {
+			return pkg.ErrNotFound
+		}
+		from := swap.Status
+		if from != StatusOpen && from != StatusProposed && from != StatusAccepted {
+			return pkg.NewConflictError("The swap is already " + from)
+		}
+		swap.Status = StatusCancelled
+		if err := s.swapRepository.UpdateSwap(ctx, swap, from); err != nil {
+			return err
+		}
+		return s.swapRepository.AddEvent(ctx, id, ActionCancelled, userID, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+// ApproveSwap applies an accepted swap. Conflicts arising since it was accepted block it
+// unless the admin overrides them.
+func (s *swapService) ApproveSwap(ctx context.Context, id int, reviewerID int, override *assignments.Override) (*SwapResponse, error) {
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		swap, err := s.acceptedSwap(ctx, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		swap.ReviewedBy, swap.ReviewedAt = &reviewerID, &now
+		if err := s.swapRepository.AddEvent(ctx, id, ActionApproved, reviewerID, ""); err != nil {
+			return err
+		}
+		return s.apply(ctx, swap, reviewerID, override)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+// RejectSwap turns down an accepted swap, both workers keep their shifts
+func (s *swapService) RejectSwap(ctx context.Context, id int, reviewerID int, req *RejectSwapRequest) (*SwapResponse, error) {
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		swap, err := s.acceptedSwap(ctx, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		swap.Status = StatusRejected
+		swap.Reason = strings.TrimSpace(req.Reason)
+		swap.ReviewedBy, swap.ReviewedAt = &reviewerID, &now
+		if err := s.swapRepository.UpdateSwap(ctx, swap, StatusAccepted); err != nil {
+			return err
+		}
+		return s.swapRepository.AddEvent(ctx, id, ActionRejected, reviewerID, swap.Reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.swapRepository.GetSwapByID(ctx, id)
+}
+
+func (s *swapService) acceptedSwap(ctx context.Context, id int) (*SwapResponse, error) {
+	swap, err := s.swapRepository.GetSwapByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if swap.Status != StatusAccepted {
+		return nil, pkg.NewConflictError("The swap is " + swap.Status + ", only accepted swaps can be reviewed")
+	}
+	return swap, nil
+}
+
+// applyUnlessReviewed applies a swap both workers just agreed to, unless an admin has to
+// approve it first
+func (s *swapService) applyUnlessReviewed(ctx context.Context, swap *SwapResponse, actorID int) error {
+	if s.config.Shifts.SwapRequiresApproval {
+		return nil
+	}
+	return s.apply(ctx, swap, actorID, nil)
+}
+
+// apply hands the shifts over and completes the swap, provided neither shift has started.
+// It must run in the unit of work that accepted or approved the swap, so either everything
+// changes or nothing does.
+func (s *swapService) apply(ctx context.Context, swap *SwapResponse, actorID int, override *assignments.Override) error {
+	shift, err := s.stillAssigned(ctx, swap.Shift.AssignmentID, swap.OfferedBy)
+	if err != nil {
+		return err
+	}
+	var counter *assignments.AssignmentResponse
+	if swap.CounterShift != nil {
+		if counter, err = s.stillAssigned(ctx, swap.CounterShift.AssignmentID, *swap.TakenBy); err != nil {
+			return err
+		}
+	}
+	// A swap approved late must not rewrite who worked a shift
+	now := time.Now()
+	if !shift.StartAt.After(now) || (counter != nil && !counter.StartAt.After(now)) {
+		return pkg.NewConflictError("A shift of the swap has already started")
+	}
+
+	if err := s.handOver(ctx, swap, shift, counter, *swap.TakenBy, actorID, override); err != nil {
+		return err
+	}
+	if counter != nil {
+		if err := s.handOver(ctx, swap, counter, shift, swap.OfferedBy, actorID, override); err != nil {
+			return err
+		}
+	}
+
+	swap.Status = StatusCompleted
+	if err := s.swapRepository.UpdateSwap(ctx, swap, StatusAccepted); err != nil {
+		return err
+	}
+	return s.swapRepository.AddEvent(ctx, swap.ID, ActionCompleted, actorID, "")
+}
+
+// stillAssigned returns the assignment, provided it is still active and belongs to the user
+func (s *swapService) stillAssigned(ctx context.Context, assignmentID int, userID int) (*assignments.AssignmentResponse, error) {
+	assignment, err := s.assignmentRepository.GetAssignmentByID(ctx, assignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment %d: %w", assignmentID, err)
+	}
+	if assignment == nil || !assignment.IsActive() || assignment.UserID != userID {
+		return nil, pkg.NewConflictError("A shift of the swap has been reassigned in the meantime")
+	}
+	return assignment, nil
+}
+
+// handOver gives the assignment to the user, who gives up the other one in return when
+// it is set, and records it in the assignment's history. The approved request of the
+// previous holder is unassigned, so they may request the shift again.
+func (s *swapService) handOver(ctx context.Context, swap *SwapResponse, assignment *assignments.AssignmentResponse, other *assignments.AssignmentResponse, toUserID int, actorID int, override *assignments.Override) error {
+	conflicts, err := s.conflictsOf(ctx, assignment, other, toUserID)
+	if err != nil {
+		return err
+	}
+	if err := assignments.ResolveConflicts(ctx, s.assignmentRepository, assignment.ShiftID, toUserID, conflicts, override); err != nil {
+		return err
+	}
+
+	if _, err := s.assignmentRepository.UpdateAssignment(ctx, assignment.ID, &assignments.UpdateAssignmentRequest{UserID: toUserID}); err != nil {
+		return fmt.Errorf("failed to hand over assignment %d: %w", assignment.ID, err)
+	}
+	if err := s.assignmentRepository.RecordHistory(ctx, &assignments.HistoryRecord{
+		AssignmentID: assignment.ID,
+		ShiftID:      assignment.ShiftID,
+		FromUserID:   assignment.UserID,
+		ToUserID:     toUserID,
+		ChangedBy:    actorID,
+		SwapID:       &swap.ID,
+	}); err != nil {
+		return err
+	}
+	return s.requestReleaser.ReleaseApprovedRequest(ctx, assignment.ShiftID, assignment.UserID, actorID, assignments.ReasonHandedOver)
+}
+
+// checkConflicts refuses a swap that would leave either worker with clashing shifts, or
+// working while unavailable. Workers can't override conflicts.
+func (s *swapService) checkConflicts(ctx context.Context, swap *SwapResponse) error {
+	shift, err := s.stillAssigned(ctx, swap.Shift.AssignmentID, swap.OfferedBy)
+	if err != nil {
+		return err
+	}
+	var counter *assignments.AssignmentResponse
+	if swap.CounterShift != nil {
+		if counter, err = s.stillAssigned(ctx, swap.CounterShift.AssignmentID, *swap.TakenBy); err != nil {
+			return err
+		}
+	}
+
+	conflicts, err := s.conflictsOf(ctx, shift, counter, *swap.TakenBy)
+	if err != nil {
+		return err
+	}
+	if counter != nil {
+		counterConflicts, err := s.conflictsOf(ctx, counter, shift, swap.OfferedBy)
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, counterConflicts...)
+	}
+	if len(conflicts) > 0 {
+		return pkg.NewScheduleConflictError(conflicts)
+	}
+	return nil
+}
+
+// conflictsOf lists what clashes with the user taking the assignment. The other assignment,
+// which the user gives up in the swap, doesn't count.
+func (s *swapService) conflictsOf(ctx context.Context, assignment *assignments.AssignmentResponse, other *assignments.AssignmentResponse, userID int) ([]pkg.ScheduleConflict, error) {
+	found, err := assignments.FindConflicts(ctx, s.assignmentRepository, userID, assignment.ShiftID, assignment.StartAt, assignment.EndAt, s.config.Shifts.MinRest())
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []pkg.ScheduleConflict
+	for _, conflict := range found {
+		if other == nil || conflict.ShiftID != other.ShiftID {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	unavailable, err := s.availabilityService.CheckAvailability(ctx, userID, assignment.StartAt, assignment.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	return append(conflicts, unavailable...), nil
+}
@@ -1,7 +1,24 @@
 package users
 
+import "github.com/afrianjunior/justpayd/internal/pkg"
+
 type CreateUserRequest struct {
 	Name  string `json:"name" binding:"required"`
 	Email string `json:"email" binding:"required,email"`
 	Role  string `json:"role" binding:"required"`
+	// Password is optional; users without one can only log in while email-only login is enabled
+	Password string `json:"password,omitempty"`
+}
+
+type UpdateUserRequest struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+	// Role can only be changed by admins
+	Role *string `json:"role"`
+}
+
+// UserFilter is a list query narrowed further by status
+type UserFilter struct {
+	pkg.ListQuery
+	Status string
 }
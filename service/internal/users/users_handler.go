@@ -3,6 +3,7 @@ package users
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
@@ -23,7 +24,17 @@ func NewUserHandler(userService UserService, logger *zap.SugaredLogger) *UserHan
 }
 
 func (h *UserHandler) RegisterRoutes(r chi.Router) {
-	r.Post("/", h.CreateUser)
+	r.Group(func(r chi.Router) {
+		r.Use(pkg.RequirePermission(pkg.PermUsersManage))
+		r.Post("/", h.CreateUser)
+		r.Get("/", h.ListUsers)
+		r.Put("/{id}/deactivate", h.DeactivateUser)
+		r.Put("/{id}/activate", h.ActivateUser)
+	})
+
+	// Users can read and update their own profile, admins can do so for anyone
+	r.Get("/{id}", h.GetUserByID)
+	r.Put("/{id}", h.UpdateUser)
 }
 
 // @Summary Create a new user
@@ -34,6 +45,8 @@ func (h *UserHandler) RegisterRoutes(r chi.Router) {
 // @Param payload body CreateUserRequest true "User information"
 // @Success 200 {object} pkg.BaseResponse "User created successfully"
 // @Failure 400 {object} pkg.BaseResponse "Invalid request payload"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 409 {object} pkg.BaseResponse "Email is already in use"
 // @Failure 500 {object} pkg.BaseResponse "Internal server error"
 // @Router /users [post]
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -43,11 +56,214 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.UserService.CreateUser(&payload)
+	err := h.UserService.CreateUser(r.Context(), &payload)
 	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error creating user: %v", err)
 		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to create user"))
 		return
 	}
 
+	// Never echo the password back
+	payload.Password = ""
+
 	pkg.WriteJSON(w, http.StatusCreated, pkg.SuccessResponse(payload))
 }
+
+// @Summary List users
+// @Description Admin lists users a page at a time, optionally filtered by role and status
+// @Tags users
+// @Produce json
+// @Param role query string false "Filter by role (admin, worker)"
+// @Param status query string false "Filter by status (active, inactive)"
+// @Param sort query string false "name, email or id, prefixed with - for descending" default(id)
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} pkg.BaseResponse{data=[]pkg.User} "Successfully retrieved users"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 422 {object} pkg.BaseResponse "Invalid filter, sort or cursor, see errors for the fields"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /users [get]
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	q, err := pkg.ParseListQuery(r)
+	if err != nil {
+		status, response, _ := pkg.ErrorResponseFromError(err)
+		pkg.WriteJSON(w, status, response)
+		return
+	}
+	filter := &UserFilter{ListQuery: *q, Status: r.URL.Query().Get("status")}
+
+	users, page, err := h.UserService.ListUsers(r.Context(), filter)
+	if err != nil {
+		if status, response, ok := pkg.ErrorResponseFromError(err); ok {
+			pkg.WriteJSON(w, status, response)
+			return
+		}
+		h.logger.Errorf("Error listing users: %v", err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve users"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.PaginatedResponse(users, page))
+}
+
+// @Summary Get user
+// @Description Get a user by ID. Workers can only read their own profile.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} pkg.BaseResponse{data=pkg.User} "Successfully retrieved user"
+// @Failure 400 {object} pkg.BaseResponse "Invalid user ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden"
+// @Failure 404 {object} pkg.BaseResponse "User not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /users/{id} [get]
+func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorizedUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.UserService.GetUserByID(r.Context(), id)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error getting user %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to retrieve user"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(user))
+}
+
+// @Summary Update user
+// @Description Update a user's profile. Workers can only update their own name and email, admins can also change roles.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param payload body UpdateUserRequest true "User update payload"
+// @Success 200 {object} pkg.BaseResponse{data=pkg.User} "User updated successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid request payload or user ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden"
+// @Failure 404 {object} pkg.BaseResponse "User not found"
+// @Failure 409 {object} pkg.BaseResponse "Email is already in use"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /users/{id} [put]
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorizedUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid request payload: "+err.Error()))
+		return
+	}
+
+	actor, _ := pkg.GetUserFromContext(r.Context())
+	if payload.Role != nil && !pkg.HasPermission(actor.Role, pkg.PermUsersManage) {
+		pkg.WriteJSON(w, http.StatusForbidden, pkg.NewErrorResponse("You do not have permission to perform this action"))
+		return
+	}
+
+	user, err := h.UserService.UpdateUser(r.Context(), id, &payload)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error updating user %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to update user"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(user))
+}
+
+// @Summary Deactivate user
+// @Description Admin deactivates a user. Deactivated users cannot log in and their sessions are revoked.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} pkg.BaseResponse{data=pkg.User} "User deactivated successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid user ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "User not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /users/{id}/deactivate [put]
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid user ID"))
+		return
+	}
+	actor, _ := pkg.GetUserFromContext(r.Context())
+
+	user, err := h.UserService.DeactivateUser(r.Context(), actor.ID, id)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error deactivating user %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to deactivate user"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(user))
+}
+
+// @Summary Activate user
+// @Description Admin reactivates a previously deactivated user
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} pkg.BaseResponse{data=pkg.User} "User activated successfully"
+// @Failure 400 {object} pkg.BaseResponse "Invalid user ID"
+// @Failure 403 {object} pkg.BaseResponse "Forbidden - Not an admin"
+// @Failure 404 {object} pkg.BaseResponse "User not found"
+// @Failure 500 {object} pkg.BaseResponse "Internal server error"
+// @Router /users/{id}/activate [put]
+func (h *UserHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid user ID"))
+		return
+	}
+
+	user, err := h.UserService.ActivateUser(r.Context(), id)
+	if err != nil {
+		if status, msg, ok := pkg.StatusFromError(err); ok {
+			pkg.WriteJSON(w, status, pkg.NewErrorResponse(msg))
+			return
+		}
+		h.logger.Errorf("Error activating user %d: %v", id, err)
+		pkg.WriteJSON(w, http.StatusInternalServerError, pkg.NewErrorResponse("Failed to activate user"))
+		return
+	}
+	pkg.WriteJSON(w, http.StatusOK, pkg.SuccessResponse(user))
+}
+
+// authorizedUserID parses the {id} URL parameter and makes sure the caller may act on that user.
+// It writes the error response itself and returns false when the request must stop.
+func (h *UserHandler) authorizedUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.WriteJSON(w, http.StatusBadRequest, pkg.NewErrorResponse("Invalid user ID"))
+		return 0, false
+	}
+
+	actor, ok := pkg.GetUserFromContext(r.Context())
+	if !ok {
+		pkg.WriteJSON(w, http.StatusUnauthorized, pkg.NewErrorResponse("User not authenticated"))
+		return 0, false
+	}
+	if actor.ID != id && !pkg.HasPermission(actor.Role, pkg.PermUsersManage) {
+		pkg.WriteJSON(w, http.StatusForbidden, pkg.NewErrorResponse("You do not have permission to perform this action"))
+		return 0, false
+	}
+	return id, true
+}
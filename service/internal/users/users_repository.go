@@ -3,13 +3,18 @@ package users
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/afrianjunior/justpayd/internal/pkg"
 )
 
 type UserRepository interface {
-	CreateUser(user *CreateUserRequest) error
+	CreateUser(ctx context.Context, user *CreateUserRequest, passwordHash string) error
 	GetUserByEmail(ctx context.Context, email string) (*pkg.User, error)
+	GetUserByID(ctx context.Context, id int) (*pkg.User, error)
+	ListUsers(ctx context.Context, filter *UserFilter) ([]pkg.User, *pkg.Pagination, error)
+	UpdateUser(ctx context.Context, id int, req *UpdateUserRequest) (*pkg.User, error)
+	SetUserStatus(ctx context.Context, id int, status string) (*pkg.User, error)
 }
 
 type userRepository struct {
@@ -20,15 +25,24 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) CreateUser(payload *CreateUserRequest) error {
-	_, err := r.db.Exec("INSERT INTO users (name, email, role) VALUES (?, ?, ?)", payload.Name, payload.Email, payload.Role)
+func (r *userRepository) CreateUser(ctx context.Context, payload *CreateUserRequest, passwordHash string) error {
+	var hash sql.NullString
+	if passwordHash != "" {
+		hash = sql.NullString{String: passwordHash, Valid: true}
+	}
+
+	// Users added by an admin are trusted, so their email counts as verified
+	_, err := pkg.Conn(ctx, r.db).ExecContext(ctx, "INSERT INTO users (name, email, role, password_hash, email_verified_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)", payload.Name, payload.Email, payload.Role, hash)
+	if pkg.IsUniqueViolation(err) {
+		return pkg.NewConflictError("email is already in use")
+	}
 	return err
 }
 
 func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*pkg.User, error) {
 	var user pkg.User
-	err := r.db.QueryRowContext(ctx, "SELECT id, name, email, role, created_at FROM users WHERE email = ?", email).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt)
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT id, name, email, role, status, created_at, email_verified_at FROM users WHERE email = ?", email).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Status, &user.CreatedAt, &user.EmailVerifiedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, pkg.ErrNotFound
@@ -37,3 +51,133 @@ func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*pkg
 	}
 	return &user, nil
 }
+
+func (r *userRepository) GetUserByID(ctx context.Context, id int) (*pkg.User, error) {
+	var user pkg.User
+	err := pkg.Conn(ctx, r.db).QueryRowContext(ctx, "SELECT id, name, email, role, status, created_at, email_verified_at FROM users WHERE id = ?", id).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Status, &user.CreatedAt, &user.EmailVerifiedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, pkg.ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// userList applies list queries to the users table
+var userList = &pkg.ListSpec[pkg.User]{
+	Sorts: map[string]pkg.SortKey[pkg.User]{
+		"name":  {Column: "name", Value: func(u *pkg.User) interface{} { return u.Name }},
+		"email": {Column: "email", Value: func(u *pkg.User) interface{} { return u.Email }},
+		"id":    {Column: "id", Value: func(u *pkg.User) interface{} { return u.ID }},
+	},
+	DefaultSort: "id",
+	IDColumn:    "id",
+	ID:          func(u *pkg.User) int { return u.ID },
+	Role:        "role",
+}
+
+func (r *userRepository) ListUsers(ctx context.Context, filter *UserFilter) ([]pkg.User, *pkg.Pagination, error) {
+	var args []interface{}
+	where := []string{}
+
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	clause, args, err := userList.Build(&filter.ListQuery, where, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := "SELECT id, name, email, role, status, created_at, email_verified_at FROM users" + clause
+	rows, err := pkg.Conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	users := []pkg.User{}
+	for rows.Next() {
+		var user pkg.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Status, &user.CreatedAt, &user.EmailVerifiedAt); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	users, page := userList.Page(&filter.ListQuery, users)
+	return users, page, nil
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, id int, req *UpdateUserRequest) (*pkg.User, error) {
+	current, err := r.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply updates only to fields that are provided
+	name := current.Name
+	email := current.Email
+	role := current.Role
+
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Email != nil {
+		email = *req.Email
+	}
+	if req.Role != nil {
+		role = *req.Role
+	}
+
+	_, err = pkg.Conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET name = ?, email = ?, role = ? WHERE id = ?", name, email, role, id)
+	if err != nil {
+		if pkg.IsUniqueViolation(err) {
+			return nil, pkg.NewConflictError("email is already in use")
+		}
+		return nil, err
+	}
+
+	return r.GetUserByID(ctx, id)
+}
+
+// SetUserStatus activates or deactivates a user. Deactivating also revokes every
+// session of the user so issued tokens stop working immediately.
+func (r *userRepository) SetUserStatus(ctx context.Context, id int, status string) (*pkg.User, error) {
+	now := time.Now().UTC()
+	var deactivatedAt interface{}
+	if status == pkg.UserStatusInactive {
+		deactivatedAt = now
+	}
+
+	err := pkg.Transact(ctx, r.db, func(tx pkg.DBTX) error {
+		result, err := tx.ExecContext(ctx, "UPDATE users SET status = ?, deactivated_at = ? WHERE id = ?", status, deactivatedAt, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return pkg.ErrNotFound
+		}
+
+		if status == pkg.UserStatusInactive {
+			_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, id)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetUserByID(ctx, id)
+}
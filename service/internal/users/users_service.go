@@ -2,13 +2,19 @@ package users
 
 import (
 	"context"
+	"strings"
 
 	"github.com/afrianjunior/justpayd/internal/pkg"
 )
 
 type UserService interface {
-	CreateUser(payload *CreateUserRequest) error
+	CreateUser(ctx context.Context, payload *CreateUserRequest) error
 	GetUserByEmail(ctx context.Context, email string) (*pkg.User, error)
+	GetUserByID(ctx context.Context, id int) (*pkg.User, error)
+	ListUsers(ctx context.Context, filter *UserFilter) ([]pkg.User, *pkg.Pagination, error)
+	UpdateUser(ctx context.Context, id int, req *UpdateUserRequest) (*pkg.User, error)
+	DeactivateUser(ctx context.Context, actorID int, id int) (*pkg.User, error)
+	ActivateUser(ctx context.Context, id int) (*pkg.User, error)
 }
 
 type userService struct {
@@ -19,10 +25,80 @@ func NewUserService(userRepository UserRepository) UserService {
 	return &userService{userRepository: userRepository}
 }
 
-func (s *userService) CreateUser(payload *CreateUserRequest) error {
-	return s.userRepository.CreateUser(payload)
+func (s *userService) CreateUser(ctx context.Context, payload *CreateUserRequest) error {
+	if err := validateProfile(&payload.Name, &payload.Email, &payload.Role); err != nil {
+		return err
+	}
+
+	var passwordHash string
+	if payload.Password != "" {
+		hash, err := pkg.HashPassword(payload.Password)
+		if err != nil {
+			return err
+		}
+		passwordHash = hash
+	}
+
+	return s.userRepository.CreateUser(ctx, payload, passwordHash)
 }
 
 func (s *userService) GetUserByEmail(ctx context.Context, email string) (*pkg.User, error) {
 	return s.userRepository.GetUserByEmail(ctx, email)
 }
+
+func (s *userService) GetUserByID(ctx context.Context, id int) (*pkg.User, error) {
+	return s.userRepository.GetUserByID(ctx, id)
+}
+
+func (s *userService) ListUsers(ctx context.Context, filter *UserFilter) ([]pkg.User, *pkg.Pagination, error) {
+	var errs []pkg.FieldError
+	if filter.Role != "" && !strings.EqualFold(filter.Role, pkg.RoleAdmin) && !strings.EqualFold(filter.Role, pkg.RoleWorker) {
+		errs = append(errs, pkg.FieldError{Field: "role", Message: "must be one of: admin, worker"})
+	}
+	if filter.Status != "" && filter.Status != pkg.UserStatusActive && filter.Status != pkg.UserStatusInactive {
+		errs = append(errs, pkg.FieldError{Field: "status", Message: "must be one of: active, inactive"})
+	}
+	if len(errs) > 0 {
+		return nil, nil, pkg.NewFieldValidationError(errs)
+	}
+	return s.userRepository.ListUsers(ctx, filter)
+}
+
+func (s *userService) UpdateUser(ctx context.Context, id int, req *UpdateUserRequest) (*pkg.User, error) {
+	if err := validateProfile(req.Name, req.Email, req.Role); err != nil {
+		return nil, err
+	}
+	return s.userRepository.UpdateUser(ctx, id, req)
+}
+
+func (s *userService) DeactivateUser(ctx context.Context, actorID int, id int) (*pkg.User, error) {
+	if actorID == id {
+		return nil, pkg.NewValidationError("you cannot deactivate your own account")
+	}
+	return s.userRepository.SetUserStatus(ctx, id, pkg.UserStatusInactive)
+}
+
+func (s *userService) ActivateUser(ctx context.Context, id int) (*pkg.User, error) {
+	return s.userRepository.SetUserStatus(ctx, id, pkg.UserStatusActive)
+}
+
+// validateProfile checks the profile fields that are present and normalizes them in place
+func validateProfile(name *string, email *string, role *string) error {
+	if name != nil {
+		*name = strings.TrimSpace(*name)
+		if *name == "" {
+			return pkg.NewValidationError("name is required")
+		}
+	}
+	if email != nil {
+		normalized, err := pkg.NormalizeEmail(*email)
+		if err != nil {
+			return err
+		}
+		*email = normalized
+	}
+	if role != nil && *role != pkg.RoleAdmin && *role != pkg.RoleWorker {
+		return pkg.NewValidationError("role must be one of: admin, worker")
+	}
+	return nil
+}
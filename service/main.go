@@ -8,8 +8,10 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/afrianjunior/justpayd/cmd"
+	"github.com/afrianjunior/justpayd/internal/mailer"
 	"github.com/afrianjunior/justpayd/internal/pkg"
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
 	"go.uber.org/zap"
@@ -19,11 +21,17 @@ type App struct {
 	db     *sql.DB
 	logger *zap.SugaredLogger
 	config *pkg.Config
+	mailer mailer.Mailer
 }
 
 func loadConfigFromEnv() *pkg.Config {
 	config := &pkg.Config{}
 
+	config.Environment = os.Getenv("APP_ENV")
+	if config.Environment == "" {
+		config.Environment = pkg.EnvDevelopment
+	}
+
 	config.JWT.Secret = os.Getenv("JWT_SECRET")
 	expStr := os.Getenv("JWT_EXPIRATION")
 	if expStr != "" {
@@ -33,11 +41,45 @@ func loadConfigFromEnv() *pkg.Config {
 		}
 	}
 
+	refreshExpStr := os.Getenv("JWT_REFRESH_EXPIRATION")
+	if refreshExpStr != "" {
+		exp, err := strconv.Atoi(refreshExpStr)
+		if err == nil {
+			config.JWT.RefreshExpiration = exp
+		}
+	}
+
 	if config.JWT.Secret == "" {
-		config.JWT.Secret = "secret"
+		config.JWT.Secret = pkg.DefaultJWTSecret
+	}
+	config.JWT.Algorithm = os.Getenv("JWT_ALGORITHM")
+	if config.JWT.Algorithm == "" {
+		config.JWT.Algorithm = pkg.AlgorithmHS256
+	}
+	config.JWT.PrivateKeyFile = os.Getenv("JWT_PRIVATE_KEY_FILE")
+	config.JWT.KeyID = os.Getenv("JWT_KEY_ID")
+	// Comma separated public keys that are still trusted, e.g. while rotating keys. Each one is
+	// kid=path with the kid the key signed with, or just the path to use its thumbprint.
+	if files := os.Getenv("JWT_VERIFICATION_KEY_FILES"); files != "" {
+		for _, entry := range strings.Split(files, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			var key pkg.VerificationKey
+			if kid, file, ok := strings.Cut(entry, "="); ok {
+				key.KeyID, key.File = strings.TrimSpace(kid), strings.TrimSpace(file)
+			} else {
+				key.File = entry
+			}
+			config.JWT.VerificationKeys = append(config.JWT.VerificationKeys, key)
+		}
 	}
+	// Access tokens are short-lived, sessions are kept alive through refresh tokens
 	if config.JWT.Expiration == 0 {
-		config.JWT.Expiration = 3600
+		config.JWT.Expiration = 15
+	}
+	if config.JWT.RefreshExpiration == 0 {
+		config.JWT.RefreshExpiration = 60 * 24 * 30
 	}
 
 	config.StoragePath = os.Getenv("STORAGE_PATH")
@@ -54,6 +96,122 @@ func loadConfigFromEnv() *pkg.Config {
 		config.LogLevel = "info"
 	}
 
+	// Email-only login lets anyone knowing an email in, so it is only on when explicitly enabled
+	if allowStr := os.Getenv("AUTH_ALLOW_EMAIL_ONLY_LOGIN"); allowStr != "" {
+		allow, err := strconv.ParseBool(allowStr)
+		if err == nil {
+			config.Auth.AllowEmailOnlyLogin = allow
+		}
+	}
+
+	config.Auth.AllowRegistration = true
+	if allowStr := os.Getenv("AUTH_ALLOW_REGISTRATION"); allowStr != "" {
+		allow, err := strconv.ParseBool(allowStr)
+		if err == nil {
+			config.Auth.AllowRegistration = allow
+		}
+	}
+	if expStr := os.Getenv("AUTH_VERIFICATION_EXPIRATION"); expStr != "" {
+		exp, err := strconv.Atoi(expStr)
+		if err == nil {
+			config.Auth.VerificationExpiration = exp
+		}
+	}
+	if config.Auth.VerificationExpiration == 0 {
+		config.Auth.VerificationExpiration = 60 * 24
+	}
+
+	if expStr := os.Getenv("AUTH_INVITATION_EXPIRATION"); expStr != "" {
+		exp, err := strconv.Atoi(expStr)
+		if err == nil {
+			config.Auth.InvitationExpiration = exp
+		}
+	}
+	if config.Auth.InvitationExpiration == 0 {
+		config.Auth.InvitationExpiration = 60 * 24 * 7
+	}
+
+	config.BaseURL = os.Getenv("BASE_URL")
+	if config.BaseURL == "" {
+		config.BaseURL = "http://localhost:" + config.ServerPort
+	}
+
+	config.Mail.Driver = os.Getenv("MAIL_DRIVER")
+	if config.Mail.Driver == "" {
+		config.Mail.Driver = "log"
+	}
+	config.Mail.From = os.Getenv("MAIL_FROM")
+	if config.Mail.From == "" {
+		config.Mail.From = "no-reply@justpayd.local"
+	}
+	config.Mail.SMTPHost = os.Getenv("SMTP_HOST")
+	config.Mail.SMTPPort = os.Getenv("SMTP_PORT")
+	if config.Mail.SMTPPort == "" {
+		config.Mail.SMTPPort = "587"
+	}
+	config.Mail.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	config.Mail.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	config.Mail.OutputDir = os.Getenv("MAIL_OUTPUT_DIR")
+	if config.Mail.OutputDir == "" {
+		config.Mail.OutputDir = config.StoragePath + "/mail"
+	}
+
+	// Long enough for overnight and multi-day shifts out of the box
+	config.Shifts.MaxDurationHours = 72
+	if hoursStr := os.Getenv("SHIFT_MAX_DURATION_HOURS"); hoursStr != "" {
+		hours, err := strconv.Atoi(hoursStr)
+		if err == nil && hours > 0 {
+			config.Shifts.MaxDurationHours = min(hours, pkg.ShiftDurationLimitHours)
+		}
+	}
+	config.Shifts.MinRestHours = 8
+	if hoursStr := os.Getenv("SHIFT_MIN_REST_HOURS"); hoursStr != "" {
+		hours, err := strconv.Atoi(hoursStr)
+		if err == nil {
+			config.Shifts.MinRestHours = hours
+		}
+	}
+	// Swaps wait for an admin unless explicitly turned off
+	config.Shifts.SwapRequiresApproval = true
+	if approvalStr := os.Getenv("SHIFT_SWAP_REQUIRES_APPROVAL"); approvalStr != "" {
+		approval, err := strconv.ParseBool(approvalStr)
+		if err == nil {
+			config.Shifts.SwapRequiresApproval = approval
+		}
+	}
+	rolesStr := os.Getenv("SHIFT_ROLES")
+	if rolesStr == "" {
+		rolesStr = "cashier,washer,cook,cleaner,security,supervisor"
+	}
+	for _, role := range strings.Split(rolesStr, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			config.Shifts.Roles = append(config.Shifts.Roles, role)
+		}
+	}
+
+	config.OIDC.IssuerURL = os.Getenv("OIDC_ISSUER_URL")
+	config.OIDC.ClientID = os.Getenv("OIDC_CLIENT_ID")
+	config.OIDC.JWKSURL = os.Getenv("OIDC_JWKS_URL")
+	if provisionStr := os.Getenv("OIDC_AUTO_PROVISION"); provisionStr != "" {
+		provision, err := strconv.ParseBool(provisionStr)
+		if err == nil {
+			config.OIDC.AutoProvision = provision
+		}
+	}
+	if stubStr := os.Getenv("OIDC_STUB_ISSUER"); stubStr != "" {
+		stub, err := strconv.ParseBool(stubStr)
+		if err == nil {
+			config.OIDC.StubIssuer = stub
+		}
+	}
+	// The stub issuer is served by this application, so trust it unless another issuer is set
+	if config.OIDC.StubIssuer && config.OIDC.IssuerURL == "" {
+		config.OIDC.IssuerURL = strings.TrimRight(config.BaseURL, "/") + "/oidc-stub"
+	}
+	if config.OIDC.StubIssuer && config.OIDC.ClientID == "" {
+		config.OIDC.ClientID = "justpayd"
+	}
+
 	return config
 }
 
@@ -76,17 +234,27 @@ func NewApp(ctx context.Context, config *pkg.Config) (*App, error) {
 		return nil, err
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.JWT.Keys, err = pkg.LoadKeySet(config.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("error loading jwt keys: %v", err)
+	}
+
 	// Ensure data directory exists
 	if err := os.MkdirAll(config.StoragePath, 0755); err != nil {
 		fmt.Println(config.StoragePath)
 		return nil, fmt.Errorf("error creating data directory: %v", err)
 	}
 
-	// SQLite database file path
-	sqliteDBPath := fmt.Sprintf("%s/main.db", config.StoragePath)
+	// SQLite database file. Transactions take the write lock when they begin, so
+	// concurrent ones wait for each other instead of failing with "database is locked"
+	// when both try to write.
+	sqliteDSN := fmt.Sprintf("%s/main.db?_txlock=immediate", config.StoragePath)
 
 	// Initialize SQLite connection
-	db, err := sql.Open("sqlite3", sqliteDBPath)
+	db, err := sql.Open("sqlite3", sqliteDSN)
 	if err != nil {
 		return nil, fmt.Errorf("error opening sqlite database: %v", err)
 	}
@@ -96,10 +264,16 @@ func NewApp(ctx context.Context, config *pkg.Config) (*App, error) {
 		return nil, fmt.Errorf("error pinging sqlite database: %v", err)
 	}
 
+	mail, err := mailer.New(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("error creating mailer: %v", err)
+	}
+
 	return &App{
 		db:     db,
 		logger: logger,
 		config: config,
+		mailer: mail,
 	}, nil
 }
 
@@ -120,6 +294,7 @@ func main() {
 		app.db,
 		app.logger,
 		app.config,
+		app.mailer,
 	)
 
 	// Generate Swagger documentation first
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'inactive'));
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP;
+
+CREATE INDEX idx_users_status ON users(status);
+CREATE INDEX idx_users_role ON users(role);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_shifts_end_at;
+DROP INDEX IF EXISTS idx_shifts_start_at;
+
+ALTER TABLE shifts DROP COLUMN end_at;
+ALTER TABLE shifts DROP COLUMN start_at;
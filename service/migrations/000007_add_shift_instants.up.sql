@@ -0,0 +1,14 @@
+ALTER TABLE shifts ADD COLUMN start_at TIMESTAMP;
+ALTER TABLE shifts ADD COLUMN end_at TIMESTAMP;
+
+-- Existing wall clock times are taken as UTC. A shift whose end_time is not after its
+-- start_time ends on the next day.
+UPDATE shifts
+SET start_at = datetime(date || ' ' || start_time),
+    end_at = CASE
+        WHEN time(end_time) <= time(start_time) THEN datetime(date || ' ' || end_time, '+1 day')
+        ELSE datetime(date || ' ' || end_time)
+    END;
+
+CREATE INDEX idx_shifts_start_at ON shifts(start_at);
+CREATE INDEX idx_shifts_end_at ON shifts(end_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_shifts_location_id;
+
+ALTER TABLE shifts DROP COLUMN location_id;
+
+DROP TABLE IF EXISTS locations;
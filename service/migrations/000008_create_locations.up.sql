@@ -0,0 +1,19 @@
+CREATE TABLE locations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    time_zone TEXT NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE shifts ADD COLUMN location_id INTEGER REFERENCES locations(id);
+
+-- Free text locations of existing shifts become locations in UTC, the zone their
+-- start_at and end_at were migrated in. Set the real zone afterwards through the API.
+INSERT OR IGNORE INTO locations (name, time_zone)
+SELECT DISTINCT trim(location), 'UTC' FROM shifts
+WHERE location IS NOT NULL AND trim(location) <> '';
+
+UPDATE shifts SET location_id = (SELECT id FROM locations WHERE name = trim(shifts.location))
+WHERE location IS NOT NULL AND trim(location) <> '';
+
+CREATE INDEX idx_shifts_location_id ON shifts(location_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_shifts_template_occurrence;
+
+ALTER TABLE shifts DROP COLUMN occurrence_date;
+ALTER TABLE shifts DROP COLUMN template_id;
+
+DROP TABLE IF EXISTS shift_template_exceptions;
+DROP TABLE IF EXISTS shift_templates;
@@ -0,0 +1,35 @@
+CREATE TABLE shift_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL,
+    location_id INTEGER REFERENCES locations(id),
+    -- Wall clock times in the location's time zone. An end_time not after start_time ends the next day.
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    -- RRULE without DTSTART or UNTIL, e.g. FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+    rrule TEXT NOT NULL,
+    starts_on DATE NOT NULL,
+    until DATE,
+    -- Set on the template created by a "this and following" edit
+    parent_id INTEGER REFERENCES shift_templates(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE shift_template_exceptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    template_id INTEGER NOT NULL,
+    occurrence_date DATE NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('skip', 'modify')),
+    start_time TIME,
+    end_time TIME,
+    role TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (template_id, occurrence_date),
+    FOREIGN KEY (template_id) REFERENCES shift_templates(id)
+);
+
+ALTER TABLE shifts ADD COLUMN template_id INTEGER REFERENCES shift_templates(id);
+ALTER TABLE shifts ADD COLUMN occurrence_date DATE;
+
+-- An occurrence is materialized at most once
+CREATE UNIQUE INDEX idx_shifts_template_occurrence ON shifts(template_id, occurrence_date);
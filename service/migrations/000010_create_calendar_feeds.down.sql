@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_calendar_feeds_location_id;
+DROP INDEX IF EXISTS idx_calendar_feeds_user_id;
+DROP TABLE IF EXISTS calendar_feeds;
@@ -0,0 +1,16 @@
+-- A calendar feed shows either a user's assignments or a location's shifts. Only the hash
+-- of the secret token in the feed URL is stored.
+CREATE TABLE calendar_feeds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    location_id INTEGER,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (location_id IS NULL)),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (location_id) REFERENCES locations(id)
+);
+
+-- One feed per user and per location, regenerating replaces the token
+CREATE UNIQUE INDEX idx_calendar_feeds_user_id ON calendar_feeds(user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_calendar_feeds_location_id ON calendar_feeds(location_id) WHERE location_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_shift_requests_shift_id_status;
+
+ALTER TABLE shift_requests DROP COLUMN reason;
@@ -0,0 +1,4 @@
+-- Why a request was rejected, shown to the worker
+ALTER TABLE shift_requests ADD COLUMN reason TEXT;
+
+CREATE INDEX idx_shift_requests_shift_id_status ON shift_requests(shift_id, status);
@@ -0,0 +1,16 @@
+-- Assignments an admin forced through despite schedule conflicts
+CREATE TABLE assignment_overrides (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    shift_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    overridden_by INTEGER NOT NULL,
+    -- JSON array of the conflicts that were overridden
+    conflicts TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (overridden_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_assignment_overrides_shift_id ON assignment_overrides(shift_id);
+CREATE INDEX idx_assignment_overrides_user_id ON assignment_overrides(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS time_off;
+DROP TABLE IF EXISTS availability_windows;
@@ -0,0 +1,33 @@
+-- Weekly windows a worker can work in. weekday follows Go's time.Weekday, 0 is Sunday.
+-- Times are wall clock times in the zone of each shift's location; an end_time not after
+-- start_time ends the next day.
+CREATE TABLE availability_windows (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    weekday INTEGER NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_availability_windows_user_id ON availability_windows(user_id);
+
+-- Days off a worker asked for, both dates inclusive
+CREATE TABLE time_off (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reviewed_by INTEGER,
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_on >= starts_on),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_time_off_user_id_dates ON time_off(user_id, starts_on, ends_on);
+CREATE INDEX idx_time_off_status ON time_off(status);
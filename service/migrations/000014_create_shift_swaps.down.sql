@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS assignment_history;
+DROP TABLE IF EXISTS shift_swap_events;
+DROP TABLE IF EXISTS shift_swaps;
@@ -0,0 +1,66 @@
+-- Assigned shifts workers offer to hand to a colleague, outright or in exchange for one of theirs
+CREATE TABLE shift_swaps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    assignment_id INTEGER NOT NULL,
+    offered_by INTEGER NOT NULL,
+    -- offered_to limits the offer to one colleague, any eligible worker can take it when NULL
+    offered_to INTEGER,
+    taken_by INTEGER,
+    -- counter_assignment_id is the shift the taker gives in return, NULL for a give-away
+    counter_assignment_id INTEGER,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'proposed', 'accepted', 'completed', 'rejected', 'cancelled')),
+    note TEXT NOT NULL DEFAULT '',
+    reason TEXT,
+    reviewed_by INTEGER,
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (assignment_id) REFERENCES assignments(id),
+    FOREIGN KEY (offered_by) REFERENCES users(id),
+    FOREIGN KEY (offered_to) REFERENCES users(id),
+    FOREIGN KEY (taken_by) REFERENCES users(id),
+    FOREIGN KEY (counter_assignment_id) REFERENCES assignments(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id)
+);
+
+-- A shift can only be on offer once at a time
+CREATE UNIQUE INDEX idx_shift_swaps_active_assignment ON shift_swaps(assignment_id)
+    WHERE status IN ('open', 'proposed', 'accepted');
+CREATE INDEX idx_shift_swaps_offered_by ON shift_swaps(offered_by);
+CREATE INDEX idx_shift_swaps_taken_by ON shift_swaps(taken_by);
+CREATE INDEX idx_shift_swaps_status ON shift_swaps(status);
+
+-- What happened to a swap, step by step
+CREATE TABLE shift_swap_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    swap_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor_id INTEGER NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (swap_id) REFERENCES shift_swaps(id),
+    FOREIGN KEY (actor_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_shift_swap_events_swap_id ON shift_swap_events(swap_id);
+
+-- Every hand-over of an assignment from one worker to another
+CREATE TABLE assignment_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    assignment_id INTEGER NOT NULL,
+    shift_id INTEGER NOT NULL,
+    from_user_id INTEGER NOT NULL,
+    to_user_id INTEGER NOT NULL,
+    changed_by INTEGER NOT NULL,
+    -- swap_id is set when the hand-over came from a shift swap
+    swap_id INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (assignment_id) REFERENCES assignments(id),
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (from_user_id) REFERENCES users(id),
+    FOREIGN KEY (to_user_id) REFERENCES users(id),
+    FOREIGN KEY (changed_by) REFERENCES users(id),
+    FOREIGN KEY (swap_id) REFERENCES shift_swaps(id)
+);
+
+CREATE INDEX idx_assignment_history_assignment_id ON assignment_history(assignment_id);
@@ -0,0 +1,25 @@
+-- Ended assignments and cancelled shifts have no place in the older schema and are dropped
+CREATE TABLE assignments_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    shift_id INTEGER NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL,
+    assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+INSERT INTO assignments_old (id, shift_id, user_id, assigned_at)
+SELECT id, shift_id, user_id, assigned_at FROM assignments WHERE status = 'active';
+
+DROP TABLE assignments;
+ALTER TABLE assignments_old RENAME TO assignments;
+
+DELETE FROM shift_requests WHERE shift_id IN (SELECT id FROM shifts WHERE status = 'cancelled');
+DELETE FROM shifts WHERE status = 'cancelled';
+
+DROP INDEX IF EXISTS idx_shifts_status;
+
+ALTER TABLE shifts DROP COLUMN cancel_reason;
+ALTER TABLE shifts DROP COLUMN cancelled_by;
+ALTER TABLE shifts DROP COLUMN cancelled_at;
+ALTER TABLE shifts DROP COLUMN status;
@@ -0,0 +1,33 @@
+-- Cancelled shifts are kept so the workers who had them keep their history
+ALTER TABLE shifts ADD COLUMN status TEXT NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled'));
+ALTER TABLE shifts ADD COLUMN cancelled_at TIMESTAMP;
+ALTER TABLE shifts ADD COLUMN cancelled_by INTEGER REFERENCES users(id);
+ALTER TABLE shifts ADD COLUMN cancel_reason TEXT;
+
+CREATE INDEX idx_shifts_status ON shifts(status);
+
+-- Assignments are ended rather than deleted, when the worker is unassigned or the shift is
+-- cancelled. Only the active assignment of a shift is unique, so the table is rebuilt without
+-- the UNIQUE on shift_id. Foreign keys refer to it by name and stay valid.
+CREATE TABLE assignments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    shift_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'unassigned', 'cancelled')),
+    ended_at TIMESTAMP,
+    ended_by INTEGER,
+    end_reason TEXT,
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (ended_by) REFERENCES users(id)
+);
+
+INSERT INTO assignments_new (id, shift_id, user_id, assigned_at)
+SELECT id, shift_id, user_id, assigned_at FROM assignments;
+
+DROP TABLE assignments;
+ALTER TABLE assignments_new RENAME TO assignments;
+
+CREATE UNIQUE INDEX idx_assignments_active_shift ON assignments(shift_id) WHERE status = 'active';
+CREATE INDEX idx_assignments_user_id ON assignments(user_id);
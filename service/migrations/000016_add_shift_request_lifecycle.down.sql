@@ -0,0 +1,24 @@
+-- Withdrawn requests have no place in the older schema and are dropped, expired ones were
+-- never reviewed and become rejected
+CREATE TABLE shift_requests_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    shift_id INTEGER NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'rejected')),
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    approved_at TIMESTAMP,
+    reason TEXT,
+    UNIQUE(user_id, shift_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (shift_id) REFERENCES shifts(id)
+);
+
+INSERT INTO shift_requests_old (id, user_id, shift_id, status, requested_at, approved_at, reason)
+SELECT id, user_id, shift_id, CASE WHEN status = 'expired' THEN 'rejected' ELSE status END, requested_at, approved_at, reason
+FROM shift_requests
+WHERE status <> 'withdrawn';
+
+DROP TABLE shift_requests;
+ALTER TABLE shift_requests_old RENAME TO shift_requests;
+
+CREATE INDEX idx_shift_requests_shift_id_status ON shift_requests(shift_id, status);
@@ -0,0 +1,27 @@
+-- Workers can withdraw their requests and pending requests expire once the shift starts.
+-- The reviewer is kept with the reason. A withdrawn request doesn't stop the worker from
+-- asking again, so only the other requests are unique per worker and shift, and the table
+-- is rebuilt without the UNIQUE on user_id and shift_id.
+CREATE TABLE shift_requests_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    shift_id INTEGER NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'rejected', 'withdrawn', 'expired')),
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    approved_at TIMESTAMP,
+    reason TEXT,
+    reviewed_by INTEGER,
+    reviewed_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id)
+);
+
+INSERT INTO shift_requests_new (id, user_id, shift_id, status, requested_at, approved_at, reason)
+SELECT id, user_id, shift_id, status, requested_at, approved_at, reason FROM shift_requests;
+
+DROP TABLE shift_requests;
+ALTER TABLE shift_requests_new RENAME TO shift_requests;
+
+CREATE UNIQUE INDEX idx_shift_requests_user_shift ON shift_requests(user_id, shift_id) WHERE status <> 'withdrawn';
+CREATE INDEX idx_shift_requests_shift_id_status ON shift_requests(shift_id, status);
@@ -0,0 +1,30 @@
+-- Unassigned requests were approved once. Only the latest of the requests a worker made for a
+-- shift is kept, the older schema allows one besides the withdrawn ones.
+CREATE TABLE shift_requests_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    shift_id INTEGER NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'rejected', 'withdrawn', 'expired')),
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    approved_at TIMESTAMP,
+    reason TEXT,
+    reviewed_by INTEGER,
+    reviewed_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id)
+);
+
+INSERT INTO shift_requests_old (id, user_id, shift_id, status, requested_at, approved_at, reason, reviewed_by, reviewed_at)
+SELECT id, user_id, shift_id, CASE WHEN status = 'unassigned' THEN 'approved' ELSE status END,
+    requested_at, approved_at, reason, reviewed_by, reviewed_at
+FROM shift_requests
+WHERE status = 'withdrawn' OR id IN (
+    SELECT MAX(id) FROM shift_requests WHERE status <> 'withdrawn' GROUP BY user_id, shift_id
+);
+
+DROP TABLE shift_requests;
+ALTER TABLE shift_requests_old RENAME TO shift_requests;
+
+CREATE UNIQUE INDEX idx_shift_requests_user_shift ON shift_requests(user_id, shift_id) WHERE status <> 'withdrawn';
+CREATE INDEX idx_shift_requests_shift_id_status ON shift_requests(shift_id, status);
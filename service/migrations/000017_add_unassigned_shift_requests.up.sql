@@ -0,0 +1,37 @@
+-- The approved request of a worker taken off the shift becomes unassigned, and only pending
+-- requests are unique per worker and shift. Workers may ask again for a shift they were
+-- taken off, or lost to another worker, once it is open again. The CHECK on status changes,
+-- so the table is rebuilt.
+CREATE TABLE shift_requests_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    shift_id INTEGER NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'rejected', 'withdrawn', 'expired', 'unassigned')),
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    approved_at TIMESTAMP,
+    reason TEXT,
+    reviewed_by INTEGER,
+    reviewed_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id)
+);
+
+INSERT INTO shift_requests_new (id, user_id, shift_id, status, requested_at, approved_at, reason, reviewed_by, reviewed_at)
+SELECT id, user_id, shift_id, status, requested_at, approved_at, reason, reviewed_by, reviewed_at FROM shift_requests;
+
+DROP TABLE shift_requests;
+ALTER TABLE shift_requests_new RENAME TO shift_requests;
+
+-- Workers unassigned before requests kept track of it
+UPDATE shift_requests
+SET status = 'unassigned'
+WHERE status = 'approved'
+    AND shift_id IN (SELECT id FROM shifts WHERE status = 'scheduled')
+    AND NOT EXISTS (
+        SELECT 1 FROM assignments a
+        WHERE a.shift_id = shift_requests.shift_id AND a.user_id = shift_requests.user_id AND a.status = 'active'
+    );
+
+CREATE UNIQUE INDEX idx_shift_requests_user_shift ON shift_requests(user_id, shift_id) WHERE status = 'pending';
+CREATE INDEX idx_shift_requests_shift_id_status ON shift_requests(shift_id, status);
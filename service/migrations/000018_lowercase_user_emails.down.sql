@@ -0,0 +1,2 @@
+-- The original spelling of the emails isn't kept, lowercased emails stay as they are.
+SELECT 1;
@@ -0,0 +1,10 @@
+-- Logins look emails up in lower case, which locked out accounts stored with capitals
+-- before emails were normalized. Emails only differing in case from another account are
+-- left alone, as lowering them would break the UNIQUE on email.
+UPDATE users
+SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email))
+  AND NOT EXISTS (
+    SELECT 1 FROM users other
+    WHERE other.id <> users.id AND LOWER(TRIM(other.email)) = LOWER(TRIM(users.email))
+  );
@@ -0,0 +1,9 @@
+#!/bin/sh
+set -e
+
+# The database may come from the image or a mounted volume, bring it up to date before serving
+STORAGE_PATH="${STORAGE_PATH:-./data}"
+mkdir -p "$STORAGE_PATH"
+migrate -path ./migrations -database "sqlite3://$STORAGE_PATH/main.db" up
+
+exec "$@"